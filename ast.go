@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Sa2Knight/maron/ast"
+)
+
+// dumpAST ソースコードを解析してASTを表示する (maron ast [--json] file.mr)
+// 終了コードを戻す
+func dumpAST(args []string) int {
+	fs := flag.NewFlagSet("ast", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "ASTをJSONで出力する")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: maron ast [--json] file.mr")
+		return 2
+	}
+
+	program, err := parseFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if !*asJSON {
+		fmt.Println(program.String())
+		return 0
+	}
+
+	encoded, err := ast.EncodeJSON(program)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	var out bytes.Buffer
+	json.Indent(&out, encoded, "", "  ")
+	out.WriteString("\n")
+	out.WriteTo(os.Stdout)
+	return 0
+}
@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"strconv"
 	"strings"
 
 	"github.com/Sa2Knight/maron/token"
@@ -29,6 +30,13 @@ type Expression interface {
 	expressionNode()
 }
 
+// Pattern is interface for binding target (Identifier, ArrayPattern or HashPattern)
+// match式のパターンでは、IntegerLiteral, StringLiteral, Boolean も値との一致を調べるパターンになる
+type Pattern interface {
+	Node
+	patternNode()
+}
+
 /***********************
 * 構造体 Program
 ***********************/
@@ -36,6 +44,7 @@ type Expression interface {
 // Program is root node
 type Program struct {
 	Statements []Statement
+	Comments   []token.Token // ソースコード中のコメント(評価には使用しない)
 }
 
 // TokenLiteral is Program's method
@@ -62,8 +71,8 @@ func (p *Program) String() string {
 
 // LetStatement is structure for let statement
 type LetStatement struct {
-	Token token.Token // token.LET
-	Name  *Identifier // 代入対象の識別子
+	Token token.Token // token.LET or token.CONST
+	Name  Pattern     // 代入対象の識別子、または分割代入のパターン
 	Value Expression  // 代入する式
 }
 
@@ -85,6 +94,11 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// IsConst 再代入できない定数の定義(const文)か
+func (ls *LetStatement) IsConst() bool {
+	return ls.Token.Type == token.CONST
+}
+
 func (ls *LetStatement) statementNode() {}
 
 /***********************
@@ -256,6 +270,31 @@ func (i *Identifier) statementNode() {}
 
 func (i *Identifier) expressionNode() {}
 
+func (i *Identifier) patternNode() {}
+
+/***********************
+* 構造体 FloatLiteral
+***********************/
+
+// FloatLiteral 浮動小数点数リテラル
+type FloatLiteral struct {
+	Token token.Token // token.FLOAT
+	Value float64
+}
+
+// TokenLiteral is FloatLiteral's method
+func (f *FloatLiteral) TokenLiteral() string {
+	return f.Token.Literal
+}
+
+func (f *FloatLiteral) String() string {
+	return f.Token.Literal
+}
+
+func (f *FloatLiteral) statementNode() {}
+
+func (f *FloatLiteral) expressionNode() {}
+
 /***********************
 * 構造体 IntegerLiteral
 ***********************/
@@ -279,15 +318,19 @@ func (i *IntegerLiteral) statementNode() {}
 
 func (i *IntegerLiteral) expressionNode() {}
 
+func (i *IntegerLiteral) patternNode() {}
+
 /***********************
 * 構造体 FunctionLiteral
 ***********************/
 
 // FunctionLiteral is structure for Function literal
 type FunctionLiteral struct {
-	Token      token.Token     // 'fn' トークン
-	Parameters []*Identifier   // パラメータリスト
-	Body       *BlockStatement // 関数本体
+	Token      token.Token       // 'fn' トークン (短縮形の場合は '|')
+	Name       string            // let文で束縛される関数名(エラーメッセージ用。それ以外は空)
+	Parameters []*PatternElement // パラメータリスト(束縛先と既定値)
+	Rest       *Identifier       // 残りの引数を配列として受け取る引数(省略時はnil)
+	Body       *BlockStatement   // 関数本体
 }
 
 // TokenLiteral is FunctionLiteral's method
@@ -302,6 +345,16 @@ func (fl *FunctionLiteral) String() string {
 	for _, p := range fl.Parameters {
 		params = append(params, p.String())
 	}
+	if fl.Rest != nil {
+		params = append(params, "..."+fl.Rest.String())
+	}
+
+	// 短縮形 |x| x * 2
+	if fl.IsShorthand() {
+		out.WriteString("|" + strings.Join(params, ", ") + "| ")
+		out.WriteString(fl.Body.String())
+		return out.String()
+	}
 
 	out.WriteString(fl.TokenLiteral())
 	out.WriteString("(")
@@ -312,6 +365,10 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+// IsShorthand 短縮形 |x| x * 2 で書かれた関数か
+// 短縮形の関数の本体は、ひとつの式文だけを持つ
+func (fl *FunctionLiteral) IsShorthand() bool { return fl.Token.Type == token.PIPE }
+
 func (fl *FunctionLiteral) statementNode() {}
 
 func (fl *FunctionLiteral) expressionNode() {}
@@ -325,6 +382,7 @@ type CallExpression struct {
 	Token     token.Token  // '(' トークン
 	Function  Expression   // 関数を表す式
 	Arguments []Expression // 引数リストは式のリスト
+	EndToken  token.Token  // ')' トークン
 }
 
 // TokenLiteral is CallExpression's method
@@ -352,6 +410,43 @@ func (ce *CallExpression) statementNode() {}
 
 func (ce *CallExpression) expressionNode() {}
 
+/***********************
+* 構造体 SpreadElement
+***********************/
+
+// SpreadElement is structure for spread argument that like '...xs' in 'f(...xs)'
+type SpreadElement struct {
+	Token token.Token // '...' トークン
+	Value Expression  // 展開する配列
+}
+
+// TokenLiteral is SpreadElement's method
+func (se *SpreadElement) TokenLiteral() string { return se.Token.Literal }
+
+// String is SpreadElement's method
+func (se *SpreadElement) String() string { return "..." + se.Value.String() }
+
+func (se *SpreadElement) expressionNode() {}
+
+/***********************
+* 構造体 NamedArgument
+***********************/
+
+// NamedArgument is structure for named argument that like 'b: 3' in 'f(b: 3)'
+type NamedArgument struct {
+	Token token.Token // ':' トークン
+	Name  *Identifier // 引数名
+	Value Expression
+}
+
+// TokenLiteral is NamedArgument's method
+func (na *NamedArgument) TokenLiteral() string { return na.Token.Literal }
+
+// String is NamedArgument's method
+func (na *NamedArgument) String() string { return na.Name.String() + ": " + na.Value.String() }
+
+func (na *NamedArgument) expressionNode() {}
+
 /***********************
 * 構造体 Boolean
 ***********************/
@@ -375,6 +470,8 @@ func (b *Boolean) statementNode() {}
 
 func (b *Boolean) expressionNode() {}
 
+func (b *Boolean) patternNode() {}
+
 /***********************
 * 構造体 BlockStatement
 ***********************/
@@ -383,6 +480,7 @@ func (b *Boolean) expressionNode() {}
 type BlockStatement struct {
 	Token      token.Token // { トークン
 	Statements []Statement // ブロックは複数の文を含む
+	EndToken   token.Token // } トークン
 }
 
 // TokenLiteral is BlockStatement's method
@@ -402,3 +500,491 @@ func (b *BlockStatement) String() string {
 func (b *BlockStatement) statementNode() {}
 
 func (b *BlockStatement) expressionNode() {}
+
+/***********************
+* 構造体 WhileStatement
+***********************/
+
+// WhileStatement is structure for while statement
+type WhileStatement struct {
+	Token     token.Token     // 'while' トークン
+	Condition Expression      // 条件式
+	Body      *BlockStatement // 条件が真の間繰り返し実行されるブロック
+}
+
+// TokenLiteral is WhileStatement's method
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+
+// String is WhileStatement's method
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+func (ws *WhileStatement) statementNode() {}
+
+/***********************
+* 構造体 ForStatement
+***********************/
+
+// ForStatement is structure for for-in statement
+type ForStatement struct {
+	Token    token.Token     // 'for' トークン
+	Variable *Identifier     // 各要素を束縛する識別子
+	Iterable Expression      // 要素を取り出す式
+	Body     *BlockStatement // 要素ごとに実行されるブロック
+}
+
+// TokenLiteral is ForStatement's method
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+
+// String is ForStatement's method
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("for")
+	out.WriteString("(" + fs.Variable.String() + " in " + fs.Iterable.String() + ")")
+	out.WriteString(" ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+func (fs *ForStatement) statementNode() {}
+
+/***********************
+* 構造体 ImportStatement
+***********************/
+
+// ImportStatement is structure for import statement that like 'import "lib/util.mr" as util'
+type ImportStatement struct {
+	Token token.Token    // 'import' トークン
+	Path  *StringLiteral // 読み込むモジュールのパス
+	Name  *Identifier    // モジュールを束縛する識別子
+}
+
+// TokenLiteral is ImportStatement's method
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+
+// String is ImportStatement's method
+func (is *ImportStatement) String() string {
+	return is.TokenLiteral() + " " + is.Path.String() + " as " + is.Name.String() + ";"
+}
+
+func (is *ImportStatement) statementNode() {}
+
+/***********************
+* 構造体 ExportStatement
+***********************/
+
+// ExportStatement is structure for export statement that like 'export let x = 1'
+// let文(const文)で束縛した識別子を、モジュールの外から参照できるようにする
+type ExportStatement struct {
+	Token     token.Token   // 'export' トークン
+	Statement *LetStatement // 公開する定義
+}
+
+// TokenLiteral is ExportStatement's method
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+
+// String is ExportStatement's method
+func (es *ExportStatement) String() string { return es.TokenLiteral() + " " + es.Statement.String() }
+
+// Names 公開される識別子の一覧
+func (es *ExportStatement) Names() []*Identifier { return PatternNames(es.Statement.Name) }
+
+func (es *ExportStatement) statementNode() {}
+
+/***********************
+* 構造体 BreakStatement
+***********************/
+
+// BreakStatement is structure for break statement
+type BreakStatement struct {
+	Token token.Token // 'break' トークン
+}
+
+// TokenLiteral is BreakStatement's method
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+
+// String is BreakStatement's method
+func (bs *BreakStatement) String() string { return bs.TokenLiteral() + ";" }
+
+func (bs *BreakStatement) statementNode() {}
+
+/***********************
+* 構造体 ContinueStatement
+***********************/
+
+// ContinueStatement is structure for continue statement
+type ContinueStatement struct {
+	Token token.Token // 'continue' トークン
+}
+
+// TokenLiteral is ContinueStatement's method
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+
+// String is ContinueStatement's method
+func (cs *ContinueStatement) String() string { return cs.TokenLiteral() + ";" }
+
+func (cs *ContinueStatement) statementNode() {}
+
+/***********************
+* 構造体 IndexExpression
+***********************/
+
+// IndexExpression is structure for index expression that like 'a[i]'
+type IndexExpression struct {
+	Token token.Token // '[' トークン
+	Left  Expression  // 要素を取り出すオブジェクト
+	Index Expression  // 添字
+}
+
+// TokenLiteral is IndexExpression's method
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+
+// String is IndexExpression's method
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+
+	return out.String()
+}
+
+func (ie *IndexExpression) expressionNode() {}
+
+/***********************
+* 構造体 PropertyExpression
+***********************/
+
+// PropertyExpression is structure for property expression that like 'h.k'
+// 識別子名の文字列を添字とした IndexExpression と同じ意味を持つ
+type PropertyExpression struct {
+	Token    token.Token // '.' トークン
+	Left     Expression  // 要素を取り出すオブジェクト
+	Property *Identifier // プロパティ名
+}
+
+// TokenLiteral is PropertyExpression's method
+func (pe *PropertyExpression) TokenLiteral() string { return pe.Token.Literal }
+
+// String is PropertyExpression's method
+func (pe *PropertyExpression) String() string {
+	return "(" + pe.Left.String() + "." + pe.Property.String() + ")"
+}
+
+func (pe *PropertyExpression) expressionNode() {}
+
+/***********************
+* 構造体 AssignExpression
+***********************/
+
+// AssignExpression is structure for assignment that like 'x = 5' or 'a[i] += 1'
+type AssignExpression struct {
+	Token    token.Token // 代入演算子トークン = += -= *= /=
+	Operator string      // 代入演算子トークンの文字列
+	Target   Expression  // 代入先 (Identifier, IndexExpression or PropertyExpression)
+	Value    Expression  // 代入する式
+}
+
+// TokenLiteral is AssignExpression's method
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+
+// String is AssignExpression's method
+func (ae *AssignExpression) String() string {
+	return ae.Target.String() + " " + ae.Operator + " " + ae.Value.String()
+}
+
+func (ae *AssignExpression) expressionNode() {}
+
+/***********************
+* 構造体 PipeExpression
+***********************/
+
+// PipeExpression is structure for pipeline that like 'xs |> map(f)'
+// 左辺を右辺の関数の第1引数として渡す。右辺が呼び出し式でない場合は左辺だけを渡す
+type PipeExpression struct {
+	Token token.Token // |> トークン
+	Left  Expression  // 渡す値
+	Right Expression  // 呼び出す関数、または呼び出し式
+}
+
+// TokenLiteral is PipeExpression's method
+func (pe *PipeExpression) TokenLiteral() string { return pe.Token.Literal }
+
+// String is PipeExpression's method
+func (pe *PipeExpression) String() string {
+	return "(" + pe.Left.String() + " |> " + pe.Right.String() + ")"
+}
+
+// Call パイプラインと同じ意味の呼び出し式を戻す
+//
+//	x |> f(a, b) => f(x, a, b)
+//	x |> f       => f(x)
+func (pe *PipeExpression) Call() *CallExpression {
+	if call, ok := pe.Right.(*CallExpression); ok {
+		args := append([]Expression{pe.Left}, call.Arguments...)
+		return &CallExpression{Token: call.Token, Function: call.Function, Arguments: args}
+	}
+	return &CallExpression{Token: pe.Token, Function: pe.Right, Arguments: []Expression{pe.Left}}
+}
+
+func (pe *PipeExpression) statementNode() {}
+
+func (pe *PipeExpression) expressionNode() {}
+
+/***********************
+* 構造体 StringLiteral
+***********************/
+
+// StringLiteral is structure for string literal
+type StringLiteral struct {
+	Token token.Token // token.STRING
+	Value string      // エスケープシーケンスを展開した文字列
+}
+
+// TokenLiteral is StringLiteral's method
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+
+// String is StringLiteral's method
+func (sl *StringLiteral) String() string { return strconv.Quote(sl.Value) }
+
+func (sl *StringLiteral) expressionNode() {}
+
+func (sl *StringLiteral) patternNode() {}
+
+/***********************
+* 構造体 ArrayLiteral
+***********************/
+
+// ArrayLiteral is structure for array literal that like '[1, 2]'
+type ArrayLiteral struct {
+	Token    token.Token // '[' トークン
+	Elements []Expression
+	EndToken token.Token // ']' トークン
+}
+
+// TokenLiteral is ArrayLiteral's method
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+
+// String is ArrayLiteral's method
+func (al *ArrayLiteral) String() string {
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+func (al *ArrayLiteral) expressionNode() {}
+
+/***********************
+* 構造体 HashLiteral
+***********************/
+
+// HashLiteral is structure for hash literal that like '{"k": v}'
+type HashLiteral struct {
+	Token    token.Token // '{' トークン
+	Pairs    []*HashPair // 記述した順のキーと値の組
+	EndToken token.Token // '}' トークン
+}
+
+// TokenLiteral is HashLiteral's method
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+
+// String is HashLiteral's method
+func (hl *HashLiteral) String() string {
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+func (hl *HashLiteral) expressionNode() {}
+
+// HashPair is structure for key and value in hash literal
+type HashPair struct {
+	Token token.Token // ':' トークン
+	Key   Expression
+	Value Expression
+}
+
+// TokenLiteral is HashPair's method
+func (hp *HashPair) TokenLiteral() string { return hp.Token.Literal }
+
+// String is HashPair's method
+func (hp *HashPair) String() string { return hp.Key.String() + ": " + hp.Value.String() }
+
+/***********************
+* 構造体 ArrayPattern
+***********************/
+
+// ArrayPattern is structure for array destructuring that like '[a, b = 0, ...rest]'
+type ArrayPattern struct {
+	Token    token.Token       // '[' トークン
+	Elements []*PatternElement // 先頭から順に束縛する要素
+	Rest     *Identifier       // 残りの要素を配列として束縛する識別子(省略時はnil)
+}
+
+// TokenLiteral is ArrayPattern's method
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+
+// String is ArrayPattern's method
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+func (ap *ArrayPattern) patternNode() {}
+
+/***********************
+* 構造体 HashPattern
+***********************/
+
+// HashPattern is structure for hash destructuring that like '{name, age: a = 0}'
+type HashPattern struct {
+	Token    token.Token       // '{' トークン
+	Elements []*PatternElement // キーごとに束縛する要素
+}
+
+// TokenLiteral is HashPattern's method
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+
+// String is HashPattern's method
+func (hp *HashPattern) String() string {
+	elements := []string{}
+	for _, el := range hp.Elements {
+		elements = append(elements, el.String())
+	}
+	return "{" + strings.Join(elements, ", ") + "}"
+}
+
+func (hp *HashPattern) patternNode() {}
+
+// PatternElement is structure for an element of ArrayPattern, HashPattern or function parameters
+type PatternElement struct {
+	Token   token.Token // 要素の最初のトークン
+	Key     *Identifier // ハッシュのキー(ArrayPattern の要素と関数の引数ではnil)
+	Target  Pattern     // 値を束縛する先
+	Default Expression  // 値がない場合に使用する式(省略時はnil)
+}
+
+// TokenLiteral is PatternElement's method
+func (pe *PatternElement) TokenLiteral() string { return pe.Token.Literal }
+
+// String is PatternElement's method
+func (pe *PatternElement) String() string {
+	var out bytes.Buffer
+
+	// {name} は {name: name} の省略形
+	if ident, ok := pe.Target.(*Identifier); pe.Key != nil && (!ok || ident.Value != pe.Key.Value) {
+		out.WriteString(pe.Key.String() + ": ")
+	}
+	out.WriteString(pe.Target.String())
+	if pe.Default != nil {
+		out.WriteString(" = " + pe.Default.String())
+	}
+
+	return out.String()
+}
+
+// PatternNames パターンが束縛する識別子を出現順に戻す
+func PatternNames(pattern Pattern) []*Identifier {
+	switch pattern := pattern.(type) {
+	case *Identifier:
+		return []*Identifier{pattern}
+	case *ArrayPattern:
+		names := []*Identifier{}
+		for _, el := range pattern.Elements {
+			names = append(names, PatternNames(el.Target)...)
+		}
+		if pattern.Rest != nil {
+			names = append(names, pattern.Rest)
+		}
+		return names
+	case *HashPattern:
+		names := []*Identifier{}
+		for _, el := range pattern.Elements {
+			names = append(names, PatternNames(el.Target)...)
+		}
+		return names
+	}
+	return nil
+}
+
+/***********************
+* 構造体 MatchExpression
+***********************/
+
+// WILDCARD match式で任意の値に一致し、何も束縛しないパターン
+const WILDCARD = "_"
+
+// MatchExpression is structure for match expression that like 'match (x) { 0 => a, n if n > 0 => b, _ => c }'
+type MatchExpression struct {
+	Token    token.Token // 'match' トークン
+	Subject  Expression  // パターンと照合する値
+	Arms     []*MatchArm // 上から順に照合する腕
+	EndToken token.Token // '}' トークン
+}
+
+// TokenLiteral is MatchExpression's method
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+
+// String is MatchExpression's method
+func (me *MatchExpression) String() string {
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+	if len(arms) == 0 {
+		return "match (" + me.Subject.String() + ") {}"
+	}
+	return "match (" + me.Subject.String() + ") { " + strings.Join(arms, ", ") + " }"
+}
+
+func (me *MatchExpression) expressionNode() {}
+
+// MatchArm is structure for 'pattern if guard => body' in match expression
+type MatchArm struct {
+	Token   token.Token // '=>' トークン
+	Pattern Pattern
+	Guard   Expression // パターンに一致した後に調べる条件(省略時はnil)
+	Body    Expression
+}
+
+// TokenLiteral is MatchArm's method
+func (ma *MatchArm) TokenLiteral() string { return ma.Token.Literal }
+
+// String is MatchArm's method
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ma.Pattern.String())
+	if ma.Guard != nil {
+		out.WriteString(" if " + ma.Guard.String())
+	}
+	out.WriteString(" => " + ma.Body.String())
+
+	return out.String()
+}
+
+// IsIrrefutable 腕が任意の値に一致するか(ガードのない識別子のパターン)
+func (ma *MatchArm) IsIrrefutable() bool {
+	_, ok := ma.Pattern.(*Identifier)
+	return ok && ma.Guard == nil
+}
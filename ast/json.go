@@ -0,0 +1,193 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/Sa2Knight/maron/token"
+)
+
+// JSONで表現できるノードの一覧
+// ノードの種別名(kind)は構造体名をそのまま使用する
+var nodeTypes = map[string]reflect.Type{}
+
+func init() {
+	for _, node := range []Node{
+		&Program{},
+		&LetStatement{},
+		&ReturnStatement{},
+		&ExpressionStatement{},
+		&BlockStatement{},
+		&PrefixExpression{},
+		&InfixExpression{},
+		&IfExpression{},
+		&Identifier{},
+		&IntegerLiteral{},
+		&FloatLiteral{},
+		&Boolean{},
+		&FunctionLiteral{},
+		&CallExpression{},
+		&WhileStatement{},
+		&ForStatement{},
+		&BreakStatement{},
+		&ImportStatement{},
+		&ExportStatement{},
+		&ContinueStatement{},
+		&IndexExpression{},
+		&PropertyExpression{},
+		&AssignExpression{},
+		&PipeExpression{},
+		&StringLiteral{},
+		&ArrayLiteral{},
+		&HashLiteral{},
+		&HashPair{},
+		&ArrayPattern{},
+		&HashPattern{},
+		&PatternElement{},
+		&MatchExpression{},
+		&MatchArm{},
+		&SpreadElement{},
+		&NamedArgument{},
+	} {
+		t := reflect.TypeOf(node).Elem()
+		nodeTypes[t.Name()] = t
+	}
+}
+
+var (
+	nodeType  = reflect.TypeOf((*Node)(nil)).Elem()
+	tokenType = reflect.TypeOf(token.Token{})
+)
+
+// EncodeJSON ノードをJSONに変換する
+// 各ノードは {"kind": 種別名, 各フィールド...} のオブジェクトになり、フィールド名は先頭を小文字にしたものを使う
+func EncodeJSON(node Node) ([]byte, error) {
+	return json.Marshal(encodeNode(reflect.ValueOf(node)))
+}
+
+// DecodeJSON EncodeJSON で変換したJSONからノードを復元する
+func DecodeJSON(data []byte) (Node, error) {
+	v, err := decodeNode(json.RawMessage(data), nodeType)
+	if err != nil {
+		return nil, err
+	}
+	if !v.IsValid() || v.IsNil() {
+		return nil, nil
+	}
+	return v.Interface().(Node), nil
+}
+
+func encodeNode(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.IsNil() {
+		return nil
+	}
+
+	elem := v.Elem()
+	obj := map[string]interface{}{"kind": elem.Type().Name()}
+	for i := 0; i < elem.NumField(); i++ {
+		field := elem.Type().Field(i)
+		obj[fieldName(field.Name)] = encodeValue(elem.Field(i))
+	}
+	return obj
+}
+
+func encodeValue(v reflect.Value) interface{} {
+	switch {
+	case v.Type() == tokenType:
+		return v.Interface()
+	case v.Type().Implements(nodeType):
+		return encodeNode(v)
+	case v.Kind() == reflect.Slice:
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = encodeValue(v.Index(i))
+		}
+		return list
+	default:
+		return v.Interface()
+	}
+}
+
+// decodeNode JSONからノードを復元する
+// 復元したノードが expected に代入できない場合はエラー
+func decodeNode(data json.RawMessage, expected reflect.Type) (reflect.Value, error) {
+	if string(data) == "null" {
+		return reflect.Zero(expected), nil
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return reflect.Value{}, err
+	}
+
+	var kind string
+	if err := json.Unmarshal(obj["kind"], &kind); err != nil {
+		return reflect.Value{}, fmt.Errorf("node has no kind: %s", data)
+	}
+	t, ok := nodeTypes[kind]
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("unknown node kind: %s", kind)
+	}
+
+	node := reflect.New(t)
+	if !node.Type().AssignableTo(expected) {
+		return reflect.Value{}, fmt.Errorf("%s is not %s", kind, expected)
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		raw, ok := obj[fieldName(field.Name)]
+		if !ok {
+			continue
+		}
+		if err := decodeValue(raw, node.Elem().Field(i)); err != nil {
+			return reflect.Value{}, fmt.Errorf("%s.%s: %s", kind, field.Name, err)
+		}
+	}
+	return node, nil
+}
+
+func decodeValue(data json.RawMessage, dst reflect.Value) error {
+	switch {
+	case dst.Type() == tokenType:
+		return json.Unmarshal(data, dst.Addr().Interface())
+
+	case dst.Type().Implements(nodeType):
+		node, err := decodeNode(data, dst.Type())
+		if err != nil {
+			return err
+		}
+		dst.Set(node)
+		return nil
+
+	case dst.Kind() == reflect.Slice:
+		var list []json.RawMessage
+		if err := json.Unmarshal(data, &list); err != nil {
+			return err
+		}
+		if list == nil {
+			return nil
+		}
+		slice := reflect.MakeSlice(dst.Type(), len(list), len(list))
+		for i, raw := range list {
+			if err := decodeValue(raw, slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(slice)
+		return nil
+
+	default:
+		return json.Unmarshal(data, dst.Addr().Interface())
+	}
+}
+
+// fieldName 構造体のフィールド名をJSONのキーに変換する (ReturnValue -> returnValue)
+func fieldName(name string) string {
+	return strings.ToLower(name[:1]) + name[1:]
+}
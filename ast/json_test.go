@@ -0,0 +1,117 @@
+package ast_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/Sa2Knight/maron/ast"
+	"github.com/Sa2Knight/maron/lexer"
+	"github.com/Sa2Knight/maron/parser"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	input := `
+// コメントも保持される
+import "lib/math.mr" as math;
+export const pi = math.pi * 1.0;
+let add = fn(x, y) { return x + y; };
+let result = if (!(add(1, -2) < 10)) { true } else { false };
+result == false;
+let [first, {name: n = "none"}, ...rest] = [1, {"name": "maron"}, 3];
+let f = fn(a, b = 2, ...more) { a }; f(...rest, b: 3);
+rest |> f(|x, y = 1| x + y);
+match (first) { 0 => "zero", [x, ...xs] if x > 0 => x, {name} => name, _ => -1 };
+`
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has errors: %v", p.Errors())
+	}
+
+	encoded, err := ast.EncodeJSON(program)
+	if err != nil {
+		t.Fatalf("EncodeJSON returned error: %s", err)
+	}
+
+	decoded, err := ast.DecodeJSON(encoded)
+	if err != nil {
+		t.Fatalf("DecodeJSON returned error: %s", err)
+	}
+	decodedProgram, ok := decoded.(*ast.Program)
+	if !ok {
+		t.Fatalf("decoded node is not *ast.Program. got=%T", decoded)
+	}
+	if decodedProgram.String() != program.String() {
+		t.Errorf("decoded program wrong.\nwant=%q\ngot =%q", program.String(), decodedProgram.String())
+	}
+
+	reencoded, err := ast.EncodeJSON(decodedProgram)
+	if err != nil {
+		t.Fatalf("EncodeJSON returned error: %s", err)
+	}
+	if !bytes.Equal(encoded, reencoded) {
+		t.Errorf("re-encoded JSON differs.\nfirst =%s\nsecond=%s", encoded, reencoded)
+	}
+}
+
+func TestEncodeJSON(t *testing.T) {
+	p := parser.New(lexer.New("let x = 5;"))
+	encoded, err := ast.EncodeJSON(p.ParseProgram())
+	if err != nil {
+		t.Fatalf("EncodeJSON returned error: %s", err)
+	}
+
+	var program struct {
+		Kind       string
+		Statements []struct {
+			Kind  string
+			Token struct {
+				Type    string
+				Literal string
+				Line    int
+				Column  int
+			}
+			Name struct {
+				Kind  string
+				Value string
+			}
+			Value struct {
+				Kind  string
+				Value int64
+			}
+		}
+	}
+	if err := json.Unmarshal(encoded, &program); err != nil {
+		t.Fatalf("invalid JSON: %s", err)
+	}
+
+	if program.Kind != "Program" || len(program.Statements) != 1 {
+		t.Fatalf("program wrong. got=%s", encoded)
+	}
+	stmt := program.Statements[0]
+	if stmt.Kind != "LetStatement" || stmt.Token.Literal != "let" || stmt.Token.Line != 1 || stmt.Token.Column != 1 {
+		t.Errorf("let statement wrong. got=%+v", stmt)
+	}
+	if stmt.Name.Kind != "Identifier" || stmt.Name.Value != "x" {
+		t.Errorf("name wrong. got=%+v", stmt.Name)
+	}
+	if stmt.Value.Kind != "IntegerLiteral" || stmt.Value.Value != 5 {
+		t.Errorf("value wrong. got=%+v", stmt.Value)
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	tests := []string{
+		`{"kind": "Unknown"}`,
+		`{"statements": []}`,
+		`{"kind": "LetStatement", "name": {"kind": "CallExpression"}}`,
+		`[1, 2]`,
+	}
+
+	for _, input := range tests {
+		if _, err := ast.DecodeJSON([]byte(input)); err == nil {
+			t.Errorf("DecodeJSON(%s) must return error", input)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Visitor Walk で巡回する際に各ノードで呼び出される
+// Visit が戻す Visitor が nil でなければ、そのノードの子をその Visitor で巡回し、最後に w.Visit(nil) を呼び出す
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk node を根とする部分木を深さ優先で巡回する
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+
+	case *LetStatement:
+		walkIfNotNil(v, n.Name)
+		walkIfNotNil(v, n.Value)
+
+	case *ReturnStatement:
+		walkIfNotNil(v, n.ReturnValue)
+
+	case *ExpressionStatement:
+		walkIfNotNil(v, n.Expression)
+
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+
+	case *PrefixExpression:
+		walkIfNotNil(v, n.Right)
+
+	case *InfixExpression:
+		walkIfNotNil(v, n.Left)
+		walkIfNotNil(v, n.Right)
+
+	case *IfExpression:
+		walkIfNotNil(v, n.Condition)
+		walkIfNotNil(v, n.Consequence)
+		walkIfNotNil(v, n.Alternative)
+
+	case *FunctionLiteral:
+		for _, param := range n.Parameters {
+			walkIfNotNil(v, param)
+		}
+		walkIfNotNil(v, n.Rest)
+		walkIfNotNil(v, n.Body)
+
+	case *CallExpression:
+		walkIfNotNil(v, n.Function)
+		for _, arg := range n.Arguments {
+			walkIfNotNil(v, arg)
+		}
+
+	case *WhileStatement:
+		walkIfNotNil(v, n.Condition)
+		walkIfNotNil(v, n.Body)
+
+	case *ForStatement:
+		walkIfNotNil(v, n.Variable)
+		walkIfNotNil(v, n.Iterable)
+		walkIfNotNil(v, n.Body)
+
+	case *ImportStatement:
+		walkIfNotNil(v, n.Path)
+		walkIfNotNil(v, n.Name)
+
+	case *ExportStatement:
+		walkIfNotNil(v, n.Statement)
+
+	case *IndexExpression:
+		walkIfNotNil(v, n.Left)
+		walkIfNotNil(v, n.Index)
+
+	case *PropertyExpression:
+		walkIfNotNil(v, n.Left)
+		walkIfNotNil(v, n.Property)
+
+	case *AssignExpression:
+		walkIfNotNil(v, n.Target)
+		walkIfNotNil(v, n.Value)
+
+	case *PipeExpression:
+		walkIfNotNil(v, n.Left)
+		walkIfNotNil(v, n.Right)
+
+	case *ArrayLiteral:
+		for _, el := range n.Elements {
+			walkIfNotNil(v, el)
+		}
+
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			walkIfNotNil(v, pair)
+		}
+
+	case *HashPair:
+		walkIfNotNil(v, n.Key)
+		walkIfNotNil(v, n.Value)
+
+	case *ArrayPattern:
+		for _, el := range n.Elements {
+			walkIfNotNil(v, el)
+		}
+		walkIfNotNil(v, n.Rest)
+
+	case *HashPattern:
+		for _, el := range n.Elements {
+			walkIfNotNil(v, el)
+		}
+
+	case *PatternElement:
+		walkIfNotNil(v, n.Key)
+		walkIfNotNil(v, n.Target)
+		walkIfNotNil(v, n.Default)
+
+	case *SpreadElement:
+		walkIfNotNil(v, n.Value)
+
+	case *NamedArgument:
+		walkIfNotNil(v, n.Name)
+		walkIfNotNil(v, n.Value)
+
+	case *MatchExpression:
+		walkIfNotNil(v, n.Subject)
+		for _, arm := range n.Arms {
+			walkIfNotNil(v, arm)
+		}
+
+	case *MatchArm:
+		walkIfNotNil(v, n.Pattern)
+		walkIfNotNil(v, n.Guard)
+		walkIfNotNil(v, n.Body)
+
+	// 子を持たないノード
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *Boolean, *StringLiteral, *BreakStatement, *ContinueStatement:
+	}
+
+	v.Visit(nil)
+}
+
+func walkStatements(v Visitor, stmts []Statement) {
+	for _, stmt := range stmts {
+		walkIfNotNil(v, stmt)
+	}
+}
+
+// walkIfNotNil 型付きのnilポインタを含め、nilのノードは巡回しない
+func walkIfNotNil(v Visitor, node Node) {
+	if node == nil || isNilNode(node) {
+		return
+	}
+	Walk(v, node)
+}
+
+func isNilNode(node Node) bool {
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect node を根とする部分木を深さ優先で巡回し、各ノードで f(node) を呼び出す
+// f が false を戻した場合、そのノードの子は巡回しない。子の巡回後には f(nil) が呼び出される
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// ModifierFunc Modify で各ノードを置き換える関数
+type ModifierFunc func(Node) Node
+
+// Modify node を根とする部分木を帰りがけ順に巡回し、各ノードを modifier の戻り値で置き換える
+// 子を置き換えた親はその場で書き換えられ、最後に node 自身を置き換えた結果を戻す
+func Modify(node Node, modifier ModifierFunc) Node {
+	if node == nil || isNilNode(node) {
+		return node
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for i, stmt := range n.Statements {
+			n.Statements[i] = modifyChild(stmt, modifier)
+		}
+
+	case *LetStatement:
+		n.Name = modifyChild(n.Name, modifier)
+		n.Value = modifyChild(n.Value, modifier)
+
+	case *ReturnStatement:
+		n.ReturnValue = modifyChild(n.ReturnValue, modifier)
+
+	case *ExpressionStatement:
+		n.Expression = modifyChild(n.Expression, modifier)
+
+	case *BlockStatement:
+		for i, stmt := range n.Statements {
+			n.Statements[i] = modifyChild(stmt, modifier)
+		}
+
+	case *PrefixExpression:
+		n.Right = modifyChild(n.Right, modifier)
+
+	case *InfixExpression:
+		n.Left = modifyChild(n.Left, modifier)
+		n.Right = modifyChild(n.Right, modifier)
+
+	case *IfExpression:
+		n.Condition = modifyChild(n.Condition, modifier)
+		n.Consequence = modifyChild(n.Consequence, modifier)
+		n.Alternative = modifyChild(n.Alternative, modifier)
+
+	case *FunctionLiteral:
+		for i, param := range n.Parameters {
+			n.Parameters[i] = modifyChild(param, modifier)
+		}
+		n.Rest = modifyChild(n.Rest, modifier)
+		n.Body = modifyChild(n.Body, modifier)
+
+	case *CallExpression:
+		n.Function = modifyChild(n.Function, modifier)
+		for i, arg := range n.Arguments {
+			n.Arguments[i] = modifyChild(arg, modifier)
+		}
+
+	case *WhileStatement:
+		n.Condition = modifyChild(n.Condition, modifier)
+		n.Body = modifyChild(n.Body, modifier)
+
+	case *ForStatement:
+		n.Variable = modifyChild(n.Variable, modifier)
+		n.Iterable = modifyChild(n.Iterable, modifier)
+		n.Body = modifyChild(n.Body, modifier)
+
+	case *ImportStatement:
+		n.Path = modifyChild(n.Path, modifier)
+		n.Name = modifyChild(n.Name, modifier)
+
+	case *ExportStatement:
+		n.Statement = modifyChild(n.Statement, modifier)
+
+	case *IndexExpression:
+		n.Left = modifyChild(n.Left, modifier)
+		n.Index = modifyChild(n.Index, modifier)
+
+	case *PropertyExpression:
+		n.Left = modifyChild(n.Left, modifier)
+		n.Property = modifyChild(n.Property, modifier)
+
+	case *AssignExpression:
+		n.Target = modifyChild(n.Target, modifier)
+		n.Value = modifyChild(n.Value, modifier)
+
+	case *PipeExpression:
+		n.Left = modifyChild(n.Left, modifier)
+		n.Right = modifyChild(n.Right, modifier)
+
+	case *ArrayLiteral:
+		for i, el := range n.Elements {
+			n.Elements[i] = modifyChild(el, modifier)
+		}
+
+	case *HashLiteral:
+		for i, pair := range n.Pairs {
+			n.Pairs[i] = modifyChild(pair, modifier)
+		}
+
+	case *HashPair:
+		n.Key = modifyChild(n.Key, modifier)
+		n.Value = modifyChild(n.Value, modifier)
+
+	case *ArrayPattern:
+		for i, el := range n.Elements {
+			n.Elements[i] = modifyChild(el, modifier)
+		}
+		n.Rest = modifyChild(n.Rest, modifier)
+
+	case *HashPattern:
+		for i, el := range n.Elements {
+			n.Elements[i] = modifyChild(el, modifier)
+		}
+
+	case *PatternElement:
+		n.Key = modifyChild(n.Key, modifier)
+		n.Target = modifyChild(n.Target, modifier)
+		n.Default = modifyChild(n.Default, modifier)
+
+	case *SpreadElement:
+		n.Value = modifyChild(n.Value, modifier)
+
+	case *NamedArgument:
+		n.Name = modifyChild(n.Name, modifier)
+		n.Value = modifyChild(n.Value, modifier)
+
+	case *MatchExpression:
+		n.Subject = modifyChild(n.Subject, modifier)
+		for i, arm := range n.Arms {
+			n.Arms[i] = modifyChild(arm, modifier)
+		}
+
+	case *MatchArm:
+		n.Pattern = modifyChild(n.Pattern, modifier)
+		n.Guard = modifyChild(n.Guard, modifier)
+		n.Body = modifyChild(n.Body, modifier)
+	}
+
+	return modifier(node)
+}
+
+// modifyChild 子ノードを Modify で置き換える
+// modifier が子の位置に置けない種類のノードを戻した場合は panic する
+func modifyChild[T Node](child T, modifier ModifierFunc) T {
+	result := Modify(child, modifier)
+	if result == nil {
+		var zero T
+		return zero
+	}
+	typed, ok := result.(T)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: modifier returned %T where %s is required", result, reflect.TypeOf((*T)(nil)).Elem()))
+	}
+	return typed
+}
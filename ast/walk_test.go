@@ -0,0 +1,174 @@
+package ast_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Sa2Knight/maron/ast"
+	"github.com/Sa2Knight/maron/lexer"
+	"github.com/Sa2Knight/maron/parser"
+)
+
+// 全種類のノードを含むプログラム
+const allNodes = `
+let one = 1;
+let f = fn(x, y) { return -x + y; };
+if (f(one, true) < 1) { one } else { !false };
+`
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has errors: %v", p.Errors())
+	}
+	return program
+}
+
+func TestInspect(t *testing.T) {
+	program := parse(t, allNodes)
+
+	kinds := map[string]int{}
+	depth, maxDepth := 0, 0
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node == nil {
+			depth--
+			return false
+		}
+		depth++
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		kinds[fmt.Sprintf("%T", node)]++
+		return true
+	})
+
+	expected := map[string]int{
+		"*ast.Program":             1,
+		"*ast.LetStatement":        2,
+		"*ast.ReturnStatement":     1,
+		"*ast.ExpressionStatement": 3,
+		"*ast.BlockStatement":      3,
+		"*ast.PrefixExpression":    2,
+		"*ast.InfixExpression":     2,
+		"*ast.IfExpression":        1,
+		"*ast.Identifier":          9,
+		"*ast.IntegerLiteral":      2,
+		"*ast.Boolean":             2,
+		"*ast.FunctionLiteral":     1,
+		"*ast.CallExpression":      1,
+	}
+	for kind, count := range expected {
+		if kinds[kind] != count {
+			t.Errorf("%s visited %d times, want %d", kind, kinds[kind], count)
+		}
+	}
+	if depth != 0 {
+		t.Errorf("Visit(nil) must be called once per visited node. depth=%d", depth)
+	}
+	if maxDepth != 8 {
+		t.Errorf("maxDepth wrong. got=%d", maxDepth)
+	}
+}
+
+func TestInspectSkipChildren(t *testing.T) {
+	program := parse(t, allNodes)
+
+	identifiers := 0
+	ast.Inspect(program, func(node ast.Node) bool {
+		if _, ok := node.(*ast.Identifier); ok {
+			identifiers++
+		}
+		// 関数の中は巡回しない
+		_, isFunction := node.(*ast.FunctionLiteral)
+		return !isFunction
+	})
+
+	if identifiers != 5 {
+		t.Errorf("identifiers outside functions wrong. got=%d", identifiers)
+	}
+}
+
+func TestModify(t *testing.T) {
+	program := parse(t, allNodes)
+
+	// 1 を 2 に、true を false に置き換える
+	modified := ast.Modify(program, func(node ast.Node) ast.Node {
+		switch node := node.(type) {
+		case *ast.IntegerLiteral:
+			if node.Value == 1 {
+				return &ast.IntegerLiteral{Token: node.Token, Value: 2}
+			}
+		case *ast.Boolean:
+			return &ast.Boolean{Token: node.Token, Value: !node.Value}
+		case *ast.Identifier:
+			return &ast.Identifier{Token: node.Token, Value: node.Value + "_"}
+		}
+		return node
+	})
+
+	expected := parse(t, `
+let one_ = 2;
+let f_ = fn(x_, y_) { return -x_ + y_; };
+if (f_(one_, false) < 2) { one_ } else { !true };
+`)
+
+	var got, want []string
+	ast.Inspect(modified, func(node ast.Node) bool {
+		if node != nil {
+			got = append(got, describe(node))
+		}
+		return true
+	})
+	ast.Inspect(expected, func(node ast.Node) bool {
+		if node != nil {
+			want = append(want, describe(node))
+		}
+		return true
+	})
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("modified program wrong.\nwant=%v\ngot =%v", want, got)
+	}
+}
+
+func TestModifyReplacesRoot(t *testing.T) {
+	node := ast.Modify(&ast.IntegerLiteral{Value: 1}, func(node ast.Node) ast.Node {
+		return &ast.Boolean{Value: true}
+	})
+
+	if b, ok := node.(*ast.Boolean); !ok || !b.Value {
+		t.Errorf("root must be replaced. got=%T", node)
+	}
+}
+
+func TestModifyPanicsOnWrongKind(t *testing.T) {
+	program := parse(t, `1 + 2`)
+
+	defer func() {
+		expected := "ast.Modify: modifier returned *ast.ReturnStatement where ast.Expression is required"
+		if r := recover(); r != expected {
+			t.Errorf("wrong panic. want=%q, got=%v", expected, r)
+		}
+	}()
+
+	// 式の位置に文を戻す
+	ast.Modify(program, func(node ast.Node) ast.Node {
+		if lit, ok := node.(*ast.IntegerLiteral); ok && lit.Value == 1 {
+			return &ast.ReturnStatement{ReturnValue: lit}
+		}
+		return node
+	})
+}
+
+func describe(node ast.Node) string {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		return "ident:" + node.Value
+	case *ast.IntegerLiteral:
+		return fmt.Sprintf("int:%d", node.Value)
+	case *ast.Boolean:
+		return fmt.Sprintf("bool:%t", node.Value)
+	}
+	return fmt.Sprintf("%T", node)
+}
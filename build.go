@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Sa2Knight/maron/compiler"
+	"github.com/Sa2Knight/maron/module"
+	"github.com/Sa2Knight/maron/optimizer"
+)
+
+// MODULE_EXT コンパイル済みモジュールの拡張子
+const MODULE_EXT = ".mrc"
+
+// buildFile ソースコードをコンパイルし、コンパイル済みモジュールとして保存する (maron build [-o out.mrc] [--optimize] [--path dirs] file.mr)
+// import文のモジュールは、コンパイル済みモジュールに含める
+// 終了コードを戻す
+func buildFile(args []string) int {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	output := fs.String("o", "", "出力先のファイル名。省略した場合は拡張子を .mrc に変えたもの")
+	optimize := fs.Bool("optimize", false, "コンパイル前にプログラムを最適化する")
+	path := fs.String("path", "", "モジュールを探すディレクトリ(: 区切り)。省略時は環境変数 "+MODULE_PATH_ENV)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: maron build [-o out.mrc] [--optimize] [--path dirs] file.mr")
+		return 2
+	}
+	filename := fs.Arg(0)
+
+	bytecode, err := compileFile(filename, *optimize, modulePath(*path))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	data, err := bytecode.MarshalBinary()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *output == "" {
+		*output = strings.TrimSuffix(filename, filepath.Ext(filename)) + MODULE_EXT
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// disassembleFile バイトコードを人が読める形式で表示する (maron disasm file.mr|file.mrc)
+// 終了コードを戻す
+func disassembleFile(args []string) int {
+	fs := flag.NewFlagSet("disasm", flag.ExitOnError)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: maron disasm file.mr|file.mrc")
+		return 2
+	}
+
+	bytecode, err := loadBytecode(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// ソースコードが読めれば各行の内容を注記する
+	source, _ := os.ReadFile(bytecode.Source)
+	compiler.Disassemble(os.Stdout, bytecode, string(source))
+	return 0
+}
+
+// compileFile ソースコードのファイルをバイトコードにコンパイルする
+// optimize がtrueの場合、コンパイル前にプログラムを最適化する
+// import文のモジュールは、ファイルのディレクトリと searchPaths から探す
+func compileFile(filename string, optimize bool, searchPaths []string) (*compiler.Bytecode, error) {
+	program, err := parseFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if optimize {
+		program = optimizer.Optimize(program)
+	}
+
+	comp := compiler.New()
+	comp.SetLoader(module.NewLoader(filename, searchPaths...))
+	if err := comp.Compile(program); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+
+	bytecode := comp.Bytecode()
+	bytecode.Source = filename
+	return bytecode, nil
+}
+
+// loadBytecode コンパイル済みモジュールを読み込む
+// ソースコードのファイルであればコンパイルする
+func loadBytecode(filename string) (*compiler.Bytecode, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !compiler.IsModule(data) {
+		return compileFile(filename, false, modulePath(""))
+	}
+
+	bytecode, err := compiler.UnmarshalBytecode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return bytecode, nil
+}
@@ -0,0 +1,331 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Instructions バイトコードの命令列
+type Instructions []byte
+
+// String 命令列を1命令1行の人が読める形式で戻す
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	for _, d := range ins.Disassemble() {
+		fmt.Fprintf(&out, "%04d %s\n", d.Offset, d.Text)
+	}
+
+	return out.String()
+}
+
+// Disassembled 逆アセンブルした1命令
+type Disassembled struct {
+	Offset int    // 命令の位置
+	Text   string // 命令の文字列表現
+}
+
+// Disassemble 命令列を1命令ずつ位置と文字列表現に分解する
+func (ins Instructions) Disassemble() []Disassembled {
+	result := []Disassembled{}
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			result = append(result, Disassembled{i, fmt.Sprintf("ERROR: %s", err)})
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		result = append(result, Disassembled{i, ins.fmtInstruction(def, operands)})
+		i += 1 + read
+	}
+
+	return result
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+// Opcode 命令の種類
+type Opcode byte
+
+const (
+	// OpConstant 定数プールの値をスタックに積む (定数のインデックス)
+	OpConstant Opcode = iota
+	// OpPop スタックの先頭を取り除く
+	OpPop
+
+	// OpAdd 加算
+	OpAdd
+	// OpSub 減算
+	OpSub
+	// OpMul 乗算
+	OpMul
+	// OpDiv 除算
+	OpDiv
+
+	// OpTrue true を積む
+	OpTrue
+	// OpFalse false を積む
+	OpFalse
+	// OpNull null を積む
+	OpNull
+
+	// OpEqual ==
+	OpEqual
+	// OpNotEqual !=
+	OpNotEqual
+	// OpGreaterThan >
+	OpGreaterThan
+	// OpLessThan <
+	OpLessThan
+
+	// OpMinus 前置 -
+	OpMinus
+	// OpBang 前置 !
+	OpBang
+
+	// OpJumpNotTruthy スタックの先頭を取り出し、偽であればジャンプする (ジャンプ先)
+	OpJumpNotTruthy
+	// OpJump 無条件にジャンプする (ジャンプ先)
+	OpJump
+
+	// OpGetGlobal グローバル変数の値を積む (グローバル変数のインデックス)
+	OpGetGlobal
+	// OpSetGlobal スタックの先頭を取り出し、グローバル変数に束縛する (グローバル変数のインデックス)
+	OpSetGlobal
+	// OpGetLocal ローカル変数の値を積む (ローカル変数のインデックス)
+	OpGetLocal
+	// OpSetLocal スタックの先頭を取り出し、ローカル変数に束縛する (ローカル変数のインデックス)
+	OpSetLocal
+	// OpGetFree 実行中のクロージャが捕捉した自由変数を積む (自由変数のインデックス)
+	OpGetFree
+	// OpCurrentClosure 実行中のクロージャ自身を積む (再帰呼び出し用)
+	OpCurrentClosure
+
+	// OpCall 関数を呼び出す (引数の数)
+	OpCall
+	// OpReturnValue スタックの先頭を戻り値として関数から戻る
+	OpReturnValue
+	// OpReturn null を戻り値として関数から戻る
+	OpReturn
+	// OpClosure 定数プールの関数と、スタックに積まれた自由変数からクロージャを生成する (定数のインデックス, 自由変数の数)
+	OpClosure
+	// OpTailCall 現在のフレームを再利用して関数を呼び出す (引数の数)
+	// 呼び出し結果をそのまま戻り値とする OpCall の代わりに使う
+	OpTailCall
+	// OpIterInit スタックの先頭のオブジェクトから、要素を順に取り出すイテレータを生成する
+	OpIterInit
+	// OpIterNext スタックの先頭のイテレータから次の要素を取り出して積む。要素がなければジャンプする (ジャンプ先)
+	OpIterNext
+	// OpDup スタックの先頭から指定した個数の値を複製して積む (個数)
+	OpDup
+	// OpAssignGlobal 定義済みのグローバル変数に代入する。未定義であればエラー (インデックス)
+	OpAssignGlobal
+	// OpGetCell クロージャに捕捉されるローカル変数の値を積む (インデックス)
+	OpGetCell
+	// OpSetCell クロージャに捕捉されるローカル変数に代入する。初回はセルを生成する (インデックス)
+	OpSetCell
+	// OpSetFree 自由変数に代入する (インデックス)
+	OpSetFree
+	// OpGetFreeCell 自由変数のセルそのものを積む(内側のクロージャの生成用) (インデックス)
+	OpGetFreeCell
+	// OpIndex オブジェクトと添字から要素を取り出す
+	OpIndex
+	// OpSetIndex オブジェクトの添字の位置に値を代入し、代入した値を積む
+	OpSetIndex
+	// OpArray スタックに積まれた要素から配列を生成する (要素の数)
+	OpArray
+	// OpHash スタックに積まれたキーと値の組からハッシュを生成する (キーと値の数の合計)
+	OpHash
+	// OpUnpackArray スタックの先頭の配列を分解し、要素を先頭の要素が上になるように積む (要素の数, 残りの要素を配列として積むか)
+	// 足りない要素の位置には値がないことを表す目印を積む
+	OpUnpackArray
+	// OpUnpackHash スタックに積まれたキーでハッシュを分解し、値を最初のキーの値が上になるように積む (キーの数)
+	OpUnpackHash
+	// OpJumpPresent スタックの先頭が分解で得た値であればジャンプする (ジャンプ先)
+	OpJumpPresent
+	// OpRequire スタックの先頭が値がないことを表す目印であればエラーにする
+	OpRequire
+	// OpMatchValue スタックの先頭のリテラルと、その下の値が一致するかを積む
+	OpMatchValue
+	// OpMatchArray スタックの先頭が要素数の合う配列であれば、OpUnpackArray と同じく要素を積んでから真を積む。それ以外は偽を積む (要素の数, 残りの要素を配列として積むか)
+	OpMatchArray
+	// OpMatchHash スタックに積まれたキーを全て持つハッシュであれば、OpUnpackHash と同じく値を積んでから真を積む。それ以外は偽を積む (キーの数)
+	OpMatchHash
+	// OpNoMatch match式のどの腕にも一致しなかった値をエラーにする
+	OpNoMatch
+	// OpAppend スタックの先頭の値を、その下の配列の末尾に追加する
+	OpAppend
+	// OpExtend スタックの先頭の配列の要素を、その下の配列の末尾に追加する。配列でなければエラー
+	OpExtend
+	// OpCallArgs スタックに積まれた関数を、位置引数の配列と名前付き引数のハッシュで呼び出す
+	OpCallArgs
+	// OpTailCallArgs OpCallArgs と同じ引数で、現在のフレームを置き換えて呼び出す(末尾呼び出し)
+	OpTailCallArgs
+	// OpImport 定数プールのモジュールの関数を実行して、モジュールを積む。実行済みであれば記録したモジュールを積む (定数のインデックス)
+	OpImport
+	// OpModule スタックに積まれた名前と値の組から、実行中のモジュールの関数のモジュールを生成して積む (名前と値の組の数)
+	OpModule
+)
+
+// Definition 命令の名前とオペランドの幅(バイト数)の定義
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd: {"OpAdd", []int{}},
+	OpSub: {"OpSub", []int{}},
+	OpMul: {"OpMul", []int{}},
+	OpDiv: {"OpDiv", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpEqual:       {"OpEqual", []int{}},
+	OpNotEqual:    {"OpNotEqual", []int{}},
+	OpGreaterThan: {"OpGreaterThan", []int{}},
+	OpLessThan:    {"OpLessThan", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{1}},
+	OpSetLocal:       {"OpSetLocal", []int{1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+	OpClosure:     {"OpClosure", []int{2, 1}},
+	OpTailCall:    {"OpTailCall", []int{1}},
+	OpIterInit:    {"OpIterInit", []int{}},
+	OpIterNext:    {"OpIterNext", []int{2}},
+
+	OpDup:          {"OpDup", []int{1}},
+	OpAssignGlobal: {"OpAssignGlobal", []int{2}},
+	OpGetCell:      {"OpGetCell", []int{1}},
+	OpSetCell:      {"OpSetCell", []int{1}},
+	OpSetFree:      {"OpSetFree", []int{1}},
+	OpGetFreeCell:  {"OpGetFreeCell", []int{1}},
+	OpIndex:        {"OpIndex", []int{}},
+	OpSetIndex:     {"OpSetIndex", []int{}},
+
+	OpArray:        {"OpArray", []int{2}},
+	OpHash:         {"OpHash", []int{2}},
+	OpUnpackArray:  {"OpUnpackArray", []int{2, 1}},
+	OpUnpackHash:   {"OpUnpackHash", []int{2}},
+	OpJumpPresent:  {"OpJumpPresent", []int{2}},
+	OpRequire:      {"OpRequire", []int{}},
+	OpMatchValue:   {"OpMatchValue", []int{}},
+	OpMatchArray:   {"OpMatchArray", []int{2, 1}},
+	OpMatchHash:    {"OpMatchHash", []int{2}},
+	OpNoMatch:      {"OpNoMatch", []int{}},
+	OpAppend:       {"OpAppend", []int{}},
+	OpExtend:       {"OpExtend", []int{}},
+	OpCallArgs:     {"OpCallArgs", []int{}},
+	OpTailCallArgs: {"OpTailCallArgs", []int{}},
+	OpImport:       {"OpImport", []int{2}},
+	OpModule:       {"OpModule", []int{2}},
+}
+
+// Lookup 命令の定義を戻す
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Make 命令とオペランドをバイト列にエンコードする
+// オペランドはビッグエンディアンで格納する
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands 命令の定義に従ってオペランドをデコードし、読み込んだバイト数と共に戻す
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+// ReadUint16 2バイトのオペランドを読み込む
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// ReadUint8 1バイトのオペランドを読み込む
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
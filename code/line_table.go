@@ -0,0 +1,45 @@
+package code
+
+// LineEntry 命令の位置とソースコードの行の対応
+type LineEntry struct {
+	Offset int // 命令の位置
+	Line   int // ソースコードの行番号(1始まり)
+}
+
+// LineTable 命令の位置の昇順に並んだ LineEntry の列
+// ある位置の命令の行は、その位置以前で最後のエントリの行とする
+type LineTable []LineEntry
+
+// Line 命令の位置に対応するソースコードの行番号を戻す。不明な場合は0
+func (lt LineTable) Line(offset int) int {
+	line := 0
+	for _, e := range lt {
+		if e.Offset > offset {
+			break
+		}
+		line = e.Line
+	}
+	return line
+}
+
+// Add 命令の位置と行の対応を追加する。直前のエントリと同じ行であれば追加しない
+func (lt LineTable) Add(offset, line int) LineTable {
+	if line == 0 || (len(lt) > 0 && lt[len(lt)-1].Line == line) {
+		return lt
+	}
+	if len(lt) > 0 && lt[len(lt)-1].Offset == offset {
+		lt[len(lt)-1].Line = line
+		return lt
+	}
+	return append(lt, LineEntry{Offset: offset, Line: line})
+}
+
+// Truncate 位置が offset 以降のエントリを取り除く
+func (lt LineTable) Truncate(offset int) LineTable {
+	for i, e := range lt {
+		if e.Offset >= offset {
+			return lt[:i]
+		}
+	}
+	return lt
+}
@@ -0,0 +1,333 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/Sa2Knight/maron/code"
+	"github.com/Sa2Knight/maron/object"
+)
+
+// MAGIC コンパイル済みモジュールの先頭に置くマジックナンバー
+const MAGIC = "MRNB"
+
+// VERSION コンパイル済みモジュールの形式のバージョン
+// 命令や定数の形式を変更した場合は上げる
+const VERSION = 11
+
+// 定数プール中の定数の種別
+const (
+	constInteger  byte = 'I'
+	constFloat    byte = 'D'
+	constString   byte = 'S'
+	constFunction byte = 'F'
+)
+
+// ErrNotModule コンパイル済みモジュールでないデータを読み込んだ場合のエラー
+var ErrNotModule = errors.New("not a compiled maron module")
+
+// Bytecode コンパイル結果
+type Bytecode struct {
+	Instructions code.Instructions
+	Lines        code.LineTable  // 命令とソースコードの行の対応(デバッグ用)
+	Constants    []object.Object // 定数プール
+	GlobalNames  []string        // インデックス順のグローバル変数名(エラーメッセージ用)
+	NumLocals    int             // トップレベルのブロックの識別子に使うローカル変数の数
+	Source       string          // コンパイル元のファイル名(デバッグ用)
+}
+
+// IsModule データがコンパイル済みモジュールか判定する
+func IsModule(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(MAGIC))
+}
+
+// MarshalBinary バイトコードをコンパイル済みモジュールの形式に変換する
+//
+//	magic "MRNB", version(uvarint)
+//	source(string)
+//	constants: 個数, 各定数 (種別1バイト + 内容)
+//	  浮動小数点数は IEEE 754 のビット列を可変長整数にしたもの
+//	  関数は locals, parameters, name, 引数の個数と各引数(name, optional), rest(残りの引数名。なければ空), instructions, lines
+//	locals, instructions(bytes), lines(行番号表)
+//	global names: 個数, 各名前(string)
+//
+// 数値は全て可変長整数で、string と bytes は長さの後に内容を置く
+func (b *Bytecode) MarshalBinary() ([]byte, error) {
+	w := &moduleWriter{}
+	w.buf.WriteString(MAGIC)
+	w.uvarint(VERSION)
+	w.string(b.Source)
+
+	w.uvarint(uint64(len(b.Constants)))
+	for i, c := range b.Constants {
+		switch c := c.(type) {
+		case *object.Integer:
+			w.buf.WriteByte(constInteger)
+			w.varint(c.Value)
+		case *object.Float:
+			w.buf.WriteByte(constFloat)
+			w.uvarint(math.Float64bits(c.Value))
+		case *object.String:
+			w.buf.WriteByte(constString)
+			w.string(c.Value)
+		case *object.CompiledFunction:
+			w.buf.WriteByte(constFunction)
+			w.uvarint(uint64(c.NumLocals))
+			w.uvarint(uint64(c.NumParameters))
+			w.string(c.Name)
+			w.uvarint(uint64(len(c.Parameters)))
+			for _, param := range c.Parameters {
+				w.string(param.Name)
+				w.bool(param.Optional)
+			}
+			w.string(c.Rest)
+			w.bytes(c.Instructions)
+			w.lines(c.Lines)
+		default:
+			return nil, fmt.Errorf("constant %d: unsupported type %s", i, c.Type())
+		}
+	}
+
+	w.uvarint(uint64(b.NumLocals))
+	w.bytes(b.Instructions)
+	w.lines(b.Lines)
+
+	w.uvarint(uint64(len(b.GlobalNames)))
+	for _, name := range b.GlobalNames {
+		w.string(name)
+	}
+
+	return w.buf.Bytes(), nil
+}
+
+// UnmarshalBytecode コンパイル済みモジュールからバイトコードを復元する
+func UnmarshalBytecode(data []byte) (*Bytecode, error) {
+	if !IsModule(data) {
+		return nil, ErrNotModule
+	}
+	r := &moduleReader{r: bytes.NewReader(data[len(MAGIC):])}
+
+	if version := r.uvarint(); r.err == nil && version != VERSION {
+		return nil, fmt.Errorf("unsupported module version %d (want %d)", version, VERSION)
+	}
+
+	b := &Bytecode{Source: r.string()}
+
+	numConstants := r.uvarint()
+	for i := uint64(0); i < numConstants && r.err == nil; i++ {
+		kind, err := r.r.ReadByte()
+		if err != nil {
+			r.err = err
+			break
+		}
+
+		switch kind {
+		case constInteger:
+			b.Constants = append(b.Constants, &object.Integer{Value: r.varint()})
+		case constFloat:
+			b.Constants = append(b.Constants, &object.Float{Value: math.Float64frombits(r.uvarint())})
+		case constString:
+			b.Constants = append(b.Constants, &object.String{Value: r.string()})
+		case constFunction:
+			fn := &object.CompiledFunction{}
+			fn.NumLocals = int(r.uvarint())
+			fn.NumParameters = int(r.uvarint())
+			fn.Name = r.string()
+			numParams := r.uvarint()
+			for j := uint64(0); j < numParams && r.err == nil; j++ {
+				fn.Parameters = append(fn.Parameters, object.Parameter{Name: r.string(), Optional: r.bool()})
+			}
+			fn.Rest = r.string()
+			fn.Instructions = r.bytes()
+			fn.Lines = r.lines()
+			b.Constants = append(b.Constants, fn)
+		default:
+			return nil, fmt.Errorf("constant %d: unknown kind %q", i, kind)
+		}
+	}
+
+	b.NumLocals = int(r.uvarint())
+	b.Instructions = r.bytes()
+	b.Lines = r.lines()
+
+	numGlobals := r.uvarint()
+	for i := uint64(0); i < numGlobals && r.err == nil; i++ {
+		b.GlobalNames = append(b.GlobalNames, r.string())
+	}
+
+	if r.err != nil {
+		return nil, fmt.Errorf("corrupted module: %s", r.err)
+	}
+	if err := validate(b); err != nil {
+		return nil, fmt.Errorf("corrupted module: %s", err)
+	}
+	return b, nil
+}
+
+// Disassemble バイトコードを人が読める形式で w に書き出す
+// source にコンパイル元のソースコードを渡すと、行番号に加えてその行の内容を注記する
+func Disassemble(w io.Writer, b *Bytecode, source string) {
+	lines := strings.Split(source, "\n")
+	if source == "" {
+		lines = nil
+	}
+
+	name := "main"
+	if b.Source != "" {
+		name = b.Source
+	}
+	fmt.Fprintf(w, "== %s ==\n", name)
+	disassembleInstructions(w, b.Instructions, b.Lines, lines)
+
+	for i, c := range b.Constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "\n== constant %d: function (parameters=%d, locals=%d) ==\n", i, fn.NumParameters, fn.NumLocals)
+		disassembleInstructions(w, fn.Instructions, fn.Lines, lines)
+	}
+
+	fmt.Fprintf(w, "\n== constants ==\n")
+	for i, c := range b.Constants {
+		switch c := c.(type) {
+		case *object.CompiledFunction:
+			fmt.Fprintf(w, "%4d %s\n", i, c.Type())
+		case *object.String:
+			fmt.Fprintf(w, "%4d %s %q\n", i, c.Type(), c.Value)
+		default:
+			fmt.Fprintf(w, "%4d %s %s\n", i, c.Type(), c.Inspect())
+		}
+	}
+
+	if len(b.GlobalNames) > 0 {
+		fmt.Fprintf(w, "\n== globals ==\n")
+		for i, name := range b.GlobalNames {
+			fmt.Fprintf(w, "%4d %s\n", i, name)
+		}
+	}
+}
+
+// disassembleInstructions 命令を1行ずつ書き出し、ソースコードの行が変わる箇所に注記を入れる
+func disassembleInstructions(w io.Writer, ins code.Instructions, lt code.LineTable, source []string) {
+	current := 0
+	for _, d := range ins.Disassemble() {
+		if line := lt.Line(d.Offset); line != current {
+			current = line
+			if line > 0 && line <= len(source) {
+				fmt.Fprintf(w, "     ; %d: %s\n", line, strings.TrimSpace(source[line-1]))
+			} else {
+				fmt.Fprintf(w, "     ; line %d\n", line)
+			}
+		}
+		fmt.Fprintf(w, "%04d %s\n", d.Offset, d.Text)
+	}
+}
+
+type moduleWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *moduleWriter) uvarint(v uint64) {
+	w.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (w *moduleWriter) varint(v int64) {
+	w.buf.Write(binary.AppendVarint(nil, v))
+}
+
+func (w *moduleWriter) bool(v bool) {
+	if v {
+		w.buf.WriteByte(1)
+	} else {
+		w.buf.WriteByte(0)
+	}
+}
+
+func (w *moduleWriter) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.buf.Write(b)
+}
+
+func (w *moduleWriter) string(s string) {
+	w.bytes([]byte(s))
+}
+
+func (w *moduleWriter) lines(lt code.LineTable) {
+	w.uvarint(uint64(len(lt)))
+	for _, e := range lt {
+		w.uvarint(uint64(e.Offset))
+		w.uvarint(uint64(e.Line))
+	}
+}
+
+// moduleReader 最初に発生したエラーを保持し、以降の読み込みはゼロ値を戻す
+type moduleReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (r *moduleReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(r.r)
+	r.err = err
+	return v
+}
+
+func (r *moduleReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(r.r)
+	r.err = err
+	return v
+}
+
+func (r *moduleReader) bool() bool {
+	if r.err != nil {
+		return false
+	}
+	b, err := r.r.ReadByte()
+	r.err = err
+	return b != 0
+}
+
+func (r *moduleReader) bytes() []byte {
+	n := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(r.r.Len()) {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := make([]byte, n)
+	_, r.err = io.ReadFull(r.r, b)
+	return b
+}
+
+func (r *moduleReader) string() string {
+	return string(r.bytes())
+}
+
+func (r *moduleReader) lines() code.LineTable {
+	n := r.uvarint()
+	if r.err != nil || n > uint64(r.r.Len()) {
+		if r.err == nil {
+			r.err = io.ErrUnexpectedEOF
+		}
+		return nil
+	}
+	lt := make(code.LineTable, 0, n)
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		lt = append(lt, code.LineEntry{Offset: int(r.uvarint()), Line: int(r.uvarint())})
+	}
+	return lt
+}
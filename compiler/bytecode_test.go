@@ -0,0 +1,228 @@
+package compiler
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Sa2Knight/maron/code"
+	"github.com/Sa2Knight/maron/lexer"
+	"github.com/Sa2Knight/maron/object"
+	"github.com/Sa2Knight/maron/parser"
+)
+
+const bytecodeTestSource = `let newAdder = fn(x) {
+  fn(y) { x + y }
+};
+let addTwo = newAdder(-2);
+addTwo(3)`
+
+func compileSource(t testing.TB, input string) *Bytecode {
+	t.Helper()
+
+	comp := New()
+	if err := comp.Compile(parser.New(lexer.New(input)).ParseProgram()); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return comp.Bytecode()
+}
+
+func TestLineTable(t *testing.T) {
+	bytecode := compileSource(t, bytecodeTestSource)
+
+	// 同じ行が続く命令はひとつのエントリにまとめられる
+	expected := code.LineTable{
+		{Offset: 0, Line: 1},  // OpClosure, OpSetGlobal
+		{Offset: 7, Line: 4},  // OpGetGlobal ... OpSetGlobal
+		{Offset: 19, Line: 5}, // OpGetGlobal ... OpPop
+	}
+
+	if !reflect.DeepEqual(bytecode.Lines, expected) {
+		t.Errorf("lines wrong.\nwant=%+v\ngot =%+v\n%s", expected, bytecode.Lines, bytecode.Instructions)
+	}
+
+	inner := bytecode.Constants[0].(*object.CompiledFunction)
+	if line := inner.Lines.Line(0); line != 2 {
+		t.Errorf("inner function must start at line 2. got=%d", line)
+	}
+}
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	sources := []string{
+		bytecodeTestSource,
+		"let f = fn(a, b = 2, ...rest) { [a, b, rest] }; f(1, b: 3)",
+		"[1.5 * 2, -0.25, math.sqrt(2.0)]",
+	}
+
+	for _, source := range sources {
+		bytecode := compileSource(t, source)
+		bytecode.Source = "adder.mr"
+
+		data, err := bytecode.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary returned error: %s", err)
+		}
+		if !IsModule(data) {
+			t.Fatalf("marshaled data must start with magic")
+		}
+
+		decoded, err := UnmarshalBytecode(data)
+		if err != nil {
+			t.Fatalf("UnmarshalBytecode returned error: %s", err)
+		}
+
+		if !reflect.DeepEqual(bytecode, decoded) {
+			t.Errorf("decoded bytecode differs.\nwant=%+v\ngot =%+v", bytecode, decoded)
+		}
+	}
+}
+
+func TestUnmarshalBytecodeErrors(t *testing.T) {
+	data, err := compileSource(t, bytecodeTestSource).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary returned error: %s", err)
+	}
+
+	newerVersion := append([]byte(MAGIC), byte(VERSION+1))
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"ソースコード", []byte("let x = 1;"), ErrNotModule.Error()},
+		{"新しいバージョン", newerVersion, "unsupported module version"},
+		{"途中で切れたデータ", data[:len(data)-5], "corrupted module"},
+	}
+
+	for _, tt := range tests {
+		_, err := UnmarshalBytecode(tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("[%s] expected error containing %q. got=%v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestUnmarshalBytecodeValidation(t *testing.T) {
+	// 自由変数をひとつ参照する関数
+	adder := &object.CompiledFunction{
+		Instructions:  instructions(code.Make(code.OpGetFree, 0), code.Make(code.OpGetLocal, 0), code.Make(code.OpAdd), code.Make(code.OpReturnValue)),
+		NumLocals:     1,
+		NumParameters: 1,
+		Parameters:    []object.Parameter{{Name: "y"}},
+	}
+	localOutOfRange := &object.CompiledFunction{
+		Instructions:  instructions(code.Make(code.OpGetLocal, 1), code.Make(code.OpReturnValue)),
+		NumLocals:     1,
+		NumParameters: 1,
+		Parameters:    []object.Parameter{{Name: "x"}},
+	}
+	integer := &object.Integer{Value: 1}
+
+	tests := []struct {
+		name     string
+		bytecode *Bytecode
+		expected string
+	}{
+		{"未知の命令", &Bytecode{Instructions: code.Instructions{255}},
+			"corrupted module: main: unknown opcode 255 at 0"},
+		{"途中で切れたオペランド", &Bytecode{Instructions: code.Make(code.OpConstant, 0)[:2], Constants: []object.Object{integer}},
+			"corrupted module: main: truncated OpConstant at 0"},
+		{"範囲外の定数", &Bytecode{Instructions: instructions(code.Make(code.OpConstant, 1), code.Make(code.OpPop)), Constants: []object.Object{integer}},
+			"corrupted module: main: constant index 1 out of range at 0"},
+		{"関数でない定数のクロージャ", &Bytecode{Instructions: instructions(code.Make(code.OpClosure, 0, 0), code.Make(code.OpPop)), Constants: []object.Object{integer}},
+			"corrupted module: main: OpClosure of non-function constant 0 at 0"},
+		{"範囲外のグローバル変数", &Bytecode{Instructions: instructions(code.Make(code.OpGetGlobal, 1), code.Make(code.OpPop)), GlobalNames: []string{"x"}},
+			"corrupted module: main: global index 1 out of range at 0"},
+		{"範囲外のローカル変数", &Bytecode{Instructions: instructions(code.Make(code.OpClosure, 0, 0), code.Make(code.OpPop)), Constants: []object.Object{localOutOfRange}},
+			"corrupted module: constant 0: local index 1 out of range at 0"},
+		{"足りない自由変数", &Bytecode{Instructions: instructions(code.Make(code.OpClosure, 0, 0), code.Make(code.OpPop)), Constants: []object.Object{adder}},
+			"corrupted module: OpClosure at 0: closure of constant 0 needs 1 free variables, got 0"},
+		{"キーと値が揃わないハッシュ", &Bytecode{Instructions: instructions(code.Make(code.OpConstant, 0), code.Make(code.OpHash, 1), code.Make(code.OpPop)), Constants: []object.Object{integer}},
+			"corrupted module: main: odd number of hash elements 1 at 3"},
+		{"オペランドの中へのジャンプ", &Bytecode{Instructions: instructions(code.Make(code.OpJump, 4), code.Make(code.OpConstant, 0), code.Make(code.OpPop)), Constants: []object.Object{integer}},
+			"corrupted module: main: invalid jump target 4 at 0"},
+		{"関数の外へのジャンプ", &Bytecode{Instructions: instructions(code.Make(code.OpJump, 100))},
+			"corrupted module: main: invalid jump target 100 at 0"},
+		{"スタックの値が足りない", &Bytecode{Instructions: instructions(code.Make(code.OpConstant, 0), code.Make(code.OpAdd), code.Make(code.OpPop)), Constants: []object.Object{integer}},
+			"corrupted module: main: stack underflow at 3: OpAdd needs 2 values, got 1"},
+		{"合流する深さが異なる", &Bytecode{Instructions: instructions(code.Make(code.OpTrue), code.Make(code.OpJumpNotTruthy, 7), code.Make(code.OpConstant, 0), code.Make(code.OpPop)), Constants: []object.Object{integer}},
+			"corrupted module: main: inconsistent stack depth at 7: 0 and 1 (from 4)"},
+		{"関数の外の return", &Bytecode{Instructions: instructions(code.Make(code.OpReturn))},
+			"corrupted module: main: OpReturn outside function at 0"},
+	}
+
+	for _, tt := range tests {
+		data, err := tt.bytecode.MarshalBinary()
+		if err != nil {
+			t.Fatalf("[%s] MarshalBinary returned error: %s", tt.name, err)
+		}
+		_, err = UnmarshalBytecode(data)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("[%s] wrong error. want=%q, got=%v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+// FuzzUnmarshalBytecode 壊れたデータを読み込んでも panic せず、読み込めたバイトコードは逆アセンブルできる
+// 1バイトずつ書き換えたデータはシードとして毎回検査する
+func FuzzUnmarshalBytecode(f *testing.F) {
+	sources := []string{
+		bytecodeTestSource,
+		"let f = fn(a, b = 2, ...rest) { [a, b, rest] }; f(1, b: 3)",
+		`let {k} = {"k": [1, 2.5, "s"]}; match (k) { [x, ...r] if x > 0 => r, _ => [] }`,
+		"let s = 0; for (i in [1, 2, 3]) { s += i }; s",
+	}
+	for _, source := range sources {
+		data, err := compileSource(f, source).MarshalBinary()
+		if err != nil {
+			f.Fatalf("MarshalBinary returned error: %s", err)
+		}
+		for i := len(MAGIC); i < len(data); i++ {
+			for _, delta := range []byte{1, 0x80, 0xff} {
+				corrupted := append([]byte{}, data...)
+				corrupted[i] += delta
+				f.Add(corrupted)
+			}
+			f.Add(data[:i])
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		bytecode, err := UnmarshalBytecode(data)
+		if err != nil {
+			return
+		}
+		Disassemble(io.Discard, bytecode, "")
+	})
+}
+
+func instructions(ins ...code.Instructions) code.Instructions {
+	result := code.Instructions{}
+	for _, i := range ins {
+		result = append(result, i...)
+	}
+	return result
+}
+
+func TestDisassemble(t *testing.T) {
+	bytecode := compileSource(t, bytecodeTestSource)
+
+	var out bytes.Buffer
+	Disassemble(&out, bytecode, bytecodeTestSource)
+
+	for _, expected := range []string{
+		"== main ==\n     ; 1: let newAdder = fn(x) {\n0000 OpClosure 1 0\n",
+		"     ; 5: addTwo(3)\n",
+		"== constant 0: function (parameters=1, locals=1) ==\n     ; 2: fn(y) { x + y }\n0000 OpGetFree 0\n",
+		"== constants ==\n   0 COMPILED_FUNCTION\n",
+		"   2 INTEGER 2\n",
+		"== globals ==\n   0 newAdder\n   1 addTwo\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("disassembly must contain %q.\ngot=\n%s", expected, out.String())
+		}
+	}
+}
@@ -0,0 +1,1220 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/Sa2Knight/maron/ast"
+	"github.com/Sa2Knight/maron/code"
+	"github.com/Sa2Knight/maron/object"
+)
+
+// maxLocals 1つの関数(またはトップレベル)で使えるローカル変数の数
+// ローカル変数を参照する命令のオペランドは1バイト
+const maxLocals = 256
+
+// EmittedInstruction 出力済みの命令
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// CompilationScope 関数ごとのコンパイル中の命令列
+type CompilationScope struct {
+	instructions        code.Instructions
+	lines               code.LineTable // 命令とソースコードの行の対応
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	loops               []*loop // コンパイル中の繰り返し文(内側ほど後ろ)
+}
+
+// loop コンパイル中の繰り返し文
+type loop struct {
+	continueTarget int   // continue文のジャンプ先
+	breaks         []int // ジャンプ先を後から書き換える、break文の OpJump の位置
+}
+
+// Compiler ASTをバイトコードに変換するコンパイラ
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	line int // コンパイル中のノードの行番号
+
+	loader object.ModuleLoader // import文でモジュールを読み込む(nilの場合は import文を使えない)
+}
+
+// New コンパイラを新規生成
+func New() *Compiler {
+	return NewWithState(NewSymbolTable(), []object.Object{})
+}
+
+// NewWithState 前回のコンパイルの識別子表と定数プールを引き継いでコンパイラを生成(REPL用)
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	// トップレベルのブロックのローカル変数は実行ごとに確保するので、前回のコンパイルの分は引き継がない
+	s.numLocals = 0
+	return &Compiler{
+		constants:   constants,
+		symbolTable: s,
+		scopes:      []CompilationScope{{}},
+	}
+}
+
+// SetLoader import文でモジュールを読み込む ModuleLoader を設定する
+func (c *Compiler) SetLoader(loader object.ModuleLoader) {
+	c.loader = loader
+}
+
+// Compile ノードをコンパイルする
+func (c *Compiler) Compile(node ast.Node) error {
+	if line := nodeLine(node); line > 0 {
+		outer := c.line
+		c.line = line
+		defer func() { c.line = outer }()
+	}
+
+	switch node := node.(type) {
+	// トップレベルのブロックの識別子も、クロージャに捕捉されるものはセルに格納する
+	case *ast.Program:
+		c.symbolTable.captured = capturedNames(node)
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	// 評価器と同じく、右辺の評価中は以前の束縛(または外側の識別子)が見えるよう、右辺を先にコンパイルする
+	// 関数の再帰呼び出しは FunctionScope で解決する
+	case *ast.LetStatement:
+		fn, isFunction := node.Value.(*ast.FunctionLiteral)
+		name, isIdentifier := node.Name.(*ast.Identifier)
+		if isFunction && isIdentifier {
+			if err := c.compileFunction(fn, name.Value); err != nil {
+				return err
+			}
+		} else if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+
+		return c.compilePattern(node.Name, node.IsConst())
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	// 未定義の識別子は、実行時に定義されている可能性があるのでグローバル変数として扱う
+	// 実行時に未定義であればVMがエラーにする
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			symbol = c.globalSymbolTable().Define(node.Value)
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	// キー、値の順に記述した順で積む
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+			if err := c.Compile(pair.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "+":
+			c.emit(code.OpAdd)
+		case "-":
+			c.emit(code.OpSub)
+		case "*":
+			c.emit(code.OpMul)
+		case "/":
+			c.emit(code.OpDiv)
+		case ">":
+			c.emit(code.OpGreaterThan)
+		case "<":
+			c.emit(code.OpLessThan)
+		case "==":
+			c.emit(code.OpEqual)
+		case "!=":
+			c.emit(code.OpNotEqual)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.IfExpression:
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+
+		// ジャンプ先は後から書き換える
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		if err := c.compileBlockExpression(node.Consequence); err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else if err := c.compileBlockExpression(node.Alternative); err != nil {
+			return err
+		}
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	case *ast.MatchExpression:
+		return c.compileMatch(node)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node, "")
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	// プロパティ名の文字列を添字とした添字式と同じ
+	case *ast.PropertyExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Property.Value}))
+		c.emit(code.OpIndex)
+
+	case *ast.AssignExpression:
+		return c.compileAssign(node)
+
+	case *ast.WhileStatement:
+		start := len(c.currentInstructions())
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+
+		exitPos := c.emit(code.OpJumpNotTruthy, 9999)
+		breaks, err := c.compileLoopBody(node.Body, start)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, start)
+
+		exit := len(c.currentInstructions())
+		c.changeOperand(exitPos, exit)
+		for _, pos := range breaks {
+			c.changeOperand(pos, exit)
+		}
+
+		// 評価器と同じく、繰り返し文の値はnull
+		c.emit(code.OpNull)
+		c.emit(code.OpPop)
+
+	// イテレータは繰り返しの間スタックに置いておき、終了時に取り除く
+	case *ast.ImportStatement:
+		return c.compileImport(node)
+
+	case *ast.ExportStatement:
+		return c.Compile(node.Statement)
+
+	case *ast.ForStatement:
+		if err := c.Compile(node.Iterable); err != nil {
+			return err
+		}
+		c.emit(code.OpIterInit)
+
+		start := len(c.currentInstructions())
+		nextPos := c.emit(code.OpIterNext, 9999)
+
+		// 評価器と同じく、変数とブロックで定義した識別子は繰り返しごとに束縛し、繰り返し文の中でのみ参照できる
+		entry := c.enterBlock(node.Body)
+		symbol, err := c.define(node.Variable.Value, false)
+		if err != nil {
+			return err
+		}
+		c.storeSymbol(symbol)
+
+		breaks, err := c.compileLoopBody(node.Body, start)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, start)
+		c.leaveBlock(entry)
+
+		exit := len(c.currentInstructions())
+		c.changeOperand(nextPos, exit)
+		for _, pos := range breaks {
+			c.changeOperand(pos, exit)
+		}
+
+		c.emit(code.OpPop)
+		c.emit(code.OpNull)
+		c.emit(code.OpPop)
+
+	case *ast.BreakStatement:
+		l := c.currentLoop()
+		if l == nil {
+			return fmt.Errorf("break outside of loop")
+		}
+		l.breaks = append(l.breaks, c.emit(code.OpJump, 9999))
+
+	case *ast.ContinueStatement:
+		l := c.currentLoop()
+		if l == nil {
+			return fmt.Errorf("continue outside of loop")
+		}
+		c.emit(code.OpJump, l.continueTarget)
+
+	// パイプラインは同じ意味の呼び出し式としてコンパイルする
+	case *ast.PipeExpression:
+		return c.Compile(node.Call())
+
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+		if hasSpreadOrNamed(node.Arguments) {
+			return c.compileArguments(node.Arguments)
+		}
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+
+	default:
+		return fmt.Errorf("unsupported node for compilation: %T", node)
+	}
+
+	return nil
+}
+
+// Bytecode コンパイル結果を戻す
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Lines:        c.scopes[c.scopeIndex].lines,
+		Constants:    c.constants,
+		GlobalNames:  c.globalSymbolTable().Names(),
+		NumLocals:    c.globalSymbolTable().numLocals,
+	}
+}
+
+// compileBlockExpression 値を持つブロックとしてコンパイルする
+// 最後の文が式であればその値を、そうでなければnullをスタックに残す
+func (c *Compiler) compileBlockExpression(block *ast.BlockStatement) error {
+	start := len(c.currentInstructions())
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if len(c.currentInstructions()) > start && c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+// 複合代入演算子と、代入前に適用する演算の命令
+var compoundOperators = map[string]code.Opcode{
+	"+=": code.OpAdd,
+	"-=": code.OpSub,
+	"*=": code.OpMul,
+	"/=": code.OpDiv,
+}
+
+// compileAssign 代入式をコンパイルする。代入した値がスタックに残る
+// 評価器と同じく、複合代入は代入先の現在の値、右辺の順に評価する
+func (c *Compiler) compileAssign(node *ast.AssignExpression) error {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(target.Value)
+		if !ok {
+			// 実行時に定義されている可能性があるので、グローバル変数として扱う
+			symbol = c.globalSymbolTable().Define(target.Value)
+		}
+		if symbol.Const {
+			return fmt.Errorf("cannot assign to constant: %s", target.Value)
+		}
+		if symbol.Scope == FunctionScope {
+			return fmt.Errorf("cannot assign to function name: %s", target.Value)
+		}
+
+		if node.Operator != "=" {
+			c.loadSymbol(symbol)
+		}
+		if err := c.compileAssignedValue(node); err != nil {
+			return err
+		}
+		c.emit(code.OpDup, 1)
+
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpAssignGlobal, symbol.Index)
+		} else {
+			c.storeSymbol(symbol)
+		}
+		return nil
+
+	case *ast.IndexExpression:
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(target.Index); err != nil {
+			return err
+		}
+
+	case *ast.PropertyExpression:
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: target.Property.Value}))
+
+	default:
+		return fmt.Errorf("invalid assignment target: %s", node.Target)
+	}
+
+	// オブジェクトと添字はスタックに残したまま、現在の値を取り出す
+	if node.Operator != "=" {
+		c.emit(code.OpDup, 2)
+		c.emit(code.OpIndex)
+	}
+	if err := c.compileAssignedValue(node); err != nil {
+		return err
+	}
+	c.emit(code.OpSetIndex)
+	return nil
+}
+
+// compileAssignedValue 右辺をコンパイルし、複合代入であれば演算の命令を出力する
+func (c *Compiler) compileAssignedValue(node *ast.AssignExpression) error {
+	if err := c.Compile(node.Value); err != nil {
+		return err
+	}
+	if node.Operator == "=" {
+		return nil
+	}
+
+	op, ok := compoundOperators[node.Operator]
+	if !ok {
+		return fmt.Errorf("unknown operator %s", node.Operator)
+	}
+	c.emit(op)
+	return nil
+}
+
+// define let文などで識別子を定義する
+// 同じスコープで定数として定義済みの識別子は定義し直せない
+func (c *Compiler) define(name string, isConst bool) (Symbol, error) {
+	if symbol, ok := c.symbolTable.store[name]; ok && symbol.Const && symbol.Scope != FreeScope {
+		return symbol, fmt.Errorf("cannot assign to constant: %s", name)
+	}
+	var symbol Symbol
+	if isConst {
+		symbol = c.symbolTable.DefineConst(name)
+	} else {
+		symbol = c.symbolTable.Define(name)
+	}
+	if symbol.Scope == LocalScope && symbol.Index >= maxLocals {
+		return symbol, fmt.Errorf("too many local variables: %s", name)
+	}
+	return symbol, nil
+}
+
+// compilePattern スタックの先頭の値をパターンに従って分解し、識別子に束縛する
+// 評価器と同じく、要素は先頭から順に束縛し、既定値はその要素の位置で評価する
+func (c *Compiler) compilePattern(pattern ast.Pattern, isConst bool) error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		symbol, err := c.define(pattern.Value, isConst)
+		if err != nil {
+			return err
+		}
+		c.storeSymbol(symbol)
+
+	case *ast.ArrayPattern:
+		hasRest := 0
+		if pattern.Rest != nil {
+			hasRest = 1
+		}
+		c.emit(code.OpUnpackArray, len(pattern.Elements), hasRest)
+
+		for _, el := range pattern.Elements {
+			if err := c.compilePatternElement(el, isConst); err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil {
+			return c.compilePattern(pattern.Rest, isConst)
+		}
+
+	case *ast.HashPattern:
+		for _, el := range pattern.Elements {
+			c.emit(code.OpConstant, c.addConstant(&object.String{Value: el.Key.Value}))
+		}
+		c.emit(code.OpUnpackHash, len(pattern.Elements))
+
+		for _, el := range pattern.Elements {
+			if err := c.compilePatternElement(el, isConst); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("invalid binding target: %s", pattern)
+	}
+	return nil
+}
+
+// compilePatternElement 分解で得た値(または値がないことを表す目印)を要素の束縛先に束縛する
+func (c *Compiler) compilePatternElement(el *ast.PatternElement, isConst bool) error {
+	if el.Default == nil {
+		c.emit(code.OpRequire)
+	} else {
+		jumpPos := c.emit(code.OpJumpPresent, 9999)
+		c.emit(code.OpPop)
+		if err := c.Compile(el.Default); err != nil {
+			return err
+		}
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+	}
+	return c.compilePattern(el.Target, isConst)
+}
+
+// compileArguments 展開や名前付き引数を含む実引数をコンパイルし、関数を呼び出す命令を出力する
+// 位置引数は先頭から順に配列に追加し、名前付き引数はハッシュにまとめてから OpCallArgs で呼び出す
+func (c *Compiler) compileArguments(args []ast.Expression) error {
+	c.emit(code.OpArray, 0)
+
+	numNamed := 0
+	for _, a := range args {
+		switch a := a.(type) {
+		case *ast.SpreadElement:
+			if err := c.Compile(a.Value); err != nil {
+				return err
+			}
+			c.emit(code.OpExtend)
+
+		case *ast.NamedArgument:
+			// 名前付き引数は位置引数より後ろにしか書けない
+			c.emit(code.OpConstant, c.addConstant(&object.String{Value: a.Name.Value}))
+			if err := c.Compile(a.Value); err != nil {
+				return err
+			}
+			numNamed++
+
+		default:
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+			c.emit(code.OpAppend)
+		}
+	}
+
+	c.emit(code.OpHash, numNamed*2)
+	c.emit(code.OpCallArgs)
+	return nil
+}
+
+func hasSpreadOrNamed(args []ast.Expression) bool {
+	for _, a := range args {
+		switch a.(type) {
+		case *ast.SpreadElement, *ast.NamedArgument:
+			return true
+		}
+	}
+	return false
+}
+
+// compileMatch match式をコンパイルする
+// 照合する値はスタックに残したまま、各腕で複製して照合する
+// 照合に失敗した場合は、それまでに積んだ値を取り除いてから次の腕へジャンプする
+func (c *Compiler) compileMatch(me *ast.MatchExpression) error {
+	if err := c.Compile(me.Subject); err != nil {
+		return err
+	}
+
+	endJumps := []int{}
+	for _, arm := range me.Arms {
+		c.emit(code.OpDup, 1)
+
+		// 評価器と同じく、パターンの識別子はその腕のガード式と式の中でのみ参照できる
+		entry := c.enterBlock(arm)
+
+		// fails[n] は、照合する値の上に n 個の値を積んだ状態で失敗するジャンプの位置
+		fails := [][]int{}
+		if err := c.compileMatchPattern(arm.Pattern, 1, &fails); err != nil {
+			return err
+		}
+		if arm.Guard != nil {
+			if err := c.Compile(arm.Guard); err != nil {
+				return err
+			}
+			addMatchFailure(&fails, 0, c.emit(code.OpJumpNotTruthy, 9999))
+		}
+
+		// 一致すれば、照合する値を取り除いてから腕の式を評価する
+		c.emit(code.OpPop)
+		if err := c.Compile(arm.Body); err != nil {
+			return err
+		}
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+		c.leaveBlock(entry)
+
+		for n := len(fails) - 1; n >= 0; n-- {
+			for _, pos := range fails[n] {
+				c.changeOperand(pos, len(c.currentInstructions()))
+			}
+			if n > 0 {
+				c.emit(code.OpPop)
+			}
+		}
+	}
+	c.emit(code.OpNoMatch)
+
+	for _, pos := range endJumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// compileMatchPattern スタックの先頭の値をパターンと照合し、パターン中の識別子に束縛する
+// depth は照合する値自身を含めた、match式の値の上に積まれている値の数
+// 評価器と同じく、束縛は照合しながら順に行う
+func (c *Compiler) compileMatchPattern(pattern ast.Pattern, depth int, fails *[][]int) error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value == ast.WILDCARD {
+			c.emit(code.OpPop)
+			return nil
+		}
+		return c.compilePattern(pattern, false)
+
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		if err := c.Compile(pattern); err != nil {
+			return err
+		}
+		c.emit(code.OpMatchValue)
+		addMatchFailure(fails, depth-1, c.emit(code.OpJumpNotTruthy, 9999))
+
+	case *ast.ArrayPattern:
+		hasRest := 0
+		if pattern.Rest != nil {
+			hasRest = 1
+		}
+		c.emit(code.OpMatchArray, len(pattern.Elements), hasRest)
+		addMatchFailure(fails, depth-1, c.emit(code.OpJumpNotTruthy, 9999))
+
+		depth += len(pattern.Elements) + hasRest - 1
+		for _, el := range pattern.Elements {
+			if err := c.compileMatchPattern(el.Target, depth, fails); err != nil {
+				return err
+			}
+			depth--
+		}
+		if pattern.Rest != nil {
+			return c.compileMatchPattern(pattern.Rest, depth, fails)
+		}
+
+	case *ast.HashPattern:
+		for _, el := range pattern.Elements {
+			c.emit(code.OpConstant, c.addConstant(&object.String{Value: el.Key.Value}))
+		}
+		c.emit(code.OpMatchHash, len(pattern.Elements))
+		addMatchFailure(fails, depth-1, c.emit(code.OpJumpNotTruthy, 9999))
+
+		depth += len(pattern.Elements) - 1
+		for _, el := range pattern.Elements {
+			if err := c.compileMatchPattern(el.Target, depth, fails); err != nil {
+				return err
+			}
+			depth--
+		}
+
+	default:
+		return fmt.Errorf("invalid match pattern: %s", pattern)
+	}
+	return nil
+}
+
+// addMatchFailure 値を n 個積んだ状態で照合に失敗するジャンプを記録する
+func addMatchFailure(fails *[][]int, n int, pos int) {
+	for len(*fails) <= n {
+		*fails = append(*fails, nil)
+	}
+	(*fails)[n] = append((*fails)[n], pos)
+}
+
+// compileLoopBody 繰り返し文のブロックをコンパイルし、ジャンプ先が未定の break文の位置を戻す
+func (c *Compiler) compileLoopBody(body *ast.BlockStatement, continueTarget int) ([]int, error) {
+	l := &loop{continueTarget: continueTarget}
+	c.scopes[c.scopeIndex].loops = append(c.scopes[c.scopeIndex].loops, l)
+
+	err := c.Compile(body)
+
+	loops := c.scopes[c.scopeIndex].loops
+	c.scopes[c.scopeIndex].loops = loops[:len(loops)-1]
+	return l.breaks, err
+}
+
+// currentLoop 最も内側の繰り返し文を戻す。関数の外側の繰り返し文は含まない
+func (c *Compiler) currentLoop() *loop {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
+// compileFunction 関数リテラルをコンパイルし、クロージャを生成する命令を出力する
+// name が空でなければ、関数本体からその名前で自身を参照できる
+func (c *Compiler) compileFunction(fn *ast.FunctionLiteral, name string) error {
+	c.enterScope()
+
+	if name != "" {
+		c.symbolTable.DefineFunctionName(name)
+	}
+	c.symbolTable.captured = capturedNames(fn.Body)
+	for _, p := range fn.Parameters {
+		if p.Default != nil {
+			for name := range capturedNames(p.Default) {
+				c.symbolTable.captured[name] = true
+			}
+		}
+	}
+
+	// 分割代入する引数は、名前のない領域で受け取る
+	// 残りの引数は最後の領域で配列として受け取る
+	params := make([]Symbol, len(fn.Parameters))
+	for i, p := range fn.Parameters {
+		if ident, ok := p.Target.(*ast.Identifier); ok {
+			params[i] = c.symbolTable.Define(ident.Value)
+		} else {
+			params[i] = c.symbolTable.DefineAnonymous()
+		}
+	}
+	if fn.Rest != nil {
+		params = append(params, c.symbolTable.Define(fn.Rest.Value))
+	}
+
+	// 内側のクロージャに捕捉される引数は、呼び出し時にセルに格納する
+	for _, symbol := range params {
+		if symbol.Cell {
+			c.emit(code.OpGetLocal, symbol.Index)
+			c.emit(code.OpSetCell, symbol.Index)
+		}
+	}
+
+	// 評価器と同じく、渡された引数を全て束縛してから、既定値を使う引数と分割代入する引数を先頭から順に束縛する
+	// 省略された引数の領域には、値がないことを表す目印が入っている
+	for i, p := range fn.Parameters {
+		_, isIdent := p.Target.(*ast.Identifier)
+		if isIdent && p.Default == nil {
+			continue
+		}
+
+		if isIdent {
+			c.loadSymbol(params[i])
+		} else {
+			c.emit(code.OpGetLocal, params[i].Index)
+		}
+		if p.Default != nil {
+			jumpPos := c.emit(code.OpJumpPresent, 9999)
+			c.emit(code.OpPop)
+			if err := c.Compile(p.Default); err != nil {
+				return err
+			}
+			c.changeOperand(jumpPos, len(c.currentInstructions()))
+		}
+		if isIdent {
+			c.storeSymbol(params[i])
+		} else if err := c.compilePattern(p.Target, false); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Compile(fn.Body); err != nil {
+		return err
+	}
+
+	// 最後の式の値を戻り値にする
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+	markTailCalls(c.currentInstructions())
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	if numLocals > maxLocals {
+		return fmt.Errorf("too many local variables in function")
+	}
+	lines := c.scopes[c.scopeIndex].lines
+	instructions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.captureSymbol(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		Lines:         lines,
+		NumLocals:     numLocals,
+		NumParameters: len(params),
+		Name:          name,
+		Parameters:    object.ParametersOf(fn.Parameters),
+	}
+	if fn.Rest != nil {
+		compiledFn.Rest = fn.Rest.Value
+	}
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+	return nil
+}
+
+// compileImport モジュールを読み込み、モジュールを識別子に束縛する命令を出力する
+// モジュールはひとつの関数にコンパイルして定数プールに置き、VMが初めて読み込む時に一度だけ実行する
+func (c *Compiler) compileImport(is *ast.ImportStatement) error {
+	if c.loader == nil {
+		return fmt.Errorf("cannot import %q: modules are not available", is.Path.Value)
+	}
+
+	mod, err := c.loader.Import(is.Path.Value, c.compileModule)
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpImport, c.constantIndex(mod))
+	return c.compilePattern(is.Name, false)
+}
+
+// compileModule モジュールのプログラムを、モジュールを生成して戻す関数にコンパイルする
+// モジュールのトップレベルの識別子は、メインのプログラムと別の名前空間のグローバル変数になる
+func (c *Compiler) compileModule(name string, program *ast.Program) (object.Object, error) {
+	symbolTable := c.symbolTable
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+	c.symbolTable = NewModuleSymbolTable(c.globalSymbolTable())
+	defer func() {
+		c.scopes = c.scopes[:len(c.scopes)-1]
+		c.scopeIndex--
+		c.symbolTable = symbolTable
+	}()
+
+	if err := c.Compile(program); err != nil {
+		return nil, err
+	}
+
+	// export文で定義された識別子の名前と値を積み、モジュールを生成する
+	numExports := 0
+	for _, stmt := range program.Statements {
+		export, ok := stmt.(*ast.ExportStatement)
+		if !ok {
+			continue
+		}
+		for _, ident := range export.Names() {
+			symbol, _ := c.symbolTable.Resolve(ident.Value)
+			c.emit(code.OpConstant, c.addConstant(&object.String{Value: ident.Value}))
+			c.loadSymbol(symbol)
+			numExports++
+		}
+	}
+	c.emit(code.OpModule, numExports)
+	c.emit(code.OpReturnValue)
+
+	fn := &object.CompiledFunction{
+		Instructions: c.currentInstructions(),
+		Lines:        c.scopes[c.scopeIndex].lines,
+		NumLocals:    c.symbolTable.numLocals,
+		Name:         name,
+	}
+	c.addConstant(fn)
+	return fn, nil
+}
+
+// constantIndex 定数プール中の obj のインデックスを戻す。なければ追加する
+func (c *Compiler) constantIndex(obj object.Object) int {
+	for i, constant := range c.constants {
+		if constant == obj {
+			return i
+		}
+	}
+	return c.addConstant(obj)
+}
+
+// markTailCalls 結果をそのまま戻り値とする関数呼び出しを OpTailCall (OpTailCallArgs) に置き換える
+// OpCall の直後(OpJump を辿った先を含む)が OpReturnValue であれば末尾呼び出し
+// 命令の長さは変わらないので、ジャンプ先を書き換える必要はない
+func markTailCalls(ins code.Instructions) {
+	for i := 0; i < len(ins); {
+		op := code.Opcode(ins[i])
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return
+		}
+		_, read := code.ReadOperands(def, ins[i+1:])
+		next := i + 1 + read
+
+		if op == code.OpCall && returnsAt(ins, next) {
+			ins[i] = byte(code.OpTailCall)
+		}
+		if op == code.OpCallArgs && returnsAt(ins, next) {
+			ins[i] = byte(code.OpTailCallArgs)
+		}
+		i = next
+	}
+}
+
+// returnsAt pos から実行すると、スタックの先頭をそのまま戻り値として戻るか
+func returnsAt(ins code.Instructions, pos int) bool {
+	// 前方へのジャンプのみを辿るので必ず終了する
+	for pos < len(ins) {
+		switch code.Opcode(ins[pos]) {
+		case code.OpReturnValue:
+			return true
+		case code.OpJump:
+			target := int(code.ReadUint16(ins[pos+1:]))
+			if target <= pos {
+				return false
+			}
+			pos = target
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		if s.Cell {
+			c.emit(code.OpGetCell, s.Index)
+		} else {
+			c.emit(code.OpGetLocal, s.Index)
+		}
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		if s.Cell {
+			c.emit(code.OpSetCell, s.Index)
+		} else {
+			c.emit(code.OpSetLocal, s.Index)
+		}
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	}
+}
+
+// captureSymbol クロージャが捕捉する識別子を積む
+// 捕捉されるローカル変数と自由変数は、値ではなくセルを積むことで、外側と内側で同じ変数を共有する
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFreeCell, s.Index)
+	default:
+		c.loadSymbol(s)
+	}
+}
+
+// capturedNames 関数本体(や引数の既定値)の中の関数リテラルで使われている識別子名を戻す
+// 外側のローカル変数を参照しているとは限らないが、多めに見積もっても正しく動作する
+func capturedNames(node ast.Node) map[string]bool {
+	names := map[string]bool{}
+	ast.Inspect(node, func(n ast.Node) bool {
+		fn, ok := n.(*ast.FunctionLiteral)
+		if !ok {
+			return true
+		}
+		ast.Inspect(fn, func(inner ast.Node) bool {
+			if ident, ok := inner.(*ast.Identifier); ok {
+				names[ident.Value] = true
+			}
+			return true
+		})
+		return false
+	})
+	return names
+}
+
+// containsFunction ノードが関数リテラルを含むか
+func containsFunction(node ast.Node) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if _, ok := n.(*ast.FunctionLiteral); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+func (c *Compiler) globalSymbolTable() *SymbolTable {
+	s := c.symbolTable
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// emit 命令を出力し、その位置を戻す
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	c.scopes[c.scopeIndex].lines = c.scopes[c.scopeIndex].lines.Add(posNewInstruction, c.line)
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:last.Position]
+	c.scopes[c.scopeIndex].lines = c.scopes[c.scopeIndex].lines.Truncate(last.Position)
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// enterBlock node を実行するブロックのスコープに入る
+// node が関数リテラルを含む場合は、ブロックに入るたびにセルを取り除く命令へのジャンプを出力し、その位置を戻す。含まなければ-1
+func (c *Compiler) enterBlock(node ast.Node) int {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	if !containsFunction(node) {
+		return -1
+	}
+	return c.emit(code.OpJump, 9999)
+}
+
+// leaveBlock ブロックのスコープを出る
+// ブロックで定義したセルは、ブロックをコンパイルし終えるまで分からないので、取り除く命令はブロックの後に出力し、
+// ブロックの入口からジャンプして取り除いた後でブロックの先頭に戻る
+// 以前に実行したときのセルを取り除くことで、実行するたびに生成されるクロージャが別々の束縛を捕捉する
+func (c *Compiler) leaveBlock(entry int) {
+	if entry >= 0 {
+		c.changeOperand(entry, len(c.currentInstructions()))
+		for _, symbol := range c.symbolTable.Cells() {
+			c.emit(code.OpNull)
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+		c.emit(code.OpJump, entry+3)
+	}
+	c.symbolTable = c.symbolTable.Outer
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
+// nodeLine ノードが始まる行番号を戻す。不明な場合は0
+func nodeLine(node ast.Node) int {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		return node.Token.Line
+	case *ast.ReturnStatement:
+		return node.Token.Line
+	case *ast.ExpressionStatement:
+		return node.Token.Line
+	case *ast.BlockStatement:
+		return node.Token.Line
+	case *ast.Identifier:
+		return node.Token.Line
+	case *ast.IntegerLiteral:
+		return node.Token.Line
+	case *ast.FloatLiteral:
+		return node.Token.Line
+	case *ast.StringLiteral:
+		return node.Token.Line
+	case *ast.ArrayLiteral:
+		return node.Token.Line
+	case *ast.HashLiteral:
+		return node.Token.Line
+	case *ast.Boolean:
+		return node.Token.Line
+	case *ast.PrefixExpression:
+		return node.Token.Line
+	case *ast.InfixExpression:
+		return node.Token.Line
+	case *ast.IfExpression:
+		return node.Token.Line
+	case *ast.MatchExpression:
+		return node.Token.Line
+	case *ast.FunctionLiteral:
+		return node.Token.Line
+	case *ast.CallExpression:
+		return node.Token.Line
+	case *ast.SpreadElement:
+		return node.Token.Line
+	case *ast.NamedArgument:
+		return node.Token.Line
+	case *ast.WhileStatement:
+		return node.Token.Line
+	case *ast.ForStatement:
+		return node.Token.Line
+	case *ast.ImportStatement:
+		return node.Token.Line
+	case *ast.ExportStatement:
+		return node.Token.Line
+	case *ast.BreakStatement:
+		return node.Token.Line
+	case *ast.ContinueStatement:
+		return node.Token.Line
+	case *ast.IndexExpression:
+		return node.Token.Line
+	case *ast.PropertyExpression:
+		return node.Token.Line
+	case *ast.AssignExpression:
+		return node.Token.Line
+	case *ast.PipeExpression:
+		return node.Token.Line
+	}
+	return 0
+}
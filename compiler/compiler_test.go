@@ -0,0 +1,727 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/Sa2Knight/maron/code"
+	"github.com/Sa2Knight/maron/lexer"
+	"github.com/Sa2Knight/maron/object"
+	"github.com/Sa2Knight/maron/parser"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 < 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-1; !true",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+				code.Make(code.OpTrue),
+				code.Make(code.OpBang),
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestConditionals(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { let a = 1; } else { }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 14),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpSetGlobal, 0),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpJump, 15),
+				// 0014
+				code.Make(code.OpNull),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			input:             "let one = 1; let two = one; let one = 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			// 未定義の識別子は実行時に解決するグローバル変数になる
+			input:             "let f = fn() { g }; let g = 1;",
+			expectedConstants: []interface{}{[]code.Instructions{code.Make(code.OpGetGlobal, 0), code.Make(code.OpReturnValue)}, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	})
+}
+
+func TestFunctions(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			input: "fn() { return 5 + 10 }",
+			expectedConstants: []interface{}{
+				5,
+				10,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "let one = fn(a) { let b = a; fn() { b } }; one(1)",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetCell, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "let f = fn() { f() }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	})
+}
+
+func TestTailCalls(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			// 分岐の中の呼び出しは OpJump の先で戻るので末尾呼び出し
+			input: "let f = fn(n) { if (n) { f(n) } else { g() } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpJumpNotTruthy, 13),
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpJump, 18),
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpTailCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 1),
+			},
+		},
+		{
+			// 呼び出し結果を使う場合は末尾呼び出しではない
+			input: "let f = fn() { return f() + 1 }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+		{
+			// トップレベルの呼び出しはフレームを置き換えない
+			input: "let f = fn() { 1 }; return f()",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	})
+}
+
+func TestLoops(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			input:             "while (true) { break; }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpJump, 10),
+				// 0007
+				code.Make(code.OpJump, 0),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "for (x in xs) { continue; }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpGetGlobal, 0),
+				// 0003
+				code.Make(code.OpIterInit),
+				// 0004
+				code.Make(code.OpIterNext, 15),
+				// 0007
+				code.Make(code.OpSetLocal, 0),
+				// 0009
+				code.Make(code.OpJump, 4),
+				// 0012
+				code.Make(code.OpJump, 4),
+				// 0015
+				code.Make(code.OpPop),
+				// 0016
+				code.Make(code.OpNull),
+				// 0017
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// クロージャを生成する繰り返し文は、繰り返しごとに前回のセルを取り除いてから変数を束縛する
+			input: "for (x in xs) { fn() { x } }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpGetGlobal, 0),
+				// 0003
+				code.Make(code.OpIterInit),
+				// 0004
+				code.Make(code.OpIterNext, 28),
+				// 0007
+				code.Make(code.OpJump, 22),
+				// 0010
+				code.Make(code.OpSetCell, 0),
+				// 0012
+				code.Make(code.OpGetLocal, 0),
+				// 0014
+				code.Make(code.OpClosure, 0, 1),
+				// 0018
+				code.Make(code.OpPop),
+				// 0019
+				code.Make(code.OpJump, 4),
+				// 0022
+				code.Make(code.OpNull),
+				// 0023
+				code.Make(code.OpSetLocal, 0),
+				// 0025
+				code.Make(code.OpJump, 10),
+				// 0028
+				code.Make(code.OpPop),
+				// 0029
+				code.Make(code.OpNull),
+				// 0030
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestAssignments(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			input:             "let x = 1; x += 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpDup, 1),
+				code.Make(code.OpAssignGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "a[0] = 1",
+			expectedConstants: []interface{}{0, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { let c = 0; fn() { c = c + 1 } }",
+			expectedConstants: []interface{}{
+				0,
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpDup, 1),
+					code.Make(code.OpSetFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetCell, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 2, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestDestructuring(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			input:             "let [a, b = 2] = [1]",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpUnpackArray, 2, 0),
+				code.Make(code.OpRequire),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpJumpPresent, 21),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+			},
+		},
+		{
+			input:             `let {x, y: [z, ...rest]} = h`,
+			expectedConstants: []interface{}{"x", "y"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpUnpackHash, 2),
+				code.Make(code.OpRequire),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpRequire),
+				code.Make(code.OpUnpackArray, 1, 1),
+				code.Make(code.OpRequire),
+				code.Make(code.OpSetGlobal, 2),
+				code.Make(code.OpSetGlobal, 3),
+			},
+		},
+		{
+			input: "fn([a]) { a }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpUnpackArray, 1, 0),
+					code.Make(code.OpRequire),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestFunctionParameters(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			input: "fn(a, b = 2) { b }",
+			expectedConstants: []interface{}{
+				2,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 1),
+					// 0002
+					code.Make(code.OpJumpPresent, 9),
+					// 0005
+					code.Make(code.OpPop),
+					// 0006
+					code.Make(code.OpConstant, 0),
+					// 0009
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let f = 1; let xs = 2; f(0, ...xs, b: 3)",
+			expectedConstants: []interface{}{1, 2, 0, "b", 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAppend),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpExtend),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpHash, 2),
+				code.Make(code.OpCallArgs),
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestMatchExpressions(t *testing.T) {
+	runCompilerTests(t, []compilerTestCase{
+		{
+			input:             "match (1) { 2 => 3, _ => 4 }",
+			expectedConstants: []interface{}{1, 2, 3, 4},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpDup, 1),
+				// 0005
+				code.Make(code.OpConstant, 1),
+				// 0008
+				code.Make(code.OpMatchValue),
+				// 0009
+				code.Make(code.OpJumpNotTruthy, 19),
+				// 0012
+				code.Make(code.OpPop),
+				// 0013
+				code.Make(code.OpConstant, 2),
+				// 0016
+				code.Make(code.OpJump, 30),
+				// 0019
+				code.Make(code.OpDup, 1),
+				// 0021
+				code.Make(code.OpPop),
+				// 0022
+				code.Make(code.OpPop),
+				// 0023
+				code.Make(code.OpConstant, 3),
+				// 0026
+				code.Make(code.OpJump, 30),
+				// 0029
+				code.Make(code.OpNoMatch),
+				// 0030
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// 照合に失敗した位置に応じて、積んだ値を取り除いてから次の腕へジャンプする
+			input:             "match (1) { [1, a] => a, _ => 0 }",
+			expectedConstants: []interface{}{1, 1, 0},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpDup, 1),
+				// 0005
+				code.Make(code.OpMatchArray, 2, 0),
+				// 0009
+				code.Make(code.OpJumpNotTruthy, 28),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpMatchValue),
+				// 0016
+				code.Make(code.OpJumpNotTruthy, 27),
+				// 0019
+				code.Make(code.OpSetLocal, 0),
+				// 0021
+				code.Make(code.OpPop),
+				// 0022
+				code.Make(code.OpGetLocal, 0),
+				// 0024
+				code.Make(code.OpJump, 39),
+				// 0027
+				code.Make(code.OpPop),
+				// 0028
+				code.Make(code.OpDup, 1),
+				// 0030
+				code.Make(code.OpPop),
+				// 0031
+				code.Make(code.OpPop),
+				// 0032
+				code.Make(code.OpConstant, 2),
+				// 0035
+				code.Make(code.OpJump, 39),
+				// 0038
+				code.Make(code.OpNoMatch),
+				// 0039
+				code.Make(code.OpPop),
+			},
+		},
+	})
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"const x = 1; x = 2", "cannot assign to constant: x"},
+		{"const x = 1; let x = 2", "cannot assign to constant: x"},
+		{"let f = fn() { f = 1 }", "cannot assign to function name: f"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		err := New().Compile(program)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestSymbolTable(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	b := global.Define("b")
+	if again := global.Define("a"); again != a {
+		t.Errorf("redefinition must reuse the symbol. want=%+v, got=%+v", a, again)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	c := local.Define("c")
+	nested := NewEnclosedSymbolTable(local)
+	d := nested.Define("d")
+
+	expected := map[string]Symbol{
+		"a": {Name: "a", Scope: GlobalScope, Index: 0},
+		"b": {Name: "b", Scope: GlobalScope, Index: 1},
+		"c": {Name: "c", Scope: FreeScope, Index: 0},
+		"d": {Name: "d", Scope: LocalScope, Index: 0},
+	}
+	for _, sym := range []Symbol{a, b} {
+		if sym != expected[sym.Name] {
+			t.Errorf("expected %s to be %+v, got=%+v", sym.Name, expected[sym.Name], sym)
+		}
+	}
+	if c.Scope != LocalScope || d.Scope != LocalScope {
+		t.Errorf("local symbols have wrong scope. c=%+v, d=%+v", c, d)
+	}
+
+	for name, want := range expected {
+		got, ok := nested.Resolve(name)
+		if !ok {
+			t.Errorf("name %s not resolvable", name)
+			continue
+		}
+		if got != want {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", name, want, got)
+		}
+	}
+
+	if len(nested.FreeSymbols) != 1 || nested.FreeSymbols[0] != c {
+		t.Errorf("free symbols wrong. got=%+v", nested.FreeSymbols)
+	}
+	if names := global.Names(); len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Errorf("names wrong. got=%v", names)
+	}
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+
+		compiler := New()
+		if err := compiler.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+		testInstructions(t, tt.input, tt.expectedInstructions, bytecode.Instructions)
+		testConstants(t, tt.input, tt.expectedConstants, bytecode.Constants)
+	}
+}
+
+func testInstructions(t *testing.T, input string, expected []code.Instructions, actual code.Instructions) {
+	t.Helper()
+
+	concatted := code.Instructions{}
+	for _, ins := range expected {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != actual.String() {
+		t.Errorf("wrong instructions for %q.\nwant=\n%s\ngot=\n%s", input, concatted, actual)
+	}
+}
+
+func testConstants(t *testing.T, input string, expected []interface{}, actual []object.Object) {
+	t.Helper()
+
+	if len(expected) != len(actual) {
+		t.Errorf("wrong number of constants for %q. want=%d, got=%d", input, len(expected), len(actual))
+		return
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok || integer.Value != int64(constant) {
+				t.Errorf("constant %d wrong for %q. want=%d, got=%+v", i, input, constant, actual[i])
+			}
+		case string:
+			str, ok := actual[i].(*object.String)
+			if !ok || str.Value != constant {
+				t.Errorf("constant %d wrong for %q. want=%q, got=%+v", i, input, constant, actual[i])
+			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				t.Errorf("constant %d not a function for %q. got=%T", i, input, actual[i])
+				continue
+			}
+			testInstructions(t, input, constant, fn.Instructions)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package compiler
+
+import "sort"
+
+// SymbolScope 識別子のスコープ
+type SymbolScope string
+
+const (
+	// GlobalScope トップレベルで定義された識別子
+	GlobalScope SymbolScope = "GLOBAL"
+	// LocalScope 関数内で定義された識別子
+	LocalScope SymbolScope = "LOCAL"
+	// FreeScope 外側の関数で定義され、クロージャが捕捉する識別子
+	FreeScope SymbolScope = "FREE"
+	// FunctionScope 実行中の関数自身を指す識別子
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+// Symbol 識別子の情報
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	Const bool // const文で定義された(代入できない)識別子
+	Cell  bool // 内側のクロージャに捕捉されるため、セルに格納するローカル変数
+}
+
+// SymbolTable スコープごとの識別子の表
+type SymbolTable struct {
+	Outer *SymbolTable
+	owner *SymbolTable // グローバル変数の領域を割り当てる表(モジュールの識別子表のみ)
+	block bool         // 関数ではなくブロックのスコープ
+
+	store          map[string]Symbol
+	numDefinitions int
+	names          []string // インデックス順の識別子名
+	numLocals      int      // トップレベルのブロックの識別子に割り当てたローカル変数の数(トップレベルの識別子表のみ)
+
+	FreeSymbols []Symbol // このスコープが捕捉した外側の識別子
+
+	captured map[string]bool // 内側の関数から参照される可能性のある識別子名
+}
+
+// NewSymbolTable グローバルスコープの識別子表を新規生成
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+// NewEnclosedSymbolTable outer の内側のスコープの識別子表を新規生成
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// NewModuleSymbolTable モジュールのトップレベルの識別子表を新規生成
+// モジュールのグローバル変数は global と同じ領域に割り当てるが、名前は global と別に管理する
+func NewModuleSymbolTable(global *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.owner = global
+	if global.owner != nil {
+		s.owner = global.owner
+	}
+	return s
+}
+
+// NewBlockSymbolTable outer の内側のブロックの識別子表を新規生成
+// ブロックの識別子は、ブロックを含む関数(またはトップレベル)のフレームのローカル変数になり、名前はブロックの外から参照できない
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	s.captured = outer.captured
+	return s
+}
+
+// Define 識別子を定義する
+// 同じスコープで定義済みの識別子であれば、同じ場所を使い回す(let による再定義)
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return symbol
+	}
+	if s.block {
+		return s.defineBlockLocal(name)
+	}
+
+	owner := s
+	if s.owner != nil {
+		owner = s.owner
+	}
+
+	symbol := Symbol{Name: name, Index: owner.numDefinitions}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+		symbol.Cell = s.captured[name]
+	}
+
+	s.store[name] = symbol
+	owner.names = append(owner.names, name)
+	owner.numDefinitions++
+	return symbol
+}
+
+// defineBlockLocal ブロックの識別子に、ブロックを含む関数(またはトップレベル)のフレームのローカル変数の領域を割り当てる
+// トップレベルのブロックの識別子も、グローバル変数ではなくローカル変数にすることで、クロージャがブロックごとの束縛を捕捉できる
+func (s *SymbolTable) defineBlockLocal(name string) Symbol {
+	frame := s
+	for frame.block {
+		frame = frame.Outer
+	}
+
+	symbol := Symbol{Name: name, Scope: LocalScope, Cell: s.captured[name]}
+	if frame.Outer == nil {
+		symbol.Index = frame.numLocals
+		frame.numLocals++
+	} else {
+		symbol.Index = frame.numDefinitions
+		frame.names = append(frame.names, name)
+		frame.numDefinitions++
+	}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineConst 識別子を定数として定義する
+func (s *SymbolTable) DefineConst(name string) Symbol {
+	symbol := s.Define(name)
+	symbol.Const = true
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineAnonymous 名前で参照しないローカル変数の領域を確保する(分割代入する引数の受け取り用)
+func (s *SymbolTable) DefineAnonymous() Symbol {
+	symbol := Symbol{Scope: LocalScope, Index: s.numDefinitions}
+	s.names = append(s.names, "")
+	s.numDefinitions++
+	return symbol
+}
+
+// DefineFunctionName 実行中の関数自身を指す識別子を定義する
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// Resolve 識別子を内側のスコープから順に探す
+// 外側の関数のローカル変数であれば、自由変数として捕捉する
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if !ok && s.block {
+		// ブロックは同じ関数の中にあるので、外側の識別子をそのまま参照する
+		return s.Outer.Resolve(name)
+	}
+	if !ok && s.Outer != nil {
+		symbol, ok = s.Outer.Resolve(name)
+		if !ok {
+			return symbol, ok
+		}
+
+		if symbol.Scope == GlobalScope {
+			return symbol, ok
+		}
+
+		return s.defineFree(symbol), true
+	}
+	return symbol, ok
+}
+
+// Cells このスコープで定義した、セルに格納するローカル変数をインデックス順に戻す
+func (s *SymbolTable) Cells() []Symbol {
+	cells := []Symbol{}
+	for _, symbol := range s.store {
+		if symbol.Scope == LocalScope && symbol.Cell {
+			cells = append(cells, symbol)
+		}
+	}
+	sort.Slice(cells, func(i, j int) bool { return cells[i].Index < cells[j].Index })
+	return cells
+}
+
+// Names 定義された識別子名をインデックス順に戻す
+func (s *SymbolTable) Names() []string {
+	return s.names
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope, Const: original.Const}
+	s.store[original.Name] = symbol
+	return symbol
+}
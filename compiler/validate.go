@@ -0,0 +1,285 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/Sa2Knight/maron/code"
+	"github.com/Sa2Knight/maron/object"
+)
+
+// validate 読み込んだバイトコードを、VMが範囲外を参照せずに実行できるか検査する
+// 命令が既知であること、オペランドが命令列に収まること、定数・グローバル変数・ローカル変数・自由変数のインデックスが範囲内であること、
+// ジャンプ先が同じ関数の命令の先頭であること、各命令が取り出す値がスタックに積まれていることを確かめる
+func validate(b *Bytecode) error {
+	functions := map[*object.CompiledFunction]int{} // 関数と、その関数が参照する自由変数の数
+	closures := []closureSite{}
+
+	main := &object.CompiledFunction{Instructions: b.Instructions, NumLocals: b.NumLocals}
+	if main.NumLocals > maxLocals {
+		return fmt.Errorf("main: too many locals %d", main.NumLocals)
+	}
+	if numFree, err := validateInstructions(b, main, &closures); err != nil {
+		return fmt.Errorf("main: %s", err)
+	} else if numFree > 0 {
+		return fmt.Errorf("main: free variable referenced outside closure")
+	}
+	if err := validateStack(main.Instructions, true); err != nil {
+		return fmt.Errorf("main: %s", err)
+	}
+
+	for i, c := range b.Constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		numParameters := len(fn.Parameters)
+		if fn.Rest != "" {
+			numParameters++
+		}
+		if fn.NumParameters != numParameters || fn.NumLocals < fn.NumParameters {
+			return fmt.Errorf("constant %d: inconsistent parameters (parameters=%d, locals=%d)", i, fn.NumParameters, fn.NumLocals)
+		}
+		if fn.NumLocals > maxLocals {
+			return fmt.Errorf("constant %d: too many locals %d", i, fn.NumLocals)
+		}
+		numFree, err := validateInstructions(b, fn, &closures)
+		if err == nil {
+			err = validateStack(fn.Instructions, false)
+		}
+		if err != nil {
+			return fmt.Errorf("constant %d: %s", i, err)
+		}
+		functions[fn] = numFree
+	}
+
+	// クロージャを生成する命令は、関数が参照する自由変数を全て渡す必要がある
+	for _, site := range closures {
+		if need := functions[site.fn]; site.numFree < need {
+			return fmt.Errorf("%s: closure of constant %d needs %d free variables, got %d", site.where, site.index, need, site.numFree)
+		}
+	}
+	return nil
+}
+
+// closureSite クロージャを生成する命令(OpClosure, OpImport)
+type closureSite struct {
+	where   string // エラーメッセージ用の命令の位置
+	index   int
+	fn      *object.CompiledFunction
+	numFree int
+}
+
+// validateInstructions 関数の命令列を検査し、参照する自由変数の数を戻す
+// クロージャを生成する命令は、全ての関数を検査した後に確かめるため closures に追加する
+func validateInstructions(b *Bytecode, fn *object.CompiledFunction, closures *[]closureSite) (int, error) {
+	ins := fn.Instructions
+	starts := map[int]bool{}
+	jumps := [][2]int{} // ジャンプ命令の位置とジャンプ先
+	numFree := 0
+
+	for ip := 0; ip < len(ins); {
+		starts[ip] = true
+		op := code.Opcode(ins[ip])
+		def, err := code.Lookup(ins[ip])
+		if err != nil {
+			return 0, fmt.Errorf("unknown opcode %d at %d", ins[ip], ip)
+		}
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if ip+1+width > len(ins) {
+			return 0, fmt.Errorf("truncated %s at %d", def.Name, ip)
+		}
+		operands, _ := code.ReadOperands(def, ins[ip+1:])
+
+		switch op {
+		case code.OpConstant:
+			if operands[0] >= len(b.Constants) {
+				return 0, fmt.Errorf("constant index %d out of range at %d", operands[0], ip)
+			}
+
+		case code.OpClosure, code.OpImport:
+			index := operands[0]
+			if index >= len(b.Constants) {
+				return 0, fmt.Errorf("constant index %d out of range at %d", index, ip)
+			}
+			target, ok := b.Constants[index].(*object.CompiledFunction)
+			if !ok {
+				return 0, fmt.Errorf("%s of non-function constant %d at %d", def.Name, index, ip)
+			}
+			site := closureSite{where: fmt.Sprintf("%s at %d", def.Name, ip), index: index, fn: target}
+			if op == code.OpClosure {
+				site.numFree = operands[1]
+			}
+			*closures = append(*closures, site)
+
+		case code.OpGetGlobal, code.OpSetGlobal, code.OpAssignGlobal:
+			if operands[0] >= len(b.GlobalNames) {
+				return 0, fmt.Errorf("global index %d out of range at %d", operands[0], ip)
+			}
+
+		case code.OpGetLocal, code.OpSetLocal, code.OpGetCell, code.OpSetCell:
+			if operands[0] >= fn.NumLocals {
+				return 0, fmt.Errorf("local index %d out of range at %d", operands[0], ip)
+			}
+
+		case code.OpGetFree, code.OpSetFree, code.OpGetFreeCell:
+			if operands[0] >= numFree {
+				numFree = operands[0] + 1
+			}
+
+		case code.OpHash:
+			if operands[0]%2 != 0 {
+				return 0, fmt.Errorf("odd number of hash elements %d at %d", operands[0], ip)
+			}
+
+		case code.OpUnpackArray, code.OpMatchArray:
+			if operands[1] > 1 {
+				return 0, fmt.Errorf("invalid rest flag %d at %d", operands[1], ip)
+			}
+
+		case code.OpJump, code.OpJumpNotTruthy, code.OpIterNext, code.OpJumpPresent:
+			jumps = append(jumps, [2]int{ip, operands[0]})
+		}
+
+		ip += 1 + width
+	}
+
+	for _, jump := range jumps {
+		if target := jump[1]; target != len(ins) && !starts[target] {
+			return 0, fmt.Errorf("invalid jump target %d at %d", target, jump[0])
+		}
+	}
+	return numFree, nil
+}
+
+// validateStack 到達できる各命令の実行前のスタックの深さを求め、命令が取り出す値が積まれていることを確かめる
+// 深さは関数のローカル変数の領域より上に積まれた値の数で、同じ命令に異なる深さで到達する場合は誤りとする
+// validateInstructions で命令列の形式を検査した後に呼び出す
+func validateStack(ins code.Instructions, isMain bool) error {
+	if len(ins) == 0 {
+		return nil
+	}
+	depths := map[int]int{0: 0}
+	pending := []int{0}
+
+	// next を深さ depth で実行するよう記録する
+	reach := func(from, next, depth int) error {
+		if next >= len(ins) {
+			return nil
+		}
+		if d, ok := depths[next]; ok {
+			if d != depth {
+				return fmt.Errorf("inconsistent stack depth at %d: %d and %d (from %d)", next, d, depth, from)
+			}
+			return nil
+		}
+		depths[next] = depth
+		pending = append(pending, next)
+		return nil
+	}
+
+	for len(pending) > 0 {
+		ip := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		depth := depths[ip]
+
+		op := code.Opcode(ins[ip])
+		def, _ := code.Lookup(ins[ip])
+		operands, width := code.ReadOperands(def, ins[ip+1:])
+		next := ip + 1 + width
+
+		if isMain && (op == code.OpReturn || op == code.OpTailCall || op == code.OpTailCallArgs) {
+			return fmt.Errorf("%s outside function at %d", def.Name, ip)
+		}
+
+		pops, pushes, ok := stackEffect(op, operands)
+		if depth < pops {
+			return fmt.Errorf("stack underflow at %d: %s needs %d values, got %d", ip, def.Name, pops, depth)
+		}
+		after := depth - pops + pushes
+
+		var err error
+		switch {
+		case !ok:
+			// 関数から戻る命令と、照合に失敗した値をエラーにする命令の後は実行しない
+		case op == code.OpJump:
+			err = reach(ip, operands[0], after)
+		case op == code.OpJumpNotTruthy, op == code.OpJumpPresent:
+			if err = reach(ip, operands[0], after); err == nil {
+				err = reach(ip, next, after)
+			}
+		case op == code.OpIterNext:
+			// 要素がなければ、要素を積まずにジャンプする
+			if err = reach(ip, operands[0], depth); err == nil {
+				err = reach(ip, next, after)
+			}
+		case op == code.OpMatchArray, op == code.OpMatchHash:
+			// 照合の結果は直後の OpJumpNotTruthy で取り出す。一致した場合のみ分解した値が残る
+			if next >= len(ins) || code.Opcode(ins[next]) != code.OpJumpNotTruthy {
+				return fmt.Errorf("%s without OpJumpNotTruthy at %d", def.Name, ip)
+			}
+			jnt, _ := code.Lookup(ins[next])
+			jntOperands, jntWidth := code.ReadOperands(jnt, ins[next+1:])
+			failed := depth - pops
+			if err = reach(next, jntOperands[0], failed); err == nil {
+				err = reach(next, next+1+jntWidth, after-1)
+			}
+		default:
+			err = reach(ip, next, after)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stackEffect 命令がスタックから取り出す値と積む値の数を戻す
+// 照合に一致した場合にのみ値を積む命令は、一致した場合の数を戻す
+// 実行が次の命令に進まない命令(関数から戻る命令など)は ok が false
+func stackEffect(op code.Opcode, operands []int) (pops, pushes int, ok bool) {
+	switch op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull, code.OpGetGlobal, code.OpGetLocal,
+		code.OpGetFree, code.OpCurrentClosure, code.OpGetCell, code.OpGetFreeCell, code.OpImport:
+		return 0, 1, true
+	case code.OpPop, code.OpSetGlobal, code.OpAssignGlobal, code.OpSetLocal, code.OpSetCell, code.OpSetFree, code.OpJumpNotTruthy:
+		return 1, 0, true
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+		code.OpIndex, code.OpMatchValue, code.OpAppend, code.OpExtend:
+		return 2, 1, true
+	case code.OpMinus, code.OpBang, code.OpIterInit, code.OpRequire, code.OpJumpPresent:
+		return 1, 1, true
+	case code.OpJump:
+		return 0, 0, true
+	case code.OpIterNext:
+		return 1, 2, true
+	case code.OpSetIndex:
+		return 3, 1, true
+	case code.OpCall, code.OpTailCall:
+		return operands[0] + 1, 1, true
+	case code.OpCallArgs, code.OpTailCallArgs:
+		return 3, 1, true
+	case code.OpClosure:
+		return operands[1], 1, true
+	case code.OpDup:
+		return operands[0], operands[0] * 2, true
+	case code.OpArray, code.OpHash:
+		return operands[0], 1, true
+	case code.OpModule:
+		return operands[0] * 2, 1, true
+	case code.OpUnpackArray:
+		return 1, operands[0] + operands[1], true
+	case code.OpMatchArray:
+		return 1, operands[0] + operands[1] + 1, true
+	case code.OpUnpackHash:
+		return operands[0] + 1, operands[0], true
+	case code.OpMatchHash:
+		return operands[0] + 1, operands[0] + 1, true
+	case code.OpReturnValue, code.OpNoMatch:
+		return 1, 0, false
+	}
+	// OpReturn
+	return 0, 0, false
+}
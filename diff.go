@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// 差分の前後に表示する変更のない行数
+const diffContext = 3
+
+// diffLine 差分の1行分 (kind は ' ', '-', '+' のいずれか)
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// unifiedDiff 2つの文字列の行単位の差分を unified 形式で戻す
+func unifiedDiff(filename, a, b string) string {
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s\n+++ %s (formatted)\n", filename, filename)
+
+	for start := 0; start < len(lines); {
+		// 次の変更行を探す
+		for start < len(lines) && lines[start].kind == ' ' {
+			start++
+		}
+		if start == len(lines) {
+			break
+		}
+
+		// 変更行の間が diffContext*2 行以下ならひとつのハンクにまとめる
+		from := max(start-diffContext, 0)
+		end := start
+		for i := start; i < len(lines) && i-end <= diffContext*2; i++ {
+			if lines[i].kind != ' ' {
+				end = i
+			}
+		}
+		to := min(end+diffContext+1, len(lines))
+
+		aStart, bStart := lineNumbers(lines[:from])
+		aCount, bCount := lineNumbers(lines[from:to])
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aStart+1, aCount, bStart+1, bCount)
+		for _, l := range lines[from:to] {
+			out.WriteByte(l.kind)
+			out.WriteString(l.text)
+			out.WriteString("\n")
+		}
+		start = to
+	}
+	return out.String()
+}
+
+// diffLines 最長共通部分列を使って2つの行の並びの差分を求める
+func diffLines(a, b []string) []diffLine {
+	// lcs[i][j] は a[i:] と b[j:] の最長共通部分列の長さ
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := []diffLine{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{'+', b[j]})
+	}
+	return lines
+}
+
+// lineNumbers 差分行のうち変更前・変更後それぞれに含まれる行数を戻す
+func lineNumbers(lines []diffLine) (int, int) {
+	a, b := 0, 0
+	for _, l := range lines {
+		if l.kind != '+' {
+			a++
+		}
+		if l.kind != '-' {
+			b++
+		}
+	}
+	return a, b
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/Sa2Knight/maron/ast"
+	"github.com/Sa2Knight/maron/compiler"
+	"github.com/Sa2Knight/maron/evaluator"
+	"github.com/Sa2Knight/maron/object"
+	"github.com/Sa2Knight/maron/vm"
+)
+
+const (
+	// EVAL ASTを辿って評価するエンジン
+	EVAL = "eval"
+	// VM バイトコードにコンパイルしてスタックマシンで実行するエンジン
+	VM = "vm"
+)
+
+// Engine プログラムを実行するエンジン
+// 同じEngineで続けて実行した場合、前回までに定義した識別子を引き継ぐ
+type Engine interface {
+	// Run プログラムを実行して評価結果を戻す
+	// エラーは *object.Error として戻し、最後の文が値を持たない場合は nil を戻す
+	Run(program *ast.Program) object.Object
+}
+
+// Options エンジンが実行するプログラムに与える機能の設定
+type Options struct {
+	// Loader import文でモジュールを読み込む。nilの場合は import文を使えない
+	Loader object.ModuleLoader
+
+	// Runtime 組み込み関数が使う実行環境の設定。nilの場合は既定の設定を生成する
+	Runtime *object.Runtime
+}
+
+// New 名前を指定してエンジンを生成する
+func New(name string) (Engine, error) {
+	return NewWithOptions(name, Options{})
+}
+
+// NewWithOptions 名前と設定を指定してエンジンを生成する
+func NewWithOptions(name string, opts Options) (Engine, error) {
+	if opts.Runtime == nil {
+		opts.Runtime = object.NewRuntime()
+	}
+
+	switch name {
+	case EVAL, "":
+		env := object.NewEnvironment()
+		env.SetLoader(opts.Loader)
+		env.SetRuntime(opts.Runtime)
+		return NewEvaluator(env), nil
+	case VM:
+		e := NewVM().(*vmEngine)
+		e.loader = opts.Loader
+		e.runtime = opts.Runtime
+		return e, nil
+	default:
+		return nil, fmt.Errorf("unknown engine: %s (available: %s, %s)", name, EVAL, VM)
+	}
+}
+
+// NewEvaluator env を使って評価するエンジンを生成する
+func NewEvaluator(env *object.Environment) Engine {
+	return &evaluatorEngine{env: env}
+}
+
+type evaluatorEngine struct {
+	env *object.Environment
+}
+
+func (e *evaluatorEngine) Run(program *ast.Program) object.Object {
+	return evaluator.Eval(program, e.env)
+}
+
+// NewVM バイトコードにコンパイルして実行するエンジンを生成する
+func NewVM() Engine {
+	return &vmEngine{
+		symbolTable: compiler.NewSymbolTable(),
+		constants:   []object.Object{},
+		globals:     make([]object.Object, vm.GlobalsSize),
+		runtime:     object.NewRuntime(),
+	}
+}
+
+type vmEngine struct {
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+	loader      object.ModuleLoader
+	runtime     *object.Runtime
+}
+
+func (e *vmEngine) Run(program *ast.Program) object.Object {
+	comp := compiler.NewWithState(e.symbolTable, e.constants)
+	comp.SetLoader(e.loader)
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	bytecode := comp.Bytecode()
+	e.constants = bytecode.Constants
+
+	machine := vm.NewWithGlobalsStore(bytecode, e.globals)
+	machine.SetRuntime(e.runtime)
+	if err := machine.Run(); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	return machine.LastPoppedStackElem()
+}
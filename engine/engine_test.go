@@ -0,0 +1,321 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sa2Knight/maron/lexer"
+	"github.com/Sa2Knight/maron/object"
+	"github.com/Sa2Knight/maron/parser"
+)
+
+// fakeClock 進めた分だけ時刻が変わる時計
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func TestFakeClock(t *testing.T) {
+	configure := func(runtime *object.Runtime) {
+		runtime.Clock = &fakeClock{now: time.Date(2024, 3, 31, 23, 59, 0, 0, time.UTC)}
+	}
+	forEachEngine(t, configure, func(name string, e Engine, runtime *object.Runtime) {
+		clock := runtime.Clock.(*fakeClock)
+
+		tests := []struct {
+			input    string
+			advance  time.Duration // 実行した後に時計を進める時間
+			expected string
+		}{
+			{`let start = time.monotonic(); let cutoff = time.date(2024, 4, 1); time.now()`, 0, "2024-03-31T23:59:00Z"},
+			{`time.now() < cutoff`, 90 * time.Second, "true"},
+			{`time.now() < cutoff`, 0, "false"},
+			{`time.sub(time.monotonic(), start)`, 0, "1m30s"},
+			{`time.in_zone(time.now(), "Asia/Tokyo")`, 0, "2024-04-01T09:00:30+09:00"},
+		}
+
+		for _, tt := range tests {
+			if got := describe(run(e, tt.input)); got != tt.expected {
+				t.Errorf("[%s] wrong result for %q. want=%q, got=%q", name, tt.input, tt.expected, got)
+			}
+			clock.now = clock.now.Add(tt.advance)
+		}
+	})
+}
+
+// TestInterrupt 中断を要求した Runtime で実行するプログラムは、終わらない場合も中断される
+func TestInterrupt(t *testing.T) {
+	forEachEngine(t, nil, func(name string, e Engine, runtime *object.Runtime) {
+		if got := describe(run(e, "1 + 1")); got != "2" {
+			t.Fatalf("[%s] wrong result before interrupt. got=%q", name, got)
+		}
+
+		runtime.Interrupt()
+		for _, input := range []string{
+			"while (true) {}",
+			"for (x in [1, 2]) { x }",
+			"let f = fn() { f() }; f()",
+			"let g = fn(n) { 1 + g(n) }; g(0)",
+		} {
+			if got := describe(run(e, input)); got != "interrupted" {
+				t.Errorf("[%s] wrong result for %q. want=%q, got=%q", name, input, "interrupted", got)
+			}
+		}
+	})
+}
+
+func TestFileSystem(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	other := filepath.Join(dir, "other")
+	for _, d := range []string{filepath.Join(root, "data"), other} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(root, "data", "a.txt"): "alpha",
+		filepath.Join(root, "data", "b.csv"): "1,2",
+		filepath.Join(other, "secret.txt"):   "secret",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"link":     other,
+		"dangling": filepath.Join(other, "created.txt"),
+		"relative": filepath.Join("..", "other", "missing", "created.txt"),
+		"inside":   filepath.Join("data", "linked.txt"),
+		"loop":     "loop",
+		"missing":  filepath.Join(other, "missing"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fs.read_file("data/a.txt")`, "alpha"},
+		{`fs.write_file("out/result.json", json.stringify({"ok": true}))`, "fs.write_file: out/result.json: no such file or directory"},
+		{`fs.mkdir("out/nested"); fs.write_file("out/nested/r.txt", "done"); fs.read_file("out/nested/r.txt")`, "done"},
+		{`fs.list_dir("data")`, `["a.txt", "b.csv"]`},
+		{`[fs.exists("data/a.txt"), fs.exists("data/none.txt"), fs.exists("data/../data")]`, "[true, false, true]"},
+		{`fs.glob("data/*.txt")`, `["data/a.txt"]`},
+		{`fs.glob("*/*.txt")`, `["data/a.txt"]`},
+		{`fs.read_file("../other/secret.txt")`, "fs.read_file: path outside allowed directories: ../other/secret.txt"},
+		{`fs.read_file("data/../../other/secret.txt")`, "fs.read_file: path outside allowed directories: data/../../other/secret.txt"},
+		{`fs.read_file("link/secret.txt")`, "fs.read_file: path outside allowed directories: link/secret.txt"},
+		{`fs.write_file("link/new.txt", "x")`, "fs.write_file: path outside allowed directories: link/new.txt"},
+		{`fs.exists("` + filepath.Join(other, "secret.txt") + `")`, "fs.exists: path outside allowed directories: " + filepath.Join(other, "secret.txt")},
+		{`fs.glob("../other/*")`, "fs.glob: path outside allowed directories: ../other/*"},
+		{`fs.list_dir("link")`, "fs.list_dir: path outside allowed directories: link"},
+		{`fs.read_file("data/none.txt")`, "fs.read_file: data/none.txt: no such file or directory"},
+		{`fs.write_file("dangling", "x")`, "fs.write_file: path outside allowed directories: dangling"},
+		{`fs.write_file("relative", "x")`, "fs.write_file: path outside allowed directories: relative"},
+		{`fs.write_file("missing/new.txt", "x")`, "fs.write_file: path outside allowed directories: missing/new.txt"},
+		{`fs.mkdir("missing/sub")`, "fs.mkdir: path outside allowed directories: missing/sub"},
+		{`fs.write_file("loop", "x")`, "fs.write_file: path outside allowed directories: loop"},
+		{`fs.write_file("inside", "linked"); fs.read_file("data/linked.txt")`, "linked"},
+	}
+
+	configure := func(runtime *object.Runtime) {
+		runtime.FSRoots = []string{root}
+	}
+	forEachEngine(t, configure, func(name string, e Engine, runtime *object.Runtime) {
+		for _, created := range []string{filepath.Join(root, "out"), filepath.Join(root, "data", "linked.txt")} {
+			if err := os.RemoveAll(created); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, tt := range tests {
+			if got := describe(run(e, tt.input)); got != tt.expected {
+				t.Errorf("[%s] wrong result for %q. want=%q, got=%q", name, tt.input, tt.expected, got)
+			}
+		}
+		for _, outside := range []string{filepath.Join(other, "created.txt"), filepath.Join(other, "missing")} {
+			if _, err := os.Lstat(outside); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("[%s] %s should not be created. err=%v", name, outside, err)
+			}
+		}
+	})
+
+	testDisabled(t, `fs.exists("data/a.txt")`, "fs.exists: file system access is disabled")
+}
+
+// forEachEngine 各エンジンを、configure で設定した Runtime で生成して f を呼び出す
+// configure が nil の場合は既定の Runtime を使う
+func forEachEngine(t *testing.T, configure func(runtime *object.Runtime), f func(name string, e Engine, runtime *object.Runtime)) {
+	t.Helper()
+	for _, name := range []string{EVAL, VM} {
+		runtime := object.NewRuntime()
+		if configure != nil {
+			configure(runtime)
+		}
+		e, err := NewWithOptions(name, Options{Runtime: runtime})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f(name, e, runtime)
+	}
+}
+
+// testDisabled 許可しなければ使えない機能を、既定の設定の各エンジンで実行すると expected のエラーになることを確認する
+func testDisabled(t *testing.T, input, expected string) {
+	t.Helper()
+	for _, name := range []string{EVAL, VM} {
+		e, err := New(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := describe(run(e, input)); got != expected {
+			t.Errorf("[%s] %q should be disabled by default. want=%q, got=%q", name, input, expected, got)
+		}
+	}
+}
+
+func run(e Engine, input string) object.Object {
+	return e.Run(parser.New(lexer.New(input)).ParseProgram())
+}
+
+// describe 評価結果を文字列にする。エラーはメッセージにする
+func describe(obj object.Object) string {
+	switch obj := obj.(type) {
+	case nil:
+		return "nil"
+	case *object.Error:
+		return obj.Message
+	}
+	return obj.Inspect()
+}
+
+func TestHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/echo":
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Add("X-Multi", "a")
+			w.Header().Add("X-Multi", "b")
+			fmt.Fprintf(w, `{"method": %q, "type": %q, "token": %q, "body": %q}`,
+				r.Method, r.Header.Get("Content-Type"), r.Header.Get("X-Token"), body)
+		case "/missing":
+			http.Error(w, "not here", http.StatusNotFound)
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let res = http.get(base + "/echo", {"headers": {"X-Token": "t1"}}); [res["status"], res["ok"], json.parse(res["body"])]`,
+			`[200, true, {"method": "GET", "type": "", "token": "t1", "body": ""}]`},
+		{`http.get(base + "/echo")["headers"]["x-multi"]`, "a, b"},
+		{`json.parse(http.post(base + "/echo", {"id": 1, "tags": ["a"]})["body"])`,
+			`{"method": "POST", "type": "application/json", "token": "", "body": "{\"id\":1,\"tags\":[\"a\"]}"}`},
+		{`json.parse(http.post(base + "/echo", "a=1", {"headers": {"Content-Type": "text/plain"}})["body"])`,
+			`{"method": "POST", "type": "text/plain", "token": "", "body": "a=1"}`},
+		{`json.parse(http.request("put", base + "/echo", {"json": [true]})["body"])`,
+			`{"method": "PUT", "type": "application/json", "token": "", "body": "[true]"}`},
+		{`let res = http.get(base + "/missing"); [res["status"], res["ok"], res["body"]]`, `[404, false, "not here\n"]`},
+		{`http.get(base + "/slow", {"timeout": time.duration("50ms")})`, "http.get: request timed out after 50ms: " + server.URL + "/slow"},
+		{`http.get(base + "/slow", {"timeout": 0})`, "http.get: timeout must be positive: 0"},
+		{`http.get(base, {"retries": 3})`, "http.get: unknown option: retries"},
+		{`http.get(base, {"headers": {"X-Id": 1}})`, "http.get: headers must map STRING to STRING, got STRING: INTEGER"},
+		{`http.post(base, [fn() {}])`, "http.post: unsupported value: FUNCTION"},
+		{`http.get("://bad")`, `http.get: invalid request: parse "://bad": missing protocol scheme`},
+	}
+
+	configure := func(runtime *object.Runtime) {
+		runtime.HTTPTransport = server.Client().Transport
+	}
+	forEachEngine(t, configure, func(name string, e Engine, runtime *object.Runtime) {
+		run(e, fmt.Sprintf("let base = %q", server.URL))
+		for _, tt := range tests {
+			if got := describe(run(e, tt.input)); got != tt.expected {
+				t.Errorf("[%s] wrong result for %q. want=%q, got=%q", name, tt.input, tt.expected, got)
+			}
+		}
+	})
+
+	testDisabled(t, fmt.Sprintf("http.get(%q)", server.URL), "http.get: network access is disabled")
+}
+
+func TestOS(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`os.args()`, `["in.csv", "-v"]`},
+		{`[os.getenv("HOME"), os.getenv("EDITOR"), os.getenv("EDITOR", "vi")]`, `["/home/maron", null, "vi"]`},
+		{`os.setenv("EDITOR", "nano"); os.getenv("EDITOR")`, "nano"},
+		{`os.environ()`, `{"EDITOR": "nano", "HOME": "/home/maron"}`},
+		{`os.setenv("EDITOR", find([], |x| x)); os.environ()`, `{"HOME": "/home/maron"}`},
+		{`os.setenv("A=B", "x")`, `os.setenv: invalid name: "A=B"`},
+		{`[os.read_line(), os.read_line()]`, `["first", "second"]`},
+		{`os.read_lines()`, `["third", "last"]`},
+		{`os.read_line()`, "null"},
+		{`os.exec("sh", ["-c", "echo $HOME; echo oops >&2; exit 3"])`, `{"status": 3, "stdout": "/home/maron\n", "stderr": "oops\n"}`},
+		{`os.exec("tr", ["a-z", "A-Z"], {"stdin": "hi"})["stdout"]`, "HI"},
+		{`os.exec("pwd", [], {"dir": "/"})["stdout"]`, "/\n"},
+		{`os.exec("sh", [1])`, "os.exec: argument 0 must be STRING, got INTEGER"},
+		{`os.exec("sh", [], {"shell": true})`, "os.exec: unknown option: shell"},
+		{`os.exit(256)`, "os.exit: exit code out of range: 256"},
+		{`os.exit(2); "unreachable"`, "exit 2"},
+	}
+
+	configure := func(runtime *object.Runtime) {
+		runtime.OS = &object.OSAccess{
+			Args:      []string{"in.csv", "-v"},
+			Env:       map[string]string{"HOME": "/home/maron"},
+			Stdin:     strings.NewReader("first\r\nsecond\nthird\nlast"),
+			Exit:      func(code int) { panic(fmt.Sprintf("exit %d", code)) },
+			AllowExec: true,
+		}
+	}
+	forEachEngine(t, configure, func(name string, e Engine, runtime *object.Runtime) {
+		for _, tt := range tests {
+			if got := runUntilExit(e, tt.input); got != tt.expected {
+				t.Errorf("[%s] wrong result for %q. want=%q, got=%q", name, tt.input, tt.expected, got)
+			}
+		}
+
+		// サブプロセスの実行は別に許可しなければ使えない
+		runtime.OS.AllowExec = false
+		if got := describe(run(e, `os.exec("true")`)); got != "os.exec: subprocess execution is disabled" {
+			t.Errorf("[%s] exec should be disabled. got=%q", name, got)
+		}
+	})
+
+	testDisabled(t, `os.getenv("HOME")`, "os.getenv: os access is disabled")
+}
+
+// runUntilExit プログラムを実行する。os.exit が呼ばれた場合は終了コードを戻す
+func runUntilExit(e Engine, input string) (result string) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = fmt.Sprint(r)
+		}
+	}()
+	return describe(run(e, input))
+}
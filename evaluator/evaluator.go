@@ -1,56 +1,1122 @@
 package evaluator
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/Sa2Knight/maron/ast"
 	"github.com/Sa2Knight/maron/object"
+	"github.com/Sa2Knight/maron/stdlib"
 )
 
 var (
 	// NULL ネイティブオブジェクト
-	NULL = &object.Null{}
+	NULL = object.NullObject
 
 	// TRUE ネイティブオブジェクト
-	TRUE = &object.Boolean{Value: true}
+	TRUE = object.TrueObject
 
 	// FALSE ネイティブオブジェクト
-	FALSE = &object.Boolean{Value: false}
+	FALSE = object.FalseObject
 )
 
 // Eval is evaluate ast.node
-func Eval(node ast.Node) object.Object {
+func Eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 
 	// ルートノードの場合、ステートメントを巡回して評価する
 	case *ast.Program:
-		return evalStatements(node.Statements)
+		return evalProgram(node, env)
 
 	// 式ステートメントの場合、式本体を評価する
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression)
+		return Eval(node.Expression, env)
+
+	// ブロックの場合、ステートメントを巡回して評価する
+	case *ast.BlockStatement:
+		return evalBlockStatement(node, env)
+
+	// let文、const文の場合、式を評価して環境に束縛する
+	case *ast.LetStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		if err := bindPattern(env, node.Name, val, node.IsConst()); err != nil {
+			return err
+		}
+
+	// return文の場合、式を評価して戻り値としてラップする
+	case *ast.ReturnStatement:
+		val := Eval(node.ReturnValue, env)
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
+
+	case *ast.ExportStatement:
+		return Eval(node.Statement, env)
+
+	// break文、continue文の場合、繰り返し文まで伝播させる
+	case *ast.BreakStatement:
+		return breakControl
+
+	case *ast.ContinueStatement:
+		return continueControl
+
+	// 識別子の場合、環境から値を取り出す
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
 
 	// 数値リテラル、真偽値リテラルの場合、そのまま数値として評価する
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
 	case *ast.Boolean:
-		return &object.Boolean{Value: node.Value}
+		return nativeBoolToBooleanObject(node.Value)
+
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+
+	// 配列リテラルの場合、要素を先頭から順に評価する
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+
+	// ハッシュリテラルの場合、キー、値の順に記述した順に評価する
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
+
+	// 前置式の場合、右辺を評価してから演算子を適用する
+	case *ast.PrefixExpression:
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return evalPrefixExpression(node.Operator, right)
+
+	// 中置式の場合、左辺、右辺の順に評価してから演算子を適用する
+	case *ast.InfixExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return evalInfixExpression(node.Operator, left, right)
+
+	case *ast.IfExpression:
+		return evalIfExpression(node, env)
+
+	case *ast.MatchExpression:
+		arm, armEnv, err := selectMatchArm(node, env)
+		if arm == nil {
+			return err
+		}
+		return Eval(arm.Body, armEnv)
+
+	// 添字式の場合、オブジェクト、添字の順に評価してから要素を取り出す
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+
+	// プロパティ式の場合、プロパティ名の文字列を添字として要素を取り出す
+	case *ast.PropertyExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		return evalIndexExpression(left, &object.String{Value: node.Property.Value})
+
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
+
+	// 関数リテラルの場合、定義された時点の環境を閉じ込めた関数オブジェクトを生成する
+	case *ast.FunctionLiteral:
+		return &object.Function{Name: node.Name, Parameters: node.Parameters, Rest: node.Rest, Body: node.Body, Env: env}
+
+	// パイプラインの場合、同じ意味の呼び出し式として評価する
+	case *ast.PipeExpression:
+		return Eval(node.Call(), env)
+
+	// 関数呼び出しの場合、関数、引数の順に評価してから関数を適用する
+	case *ast.CallExpression:
+		function := Eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+		args, named, err := evalArguments(node.Arguments, env)
+		if err != nil {
+			return err
+		}
+		return applyFunction(env, function, args, named)
+	}
+
+	return nil
+}
+
+// evalProgram プログラムを評価する
+// return文があればその時点で評価を終了し、戻り値をアンラップして戻す
+func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+	for _, statement := range program.Statements {
+		result = Eval(statement, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		}
+	}
+
+	return result
+}
+
+// evalBlockStatement ブロックを評価する
+// return文やエラー、break文、continue文はアンラップせずに外側へ伝播させる
+// 最後の文が値を持たない場合(空のブロックやlet文)はNULLを戻す
+func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+	for _, statement := range block.Statements {
+		result = Eval(statement, env)
+
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE || rt == object.ERROR || rt == loopControlType {
+				return result
+			}
+		}
+	}
+
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// loopControlType break文、continue文のオブジェクト種別(評価器の内部でのみ使用する)
+const loopControlType = "LOOP_CONTROL"
+
+// loopControl break文、continue文による繰り返しの中断
+type loopControl struct {
+	keyword string
+}
+
+func (lc *loopControl) Inspect() string         { return lc.keyword }
+func (lc *loopControl) Type() object.ObjectType { return loopControlType }
+
+var (
+	// breakControl break文の評価結果
+	breakControl = &loopControl{keyword: "break"}
+
+	// continueControl continue文の評価結果
+	continueControl = &loopControl{keyword: "continue"}
+)
+
+// evalWhileStatement 条件が真の間ブロックを繰り返し評価する
+// 繰り返し文は値を持たないのでNULLを戻す
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		if err := checkInterrupted(env); err != nil {
+			return err
+		}
+		condition := Eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		if result, done := evalLoopBody(ws.Body, env); done {
+			return result
+		}
+	}
+}
+
+// evalForStatement 要素ごとに変数へ束縛してブロックを評価する
+// 変数とブロックで定義した識別子は、繰り返しごとに生成する環境に束縛し、外側の同名の識別子を隠す
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := Eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+	it, ok := iterable.(object.Iterable)
+	if !ok {
+		return newError("not iterable: %s", iterable.Type())
+	}
+
+	// 繰り返しごとに環境を生成し、クロージャがその回の変数とブロックの識別子を捕捉するようにする
+	for _, element := range it.Iterate() {
+		if err := checkInterrupted(env); err != nil {
+			return err
+		}
+		iterEnv := object.NewEnclosedEnvironment(env)
+		if err := bind(iterEnv, fs.Variable.Value, element, false); err != nil {
+			return err
+		}
+		if result, done := evalLoopBody(fs.Body, iterEnv); done {
+			return result
+		}
+	}
+	return NULL
+}
+
+// checkInterrupted 実行の中断を要求されていればエラーを戻す
+// 終わらないプログラムも中断できるよう、繰り返しと関数呼び出しのたびに確かめる
+func checkInterrupted(env *object.Environment) *object.Error {
+	if env.Runtime().Interrupted() {
+		return newError("%s", object.ErrInterrupted)
+	}
+	return nil
+}
+
+// evalLoopBody 繰り返し文のブロックを一周分評価する
+// 繰り返しを終える場合は done がtrueになり、result を繰り返し文の評価結果とする
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (result object.Object, done bool) {
+	switch result := Eval(body, env); result {
+	case breakControl:
+		return NULL, true
+	case continueControl:
+		return nil, false
+	default:
+		if result != nil && (result.Type() == object.RETURN_VALUE || result.Type() == object.ERROR) {
+			return result, true
+		}
+		return nil, false
+	}
+}
+
+func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+	for _, e := range exps {
+		evaluated := Eval(e, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+// evalArguments 実引数を先頭から順に評価する
+// ...xs は配列の要素を位置引数として展開し、名前付き引数はハッシュにまとめる(名前付き引数がなければnil)
+func evalArguments(exps []ast.Expression, env *object.Environment) ([]object.Object, *object.Hash, object.Object) {
+	args := []object.Object{}
+	var named *object.Hash
+
+	for _, e := range exps {
+		switch e := e.(type) {
+		case *ast.SpreadElement:
+			evaluated := Eval(e.Value, env)
+			if isError(evaluated) {
+				return nil, nil, evaluated
+			}
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				return nil, nil, newError("cannot spread %s", evaluated.Type())
+			}
+			args = append(args, array.Elements...)
+
+		case *ast.NamedArgument:
+			evaluated := Eval(e.Value, env)
+			if isError(evaluated) {
+				return nil, nil, evaluated
+			}
+			if named == nil {
+				named = object.NewHash()
+			}
+			named.Set(&object.String{Value: e.Name.Value}, evaluated)
+
+		default:
+			evaluated := Eval(e, env)
+			if isError(evaluated) {
+				return nil, nil, evaluated
+			}
+			args = append(args, evaluated)
+		}
+	}
+
+	return args, named, nil
+}
+
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+	// 定義されていなければ組み込みの識別子を探す
+	if val, ok := stdlib.Lookup(node.Value); ok {
+		return val
+	}
+	return newError("identifier not found: %s", node.Value)
+}
+
+func evalPrefixExpression(operator string, right object.Object) object.Object {
+	switch operator {
+	case "!":
+		return nativeBoolToBooleanObject(!isTruthy(right))
+	case "-":
+		switch right := right.(type) {
+		case *object.Integer:
+			return &object.Integer{Value: -right.Value}
+		case *object.Float:
+			return &object.Float{Value: -right.Value}
+		}
+		return newError("unknown operator: -%s", right.Type())
+	default:
+		return newError("unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+func evalInfixExpression(operator string, left, right object.Object) object.Object {
+	switch {
+	case left.Type() == object.INTEGER && right.Type() == object.INTEGER:
+		return evalIntegerInfixExpression(operator, left.(*object.Integer), right.(*object.Integer))
+	// 浮動小数点数を含む数値同士は、浮動小数点数で計算する
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
+	case left.Type() == object.STRING && right.Type() == object.STRING:
+		return evalStringInfixExpression(operator, left.(*object.String), right.(*object.String))
+	// 時刻などの大小を比較できるオブジェクト同士
+	case isComparable(left, right):
+		return evalComparableInfixExpression(operator, left, right)
+	// 数値と文字列以外はネイティブオブジェクトを使い回しているので、ポインタの比較で一致を判定できる
+	case operator == "==":
+		return nativeBoolToBooleanObject(left == right)
+	case operator == "!=":
+		return nativeBoolToBooleanObject(left != right)
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isComparable(left, right object.Object) bool {
+	_, ok := object.Compare(left, right)
+	return ok
+}
+
+func evalComparableInfixExpression(operator string, left, right object.Object) object.Object {
+	result, _ := object.Compare(left, right)
+
+	switch operator {
+	case "<":
+		return nativeBoolToBooleanObject(result < 0)
+	case ">":
+		return nativeBoolToBooleanObject(result > 0)
+	case "==":
+		return nativeBoolToBooleanObject(result == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(result != 0)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalIntegerInfixExpression(operator string, left, right *object.Integer) object.Object {
+	leftVal, rightVal := left.Value, right.Value
+
+	switch operator {
+	case "+":
+		return &object.Integer{Value: leftVal + rightVal}
+	case "-":
+		return &object.Integer{Value: leftVal - rightVal}
+	case "*":
+		return &object.Integer{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Integer{Value: leftVal / rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal, _ := object.ToFloat(left)
+	rightVal, _ := object.ToFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Float{Value: leftVal / rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalStringInfixExpression 文字列の連結と比較(バイト列の辞書順)
+func evalStringInfixExpression(operator string, left, right *object.String) object.Object {
+	leftVal, rightVal := left.Value, right.Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	_, ok := object.ToFloat(obj)
+	return ok
+}
+
+func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := Eval(ie.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+
+	if isTruthy(condition) {
+		return Eval(ie.Consequence, env)
+	} else if ie.Alternative != nil {
+		return Eval(ie.Alternative, env)
+	}
+	return NULL
+}
+
+// bind 識別子に値を束縛する
+// 同じ環境で定数として束縛されている識別子は束縛し直せない
+func bind(env *object.Environment, name string, val object.Object, isConst bool) *object.Error {
+	if env.IsConst(name) {
+		return newError("%s: %s", object.ErrConstant, name)
+	}
+	if isConst {
+		env.SetConst(name, val)
+	} else {
+		env.Set(name, val)
+	}
+	return nil
+}
+
+// evalAssignExpression 代入式を評価し、代入した値を戻す
+// 複合代入(+= など)は、代入先の現在の値、右辺の順に評価してから演算子を適用する
+func evalAssignExpression(ae *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := ae.Target.(type) {
+	case *ast.Identifier:
+		var current object.Object
+		if ae.Operator != "=" {
+			if current = evalIdentifier(target, env); isError(current) {
+				return current
+			}
+		}
+		val := evalAssignedValue(ae, current, env)
+		if isError(val) {
+			return val
+		}
+		if err := env.Assign(target.Value, val); err != nil {
+			return newError("%s: %s", err, target.Value)
+		}
+		return val
+
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexAssignment(ae, left, index, env)
+
+	case *ast.PropertyExpression:
+		left := Eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+		return evalIndexAssignment(ae, left, &object.String{Value: target.Property.Value}, env)
+	}
+
+	return newError("invalid assignment target: %s", ae.Target)
+}
+
+func evalIndexAssignment(ae *ast.AssignExpression, left, index object.Object, env *object.Environment) object.Object {
+	var current object.Object
+	if ae.Operator != "=" {
+		if current = evalIndexExpression(left, index); isError(current) {
+			return current
+		}
+	}
+	val := evalAssignedValue(ae, current, env)
+	if isError(val) {
+		return val
+	}
+	if err := evalSetIndex(left, index, val); err != nil {
+		return err
+	}
+	return val
+}
+
+// evalAssignedValue 代入する値を評価する
+// 複合代入の場合は、代入先の現在の値 current に右辺を演算した結果を戻す
+func evalAssignedValue(ae *ast.AssignExpression, current object.Object, env *object.Environment) object.Object {
+	val := Eval(ae.Value, env)
+	if isError(val) || ae.Operator == "=" {
+		return val
+	}
+	return evalInfixExpression(strings.TrimSuffix(ae.Operator, "="), current, val)
+}
+
+// evalHashLiteral ハッシュリテラルを評価する
+// VMと同じく、全てのキーと値を評価してから、キーとして使用できるか検査する
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	pairs := []object.HashPair{}
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if isError(key) {
+			return key
+		}
+		val := Eval(pair.Value, env)
+		if isError(val) {
+			return val
+		}
+		pairs = append(pairs, object.HashPair{Key: key, Value: val})
+	}
+
+	hash := object.NewHash()
+	for _, pair := range pairs {
+		key, ok := pair.Key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", pair.Key.Type())
+		}
+		hash.Set(key, pair.Value)
+	}
+	return hash
+}
+
+// evalIndexExpression 配列、ハッシュから要素を取り出す
+// 範囲外の添字や存在しないキーの場合は NULL を戻す
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be INTEGER: %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return NULL
+		}
+		return left.Elements[i.Value]
+
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		if val, ok := left.Get(key); ok {
+			return val
+		}
+		return NULL
+
+	case *object.Module:
+		val, err := left.Member(index)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return val
+	}
+
+	return newError("index operator not supported: %s", left.Type())
+}
+
+// evalImportStatement モジュールを読み込んで識別子に束縛する
+// モジュールは新しい環境で評価し、export文で定義された識別子の評価後の値を公開する
+func evalImportStatement(is *ast.ImportStatement, env *object.Environment) object.Object {
+	loader := env.Loader()
+	if loader == nil {
+		return newError("cannot import %q: modules are not available", is.Path.Value)
+	}
+
+	mod, err := loader.Import(is.Path.Value, func(name string, program *ast.Program) (object.Object, error) {
+		modEnv := object.NewEnvironment()
+		modEnv.SetLoader(loader)
+		modEnv.SetRuntime(env.Runtime())
+		if result := Eval(program, modEnv); isError(result) {
+			return nil, errors.New(result.(*object.Error).Message)
+		}
+
+		exports := map[string]object.Object{}
+		for _, stmt := range program.Statements {
+			if export, ok := stmt.(*ast.ExportStatement); ok {
+				for _, ident := range export.Names() {
+					exports[ident.Value], _ = modEnv.Get(ident.Value)
+				}
+			}
+		}
+		return &object.Module{Name: name, Exports: exports}, nil
+	})
+	if err != nil {
+		return newError("%s", err)
 	}
 
+	if err := bindPattern(env, is.Name, mod, false); err != nil {
+		return err
+	}
 	return nil
 }
 
-func evalStatements(stmts []ast.Statement) object.Object {
+// evalSetIndex 配列、ハッシュの要素を書き換える
+// 配列の範囲外への代入はエラーとし、ハッシュは存在しないキーを追加する
+func evalSetIndex(left, index, val object.Object) *object.Error {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be INTEGER: %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return newError("index out of range: %d", i.Value)
+		}
+		left.Elements[i.Value] = val
+		return nil
+
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		left.Set(key, val)
+		return nil
+	}
+
+	return newError("index assignment not supported: %s", left.Type())
+}
+
+// bindParameters 引数の並びに対応付けた値(省略された引数はnil)を環境に束縛する
+// 値を渡された識別子の引数と残りの引数を束縛してから、既定値を使う引数と分割代入する引数を先頭から順に束縛する
+func bindParameters(env *object.Environment, fn *object.Function, values, rest []object.Object) *object.Error {
+	for i, param := range fn.Parameters {
+		if ident, ok := param.Target.(*ast.Identifier); ok && values[i] != nil {
+			env.Set(ident.Value, values[i])
+		}
+	}
+	if fn.Rest != nil {
+		env.Set(fn.Rest.Value, &object.Array{Elements: rest})
+	}
+
+	for i, param := range fn.Parameters {
+		val := values[i]
+		if _, ok := param.Target.(*ast.Identifier); ok && val != nil {
+			continue
+		}
+		if val == nil {
+			if val = Eval(param.Default, env); isError(val) {
+				return val.(*object.Error)
+			}
+		}
+		if err := bindPattern(env, param.Target, val, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindPattern 値をパターンに従って分解し、環境に束縛する
+// 要素の既定値は、それより前の要素を束縛した後に評価する
+func bindPattern(env *object.Environment, pattern ast.Pattern, val object.Object, isConst bool) *object.Error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		return bind(env, pattern.Value, val, isConst)
+
+	case *ast.ArrayPattern:
+		array, ok := val.(*object.Array)
+		if !ok {
+			return newError("cannot destructure %s as array", val.Type())
+		}
+		if pattern.Rest == nil && len(array.Elements) > len(pattern.Elements) {
+			return newError("too many elements to destructure: want=%d, got=%d", len(pattern.Elements), len(array.Elements))
+		}
+
+		for i, el := range pattern.Elements {
+			var element object.Object
+			if i < len(array.Elements) {
+				element = array.Elements[i]
+			}
+			if err := bindPatternElement(env, el, element, fmt.Sprintf("element %d in array pattern", i), isConst); err != nil {
+				return err
+			}
+		}
+
+		if pattern.Rest != nil {
+			rest := []object.Object{}
+			if len(array.Elements) > len(pattern.Elements) {
+				rest = append(rest, array.Elements[len(pattern.Elements):]...)
+			}
+			return bind(env, pattern.Rest.Value, &object.Array{Elements: rest}, isConst)
+		}
+		return nil
+
+	case *ast.HashPattern:
+		hash, ok := val.(*object.Hash)
+		if !ok {
+			return newError("cannot destructure %s as hash", val.Type())
+		}
+
+		for _, el := range pattern.Elements {
+			element, _ := hash.Get(&object.String{Value: el.Key.Value})
+			if err := bindPatternElement(env, el, element, fmt.Sprintf("key %s in hash pattern", el.Key.Value), isConst); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return newError("invalid binding target: %s", pattern)
+}
+
+// selectMatchArm match式の値を評価し、上から順に照合して最初に一致した腕と、腕の本体を評価する環境を戻す
+// パターンの識別子は腕ごとに生成する環境に束縛するので、ガード式と本体の外からは参照できない
+// 一致する腕がない場合やエラーの場合は、腕の代わりにエラーを戻す
+func selectMatchArm(me *ast.MatchExpression, env *object.Environment) (*ast.MatchArm, *object.Environment, object.Object) {
+	subject := Eval(me.Subject, env)
+	if isError(subject) {
+		return nil, nil, subject
+	}
+
+	for _, arm := range me.Arms {
+		armEnv := object.NewEnclosedEnvironment(env)
+		matched, err := matchPattern(armEnv, arm.Pattern, subject)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !matched {
+			continue
+		}
+
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armEnv)
+			if isError(guard) {
+				return nil, nil, guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+		return arm, armEnv, nil
+	}
+
+	return nil, nil, newError("no match for %s", subject.Inspect())
+}
+
+// matchPattern 値がパターンに一致するかを調べ、パターン中の識別子に束縛する
+// 束縛は照合しながら順に行うので、途中で一致しなくなった場合もそれまでの束縛は残る
+func matchPattern(env *object.Environment, pattern ast.Pattern, val object.Object) (bool, *object.Error) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value == ast.WILDCARD {
+			return true, nil
+		}
+		return true, bind(env, pattern.Value, val, false)
+
+	case *ast.IntegerLiteral:
+		integer, ok := val.(*object.Integer)
+		return ok && integer.Value == pattern.Value, nil
+
+	case *ast.StringLiteral:
+		str, ok := val.(*object.String)
+		return ok && str.Value == pattern.Value, nil
+
+	case *ast.Boolean:
+		return val == nativeBoolToBooleanObject(pattern.Value), nil
+
+	case *ast.ArrayPattern:
+		array, ok := val.(*object.Array)
+		if !ok || len(array.Elements) < len(pattern.Elements) {
+			return false, nil
+		}
+		if pattern.Rest == nil && len(array.Elements) != len(pattern.Elements) {
+			return false, nil
+		}
+
+		for i, el := range pattern.Elements {
+			if matched, err := matchPattern(env, el.Target, array.Elements[i]); !matched || err != nil {
+				return false, err
+			}
+		}
+
+		if pattern.Rest != nil {
+			rest := []object.Object{}
+			rest = append(rest, array.Elements[len(pattern.Elements):]...)
+			return matchPattern(env, pattern.Rest, &object.Array{Elements: rest})
+		}
+		return true, nil
+
+	case *ast.HashPattern:
+		hash, ok := val.(*object.Hash)
+		if !ok {
+			return false, nil
+		}
+
+		for _, el := range pattern.Elements {
+			element, ok := hash.Get(&object.String{Value: el.Key.Value})
+			if !ok {
+				return false, nil
+			}
+			if matched, err := matchPattern(env, el.Target, element); !matched || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	return false, newError("invalid match pattern: %s", pattern)
+}
+
+// bindPatternElement パターンの要素を束縛する
+// 対応する値がない(nil)場合は既定値を使用し、既定値もなければエラーとする
+func bindPatternElement(env *object.Environment, el *ast.PatternElement, val object.Object, desc string, isConst bool) *object.Error {
+	if val == nil {
+		if el.Default == nil {
+			return newError("missing %s", desc)
+		}
+		val = Eval(el.Default, env)
+		if err, ok := val.(*object.Error); ok {
+			return err
+		}
+	}
+	return bindPattern(env, el.Target, val, isConst)
+}
+
+// applyFunction 関数を適用する
+// 末尾呼び出しは呼び出し元に戻ってから繰り返し適用するので、再帰の深さに関わらずGoのスタックを消費しない
+// それ以外の呼び出しの深さは object.MaxCallDepth までとし、超えた場合は "stack overflow" のエラーにする
+// env は呼び出し元の環境で、呼び出しの深さを数えることと、組み込み関数に実行環境の設定を渡すために使う
+func applyFunction(env *object.Environment, fn object.Object, args []object.Object, named *object.Hash) object.Object {
+	for {
+		if builtin, ok := fn.(*object.Builtin); ok {
+			return applyBuiltin(env, builtin, args, named)
+		}
+
+		function, ok := fn.(*object.Function)
+		if !ok {
+			return newError("not a function: %s", fn.Type())
+		}
+
+		params := object.ParametersOf(function.Parameters)
+		values, rest, err := object.ArrangeArguments(function.Name, params, function.Rest != nil, args, named)
+		if err != nil {
+			return newError("%s", err)
+		}
+
+		if err := checkInterrupted(env); err != nil {
+			return err
+		}
+		callEnv, callErr := object.NewCallEnvironment(function.Env, env)
+		if callErr != nil {
+			return newError("%s", callErr)
+		}
+		if err := bindParameters(callEnv, function, values, rest); err != nil {
+			return err
+		}
+
+		evaluated := evalTailBlock(function.Body, callEnv)
+		if call, ok := evaluated.(*tailCall); ok {
+			fn, args, named = call.function, call.args, call.named
+			continue
+		}
+		if returnValue, ok := evaluated.(*object.ReturnValue); ok {
+			return returnValue.Value
+		}
+		return evaluated
+	}
+}
+
+// applyBuiltin 組み込み関数を適用する。組み込み関数は名前付き引数を受け取らない
+func applyBuiltin(env *object.Environment, builtin *object.Builtin, args []object.Object, named *object.Hash) object.Object {
+	if named != nil {
+		return newError("%s does not accept named arguments", builtin.Name)
+	}
+	return builtin.Fn(&builtinContext{env: env}, args...)
+}
+
+// builtinContext 評価器から呼び出した組み込み関数に提供する機能
+type builtinContext struct {
+	env *object.Environment
+}
+
+// Runtime is object.Context's method.
+func (c *builtinContext) Runtime() *object.Runtime { return c.env.Runtime() }
+
+// Call is object.Context's method.
+func (c *builtinContext) Call(fn object.Object, args ...object.Object) object.Object {
+	return applyFunction(c.env, fn, args, nil)
+}
+
+// tailCallType 末尾呼び出しのオブジェクト種別(評価器の内部でのみ使用する)
+const tailCallType = "TAIL_CALL"
+
+// tailCall 末尾位置の関数呼び出し
+// 関数と引数を評価した時点で評価を中断し、applyFunction で適用する
+type tailCall struct {
+	function object.Object
+	args     []object.Object
+	named    *object.Hash
+}
+
+func (tc *tailCall) Inspect() string         { return "tail call" }
+func (tc *tailCall) Type() object.ObjectType { return tailCallType }
+
+// evalTailBlock 末尾位置にあるブロック(関数本体など)を評価する
+// 最後の式文とreturn文の式は末尾位置として評価する
+func evalTailBlock(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
-	for _, statement := range stmts {
-		result = Eval(statement)
+	for i, statement := range block.Statements {
+		switch statement := statement.(type) {
+		case *ast.ReturnStatement:
+			result = evalTailExpression(statement.ReturnValue, env)
+			if result != nil && result.Type() != object.ERROR && result.Type() != tailCallType {
+				result = &object.ReturnValue{Value: result}
+			}
+		case *ast.ExpressionStatement:
+			if i == len(block.Statements)-1 {
+				result = evalTailExpression(statement.Expression, env)
+			} else {
+				result = Eval(statement, env)
+			}
+		default:
+			result = Eval(statement, env)
+		}
+
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE || rt == object.ERROR || rt == tailCallType {
+				return result
+			}
+		}
 	}
 
+	if result == nil {
+		return NULL
+	}
 	return result
 }
 
+// evalTailExpression 末尾位置の式を評価する
+// 関数呼び出しは適用せずに tailCall を戻し、if式とmatch式はそれぞれの分岐を末尾位置として評価する
+func evalTailExpression(exp ast.Expression, env *object.Environment) object.Object {
+	switch exp := exp.(type) {
+	case *ast.CallExpression:
+		function := Eval(exp.Function, env)
+		if isError(function) {
+			return function
+		}
+		args, named, err := evalArguments(exp.Arguments, env)
+		if err != nil {
+			return err
+		}
+		return &tailCall{function: function, args: args, named: named}
+
+	case *ast.PipeExpression:
+		return evalTailExpression(exp.Call(), env)
+
+	case *ast.IfExpression:
+		condition := Eval(exp.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+
+		if isTruthy(condition) {
+			return evalTailBlock(exp.Consequence, env)
+		} else if exp.Alternative != nil {
+			return evalTailBlock(exp.Alternative, env)
+		}
+		return NULL
+
+	case *ast.MatchExpression:
+		arm, armEnv, err := selectMatchArm(exp, env)
+		if arm == nil {
+			return err
+		}
+		return evalTailExpression(arm.Body, armEnv)
+	}
+
+	return Eval(exp, env)
+}
+
+// isTruthy NULLとFALSE以外は全て真として扱う
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL, FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return TRUE
 	}
 	return FALSE
 }
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+func isError(obj object.Object) bool {
+	return obj != nil && obj.Type() == object.ERROR
+}
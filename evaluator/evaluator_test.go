@@ -1,11 +1,19 @@
 package evaluator
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/Sa2Knight/maron/ast"
+	"github.com/Sa2Knight/maron/compiler"
 	"github.com/Sa2Knight/maron/lexer"
+	"github.com/Sa2Knight/maron/module"
 	"github.com/Sa2Knight/maron/object"
+	"github.com/Sa2Knight/maron/optimizer"
 	"github.com/Sa2Knight/maron/parser"
+	"github.com/Sa2Knight/maron/vm"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -15,10 +23,23 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}{
 		{"5", 5},
 		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"3 * 3 * 3 + 10", 37},
+		{"3 * (3 * 3) + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testIntegerObject(t, evaluated, tt.expected)
 	}
 }
@@ -30,25 +51,1140 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}{
 		{"true", true},
 		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"false != true", true},
+		{"(1 < 2) == true", true},
+		{"(1 < 2) == false", false},
+		{"(1 > 2) == true", false},
+		{"(1 > 2) == false", true},
+		{"1 == true", false},
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testBooleanObject(t, evaluated, tt.expected)
 	}
 }
 
-func testEval(input string) object.Object {
-	p := parser.New(lexer.New(input))
-	program := p.ParseProgram()
+func TestBangOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!false", false},
+		{"!!5", true},
+		{"!(if (false) { 5 })", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (true) {}", nil},
+		{"if (true) { let a = 1 }", nil},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"if (10 > 1) { if (10 > 1) { return 10; } return 1; }", 10},
+		{"let f = fn(x) { return x; x + 10; }; f(10);", 10},
+		{"let f = fn(x) { let result = x + 10; return result; return 10; }; f(10);", 20},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
 
-	return Eval(program)
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"5 + true; 5;", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"5; true + false; 5", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { true + false; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { if (10 > 1) { return true + false; } return 1; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"true < false", "unknown operator: BOOLEAN < BOOLEAN"},
+		{"(1 + true) < (1 / 0)", "type mismatch: INTEGER + BOOLEAN"},
+		{"10 / 0", "division by zero"},
+		{"foobar", "identifier not found: foobar"},
+		{"let a = b; 5", "identifier not found: b"},
+		{"let f = fn() { y }; f()", "identifier not found: y"},
+		{"5()", "not a function: INTEGER"},
+		{"fn(x) { x }()", "missing argument x in call to anonymous function"},
+		{"fn() { 1 }(1)", "too many arguments to anonymous function: want at most 0, got 1"},
+		{"fn(x) { x } + 1", "type mismatch: FUNCTION + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"let a = 5; let b = 10; let a = b; a;", 10},
+		{"let a = 5; let a = a + 1; a;", 6},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestLetStatementHasNoValue(t *testing.T) {
+	tests := []string{
+		"let a = 5;",
+		"5; let a = 5;",
+		"",
+	}
+
+	for _, input := range tests {
+		if evaluated := testEval(t, input); evaluated != nil {
+			t.Errorf("%q must have no value. got=%T(%+v)", input, evaluated, evaluated)
+		}
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := Eval(parse(input), object.NewEnvironment())
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v", fn.Parameters)
+	}
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+	if fn.Body.String() != "(x + 2)" {
+		t.Fatalf("body is not %q. got=%q", "(x + 2)", fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"let f = fn() { let a = 1; let b = 2; a + b }; f()", 3},
+		{"let a = 1; let f = fn() { let a = a + 1; a }; f() + a", 3},
+		{"let f = fn() { g() }; let g = fn() { 7 }; f()", 7},
+		{"let a = 1; let f = fn() { a }; let a = 2; f()", 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestFunctionWithoutValue(t *testing.T) {
+	tests := []string{
+		"fn() {}()",
+		"fn() { let a = 1; }()",
+	}
+
+	for _, input := range tests {
+		testNullObject(t, testEval(t, input))
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`
+let newAdder = fn(x) {
+  fn(y) { x + y };
+};
+
+let addTwo = newAdder(2);
+addTwo(2);`, 4},
+		{`
+let newAdder = fn(a, b) {
+  let c = a + b;
+  fn(d) { let e = d + c; fn(f) { e + f } };
+};
+newAdder(1, 2)(3)(4);`, 10},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`
+let fibonacci = fn(x) {
+  if (x < 2) { return x; }
+  fibonacci(x - 1) + fibonacci(x - 2);
+};
+fibonacci(15);`, 610},
+		{`
+let wrapper = fn() {
+  let countDown = fn(x) { if (x == 0) { 0 } else { countDown(x - 1) } };
+  countDown(10);
+};
+wrapper();`, 0},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+
+	// 全てのエンジンで、同じ深さ(object.MaxCallDepth)まで呼び出せる
+	const depth = "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(%d)"
+	testIntegerObject(t, testEval(t, fmt.Sprintf(depth, object.MaxCallDepth-1)), object.MaxCallDepth-1)
+	for _, n := range []int{object.MaxCallDepth, 100000} {
+		errObj, ok := testEval(t, fmt.Sprintf(depth, n)).(*object.Error)
+		if !ok || errObj.Message != "stack overflow" {
+			t.Errorf("expected stack overflow for f(%d). got=%+v", n, errObj)
+		}
+	}
+}
+
+// 末尾呼び出しはスタックを消費しないので、深い再帰でも溢れない
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let loop = fn(n) { if (n == 0) { 0 } else { loop(n - 1) } }; loop(1000000)", 0},
+		{"let sum = fn(n, acc) { if (n == 0) { return acc; } return sum(n - 1, acc + n); }; sum(100000, 0)", 5000050000},
+		{`
+let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+if (isEven(100001)) { 1 } else { 0 }`, 0},
+		{"let apply = fn(f, x) { f(x) }; apply(fn(x) { x * 2 }, 21)", 42},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+
+	// 末尾呼び出しでも引数の数や呼び出し先の誤りはエラーになる
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn() { 1(2) }; f()", "not a function: INTEGER"},
+		{"let f = fn(n) { f() }; f(1)", "missing argument n in call to f"},
+		// 末尾呼び出しでない再帰は深さを制限し、Goのスタックを使い果たす前にエラーにする
+		{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(3000000)", "stack overflow"},
+		{"let f = fn(n) { map([n], fn(x) { 1 + f(x + 1) }) }; f(0)", "stack overflow"},
+	}
+	for _, tt := range errors {
+		errObj, ok := testEval(t, tt.input).(*object.Error)
+		if !ok || errObj.Message != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%+v", tt.input, tt.expected, errObj)
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; let sum = 0; while (i < 10) { let i = i + 1; let sum = sum + i; }; sum", 55},
+		{"let i = 0; while (true) { let i = i + 1; if (i == 5) { break; } }; i", 5},
+		{`
+let i = 0;
+let sum = 0;
+while (i < 10) {
+  let i = i + 1;
+  if (i / 2 * 2 == i) { continue; }
+  let sum = sum + i;
+}
+sum`, 25},
+		{`
+let count = 0;
+let i = 0;
+while (i < 3) {
+  let j = 0;
+  while (true) {
+    if (j == 2) { break; }
+    let j = j + 1;
+    let count = count + 1;
+  }
+  let i = i + 1;
+}
+count`, 6},
+		{"let f = fn(n) { let i = 0; while (true) { if (i == n) { return i * 2; } let i = i + 1; } }; f(5)", 10},
+		{"let f = fn() { while (false) { 1 } }; f()", nil},
+		{"while (false) { 1 }", nil},
+		{"let i = 0; while (i < 3) { let i = i + 1; i }", nil},
+		{"while (1 + true) { 1 }", "type mismatch: INTEGER + BOOLEAN"},
+		{"let i = 0; while (i < 10) { let i = i + 1; if (i == 3) { x } }", "identifier not found: x"},
+		{"for (x in 5) { x }", "not iterable: INTEGER"},
+		{"let x = 99; for (x in [1, 2]) { }; x", 99},
+		{"const x = 99; for (x in [1, 2]) { x }; x", 99},
+		{"let f = fn() { let x = 99; for (x in [1, 2]) { }; x }; f()", 99},
+		{"let s = 0; for (x in [1, 2, 3]) { s += x }; s", 6},
+		{"for (x in [1, 2]) { let y = x }; y", "identifier not found: y"},
+		{"for (x in [1, 2]) { }; x", "identifier not found: x"},
+		{`
+let f = fn() {
+  let fs = [];
+  for (a in [1, 2]) {
+    for (b in [a]) { fs = push(fs, fn() { b }) }
+  }
+  fs[0]() + fs[1]() * 10
+};
+f()`, 21},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != expected {
+				t.Errorf("wrong error for %q. want=%q, got=%+v", tt.input, expected, evaluated)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+// TestLoopClosures 繰り返し文の中で生成したクロージャは、その回の変数とブロックの識別子を捕捉する
+func TestLoopClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let fs = []; for (x in [1, 2, 3]) { let y = x; fs = push(fs, fn() { [x, y] }); } map(fs, fn(f) { f() })", "[[1, 1], [2, 2], [3, 3]]"},
+		{"let f = fn() { let fs = []; for (x in [1, 2, 3]) { let y = x * 10; fs = push(fs, fn() { [x, y] }) }; map(fs, fn(g) { g() }) }; f()", "[[1, 10], [2, 20], [3, 30]]"},
+		{"let fs = []; for (a in [1, 2]) { for (b in [a * 10]) { fs = push(fs, fn() { a + b }) } }; map(fs, fn(f) { f() })", "[11, 22]"},
+		{"let fs = []; for (x in [1, 2, 3]) { let y = x; fs = push(fs, fn() { y }); if (x == 2) { continue } }; map(fs, fn(f) { f() })", "[1, 2, 3]"},
+		{"let fs = []; for (x in [1, 2]) { fs = push(fs, match (x) { n => fn() { n } }) }; map(fs, fn(f) { f() })", "[1, 2]"},
+		{`
+let fs = [];
+for (x in [1, 10]) {
+  let n = 0;
+  fs = push(fs, [fn() { n += x; n }, fn() { n }]);
+}
+fs[0][0](); fs[0][0](); fs[1][0]();
+[fs[0][1](), fs[1][1]()]`, "[2, 10]"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x = 5; x", 5},
+		{"let x = 1; x = 5", 5},
+		{"let a = 1; let b = 2; a = b = 3; a + b", 6},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x", 6},
+		{"let i = 0; let sum = 0; while (i < 10) { i += 1; sum += i; }; sum", 55},
+		{"let x = 1; let f = fn() { x = x + 1 }; f(); f(); x", 3},
+		{"let f = fn() { let c = 0; fn() { c += 1 } }; let counter = f(); counter(); counter(); counter()", 3},
+		{"let f = fn() { let x = 1; let g = fn() { x }; let x = 2; g() }; f()", 2},
+		{"let f = fn(n) { let g = fn() { n += 1 }; g(); n }; f(1)", 2},
+		{"let f = fn() { x = 5 }; let x = 1; f(); x", 5},
+		{"let f = fn() { let c = 0; let inc = fn() { c += 1 }; inc(); inc(); c }; f(); f()", 2},
+		{"x = 1", "cannot assign to undeclared identifier: x"},
+		{"let f = fn() { y += 1 }; f()", "identifier not found: y"},
+		{"let f = fn() { y = 1 }; f()", "cannot assign to undeclared identifier: y"},
+		{"const x = 1; x = 2", "cannot assign to constant: x"},
+		{"const x = 1; x += 2", "cannot assign to constant: x"},
+		{"const x = 1; let x = 2", "cannot assign to constant: x"},
+		{"const x = 1; let f = fn() { x = 2 }; f()", "cannot assign to constant: x"},
+		{"const x = 1; let f = fn() { let x = 2; x }; f()", 2},
+		{"const x = 1; x", 1},
+		{"let x = 1; x += true", "type mismatch: INTEGER + BOOLEAN"},
+		{"let x = 1; x[0]", "index operator not supported: INTEGER"},
+		{"let x = 1; x.k", "index operator not supported: INTEGER"},
+		{"let x = 1; x[0] = 2", "index assignment not supported: INTEGER"},
+		{"let x = 1; x.k += 2", "index operator not supported: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != expected {
+				t.Errorf("wrong error for %q. want=%q, got=%+v", tt.input, expected, evaluated)
+			}
+		}
+	}
+}
+
+func TestCollections(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"hello\tworld"`, "hello\tworld"},
+		{"[1, 2 * 2, 3 + 3]", "[1, 4, 6]"},
+		{`["a", [true]]`, `["a", [true]]`},
+		{`{"one": 1, 2: "two", true: [3]}`, `{"one": 1, 2: "two", true: [3]}`},
+		{"{1: 1, 1: 2}", "{1: 2}"},
+		{"[1, 2, 3][1]", "2"},
+		{"[1, 2, 3][3]", "null"},
+		{"[1, 2, 3][-1]", "null"},
+		{`{"a": 1}["a"]`, "1"},
+		{`{"a": 1}["b"]`, "null"},
+		{`let h = {"key": 5}; h.key`, "5"},
+		{"let a = [1, 2]; a[0] = 5; a", "[5, 2]"},
+		{"let a = [1, 2]; a[1] += 5; a", "[1, 7]"},
+		{`let h = {}; h["x"] = 1; h.y = 2; h.x += 10; h`, `{"x": 11, "y": 2}`},
+		{"let a = [1]; for (x in [1, 2, 3]) { a[0] += x }; a[0]", "7"},
+		{"let a = [1, 2]; a[2] = 3", "index out of range: 2"},
+		{"[1][true]", "array index must be INTEGER: BOOLEAN"},
+		{"{[1]: 2}", "unusable as hash key: ARRAY"},
+		{"{1: 2}[fn() {}]", "unusable as hash key: FUNCTION"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let [a, b] = [1, 2]; a * 10 + b", 12},
+		{"let [a, ...rest] = [1, 2, 3]; rest[1]", 3},
+		{"let [a, b, ...rest] = [1, 2]; rest", "[]"},
+		{"let [a, b = 5] = [1]; a + b", 6},
+		{"let [a, b = a + 1] = [1]; b", 2},
+		{"let [a = 100] = [1]; a", 1},
+		{"let [[a, b], c] = [[1, 2], 3]; a + b + c", 6},
+		{`let {name, age} = {"name": 1, "age": 2}; name + age`, 3},
+		{`let {name: n, age: a = 30} = {"name": 1}; n + a`, 31},
+		{`let {pos: [x, y]} = {"pos": [3, 4]}; x * y`, 12},
+		{`let {a} = {"a": 1, "b": 2}; a`, 1},
+		{"let f = fn([a, b], c) { a + b + c }; f([1, 2], 3)", 6},
+		{`let f = fn({x, y = 10}) { x + y }; f({"x": 1})`, 11},
+		{"let f = fn([a, b]) { fn() { a + b } }; f([1, 2])()", 3},
+		{"let f = fn([a], b) { let g = fn() { a += b }; g(); a }; f([1], 2)", 3},
+		{"const [a, b] = [1, 2]; a = 3", "cannot assign to constant: a"},
+		{"let [a, b] = [1]", "missing element 1 in array pattern"},
+		{"let [a] = [1, 2]", "too many elements to destructure: want=1, got=2"},
+		{`let {a} = {"b": 1}`, "missing key a in hash pattern"},
+		{"let [a] = 1", "cannot destructure INTEGER as array"},
+		{"let {a} = [1]", "cannot destructure ARRAY as hash"},
+		{"let f = fn([a]) { a }; f(true)", "cannot destructure BOOLEAN as array"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testInspectObject(t, tt.input, evaluated, expected)
+		}
+	}
+}
+
+func TestFunctionParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn(a, b = 2) { a * 10 + b }; f(1)", "12"},
+		{"let f = fn(a, b = 2) { a * 10 + b }; f(1, 3)", "13"},
+		{"let f = fn(a, b = a + 1) { b }; f(5)", "6"},
+		{"let x = 100; let f = fn(a = x) { a }; f()", "100"},
+		{"let f = fn(a, ...rest) { rest }; f(1, 2, 3)", "[2, 3]"},
+		{"let f = fn(a, ...rest) { rest }; f(1)", "[]"},
+		{"let f = fn(...args) { args }; f()", "[]"},
+		{"let f = fn(a, b, c) { a + b + c }; f(...[1, 2, 3])", "6"},
+		{"let f = fn(...xs) { xs }; f(0, ...[1, 2], 3, ...[])", "[0, 1, 2, 3]"},
+		{"let f = fn(a, b = 2, c = 3) { [a, b, c] }; f(1, c: 30)", "[1, 2, 30]"},
+		{"let f = fn(a, b) { a - b }; f(b: 1, a: 10)", "9"},
+		{"let f = fn(a, b = 2, ...rest) { [a, b, rest] }; f(...[1, 2, 3])", "[1, 2, [3]]"},
+		{"let f = fn(a, b = 2, ...rest) { [a, b, rest] }; f(...[1], b: 5)", "[1, 5, []]"},
+		{"let f = fn([a, b] = [1, 2]) { a + b }; f()", "3"},
+		{"let f = fn({x, y = 5} = {\"x\": 1}) { x + y }; f()", "6"},
+		{"let f = fn(a = 1) { fn() { a } }; f()()", "1"},
+		{"let f = fn(a = 1) { let g = fn() { a += 1 }; g(); a }; f()", "2"},
+		{"let f = fn(n, acc = 0) { if (n == 0) { acc } else { f(n - 1, acc: acc + n) } }; f(100000)", "5000050000"},
+		{"let f = fn(...xs) { match (xs) { [] => 0, [_, ...r] => f(...r) + 1 } }; f(1, 2, 3)", "3"},
+		{"let f = fn(n, ...xs) { if (n == 0) { xs } else { f(n - 1, ...xs, n) } }; f(3)", "[3, 2, 1]"},
+		{"let f = fn(a, b) { a }; f(1)", "missing argument b in call to f"},
+		{"let f = fn(a, b = 1) { a }; f(b: 2)", "missing argument a in call to f"},
+		{"let f = fn(a) { a }; f(1, 2)", "too many arguments to f: want at most 1, got 2"},
+		{"fn(a) { a }(1, 2)", "too many arguments to anonymous function: want at most 1, got 2"},
+		{"let f = fn(a) { a }; f(c: 1)", "unknown argument c in call to f"},
+		{"let f = fn(a, ...rest) { a }; f(rest: 1)", "unknown argument rest in call to f"},
+		{"let f = fn(a) { a }; f(1, a: 2)", "duplicate argument a in call to f"},
+		{"let f = fn(a, b = 2, ...rest) { a }; f(1, 2, 3, b: 5)", "duplicate argument b in call to f"},
+		{"let f = fn(a) { a }; f(...1)", "cannot spread INTEGER"},
+		{"let f = fn(a = 1 + true) { a }; f()", "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestShorthandFunctionsAndPipelines(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let double = |x| x * 2; double(21)", "42"},
+		{"(|| 7)()", "7"},
+		{"let add = |a, b = 10| a + b; add(1) + add(1, 2)", "14"},
+		{"let adder = |x| |y| x + y; adder(2)(3)", "5"},
+		{"let f = |[a, b], ...rest| [a + b, rest]; f([1, 2], 3, 4)", "[3, [3, 4]]"},
+		{"let total = 0; let add = |x| total += x; add(3); add(4); total", "7"},
+		{"let inc = |x| x + 1; 1 |> inc", "2"},
+		{"let inc = |x| x + 1; 1 |> inc |> inc |> inc", "4"},
+		{"let sub = fn(a, b) { a - b }; 10 |> sub(3)", "7"},
+		{"let sub = fn(a, b) { a - b }; 10 |> sub(b: 3)", "7"},
+		{"1 + 2 |> |x| x * 10", "30"},
+		{"let inc = |x| x + 1; 1 |> inc == 2", "true"},
+		{"let apply = fn(x, f) { f(x) }; 5 |> apply(|x| x * x)", "25"},
+		{"let inc = |x| x + 1; [1, 2] |> fn(xs) { match (xs) { [a, b] => [inc(a), inc(b)] } }", "[2, 3]"},
+		{"let count = |n, acc = 0| if (n == 0) { acc } else { n - 1 |> count(acc: acc + 1) }; count(100000)", "100000"},
+		{"1 |> 2", "not a function: INTEGER"},
+		{"let f = |a| a; 1 |> f(2)", "too many arguments to f: want at most 1, got 2"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (1) { 0 => "zero", 1 => "one", _ => "other" }`, "one"},
+		{`match (5) { 0 => "zero", 1 => "one", _ => "other" }`, "other"},
+		{`match (-1) { -1 => "minus", _ => "other" }`, "minus"},
+		{`match ("b") { "a" => 1, "b" => 2 }`, "2"},
+		{"match (false) { true => 1, false => 2 }", "2"},
+		{"match (1) { true => 1, _ => 2 }", "2"},
+		{`match ("1") { 1 => 1, _ => 2 }`, "2"},
+		{"match (3) { n => n * 2 }", "6"},
+		{"match (3) { n if n > 5 => 1, n if n > 1 => 2, _ => 3 }", "2"},
+		{"match ([]) { [] => 0, _ => 1 }", "0"},
+		{"match ([1, 2]) { [a] => a, [a, b] => a + b, _ => 0 }", "3"},
+		{"match ([1, 2, 3]) { [a, b] => 0, [a, ...rest] => rest }", "[2, 3]"},
+		{"match ([1, [2, 3]]) { [1, [x, 4]] => 0, [1, [x, 3]] => x }", "2"},
+		{"match ([1, 2]) { [_, _, ...r] => r, _ => 9 }", "[]"},
+		{"match ([1]) { [1, ..._] => 1 }", "1"},
+		{`match ({"a": 1, "b": 2}) { {a: 2} => 0, {a, c} => 1, {a: 1, b} => b }`, "2"},
+		{`match ({"pos": [1, 2]}) { {pos: [x, y]} => x + y }`, "3"},
+		{`match (5) { [a] => a, {a} => a, _ => 0 }`, "0"},
+		{"let f = fn(x) { match (x) { 0 => 1, n => n * f(n - 1) } }; f(5)", "120"},
+		{"let f = fn(n, acc) { match (n) { 0 => acc, _ => f(n - 1, acc + n) } }; f(100000, 0)", "5000050000"},
+		{"let x = 1; match (2) { x => x }; x", "1"},
+		{"let n = 10; match (3) { n if n > 5 => 1, _ => 0 }; n", "10"},
+		{"let n = 10; match (3) { n if n > 5 => n, m => m + n }", "13"},
+		{"let n = 10; match ([3]) { [n, m] => 0, _ => n }", "10"},
+		{"match (3) { n if n > 5 => 1, _ => 0 }; n", "identifier not found: n"},
+		{"const n = 10; match (3) { n => n }", "3"},
+		{"const n = 10; match (3) { n => n }; n", "10"},
+		{"let f = fn() { let n = 10; match (3) { n if n > 5 => 1, _ => n } }; f()", "10"},
+		{`
+let f = fn() {
+  let fs = [];
+  let i = 0;
+  while (i < 2) {
+    let i = i + 1;
+    match (i) { n => fs = push(fs, fn() { n }) }
+  }
+  fs[0]() + fs[1]() * 10
+};
+f()`, "21"},
+		{"let f = fn(n, acc) { match (n) { 0 => acc(), m => f(m - 1, fn() { m }) } }; f(100000, fn() { 0 })", "1"},
+		{"let f = fn() { match ([1, 2]) { [a, b] => fn() { a + b } } }; f()()", "3"},
+		{"let t = match (1) { 1 => 10, _ => 20 } + 1; t", "11"},
+		{"match (3) { 1 => 1, 2 => 2 }", "no match for 3"},
+		{`match ("x") { n if false => 1 }`, "no match for x"},
+		{"match (1) { n if n + true => 1 }", "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+// engines 評価器のテストを実行するエンジンの一覧
+// loader がnilでなければ import文でモジュールを読み込める
+var engines = []struct {
+	name string
+	run  func(program *ast.Program, loader object.ModuleLoader) object.Object
+}{
+	{"eval", func(program *ast.Program, loader object.ModuleLoader) object.Object {
+		env := object.NewEnvironment()
+		env.SetLoader(loader)
+		return Eval(program, env)
+	}},
+	{"vm", func(program *ast.Program, loader object.ModuleLoader) object.Object {
+		comp := compiler.New()
+		comp.SetLoader(loader)
+		if err := comp.Compile(program); err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		machine := vm.New(comp.Bytecode())
+		if err := machine.Run(); err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		return machine.LastPoppedStackElem()
+	}},
+	{"eval+optimizer", func(program *ast.Program, loader object.ModuleLoader) object.Object {
+		env := object.NewEnvironment()
+		env.SetLoader(loader)
+		return Eval(optimizer.Optimize(program), env)
+	}},
+}
+
+func TestFloats(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1.5", "1.5"},
+		{"-2.25", "-2.25"},
+		{"2.0", "2.0"},
+		{"0.1 + 0.2", "0.30000000000000004"},
+		{"1.5 * 2", "3.0"},
+		{"3 / 2.0", "1.5"},
+		{"7 / 2", "3"},
+		{"1 - 0.5", "0.5"},
+		{"[1.5 < 2, 2 > 1.5, 1 == 1.0, 1.5 != 1.5]", "[true, true, true, false]"},
+		{"let x = 1.0; x += 1; x", "2.0"},
+		{"match (1.5) { x => x * 2 }", "3.0"},
+		{`{1.5: "a"}[1.5]`, "a"},
+		{"1.0 / 0", "division by zero"},
+		{"1.5 + true", "type mismatch: FLOAT + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestMathModule(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"math", "<module math>"},
+		{"math.sqrt", "<builtin math.sqrt>"},
+		{"[math.pi, math.e]", "[3.141592653589793, 2.718281828459045]"},
+		{"[math.abs(-3), math.abs(2.5), math.abs(-0.5)]", "[3, 2.5, 0.5]"},
+		{"[math.min(3, 1.5, 2), math.max(3, 1.5, 2), math.min(4)]", "[1.5, 3, 4]"},
+		{"math.max(...[4, 9, 2])", "9"},
+		{"[math.pow(2, 10), math.pow(-2, 3), math.pow(2, -1), math.pow(2.0, 0.5), math.pow(-1, 1001)]", "[1024, -8, 0.5, 1.4142135623730951, -1]"},
+		{"[math.sqrt(16), math.sqrt(2.25)]", "[4.0, 1.5]"},
+		{"[math.floor(2.7), math.ceil(2.1), math.round(2.5), math.round(-2.5), math.floor(-0.5), math.floor(3)]", "[2, 3, 3, -3, -1, 3]"},
+		{"[math.sin(0), math.cos(0), math.tan(0), math.atan(1) * 4 == math.pi, math.atan2(1, 1) * 4 == math.pi]", "[0.0, 1.0, 0.0, true, true]"},
+		{"[math.asin(1) * 2 == math.pi, math.acos(1)]", "[true, 0.0]"},
+		{"[math.exp(0), math.log(math.e), math.log(8, 2), math.log2(1024), math.log10(1000)]", "[1.0, 1.0, 3.0, 10.0, 3.0]"},
+		{"[math.gcd(12, 18), math.gcd(-12, 18), math.gcd(0, 5), math.lcm(4, 6), math.lcm(-4, 6), math.lcm(0, 3)]", "[6, 6, 5, 12, 12, 0]"},
+		{"let sqrt = |x| x; sqrt(2) + math.sqrt(4)", "4.0"},
+		{"let math = 1; math", "1"},
+		{"let f = fn() { math }; let math = 2; f()", "2"},
+		{"let square = |x| math.pow(x, 2); [1, 2, 3] |> fn(xs) { match (xs) { [a, b, c] => [square(a), square(b), square(c)] } }", "[1, 4, 9]"},
+		{"let f = fn(n) { math.abs(n) }; f(-5)", "5"},
+		{"math.seed(42); [math.random(100), math.random(100), math.random(-3, 3)]", "[75, 11, -2]"},
+		{"math.seed(42); let a = math.random(100); let b = math.random(); math.seed(42); [math.random(100) - a, math.random() - b]", "[0, 0.0]"},
+		{"math.seed(1); let a = math.random(1, 6); math.seed(1); a - math.random(1, 6)", "0"},
+		{"math.seed(7); let x = math.random(); [x < 1, x < 0]", "[true, false]"},
+		{"math.seed(3); math.random(5, 5)", "5"},
+		{"math.sqrt(-1)", "math.sqrt: argument out of domain: -1"},
+		{"math.asin(2)", "math.asin: argument out of domain: 2"},
+		{"math.log(0)", "math.log: argument out of domain: 0"},
+		{"math.log(8, 1)", "math.log: base out of domain: 1"},
+		{"math.pow(-8, 0.5)", "math.pow: argument out of domain: -8"},
+		{"math.pow(0, -1)", "math.pow: result out of range"},
+		{"math.exp(1000)", "math.exp: result out of range"},
+		{"math.pow(10, 19)", "math.pow: integer overflow"},
+		{"math.floor(math.pow(10.0, 19))", "math.floor: integer overflow"},
+		{"math.sqrt()", "wrong number of arguments to math.sqrt: want 1, got 0"},
+		{"math.min()", "wrong number of arguments to math.min: want at least 1, got 0"},
+		{"math.log(1, 2, 3)", "wrong number of arguments to math.log: want 1 to 2, got 3"},
+		{`math.abs("1")`, "argument to math.abs must be INTEGER or FLOAT, got STRING"},
+		{"math.gcd(1.5, 2)", "argument to math.gcd must be INTEGER, got FLOAT"},
+		{"math.random(0)", "math.random: upper bound must be positive: 0"},
+		{"math.random(3, 1)", "math.random: empty range 3 to 1"},
+		{"math.sqrt(x: 1)", "math.sqrt does not accept named arguments"},
+		{"math.cbrt(8)", "module math has no export cbrt"},
+		{"math = 1", "cannot assign to undeclared identifier: math"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"foo" + "bar"`, "foobar"},
+		{`let s = "a"; s += "b"; s += "c"; s`, "abc"},
+		{`["a" == "a", "a" != "a", "a" == "b", "abc" < "abd", "b" > "abc", "" < "a"]`, "[true, false, false, true, true, true]"},
+		{`"\u00e9\x41\t" == "é" + "A" + "\t"`, "true"},
+		{`"a" - "b"`, "unknown operator: STRING - STRING"},
+		{`"a" + 1`, "type mismatch: STRING + INTEGER"},
+		{`[strings.len("héllo"), strings.len(""), strings.len("日本語")]`, "[5, 0, 3]"},
+		{`strings.split("a,b,,c", ",")`, `["a", "b", "", "c"]`},
+		{`strings.split("日本", "")`, `["日", "本"]`},
+		{`strings.join(["a", "b", "c"], ", ")`, "a, b, c"},
+		{`strings.join([], "-")`, ""},
+		{`[strings.trim("  hi \n"), strings.trim_start("  hi  "), strings.trim_end("  hi  "), strings.trim("xxhixx", "x")]`, `["hi", "hi  ", "  hi", "hi"]`},
+		{`[strings.trim_prefix("v1.2", "v"), strings.trim_suffix("main.mr", ".mr"), strings.trim_prefix("abc", "x")]`, `["1.2", "main", "abc"]`},
+		{`[strings.upper("MaRon é"), strings.lower("MaRon É")]`, `["MARON É", "maron é"]`},
+		{`[strings.contains("maron", "ar"), strings.starts_with("maron", "ma"), strings.ends_with("maron", "ma")]`, "[true, true, false]"},
+		{`[strings.index_of("日本語テキスト", "テ"), strings.index_of("abc", "z"), strings.index_of("abc", "")]`, "[3, -1, 0]"},
+		{`[strings.replace("a-b-c", "-", "+"), strings.replace("a-b-c", "-", "+", 1)]`, `["a+b+c", "a+b-c"]`},
+		{`[strings.repeat("ab", 3), strings.repeat("x", 0)]`, `["ababab", ""]`},
+		{`[strings.pad_start("7", 3, "0"), strings.pad_end("ab", 5, "xy"), strings.pad_start("日本", 4), strings.pad_end("long", 2)]`, `["007", "abxyx", "  日本", "long"]`},
+		{`strings.format("{} + {} = {}", 1, 2.5, "x")`, "1 + 2.5 = x"},
+		{`strings.format("{{}} {}", [1, "a"])`, `{} [1, "a"]`},
+		{`strings.format("none")`, "none"},
+		{`[strings.chars("aé"), strings.char(233), strings.code("é"), strings.code("A")]`, `[["a", "é"], "é", 233, 65]`},
+		{`let count = fn(s) { let n = 0; for (c in strings.chars(s)) { if (c == "l") { n += 1 } }; n }; count("hello world")`, "3"},
+		{`match (strings.split("key=value", "=")) { [k, v] => strings.upper(k) + ":" + v }`, "KEY:value"},
+		{`strings.format("{} {}", 1)`, `strings.format: too few arguments for "{} {}"`},
+		{`strings.format("{}", 1, 2)`, `strings.format: too many arguments for "{}"`},
+		{`strings.format("{x}", 1)`, `strings.format: unmatched { in "{x}"`},
+		{`strings.join(["a", 1], "")`, "strings.join: element 1 must be STRING, got INTEGER"},
+		{`strings.repeat("a", -1)`, "strings.repeat: negative count: -1"},
+		{`strings.pad_start("a", 3, "")`, "strings.pad_start: empty padding"},
+		{`strings.char(-1)`, "strings.char: invalid code point: -1"},
+		{`strings.code("ab")`, `strings.code: want a single character, got "ab"`},
+		{`strings.upper(1)`, "argument to strings.upper must be STRING, got INTEGER"},
+		{`strings.split("a")`, "wrong number of arguments to strings.split: want 2, got 1"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[len([1, 2]), len("日本"), len({"a": 1}), len([])]`, "[2, 2, 1, 0]"},
+		{`let xs = [1, 2]; [push(xs, 3, 4), xs]`, "[[1, 2, 3, 4], [1, 2]]"},
+		{`[range(3), range(2, 5), range(0)]`, "[[0, 1, 2], [2, 3, 4], []]"},
+		{`map([1, 2, 3], fn(x) { x * x })`, "[1, 4, 9]"},
+		{`let n = 10; map([1, 2], |x| x + n)`, "[11, 12]"},
+		{`map(["a", "bc"], strings.len)`, "[1, 2]"},
+		{`filter(range(10), |x| x / 3 * 3 == x)`, "[0, 3, 6, 9]"},
+		{`[reduce([1, 2, 3], |a, b| a + b), reduce([1, 2], |acc, x| push(acc, x), []), reduce([], |a, b| a, 0)]`, "[6, [1, 2], 0]"},
+		{`let total = 0; let add = fn(x) { total += x }; [each([1, 2, 3], add), total]`, "[null, 6]"},
+		{`[zip([1, 2, 3], ["a", "b"]), zip([1], [2], [3])]`, `[[[1, "a"], [2, "b"]], [[1, 2, 3]]]`},
+		{`enumerate(["a", "b"])`, `[[0, "a"], [1, "b"]]`},
+		{`let xs = [3, 1, 2]; [sort(xs), xs]`, "[[1, 2, 3], [3, 1, 2]]"},
+		{`[sort([2.5, 1, 2]), sort(["b", "a", "ab"])]`, `[[1, 2, 2.5], ["a", "ab", "b"]]`},
+		{`[sort([1, 3, 2], |a, b| b - a), sort([1, 3, 2], |a, b| a > b)]`, "[[3, 2, 1], [3, 2, 1]]"},
+		{`sort([[2, "a"], [1, "b"], [2, "c"], [1, "d"]], |a, b| a[0] - b[0])`, `[[1, "b"], [1, "d"], [2, "a"], [2, "c"]]`},
+		{`sort_by(["ccc", "a", "bb", "d"], strings.len)`, `["a", "d", "bb", "ccc"]`},
+		{`group_by(range(6), |x| if (x / 2 * 2 == x) { "even" } else { "odd" })`, `{"even": [0, 2, 4], "odd": [1, 3, 5]}`},
+		{`let a = [1]; uniq([1, "1", 1, 2.0, 2.0, true, a, a, [1]])`, `[1, "1", 2.0, true, [1], [1]]`},
+		{`[flatten([1, [2, [3, [4]]]]), flatten([1, [2, [3]]], 1), flatten([[1]], 0)]`, "[[1, 2, 3, 4], [1, 2, [3]], [[1]]]"},
+		{`[any([1, 2], |x| x > 1), any([], |x| true), all([1, 2], |x| x > 1), all([]), any([false, find([], |x| x)]), all([1, "a"])]`, "[true, false, false, true, false, true]"},
+		{`let calls = 0; any([1, 2, 3], fn(x) { calls += 1; x == 1 }); calls`, "1"},
+		{`[find([1, 2, 3, 4], |x| x > 2), find([1], |x| false)]`, "[3, null]"},
+		{`[take([1, 2, 3], 2), take([1], 5), drop([1, 2, 3], 1), drop([1], 5)]`, "[[1, 2], [1], [2, 3], []]"},
+		{`[sum([1, 2, 3]), sum([1, 0.5]), sum([])]`, "[6, 1.5, 0]"},
+		{`range(5) |> filter(|x| x > 1) |> map(|x| x * 10) |> sum()`, "90"},
+		{`let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; map([3, 5], fact)`, "[6, 120]"},
+		{`map([[1, 2], [3]], |xs| map(xs, |x| x + 1))`, "[[2, 3], [4]]"},
+		{`let counter = fn(n) { if (n == 0) { 0 } else { counter(n - 1) + 1 } }; sum(map(range(100), counter))`, "4950"},
+		{`map([1, 2], fn(x) { if (x == 2) { return x * 100 }; x })`, "[1, 200]"},
+		{`map([1, 2], fn(x) { x + true })`, "type mismatch: INTEGER + BOOLEAN"},
+		{`sort([1, 2], |a, b| undefined)`, "identifier not found: undefined"},
+		{`map([1], 1)`, "not a function: INTEGER"},
+		{`sort([1, "a"])`, "sort: cannot compare STRING and INTEGER"},
+		{`sort([1, 2], |a, b| "x")`, "sort: comparator must return INTEGER or BOOLEAN, got STRING"},
+		{`group_by([1], |x| [x])`, "group_by: unusable as hash key: ARRAY"},
+		{`reduce([], |a, b| a)`, "reduce: empty array with no initial value"},
+		{`take([1], -1)`, "take: negative count: -1"},
+		{`sum([1, "a"])`, "sum: element 1 must be INTEGER or FLOAT, got STRING"},
+		{`map(1, |x| x)`, "argument to map must be ARRAY, got INTEGER"},
+		{`len(1)`, "argument to len not supported, got INTEGER"},
+		{`filter([1])`, "wrong number of arguments to filter: want 2, got 1"},
+		{`map([1], strings.len)`, "argument to strings.len must be STRING, got INTEGER"},
+		{`let map = fn(x) { x }; map(5)`, "5"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestJSONModule(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json.parse("{\"b\": [1, -2.5, 1e3, \"x\"], \"a\": {\"t\": true, \"f\": false, \"n\": null}}")`, `{"b": [1, -2.5, 1000.0, "x"], "a": {"t": true, "f": false, "n": null}}`},
+		{`json.parse(" 42 ")`, "42"},
+		{`[json.parse("9223372036854775807"), json.parse("9223372036854775808"), json.parse("-0")]`, "[9223372036854775807, 9.223372036854776e+18, 0]"},
+		{`json.parse("\"a\\n\\u00e9\\ud83d\\ude00\\/\"") == "a\né😀/"`, "true"},
+		{`json.parse("{\"a\": 1, \"a\": 2}")`, `{"a": 2}`},
+		{`let req = json.parse("{\"user\": {\"age\": 20}}"); req["user"]["age"] > 18`, "true"},
+		{`json.stringify({"a": [1, 2.0, "x"], "b": json.parse("null"), "c": {}, "d": [], 1: true})`, `{"a":[1,2.0,"x"],"b":null,"c":{},"d":[],"1":true}`},
+		{`json.stringify("q\"\\\n\t\x01é")`, `"q\"\\\n\t\u0001é"`},
+		{`json.stringify({"a": [1, {"b": 2}], "c": []}, 2)`, "{\n  \"a\": [\n    1,\n    {\n      \"b\": 2\n    }\n  ],\n  \"c\": []\n}"},
+		{`json.stringify([1], "\t")`, "[\n\t1\n]"},
+		{`let text = "{\"k\":[1,2.5,\"s\",true,null]}"; json.stringify(json.parse(text)) == text`, "true"},
+		{`json.parse("{\"a\": 1,}")`, "json.parse: unexpected character '}' at offset 8"},
+		{`json.parse("[1, 2")`, "json.parse: unexpected end of input at offset 5"},
+		{`json.parse("")`, "json.parse: unexpected end of input at offset 0"},
+		{`json.parse("1 2")`, "json.parse: unexpected character '2' at offset 2"},
+		{`json.parse("[01]")`, "json.parse: unexpected character '1' at offset 2"},
+		{`json.parse("{\"a\" 1}")`, "json.parse: unexpected character '1' at offset 5"},
+		{`json.parse("\"\\q\"")`, `json.parse: invalid escape "\\q" at offset 1`},
+		{`json.parse("\"\\u12\"")`, "json.parse: invalid unicode escape at offset 1"},
+		{`json.parse("nul")`, "json.parse: unexpected character 'n' at offset 0"},
+		{`json.parse("1e999")`, "json.parse: number out of range 1e999 at offset 0"},
+		{`json.stringify([fn() {}])`, "json.stringify: unsupported value: FUNCTION"},
+		{`json.stringify({true: 1})`, "json.stringify: unsupported hash key: BOOLEAN"},
+		{`json.stringify(1, -1)`, "json.stringify: indent out of range: -1"},
+		{`json.parse(1)`, "argument to json.parse must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestRegexModule(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`re.compile("[a-z]+\\d")`, `<regex /[a-z]+\d/>`},
+		{`let r = re.compile("^\\d+$"); [re.match(r, "123"), re.match(r, "12a"), re.match("b", "abc")]`, "[true, false, true]"},
+		{`[re.find("\\d+", "ab12cd345"), re.find("x", "abc")]`, `["12", null]`},
+		{`[re.find_all("\\d+", "a1b22c333"), re.find_all("\\d+", "a1b22c333", 2), re.find_all("x", "abc")]`, `[["1", "22", "333"], ["1", "22"], []]`},
+		{`re.captures("(\\w+)@(\\w+)(\\.jp)?", "mail: foo@example.com")`, `["foo@example", "foo", "example", null]`},
+		{`re.captures("(?P<year>\\d{4})-(?P<month>\\d{2})-(\\d{2})", "due 2024-05-17")`, `{"year": "2024", "month": "05"}`},
+		{`re.captures("\\d", "abc")`, "null"},
+		{`let m = re.captures("(?P<key>\\w+)=(?P<value>\\w*)", "name=maron"); m["key"] + ":" + m["value"]`, "name:maron"},
+		{`re.replace("(\\w+)@(\\w+)", "foo@bar baz@qux", "$2@$1")`, "bar@foo qux@baz"},
+		{`re.replace("(?P<n>\\d+)", "a1b2", "<${n}>")`, "a<1>b<2>"},
+		{`re.replace("\\d+", "a1b22", fn(m) { strings.repeat("#", strings.len(m)) })`, "a#b##"},
+		{`let n = 0; re.replace("x", "xax", fn(m) { n += 1; strings.format("{}", n) })`, "1a2"},
+		{`[re.split("\\s*,\\s*", "a , b,c"), re.split(",", "a,b,c", 2)]`, `[["a", "b", "c"], ["a", "b,c"]]`},
+		{`re.match(re.escape("a.b"), "axb")`, "false"},
+		{`filter(["ok-1", "ng", "ok-22"], |s| re.match("^ok-\\d+$", s))`, `["ok-1", "ok-22"]`},
+		{`re.compile("(")`, "re.compile: invalid pattern: error parsing regexp: missing closing ): `(`"},
+		{`re.match("[", "a")`, "re.match: invalid pattern: error parsing regexp: missing closing ]: `[`"},
+		{`re.replace("a", "abc", |m| 1)`, "re.replace: replacement function must return STRING, got INTEGER"},
+		{`re.replace("a", "abc", |m| m + 1)`, "type mismatch: STRING + INTEGER"},
+		{`re.match(1, "a")`, "argument to re.match must be REGEX or STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestTimeModule(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`time.date(2024, 2, 29)`, "2024-02-29T00:00:00Z"},
+		{`time.date(2024, 4, 1, 9, 30, 0, "Asia/Tokyo")`, "2024-04-01T09:30:00+09:00"},
+		{`time.parse("2024-05-17T10:00:00.5+02:00")`, "2024-05-17T10:00:00.5+02:00"},
+		{`time.parse("17/05/2024 08:15", "02/01/2006 15:04", "America/New_York")`, "2024-05-17T08:15:00-04:00"},
+		{`time.parse("2024-01-15", time.date_only)`, "2024-01-15T00:00:00Z"},
+		{`let t = time.date(2024, 12, 25, 18, 5, 9); [time.format(t, "2006/01/02 (Mon) 15:04"), time.format(t, time.rfc1123), time.format(t)]`, `["2024/12/25 (Wed) 18:05", "Wed, 25 Dec 2024 18:05:09 UTC", "2024-12-25T18:05:09Z"]`},
+		{`time.in_zone(time.date(2024, 1, 1, 0, 0, 0), "Asia/Tokyo")`, "2024-01-01T09:00:00+09:00"},
+		{`time.zone(time.in_zone(time.date(2024, 1, 1), "Europe/Paris"))`, "Europe/Paris"},
+		{`time.fields(time.date(2024, 3, 10, 4, 5, 6, "Asia/Tokyo"))`, `{"year": 2024, "month": 3, "day": 10, "hour": 4, "minute": 5, "second": 6, "nanosecond": 0, "weekday": "Sunday", "yearday": 70, "zone": "JST", "offset": 32400}`},
+		{`[time.unix(time.date(1970, 1, 2)), time.from_unix(86400), time.from_unix(0, "Asia/Tokyo")]`, "[86400, 1970-01-02T00:00:00Z, 1970-01-01T09:00:00+09:00]"},
+		{`time.duration("1h30m")`, "1h30m0s"},
+		{`[time.seconds(time.duration("1m30s")), time.seconds(time.duration("-250ms"))]`, "[90.0, -0.25]"},
+		{`time.add(time.date(2024, 1, 31), time.duration("36h"))`, "2024-02-01T12:00:00Z"},
+		{`time.add(time.duration("1h"), time.duration("30m"))`, "1h30m0s"},
+		{`time.sub(time.date(2024, 3, 1), time.date(2024, 2, 1))`, "696h0m0s"},
+		{`time.sub(time.date(2024, 3, 1), time.duration("1s"))`, "2024-02-29T23:59:59Z"},
+		{`time.sub(time.duration("1h"), time.duration("2h"))`, "-1h0m0s"},
+		{`[time.add_date(time.date(2024, 1, 31), 0, 1, 0), time.add_date(time.date(2024, 2, 29), 1, 0, 0), time.add_date(time.date(2024, 1, 1), 0, 0, -1)]`, "[2024-03-02T00:00:00Z, 2025-03-01T00:00:00Z, 2023-12-31T00:00:00Z]"},
+		{`let cutoff = time.date(2024, 4, 1); [time.date(2024, 3, 31) < cutoff, time.date(2024, 4, 2) > cutoff, time.date(2024, 4, 1) == cutoff, time.date(2024, 4, 1) != cutoff]`, "[true, true, true, false]"},
+		{`time.date(2024, 4, 1, 9, 0, 0, "Asia/Tokyo") == time.date(2024, 4, 1, 0, 0, 0)`, "true"},
+		{`[time.duration("90s") > time.duration("1m"), time.duration("60s") == time.duration("1m")]`, "[true, true]"},
+		{`sort([time.date(2024, 3, 1), time.date(2023, 1, 1), time.date(2024, 1, 1)])`, "[2023-01-01T00:00:00Z, 2024-01-01T00:00:00Z, 2024-03-01T00:00:00Z]"},
+		{`time.date(2024, 1, 1) < time.duration("1h")`, "type mismatch: TIME < DURATION"},
+		{`time.date(2024, 1, 1) + time.duration("1h")`, "type mismatch: TIME + DURATION"},
+		{`time.date(2024, 1, 1) - time.date(2024, 1, 1)`, "unknown operator: TIME - TIME"},
+		{`time.date(2023, 2, 29)`, "time.date: invalid date: 2023-02-29 00:00:00"},
+		{`time.date(2024, 1, 1, 24, 0, 0)`, "time.date: invalid date: 2024-01-01 24:00:00"},
+		{`time.date(2024, 1, 1, 12)`, "time.date: want hour, minute and second together"},
+		{`time.in_zone(time.date(2024, 1, 1), "Mars/Olympus")`, "time.in_zone: unknown time zone: Mars/Olympus"},
+		{`time.parse("2024-13-01", time.date_only)`, `time.parse: parsing time "2024-13-01": month out of range`},
+		{`time.duration("5 days")`, `time.duration: invalid duration: "5 days"`},
+		{`time.format("2024")`, "argument to time.format must be TIME, got STRING"},
+		{`time.sub(time.date(2024, 1, 1), 1)`, "argument to time.sub must be TIME or DURATION, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestFunctionInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn() { 1 }", "<fn()>"},
+		{"let add = fn(a, b) { a + b }; add", "<fn add(a, b)>"},
+		{"fn(a, b = 2, [c, d] = [1, 2], ...rest) { a }", "<fn(a, b, [c, d], ...rest)>"},
+		{"let outer = fn(x) { fn(y) { x + y } }; [outer, outer(1)]", "[<fn outer(x)>, <fn(y)>]"},
+		{"{\"f\": |x| x * 2}", "{\"f\": <fn(x)>}"},
+		{"math.sqrt", "<builtin math.sqrt>"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestModules(t *testing.T) {
+	files := map[string]string{
+		"util.mr":        `import "lib/math.mr" as math; export let twice = fn(x) { math.square(x) * 2 / x };`,
+		"lib/math.mr":    `export const pi = 3; export let square = fn(x) { x * x }; let hidden = 1;`,
+		"lib/pair.mr":    `export let [first, second] = [1, 2]; export let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };`,
+		"lib/counter.mr": `export let count = 0; count += 1;`,
+		"a.mr":           `import "b.mr" as b; export let x = 1;`,
+		"b.mr":           `import "./a.mr" as a; export let y = 2;`,
+		"broken.mr":      `export let = 1;`,
+		"failing.mr":     `export let x = 1 + true;`,
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "lib/math.mr" as m; m.square(m.pi)`, "9"},
+		{`import "math.mr" as m; m["square"](4)`, "16"},
+		{`import "util.mr" as u; u.twice(21)`, "42"},
+		{`import "pair.mr" as p; [p.first, p.second, p.even(10), p.even(7)]`, "[1, 2, true, false]"},
+		{`import "counter.mr" as a; import "lib/counter.mr" as b; a.count + b.count`, "2"},
+		{`import "math.mr" as m; m`, "<module math.mr>"},
+		{`let f = fn() { m.pi }; import "math.mr" as m; f()`, "3"},
+		{`import "math.mr" as m; m.hidden`, "module math.mr has no export hidden"},
+		{`import "math.mr" as m; m[1]`, "module member must be STRING: INTEGER"},
+		{`import "missing.mr" as m; 1`, `cannot find module "missing.mr"`},
+		{`import "./math.mr" as m; 1`, `cannot find module "./math.mr"`},
+		{`import "a.mr" as a; 1`, "import cycle: a.mr -> b.mr -> ./a.mr"},
+		{`import "broken.mr" as m; 1`, "broken.mr: invalid binding target: ="},
+		{`import "failing.mr" as m; 1`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		testInspectObject(t, tt.input, testEvalWithModules(t, files, tt.input), tt.expected)
+	}
+
+	evaluated := testEval(t, `import "math.mr" as m; 1`)
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != `cannot import "math.mr": modules are not available` {
+		t.Errorf("import without loader should fail. got=%+v", evaluated)
+	}
+}
+
+func parse(input string) *ast.Program {
+	return parser.New(lexer.New(input)).ParseProgram()
+}
+
+// testInspect input を全てのエンジンで実行し、評価結果を Inspect した文字列(エラーの場合はメッセージ)が expected と一致することを確認する
+func testInspect(t *testing.T, input string, expected string) {
+	t.Helper()
+	testInspectObject(t, input, testEval(t, input), expected)
+}
+
+// testInspectObject input の評価結果 obj を Inspect した文字列(エラーの場合はメッセージ)が expected と一致することを確認する
+func testInspectObject(t *testing.T, input string, obj object.Object, expected string) {
+	t.Helper()
+
+	if errObj, ok := obj.(*object.Error); ok {
+		if errObj.Message != expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", input, expected, errObj.Message)
+		}
+		return
+	}
+	if obj == nil || obj.Inspect() != expected {
+		t.Errorf("wrong result for %q. want=%q, got=%+v", input, expected, obj)
+	}
+}
+
+// testEval は全てのエンジンで実行し、結果が評価器と一致することを確認する
+func testEval(t *testing.T, input string) object.Object {
+	t.Helper()
+	return testEvalWithLoader(t, input, func() object.ModuleLoader { return nil })
+}
+
+// testEvalWithModules files (パスと内容の組)を一時ディレクトリに書き出し、その中の main.mr として input を実行する
+func testEvalWithModules(t *testing.T, files map[string]string, input string) object.Object {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// モジュールの評価結果はエンジンごとに記録されるので、エンジンごとに Loader を生成する
+	return testEvalWithLoader(t, input, func() object.ModuleLoader {
+		return module.NewLoader(filepath.Join(dir, "main.mr"), filepath.Join(dir, "lib"))
+	})
+}
+
+func testEvalWithLoader(t *testing.T, input string, newLoader func() object.ModuleLoader) object.Object {
+	t.Helper()
+
+	// 各エンジンには別々に構文解析したプログラムを渡す
+	expected := engines[0].run(parse(input), newLoader())
+	for _, engine := range engines[1:] {
+		got := engine.run(parse(input), newLoader())
+		if !sameObject(expected, got) {
+			t.Errorf("engine %q disagrees with %q for %q.\nwant=%s\ngot =%s",
+				engine.name, engines[0].name, input, describe(expected), describe(got))
+		}
+	}
+
+	return expected
+}
+
+// sameObject エンジン間で評価結果が同じか判定する
+// 種別と Inspect の文字列を比較する。関数もエンジン間で同じ文字列になる
+func sameObject(a, b object.Object) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	return a.Inspect() == b.Inspect()
+}
+
+func describe(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+	return string(obj.Type()) + " " + obj.Inspect()
 }
 
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	t.Helper()
+
 	result, ok := obj.(*object.Integer)
 	if !ok {
 		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
 	}
 	if result.Value != expected {
 		t.Errorf("objectが%dじゃなくて%dだった", expected, result.Value)
@@ -58,6 +1194,8 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 }
 
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	t.Helper()
+
 	result, ok := obj.(*object.Boolean)
 	if !ok {
 		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
@@ -69,3 +1207,13 @@ func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	}
 	return true
 }
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	t.Helper()
+
+	if obj != NULL {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
+	return true
+}
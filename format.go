@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Sa2Knight/maron/format"
+)
+
+// formatFiles ソースコードを標準の書式に整形する (maron fmt [--check] [--diff] [files...])
+// ファイルを指定しない場合は標準入力を整形して標準出力に書き出す
+// 終了コードを戻す
+func formatFiles(args []string) int {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := fs.Bool("check", false, "ファイルを書き換えず、整形が必要なファイル名を表示する。該当があれば終了コード1")
+	diff := fs.Bool("diff", false, "ファイルを書き換えず、整形結果との差分を表示する")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		formatted, err := format.Source(src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "<stdin>: %s\n", err)
+			return 2
+		}
+		os.Stdout.Write(formatted)
+		return 0
+	}
+
+	status := 0
+	for _, filename := range fs.Args() {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 2
+			continue
+		}
+		formatted, err := format.Source(src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", filename, err)
+			status = 2
+			continue
+		}
+		if bytes.Equal(src, formatted) {
+			continue
+		}
+
+		switch {
+		case *check || *diff:
+			if *check {
+				fmt.Println(filename)
+			}
+			if *diff {
+				fmt.Print(unifiedDiff(filename, string(src), string(formatted)))
+			}
+			if status == 0 {
+				status = 1
+			}
+		default:
+			if err := os.WriteFile(filename, formatted, 0644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				status = 2
+			}
+		}
+	}
+	return status
+}
@@ -0,0 +1,672 @@
+package format
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Sa2Knight/maron/ast"
+	"github.com/Sa2Knight/maron/lexer"
+	"github.com/Sa2Knight/maron/parser"
+	"github.com/Sa2Knight/maron/token"
+)
+
+// INDENT インデント1段分の文字列
+const INDENT = "\t"
+
+// LINE_WIDTH 1行の長さの目安
+// 配列、ハッシュ、呼び出しの引数を1行に並べるとこれを超える場合は、1行に1要素ずつ出力する
+const LINE_WIDTH = 100
+
+// 行の長さを数える際のインデント1段分の幅
+const indentWidth = 4
+
+// 識別子やリテラルなど、括弧で囲む必要のない式の優先順位
+const primary = parser.CALL + 1
+
+// Source ソースコードを解析し、標準の書式に整形して戻す
+// コメントは元の位置に近い場所に出力される
+func Source(src []byte) ([]byte, error) {
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	pr := &printer{
+		lines:    strings.Split(string(src), "\n"),
+		comments: program.Comments,
+	}
+	pr.statements(program.Statements, 0)
+	return pr.buf.Bytes(), nil
+}
+
+// Node ノードを標準の書式で文字列化する(コメントは出力しない)
+func Node(node ast.Node) string {
+	pr := &printer{}
+	switch node := node.(type) {
+	case *ast.Program:
+		pr.statements(node.Statements, 0)
+	case ast.Statement:
+		pr.statement(node)
+	case ast.Expression:
+		pr.expression(node, parser.LOWEST)
+	}
+	return pr.buf.String()
+}
+
+// printer 整形済みのソースコードを出力する
+type printer struct {
+	buf      bytes.Buffer
+	indent   int           // 現在のインデントの深さ
+	lines    []string      // 整形前のソースコードの各行(空行とコメントの位置の判定に使う)
+	comments []token.Token // まだ出力していないコメント
+	flat     bool          // 外側の並びを1行に出力しようとしている(内側の並びは行の長さで改行しない)
+}
+
+// statements 文の並びを1行ずつ出力する
+// end は並びを閉じる } の行番号で、それより前のコメントはこの並びの中に出力する(0の場合は全て)
+func (p *printer) statements(stmts []ast.Statement, end int) {
+	first := true
+	for i, stmt := range stmts {
+		line := startLine(stmt)
+
+		// 文より前にあるコメントは独立した行として出力
+		for p.hasCommentBefore(line) {
+			p.separate(p.comments[0].Line, first)
+			first = false
+			p.writeIndent()
+			p.buf.WriteString(p.popComment().Literal)
+			p.buf.WriteString("\n")
+		}
+
+		p.separate(line, first)
+		first = false
+		p.writeIndent()
+		p.statement(stmt)
+
+		// 文の後ろに書かれたコメントは同じ行に出力
+		next := end
+		if i+1 < len(stmts) {
+			next = startLine(stmts[i+1])
+		}
+		p.trailingComments(next)
+		p.buf.WriteString("\n")
+	}
+
+	// 並びの末尾に残ったコメント
+	for len(p.comments) > 0 && (end == 0 || p.comments[0].Line < end) {
+		p.separate(p.comments[0].Line, first)
+		first = false
+		p.writeIndent()
+		p.buf.WriteString(p.popComment().Literal)
+		p.buf.WriteString("\n")
+	}
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.buf.WriteString(stmt.Token.Literal + " ")
+		p.pattern(stmt.Name)
+		p.buf.WriteString(" = ")
+		p.expression(stmt.Value, parser.LOWEST)
+		p.buf.WriteString(";")
+
+	case *ast.ReturnStatement:
+		p.buf.WriteString("return ")
+		p.expression(stmt.ReturnValue, parser.LOWEST)
+		p.buf.WriteString(";")
+
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression, parser.LOWEST)
+		// ブロックで終わる式には ; を付けない
+		switch stmt.Expression.(type) {
+		case *ast.IfExpression, *ast.MatchExpression:
+		default:
+			p.buf.WriteString(";")
+		}
+
+	case *ast.BlockStatement:
+		p.block(stmt)
+
+	case *ast.WhileStatement:
+		p.buf.WriteString("while (")
+		p.expression(stmt.Condition, parser.LOWEST)
+		p.buf.WriteString(") ")
+		p.block(stmt.Body)
+
+	case *ast.ForStatement:
+		p.buf.WriteString("for (" + stmt.Variable.Value + " in ")
+		p.expression(stmt.Iterable, parser.LOWEST)
+		p.buf.WriteString(") ")
+		p.block(stmt.Body)
+
+	case *ast.ImportStatement:
+		p.buf.WriteString("import " + stmt.Path.String() + " as " + stmt.Name.Value + ";")
+
+	case *ast.ExportStatement:
+		p.buf.WriteString("export ")
+		p.statement(stmt.Statement)
+
+	case *ast.BreakStatement:
+		p.buf.WriteString("break;")
+
+	case *ast.ContinueStatement:
+		p.buf.WriteString("continue;")
+
+	default:
+		p.buf.WriteString(stmt.String())
+	}
+}
+
+// expression 式を出力する
+// 式の優先順位が precedence より低い場合は括弧で囲む
+func (p *printer) expression(exp ast.Expression, precedence int) {
+	if expressionPrecedence(exp) < precedence {
+		p.buf.WriteString("(")
+		defer p.buf.WriteString(")")
+	}
+
+	switch exp := exp.(type) {
+	case *ast.PrefixExpression:
+		p.buf.WriteString(exp.Operator)
+		p.expression(exp.Right, parser.PREFIX)
+
+	case *ast.InfixExpression:
+		// 左結合なので、右辺は同じ優先順位でも括弧で囲む
+		prec := parser.Precedence(exp.Token.Type)
+		p.expression(exp.Left, prec)
+		p.buf.WriteString(" " + exp.Operator + " ")
+		p.expression(exp.Right, prec+1)
+
+	case *ast.IfExpression:
+		p.buf.WriteString("if (")
+		p.expression(exp.Condition, parser.LOWEST)
+		p.buf.WriteString(") ")
+		p.block(exp.Consequence)
+		if exp.Alternative != nil {
+			p.buf.WriteString(" else ")
+			p.block(exp.Alternative)
+		}
+
+	case *ast.MatchExpression:
+		p.buf.WriteString("match (")
+		p.expression(exp.Subject, parser.LOWEST)
+		p.buf.WriteString(") ")
+		p.matchArms(exp)
+
+	case *ast.FunctionLiteral:
+		if exp.IsShorthand() {
+			p.shorthandFunction(exp)
+			break
+		}
+		p.buf.WriteString("fn(")
+		for i, param := range exp.Parameters {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.patternElement(param)
+		}
+		if exp.Rest != nil {
+			if len(exp.Parameters) > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.buf.WriteString("..." + exp.Rest.Value)
+		}
+		p.buf.WriteString(") ")
+		p.block(exp.Body)
+
+	case *ast.PipeExpression:
+		// 左結合なので、右辺は同じ優先順位でも括弧で囲む
+		p.expression(exp.Left, parser.PIPELINE)
+		p.buf.WriteString(" |> ")
+		p.expression(exp.Right, parser.PIPELINE+1)
+
+	case *ast.CallExpression:
+		p.expression(exp.Function, parser.CALL)
+		p.list("(", ")", exp.Token, exp.EndToken, nodes(exp.Arguments), func(i int) {
+			p.expression(exp.Arguments[i], parser.LOWEST)
+		})
+
+	case *ast.SpreadElement:
+		p.buf.WriteString("...")
+		p.expression(exp.Value, parser.LOWEST)
+
+	case *ast.NamedArgument:
+		p.buf.WriteString(exp.Name.Value + ": ")
+		p.expression(exp.Value, parser.LOWEST)
+
+	case *ast.ArrayLiteral:
+		p.list("[", "]", exp.Token, exp.EndToken, nodes(exp.Elements), func(i int) {
+			p.expression(exp.Elements[i], parser.LOWEST)
+		})
+
+	case *ast.HashLiteral:
+		pairs := make([]ast.Node, len(exp.Pairs))
+		for i, pair := range exp.Pairs {
+			pairs[i] = pair
+		}
+		p.list("{", "}", exp.Token, exp.EndToken, pairs, func(i int) {
+			p.expression(exp.Pairs[i].Key, parser.LOWEST)
+			p.buf.WriteString(": ")
+			p.expression(exp.Pairs[i].Value, parser.LOWEST)
+		})
+
+	case *ast.IndexExpression:
+		p.expression(exp.Left, parser.INDEX)
+		p.buf.WriteString("[")
+		p.expression(exp.Index, parser.LOWEST)
+		p.buf.WriteString("]")
+
+	case *ast.PropertyExpression:
+		p.expression(exp.Left, parser.INDEX)
+		p.buf.WriteString("." + exp.Property.Value)
+
+	case *ast.AssignExpression:
+		// 右結合なので、右辺は同じ優先順位でも括弧で囲まない
+		p.expression(exp.Target, parser.INDEX)
+		p.buf.WriteString(" " + exp.Operator + " ")
+		p.expression(exp.Value, parser.ASSIGN)
+
+	default:
+		p.buf.WriteString(exp.String())
+	}
+}
+
+// pattern let文や関数の引数の束縛先、match式のパターンを出力する
+func (p *printer) pattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.ArrayPattern:
+		p.buf.WriteString("[")
+		for i, el := range pattern.Elements {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.patternElement(el)
+		}
+		if pattern.Rest != nil {
+			if len(pattern.Elements) > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.buf.WriteString("..." + pattern.Rest.Value)
+		}
+		p.buf.WriteString("]")
+
+	case *ast.HashPattern:
+		p.buf.WriteString("{")
+		for i, el := range pattern.Elements {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.patternElement(el)
+		}
+		p.buf.WriteString("}")
+
+	default:
+		p.buf.WriteString(pattern.String())
+	}
+}
+
+func (p *printer) patternElement(el *ast.PatternElement) {
+	// {name: name} は {name} と出力する
+	if ident, ok := el.Target.(*ast.Identifier); el.Key != nil && (!ok || ident.Value != el.Key.Value) {
+		p.buf.WriteString(el.Key.Value + ": ")
+	}
+	p.pattern(el.Target)
+	if el.Default != nil {
+		p.buf.WriteString(" = ")
+		p.expression(el.Default, parser.ASSIGN+1)
+	}
+}
+
+// shorthandFunction 短縮形の関数を |x, y| x + y の形で出力する
+func (p *printer) shorthandFunction(fn *ast.FunctionLiteral) {
+	p.buf.WriteString("|")
+	for i, param := range fn.Parameters {
+		if i > 0 {
+			p.buf.WriteString(", ")
+		}
+		p.patternElement(param)
+	}
+	if fn.Rest != nil {
+		if len(fn.Parameters) > 0 {
+			p.buf.WriteString(", ")
+		}
+		p.buf.WriteString("..." + fn.Rest.Value)
+	}
+	p.buf.WriteString("| ")
+	p.expression(fn.Body.Statements[0].(*ast.ExpressionStatement).Expression, parser.LOWEST)
+}
+
+// matchArms match式の腕を1行に1つずつ、末尾にカンマを付けて出力する
+// 腕の間と後ろに書かれたコメントは、その腕の前と後ろに出力する
+func (p *printer) matchArms(me *ast.MatchExpression) {
+	end := me.EndToken.Line
+	if len(me.Arms) == 0 && !(end > 0 && p.hasCommentBefore(end)) {
+		p.buf.WriteString("{}")
+		return
+	}
+
+	// 腕はそれぞれ別の行なので、外側の並びに関わらず行の長さで改行する
+	outer := p.flat
+	p.flat = false
+	defer func() { p.flat = outer }()
+
+	p.buf.WriteString("{\n")
+	p.indent++
+	for i, arm := range me.Arms {
+		p.commentLines(nodeLine(arm.Pattern))
+		p.writeIndent()
+		p.pattern(arm.Pattern)
+		if arm.Guard != nil {
+			p.buf.WriteString(" if ")
+			p.expression(arm.Guard, parser.LOWEST)
+		}
+		p.buf.WriteString(" => ")
+		p.expression(arm.Body, parser.LOWEST)
+		p.buf.WriteString(",")
+
+		next := end
+		if i+1 < len(me.Arms) {
+			next = nodeLine(me.Arms[i+1].Pattern)
+		}
+		p.trailingComments(next)
+		p.buf.WriteString("\n")
+	}
+	p.commentLines(end)
+	p.indent--
+	p.writeIndent()
+	p.buf.WriteString("}")
+}
+
+// list 括弧で囲まれた要素の並びを出力する。start と end は開き括弧と閉じ括弧のトークンで、element は i 番目の要素を出力する
+// 元のソースコードで開き括弧の直後で改行していた場合、要素の間にコメントがある場合、1行に収まらない場合は、
+// 1行に1要素ずつ、末尾にカンマを付けて出力する
+func (p *printer) list(open, close string, start, end token.Token, elements []ast.Node, element func(i int)) {
+	broken := len(elements) > 0 && start.Line > 0 && nodeLine(elements[0]) > start.Line
+	if !broken && !p.hasListComment(start, end, elements) {
+		mark := p.buf.Len()
+		outer := p.flat
+		p.flat = true
+		p.buf.WriteString(open)
+		for i := range elements {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			element(i)
+		}
+		p.buf.WriteString(close)
+		p.flat = outer
+		if outer || p.fits(mark) {
+			return
+		}
+		p.buf.Truncate(mark)
+	}
+
+	p.buf.WriteString(open + "\n")
+	p.indent++
+	for i := range elements {
+		p.commentLines(nodeLine(elements[i]))
+		p.writeIndent()
+		element(i)
+		p.buf.WriteString(",")
+
+		next := end.Line
+		if i+1 < len(elements) {
+			next = nodeLine(elements[i+1])
+		}
+		p.trailingComments(next)
+		p.buf.WriteString("\n")
+	}
+	p.commentLines(end.Line)
+	p.indent--
+	p.writeIndent()
+	p.buf.WriteString(close)
+}
+
+// hasListComment 括弧の中に、並びの要素の間や後ろに書かれたコメントがあるか
+// 要素の中のブロックや括弧の中のコメントは、そのブロックや括弧の中に出力するので含めない
+func (p *printer) hasListComment(start, end token.Token, elements []ast.Node) bool {
+	for _, comment := range p.comments {
+		if !isBetween(comment, start, end) {
+			continue
+		}
+		inner := false
+		for _, el := range elements {
+			ast.Inspect(el, func(n ast.Node) bool {
+				if s, e, ok := brackets(n); ok && isBetween(comment, s, e) {
+					inner = true
+				}
+				return !inner
+			})
+		}
+		if !inner {
+			return true
+		}
+	}
+	return false
+}
+
+// fits mark から出力した内容が、その行の長さを LINE_WIDTH 以下に収めているか
+// 出力した内容が複数行にわたる場合は、最初の行のみを数える
+func (p *printer) fits(mark int) bool {
+	out := p.buf.Bytes()
+	lineStart := bytes.LastIndexByte(out[:mark], '\n') + 1
+	line := out[lineStart:]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	indent := len(line) - len(bytes.TrimLeft(line, INDENT))
+	return indent*indentWidth+utf8.RuneCount(line[indent:]) <= LINE_WIDTH
+}
+
+// block 中括弧で囲まれたブロックを出力する
+// 中身が空の場合は {} と出力する
+func (p *printer) block(b *ast.BlockStatement) {
+	end := b.EndToken.Line
+	if len(b.Statements) == 0 && !(end > 0 && p.hasCommentBefore(end)) {
+		p.buf.WriteString("{}")
+		return
+	}
+
+	// ブロックの文はそれぞれ別の行なので、外側の並びに関わらず行の長さで改行する
+	outer := p.flat
+	p.flat = false
+	defer func() { p.flat = outer }()
+
+	p.buf.WriteString("{\n")
+	p.indent++
+	p.statements(b.Statements, end)
+	p.indent--
+	p.writeIndent()
+	p.buf.WriteString("}")
+}
+
+func (p *printer) writeIndent() {
+	p.buf.WriteString(strings.Repeat(INDENT, p.indent))
+}
+
+// separate 並びの先頭でなく、元のソースコードで直前が空行だった場合は空行を1つ出力する
+func (p *printer) separate(line int, first bool) {
+	if !first && p.isBlankLine(line-1) {
+		p.buf.WriteString("\n")
+	}
+}
+
+func (p *printer) isBlankLine(line int) bool {
+	if line < 1 || line > len(p.lines) {
+		return false
+	}
+	return strings.TrimSpace(p.lines[line-1]) == ""
+}
+
+// isTrailing コメントが同じ行のコードの後ろに書かれているか
+func (p *printer) isTrailing(comment token.Token) bool {
+	if comment.Line < 1 || comment.Line > len(p.lines) {
+		return false
+	}
+	return strings.TrimSpace(p.lines[comment.Line-1][:comment.Column-1]) != ""
+}
+
+// commentLines line 行より前にあるコメントを、1つずつ独立した行として出力する
+func (p *printer) commentLines(line int) {
+	for p.hasCommentBefore(line) {
+		p.writeIndent()
+		p.buf.WriteString(p.popComment().Literal)
+		p.buf.WriteString("\n")
+	}
+}
+
+// trailingComments 直前に出力したコードの後ろに書かれた、next 行より前のコメントを同じ行に出力する(next が0の場合は全て)
+func (p *printer) trailingComments(next int) {
+	for len(p.comments) > 0 && p.isTrailing(p.comments[0]) && (next == 0 || p.comments[0].Line < next) {
+		p.buf.WriteString(" ")
+		p.buf.WriteString(p.popComment().Literal)
+	}
+}
+
+func (p *printer) hasCommentBefore(line int) bool {
+	return len(p.comments) > 0 && p.comments[0].Line < line
+}
+
+func (p *printer) popComment() token.Token {
+	comment := p.comments[0]
+	p.comments = p.comments[1:]
+	return comment
+}
+
+// startLine 文が始まる行番号を戻す
+func startLine(stmt ast.Statement) int {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token.Line
+	case *ast.ReturnStatement:
+		return stmt.Token.Line
+	case *ast.ExpressionStatement:
+		return stmt.Token.Line
+	case *ast.BlockStatement:
+		return stmt.Token.Line
+	case *ast.WhileStatement:
+		return stmt.Token.Line
+	case *ast.ForStatement:
+		return stmt.Token.Line
+	case *ast.BreakStatement:
+		return stmt.Token.Line
+	case *ast.ContinueStatement:
+		return stmt.Token.Line
+	case *ast.ImportStatement:
+		return stmt.Token.Line
+	case *ast.ExportStatement:
+		return stmt.Token.Line
+	}
+	return 0
+}
+
+// nodeLine 式やパターンが始まる行番号を戻す。不明な場合は0
+func nodeLine(node ast.Node) int {
+	switch node := node.(type) {
+	case *ast.InfixExpression:
+		return nodeLine(node.Left)
+	case *ast.PipeExpression:
+		return nodeLine(node.Left)
+	case *ast.CallExpression:
+		return nodeLine(node.Function)
+	case *ast.IndexExpression:
+		return nodeLine(node.Left)
+	case *ast.PropertyExpression:
+		return nodeLine(node.Left)
+	case *ast.AssignExpression:
+		return nodeLine(node.Target)
+	case *ast.NamedArgument:
+		return node.Name.Token.Line
+	case *ast.HashPair:
+		return nodeLine(node.Key)
+	case *ast.Identifier:
+		return node.Token.Line
+	case *ast.IntegerLiteral:
+		return node.Token.Line
+	case *ast.FloatLiteral:
+		return node.Token.Line
+	case *ast.StringLiteral:
+		return node.Token.Line
+	case *ast.Boolean:
+		return node.Token.Line
+	case *ast.ArrayLiteral:
+		return node.Token.Line
+	case *ast.HashLiteral:
+		return node.Token.Line
+	case *ast.PrefixExpression:
+		return node.Token.Line
+	case *ast.IfExpression:
+		return node.Token.Line
+	case *ast.MatchExpression:
+		return node.Token.Line
+	case *ast.FunctionLiteral:
+		return node.Token.Line
+	case *ast.SpreadElement:
+		return node.Token.Line
+	case *ast.ArrayPattern:
+		return node.Token.Line
+	case *ast.HashPattern:
+		return node.Token.Line
+	}
+	return 0
+}
+
+func nodes(exps []ast.Expression) []ast.Node {
+	nodes := make([]ast.Node, len(exps))
+	for i, exp := range exps {
+		nodes[i] = exp
+	}
+	return nodes
+}
+
+// brackets 中身を自身で整形するブロックや括弧の、開き括弧と閉じ括弧のトークンを戻す
+func brackets(node ast.Node) (start, end token.Token, ok bool) {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		return node.Token, node.EndToken, true
+	case *ast.ArrayLiteral:
+		return node.Token, node.EndToken, true
+	case *ast.HashLiteral:
+		return node.Token, node.EndToken, true
+	case *ast.CallExpression:
+		return node.Token, node.EndToken, true
+	case *ast.MatchExpression:
+		return node.Token, node.EndToken, true
+	}
+	return start, end, false
+}
+
+// isBetween トークン tok が start と end の間にあるか
+func isBetween(tok, start, end token.Token) bool {
+	return isBefore(start, tok) && isBefore(tok, end)
+}
+
+// isBefore トークン a が b より前にあるか
+func isBefore(a, b token.Token) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// expressionPrecedence 式全体の優先順位を戻す
+func expressionPrecedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(exp.Token.Type)
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.AssignExpression:
+		return parser.ASSIGN
+	case *ast.PipeExpression:
+		return parser.PIPELINE
+	case *ast.FunctionLiteral:
+		// 短縮形の関数の本体はできるだけ長く読まれるので、後ろに演算子が続く場合は括弧で囲む
+		if exp.IsShorthand() {
+			return parser.ASSIGN
+		}
+	}
+	return primary
+}
@@ -0,0 +1,143 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/Sa2Knight/maron/lexer"
+	"github.com/Sa2Knight/maron/parser"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let   x=5",
+			"let x = 5;\n",
+		},
+		{
+			"let x = 5; let y = 10;\n\n\n\nx+y",
+			"let x = 5;\nlet y = 10;\n\nx + y;\n",
+		},
+		{
+			"let add = fn(x,y){x+y;};add(1,2*3)",
+			"let add = fn(x, y) {\n\tx + y;\n};\nadd(1, 2 * 3);\n",
+		},
+		{
+			"if(x<y){return x}else{return y}",
+			"if (x < y) {\n\treturn x;\n} else {\n\treturn y;\n}\n",
+		},
+		{
+			"let f = fn() {}",
+			"let f = fn() {};\n",
+		},
+		{
+			"while(x<10){let x=x+1;if(x==5){continue}}for(y in ys){break;}",
+			"while (x < 10) {\n\tlet x = x + 1;\n\tif (x == 5) {\n\t\tcontinue;\n\t}\n}\nfor (y in ys) {\n\tbreak;\n}\n",
+		},
+		{
+			"const  n=1;x+=n*2;a=b=c;h.k[0]=(a=1)+2;xs[i+1].y",
+			"const n = 1;\nx += n * 2;\na = b = c;\nh.k[0] = (a = 1) + 2;\nxs[i + 1].y;\n",
+		},
+		{
+			"(1 + 2) * 3; 1 + (2 * 3); 1 - (2 - 3); (1 - 2) - 3; -(1 + 2); !-a",
+			"(1 + 2) * 3;\n1 + 2 * 3;\n1 - (2 - 3);\n1 - 2 - 3;\n-(1 + 2);\n!-a;\n",
+		},
+		{
+			`let [a,b=1,...rest]=[1,"two",{"k":[3]}];let {name,age:n=20}=p;fn([x],{y}){x}`,
+			"let [a, b = 1, ...rest] = [1, \"two\", {\"k\": [3]}];\nlet {name, age: n = 20} = p;\nfn([x], {y}) {\n\tx;\n};\n",
+		},
+		{
+			"let r=match(x){0=>\"zero\",[a,...b] if a>0=>a+1,{k}=>k,_=>-1};match(y){}",
+			"let r = match (x) {\n\t0 => \"zero\",\n\t[a, ...b] if a > 0 => a + 1,\n\t{k} => k,\n\t_ => -1,\n};\nmatch (y) {}\n",
+		},
+		{
+			"let f=fn(a,b=a*2,[c]=[1],...rest){a};f(1,...xs,b:2)",
+			"let f = fn(a, b = a * 2, [c] = [1], ...rest) {\n\ta;\n};\nf(1, ...xs, b: 2);\n",
+		},
+		{
+			"let r=xs|>map(|x|x*2)|>(|| 1)();let f=(|x|x)(1)+|y|y",
+			"let r = xs |> map(|x| x * 2) |> (|| 1)();\nlet f = (|x| x)(1) + (|y| y);\n",
+		},
+		{
+			"import \"lib/math.mr\" as math\nexport const [a,b]=[1,math.pi];export let f=fn(){a}",
+			"import \"lib/math.mr\" as math;\nexport const [a, b] = [1, math.pi];\nexport let f = fn() {\n\ta;\n};\n",
+		},
+		{
+			"let r=math.sqrt(2.50*-2.0)+math.pi",
+			"let r = math.sqrt(2.50 * -2.0) + math.pi;\n",
+		},
+		{
+			`let s="\u00e9\x01"+strings.upper("a\tb")`,
+			"let s = \"é\\x01\" + strings.upper(\"a\\tb\");\n",
+		},
+		{
+			"fn(x){x}(5)",
+			"fn(x) {\n\tx;\n}(5);\n",
+		},
+		{
+			"// 先頭のコメント\nlet x = 5; // 末尾のコメント\n\n// 関数\nlet f = fn(x) { // 引数をそのまま返す\n  x\n  // 最後のコメント\n};\n// ファイル末尾のコメント\n",
+			"// 先頭のコメント\nlet x = 5; // 末尾のコメント\n\n// 関数\nlet f = fn(x) {\n\t// 引数をそのまま返す\n\tx;\n\t// 最後のコメント\n};\n// ファイル末尾のコメント\n",
+		},
+		{
+			"if (true) {\n// 空のブロック\n}",
+			"if (true) {\n\t// 空のブロック\n}\n",
+		},
+		{
+			"let r = match (x) {\n  // ゼロ\n  0 => \"zero\", // 0の場合\n  _ => x,\n  // 最後のコメント\n}; // 文の後ろ",
+			"let r = match (x) {\n\t// ゼロ\n\t0 => \"zero\", // 0の場合\n\t_ => x,\n\t// 最後のコメント\n}; // 文の後ろ\n",
+		},
+		{
+			"let h = {\n  \"a\": 1, // 一\n  \"b\": [1,\n 2]\n  // 最後\n};\nlet e = [\n];\nf(\n  1,   2)",
+			"let h = {\n\t\"a\": 1, // 一\n\t\"b\": [1, 2],\n\t// 最後\n};\nlet e = [];\nf(\n\t1,\n\t2,\n);\n",
+		},
+		{
+			"let a = [x, // 要素の後ろ\n y];map(xs, fn(x) {\n // 関数の中\n x })",
+			"let a = [\n\tx, // 要素の後ろ\n\ty,\n];\nmap(xs, fn(x) {\n\t// 関数の中\n\tx;\n});\n",
+		},
+		{
+			"let xs = [\"aaaaaaaaaaaaaaaa\", \"bbbbbbbbbbbbbbbb\", \"cccccccccccccccc\", \"dddddddddddddddd\", {\"e\": \"eeeeeeeeeeeeeeee\"}]",
+			"let xs = [\n\t\"aaaaaaaaaaaaaaaa\",\n\t\"bbbbbbbbbbbbbbbb\",\n\t\"cccccccccccccccc\",\n\t\"dddddddddddddddd\",\n\t{\"e\": \"eeeeeeeeeeeeeeee\"},\n];\n",
+		},
+		{
+			"each(xs, fn(x) { f(\"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa\", \"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb\") })",
+			"each(xs, fn(x) {\n\tf(\n\t\t\"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa\",\n\t\t\"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb\",\n\t);\n});\n",
+		},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Fatalf("Source(%q) returned error: %s", tt.input, err)
+		}
+		if string(formatted) != tt.expected {
+			t.Errorf("Source(%q) wrong.\nwant=%q\ngot =%q", tt.input, tt.expected, string(formatted))
+		}
+
+		// 整形済みのソースコードは再度整形しても変わらない
+		again, err := Source(formatted)
+		if err != nil {
+			t.Fatalf("Source(%q) returned error: %s", formatted, err)
+		}
+		if string(again) != string(formatted) {
+			t.Errorf("Source is not idempotent.\nfirst =%q\nsecond=%q", string(formatted), string(again))
+		}
+	}
+}
+
+func TestSourceParseError(t *testing.T) {
+	if _, err := Source([]byte("let = 5")); err == nil {
+		t.Errorf("Source must return error for invalid source")
+	}
+}
+
+func TestNode(t *testing.T) {
+	p := parser.New(lexer.New("let x = fn(a) { a * (a + 1) }; // comment"))
+	program := p.ParseProgram()
+
+	expected := "let x = fn(a) {\n\ta * (a + 1);\n};\n"
+	if got := Node(program); got != expected {
+		t.Errorf("Node wrong.\nwant=%q\ngot =%q", expected, got)
+	}
+}
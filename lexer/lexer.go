@@ -1,26 +1,45 @@
 package lexer
 
 import (
+	"strings"
+	"unicode/utf8"
+
 	"github.com/Sa2Knight/maron/token"
 )
 
 // Lexer 字句解析器
-// NOTE: ASCIIのみ対応
+// NOTE: ASCIIのみ対応 (文字列リテラルとコメントにはUTF-8の文字も書ける)
 type Lexer struct {
 	input        string // 字句解析対象の文字列
 	position     int    // 現在解析中の文字の位置
 	readPosition int    // 次に解析する文字の位置(position + 1)
 	ch           byte   // 現在解析中の文字
+	line         int    // 現在解析中の文字の行番号
+	column       int    // 現在解析中の文字の列番号
+
+	comments []token.Token // 読み飛ばしたコメント
 }
 
 // New 字句解析器Lexerを新規生成
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
+// Comments これまでに読み飛ばしたコメントの一覧を戻す
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -32,14 +51,26 @@ func (l *Lexer) readChar() {
 
 // NextToken 次のトークンの解析結果を取得し、次の文字に進む
 func (l *Lexer) NextToken() token.Token {
+	l.skipWhitespaceAndComments()
+
+	line, column := l.line, l.column
+	tok := l.nextToken()
+	tok.Line = line
+	tok.Column = column
+	return tok
+}
+
+func (l *Lexer) nextToken() token.Token {
 	var tok token.Token
-	l.skipWhitespace()
 
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
 			l.readChar()
 			tok = token.Token{Type: token.EQ, Literal: "=="}
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.ARROW, Literal: "=>"}
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
@@ -51,14 +82,50 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.RPAREN, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
+	case '.':
+		if l.peekChar() == '.' && l.peekCharAt(1) == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
+	case '"':
+		if str, ok := l.readString(); ok {
+			tok = token.Token{Type: token.STRING, Literal: str}
+		} else {
+			tok = token.Token{Type: token.ILLEGAL, Literal: str}
+		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.PLUS_ASSIGN, Literal: "+="}
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.MINUS_ASSIGN, Literal: "-="}
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.ASTERISK_ASSIGN, Literal: "*="}
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.SLASH_ASSIGN, Literal: "/="}
+		} else {
+			tok = newToken(token.SLASH, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			l.readChar()
@@ -66,6 +133,13 @@ func (l *Lexer) NextToken() token.Token {
 		} else {
 			tok = newToken(token.BANG, l.ch)
 		}
+	case '|':
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.PIPELINE, Literal: "|>"}
+		} else {
+			tok = newToken(token.PIPE, l.ch)
+		}
 	case '<':
 		tok = newToken(token.LT, l.ch)
 	case '>':
@@ -74,6 +148,10 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
 		tok = newToken(token.RBRACE, l.ch)
+	case '[':
+		tok = newToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(token.RBRACKET, l.ch)
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -83,8 +161,7 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Type = token.LookupIdent(tok.Literal)
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Literal = l.readNumber()
-			tok.Type = token.INT
+			tok.Literal, tok.Type = l.readNumber()
 			return tok
 		}
 		tok = newToken(token.ILLEGAL, l.ch)
@@ -104,29 +181,133 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+// 空白とコメントを読み飛ばす。コメントは後から参照できるよう記録しておく
+func (l *Lexer) skipWhitespaceAndComments() {
+	l.skipWhitespace()
+	for l.ch == '/' && l.peekChar() == '/' {
+		l.comments = append(l.comments, l.readComment())
+		l.skipWhitespace()
+	}
+}
+
+func (l *Lexer) readComment() token.Token {
+	tok := token.Token{Type: token.COMMENT, Line: l.line, Column: l.column}
+	positionFrom := l.position
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	tok.Literal = strings.TrimRight(l.input[positionFrom:l.position], " \t\r")
+	return tok
+}
+
+// readIdentifier 識別子を読み込む。2文字目以降には数字も使える (log2)
 func (l *Lexer) readIdentifier() string {
 	positionFrom := l.position
-	for isLetter(l.ch) {
+	for isLetter(l.ch) || isDigit(l.ch) {
 		l.readChar()
 	}
 	positionTo := l.position
 	return l.input[positionFrom:positionTo]
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber 数値リテラルを読み込む
+// 小数点の後に数字が続く場合は浮動小数点数リテラルとする
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	positionFrom := l.position
+	tokenType := token.TokenType(token.INT)
 	for isDigit(l.ch) {
 		l.readChar()
 	}
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
 	positionTo := l.position
-	return l.input[positionFrom:positionTo]
+	return l.input[positionFrom:positionTo], tokenType
+}
+
+// 1文字のエスケープシーケンスと、展開後の文字
+var escapes = map[byte]byte{
+	'a': '\a', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t', 'v': '\v', '"': '"', '\\': '\\',
+}
+
+// 16進数で文字を指定するエスケープシーケンスと、桁数
+// \x はバイト、\u と \U はUnicodeのコードポイントを指定する
+var hexEscapes = map[byte]int{'x': 2, 'u': 4, 'U': 8}
+
+// readString 文字列リテラルを読み込み、エスケープシーケンスを展開した内容を戻す
+// エスケープシーケンスは strconv.Quote が出力するものと同じ (Goの文字列リテラルと同じ)
+// 閉じる " がない場合や、不正なエスケープシーケンスがある場合は ok が false になる
+func (l *Lexer) readString() (str string, ok bool) {
+	var out strings.Builder
+	for {
+		l.readChar()
+		switch l.ch {
+		case '"':
+			return out.String(), true
+		case 0:
+			return out.String(), false
+		case '\\':
+			l.readChar()
+			if ch, ok := escapes[l.ch]; ok {
+				out.WriteByte(ch)
+				continue
+			}
+			digits, ok := hexEscapes[l.ch]
+			if !ok {
+				return out.String(), false
+			}
+			kind := l.ch
+			value, ok := l.readHex(digits)
+			if !ok {
+				return out.String(), false
+			}
+			if kind == 'x' {
+				out.WriteByte(byte(value))
+			} else if utf8.ValidRune(rune(value)) {
+				out.WriteRune(rune(value))
+			} else {
+				return out.String(), false
+			}
+		default:
+			out.WriteByte(l.ch)
+		}
+	}
+}
+
+// readHex エスケープシーケンスの digits 桁の16進数を読み込む
+func (l *Lexer) readHex(digits int) (value uint32, ok bool) {
+	for i := 0; i < digits; i++ {
+		l.readChar()
+		var d byte
+		switch {
+		case isDigit(l.ch):
+			d = l.ch - '0'
+		case 'a' <= l.ch && l.ch <= 'f':
+			d = l.ch - 'a' + 10
+		case 'A' <= l.ch && l.ch <= 'F':
+			d = l.ch - 'A' + 10
+		default:
+			return 0, false
+		}
+		value = value<<4 | uint32(d)
+	}
+	return value, true
 }
 
 func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
+	return l.peekCharAt(0)
+}
+
+// peekCharAt 次の文字から n 文字先の文字を戻す
+func (l *Lexer) peekCharAt(n int) byte {
+	if l.readPosition+n >= len(l.input) {
 		return 0
 	}
-	return l.input[l.readPosition]
+	return l.input[l.readPosition+n]
 }
 
 func isLetter(ch byte) bool {
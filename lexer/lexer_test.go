@@ -122,3 +122,228 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestAssignmentTokens(t *testing.T) {
+	input := "const a = 1; a += 2; a -= 3; a *= 4; a /= 5; x[0] = h.k;"
+
+	expectedTypes := []token.TokenType{
+		token.CONST, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.PLUS_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.MINUS_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.ASTERISK_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.SLASH_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.LBRACKET, token.INT, token.RBRACKET, token.ASSIGN, token.IDENT, token.DOT, token.IDENT, token.SEMICOLON,
+		token.EOF,
+	}
+
+	l := New(input)
+	for i, expected := range expectedTypes {
+		if tok := l.NextToken(); tok.Type != expected {
+			t.Fatalf("test[%d] - tokentype wrong. expected=%q, got=%q", i, expected, tok.Type)
+		}
+	}
+}
+
+func TestStringAndPatternTokens(t *testing.T) {
+	input := `let [a, ...rest] = ["foo bar", "a\"b\\c\n"]; let {k: v} = h; "unterminated`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.LBRACKET, "["},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.RBRACKET, "]"},
+		{token.ASSIGN, "="},
+		{token.LBRACKET, "["},
+		{token.STRING, "foo bar"},
+		{token.COMMA, ","},
+		{token.STRING, "a\"b\\c\n"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.LET, "let"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "k"},
+		{token.COLON, ":"},
+		{token.IDENT, "v"},
+		{token.RBRACE, "}"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "h"},
+		{token.SEMICOLON, ";"},
+		{token.ILLEGAL, "unterminated"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("test[%d] - token wrong. expected=%q %q, got=%q %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected token.Token
+	}{
+		{`"\a\b\f\n\r\t\v\"\\"`, token.Token{Type: token.STRING, Literal: "\a\b\f\n\r\t\v\"\\"}},
+		{`"\x41\u00e9\U0001F600"`, token.Token{Type: token.STRING, Literal: "Aé😀"}},
+		{`"日本語"`, token.Token{Type: token.STRING, Literal: "日本語"}},
+		{`"\xff"`, token.Token{Type: token.STRING, Literal: "\xff"}},
+		{`"\q"`, token.Token{Type: token.ILLEGAL, Literal: ""}},
+		{`"\x4"`, token.Token{Type: token.ILLEGAL, Literal: ""}},
+		{`"\uD800"`, token.Token{Type: token.ILLEGAL, Literal: ""}},
+	}
+
+	for i, tt := range tests {
+		tok := New(tt.input).NextToken()
+		if tok.Type != tt.expected.Type || tok.Literal != tt.expected.Literal {
+			t.Errorf("test[%d] - token wrong. expected=%q %q, got=%q %q", i, tt.expected.Type, tt.expected.Literal, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestMatchTokens(t *testing.T) {
+	input := `match (x) { 1 => a, _ if a == b => c }`
+
+	expectedTypes := []token.TokenType{
+		token.MATCH, token.LPAREN, token.IDENT, token.RPAREN, token.LBRACE,
+		token.INT, token.ARROW, token.IDENT, token.COMMA,
+		token.IDENT, token.IF, token.IDENT, token.EQ, token.IDENT, token.ARROW, token.IDENT,
+		token.RBRACE, token.EOF,
+	}
+
+	l := New(input)
+	for i, expected := range expectedTypes {
+		if tok := l.NextToken(); tok.Type != expected {
+			t.Fatalf("test[%d] - tokentype wrong. expected=%q, got=%q", i, expected, tok.Type)
+		}
+	}
+}
+
+func TestPipeTokens(t *testing.T) {
+	input := `xs |> map(|x| x * 2) |>sum`
+
+	expectedTypes := []token.TokenType{
+		token.IDENT, token.PIPELINE, token.IDENT, token.LPAREN,
+		token.PIPE, token.IDENT, token.PIPE, token.IDENT, token.ASTERISK, token.INT, token.RPAREN,
+		token.PIPELINE, token.IDENT, token.EOF,
+	}
+
+	l := New(input)
+	for i, expected := range expectedTypes {
+		if tok := l.NextToken(); tok.Type != expected {
+			t.Fatalf("test[%d] - tokentype wrong. expected=%q, got=%q", i, expected, tok.Type)
+		}
+	}
+}
+
+func TestModuleTokens(t *testing.T) {
+	input := `import "lib/math.mr" as math; export const pi = math.pi;`
+
+	expectedTypes := []token.TokenType{
+		token.IMPORT, token.STRING, token.AS, token.IDENT, token.SEMICOLON,
+		token.EXPORT, token.CONST, token.IDENT, token.ASSIGN, token.IDENT, token.DOT, token.IDENT, token.SEMICOLON,
+		token.EOF,
+	}
+
+	l := New(input)
+	for i, expected := range expectedTypes {
+		if tok := l.NextToken(); tok.Type != expected {
+			t.Fatalf("test[%d] - tokentype wrong. expected=%q, got=%q", i, expected, tok.Type)
+		}
+	}
+}
+
+func TestNumberAndIdentifierTokens(t *testing.T) {
+	input := `3.14 + 10.0 - 7. log2`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FLOAT, "3.14"},
+		{token.PLUS, "+"},
+		{token.FLOAT, "10.0"},
+		{token.MINUS, "-"},
+		{token.INT, "7"},
+		{token.DOT, "."},
+		{token.IDENT, "log2"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("test[%d] - token wrong. expected=%q %q, got=%q %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestTokenPosition(t *testing.T) {
+	input := "let x = 5;\n  x + 10"
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.IDENT, 2, 3},
+		{token.PLUS, 2, 5},
+		{token.INT, 2, 7},
+		{token.EOF, 2, 9},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("test[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("test[%d] - position wrong. expected=%d:%d, got=%d:%d", i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// 先頭のコメント
+let x = 10 / 2; // 末尾のコメント
+x`
+
+	expectedTypes := []token.TokenType{
+		token.LET, token.IDENT, token.ASSIGN, token.INT, token.SLASH, token.INT, token.SEMICOLON, token.IDENT, token.EOF,
+	}
+
+	l := New(input)
+	for i, expected := range expectedTypes {
+		if tok := l.NextToken(); tok.Type != expected {
+			t.Fatalf("test[%d] - tokentype wrong. expected=%q, got=%q", i, expected, tok.Type)
+		}
+	}
+
+	comments := l.Comments()
+	if len(comments) != 2 {
+		t.Fatalf("comments has wrong length. got=%d", len(comments))
+	}
+	if comments[0].Literal != "// 先頭のコメント" || comments[0].Line != 1 {
+		t.Errorf("comments[0] wrong. got=%+v", comments[0])
+	}
+	if comments[1].Literal != "// 末尾のコメント" || comments[1].Line != 2 || comments[1].Column != 17 {
+		t.Errorf("comments[1] wrong. got=%+v", comments[1])
+	}
+}
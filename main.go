@@ -1,19 +1,97 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/user"
+	"path/filepath"
+	"strings"
 
+	"github.com/Sa2Knight/maron/ast"
+	"github.com/Sa2Knight/maron/engine"
+	"github.com/Sa2Knight/maron/lexer"
+	"github.com/Sa2Knight/maron/parser"
 	"github.com/Sa2Knight/maron/repl"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+			serve(os.Args[2:])
+			return
+		case "fmt":
+			os.Exit(formatFiles(os.Args[2:]))
+		case "ast":
+			os.Exit(dumpAST(os.Args[2:]))
+		case "run":
+			os.Exit(runFile(os.Args[2:]))
+		case "build":
+			os.Exit(buildFile(os.Args[2:]))
+		case "disasm":
+			os.Exit(disassembleFile(os.Args[2:]))
+		}
+	}
+
+	quiet := flag.Bool("quiet", false, "プロンプトやバナーを表示せず、評価結果のみを出力する")
+	engineName := flag.String("engine", engine.EVAL, "実行エンジン (eval or vm)")
+	optimize := flag.Bool("optimize", false, "実行前にプログラムを最適化する")
+	flag.Parse()
+
+	if _, err := engine.New(*engineName); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
 	}
-	fmt.Printf("Hello %s! This is the Maron programming language!\n", user.Username)
-	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+
+	opts := repl.DefaultOptions()
+	opts.Quiet = *quiet
+	opts.Engine = *engineName
+	opts.Optimize = *optimize
+	opts.Banner = fmt.Sprintf("Hello %s! This is the Maron programming language!\n", user.Username) +
+		"Feel free to type in commands\n"
+	repl.StartWithOptions(os.Stdin, os.Stdout, opts)
+}
+
+// MODULE_PATH_ENV モジュールを探すディレクトリの一覧(: 区切り)を指定する環境変数
+const MODULE_PATH_ENV = "MARON_PATH"
+
+// modulePath import文で相対パスのモジュールを探すディレクトリの一覧を戻す
+// path が空であれば環境変数 MARON_PATH を使う
+func modulePath(path string) []string {
+	if path == "" {
+		path = os.Getenv(MODULE_PATH_ENV)
+	}
+	return filepath.SplitList(path)
+}
+
+// parseFile ファイルを読み込んで構文解析する
+func parseFile(filename string) (*ast.Program, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parseSource(filename, src, nil)
+}
+
+// parseSource 読み込み済みのソースコードを構文解析する
+// warn がnilでなければ、構文解析時の警告を出力する
+func parseSource(filename string, src []byte, warn io.Writer) (*ast.Program, error) {
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s: %s", filename, strings.Join(p.Errors(), "\n\t"))
+	}
+	if warn != nil {
+		for _, msg := range p.Warnings() {
+			fmt.Fprintf(warn, "%s: warning: %s\n", filename, msg)
+		}
+	}
+	return program, nil
 }
@@ -0,0 +1,127 @@
+package module
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Sa2Knight/maron/ast"
+	"github.com/Sa2Knight/maron/lexer"
+	"github.com/Sa2Knight/maron/object"
+	"github.com/Sa2Knight/maron/parser"
+)
+
+// Loader ファイルからモジュールを読み込む object.ModuleLoader
+// 同じファイルのモジュールは一度だけ評価(コンパイル)し、以降は記録した結果を使い回す
+type Loader struct {
+	searchPaths []string
+	loading     []loading                // 読み込み中のモジュール(先頭はメインのプログラム)
+	modules     map[string]object.Object // 読み込み済みのモジュール(解決済みのパスがキー)
+}
+
+// loading 読み込み中のモジュール
+type loading struct {
+	path string // 解決済みのパス
+	name string // import文で指定したパス(エラーメッセージ用)
+}
+
+// NewLoader main を起点にモジュールを読み込む Loader を生成する
+// main はメインのプログラムのファイル名で、空であればカレントディレクトリを起点にする
+// 相対パスのモジュールは、import文を書いたファイルのディレクトリ、searchPaths の順に探す
+// ./ や ../ で始まるパスは、import文を書いたファイルのディレクトリからのみ探す
+func NewLoader(main string, searchPaths ...string) *Loader {
+	l := &Loader{searchPaths: searchPaths, modules: map[string]object.Object{}}
+	if main != "" {
+		path, err := filepath.Abs(main)
+		if err == nil {
+			// 存在しないファイルでも、そのディレクトリを起点にする
+			if resolved, err := filepath.EvalSymlinks(path); err == nil {
+				path = resolved
+			}
+			l.loading = append(l.loading, loading{path: path, name: main})
+		}
+	}
+	return l
+}
+
+// Import is object.ModuleLoader's method.
+func (l *Loader) Import(path string, load func(name string, program *ast.Program) (object.Object, error)) (object.Object, error) {
+	resolved, err := l.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	if mod, ok := l.modules[resolved]; ok {
+		return mod, nil
+	}
+	if err := l.checkCycle(resolved, path); err != nil {
+		return nil, err
+	}
+
+	src, err := os.ReadFile(resolved)
+	if err != nil {
+		return nil, err
+	}
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s: %s", path, strings.Join(p.Errors(), "\n\t"))
+	}
+
+	l.loading = append(l.loading, loading{path: resolved, name: path})
+	mod, err := load(path, program)
+	l.loading = l.loading[:len(l.loading)-1]
+	if err != nil {
+		return nil, err
+	}
+
+	l.modules[resolved] = mod
+	return mod, nil
+}
+
+// resolve モジュールのパスを、存在するファイルの絶対パスに解決する
+func (l *Loader) resolve(path string) (string, error) {
+	candidates := []string{path}
+	if !filepath.IsAbs(path) {
+		dir := "."
+		if len(l.loading) > 0 {
+			dir = filepath.Dir(l.loading[len(l.loading)-1].path)
+		}
+		candidates = []string{filepath.Join(dir, path)}
+
+		if !strings.HasPrefix(path, "./") && !strings.HasPrefix(path, "../") {
+			for _, sp := range l.searchPaths {
+				candidates = append(candidates, filepath.Join(sp, path))
+			}
+		}
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err != nil || info.IsDir() {
+			continue
+		}
+		resolved, err := filepath.Abs(candidate)
+		if err != nil {
+			return "", err
+		}
+		// シンボリックリンクを辿り、同じファイルを同じモジュールとして扱う
+		return filepath.EvalSymlinks(resolved)
+	}
+	return "", fmt.Errorf("cannot find module %q", path)
+}
+
+// checkCycle 読み込み中のモジュールを再び読み込もうとしていないか検査する
+func (l *Loader) checkCycle(resolved, name string) error {
+	for i, m := range l.loading {
+		if m.path != resolved {
+			continue
+		}
+		names := []string{}
+		for _, m := range l.loading[i:] {
+			names = append(names, m.name)
+		}
+		names = append(names, name)
+		return fmt.Errorf("import cycle: %s", strings.Join(names, " -> "))
+	}
+	return nil
+}
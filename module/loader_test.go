@@ -0,0 +1,113 @@
+package module
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Sa2Knight/maron/ast"
+	"github.com/Sa2Knight/maron/object"
+)
+
+func TestLoaderResolve(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"src/main.mr":     "",
+		"src/local.mr":    "",
+		"src/shared.mr":   "",
+		"lib/shared.mr":   "",
+		"lib/library.mr":  "",
+		"lib/sub/deep.mr": "",
+	})
+	l := NewLoader(filepath.Join(dir, "src", "main.mr"), filepath.Join(dir, "lib"))
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"local.mr", "src/local.mr"},
+		{"./local.mr", "src/local.mr"},
+		{"shared.mr", "src/shared.mr"},
+		{"library.mr", "lib/library.mr"},
+		{"sub/deep.mr", "lib/sub/deep.mr"},
+		{"../lib/library.mr", "lib/library.mr"},
+		{filepath.Join(dir, "lib", "library.mr"), "lib/library.mr"},
+	}
+
+	for _, tt := range tests {
+		resolved, err := l.resolve(tt.path)
+		if err != nil {
+			t.Errorf("resolve(%q) returned error: %s", tt.path, err)
+			continue
+		}
+		if rel, _ := filepath.Rel(dir, resolved); filepath.ToSlash(rel) != tt.expected {
+			t.Errorf("resolve(%q) wrong. want=%q, got=%q", tt.path, tt.expected, rel)
+		}
+	}
+
+	for _, path := range []string{"missing.mr", "./library.mr", "sub"} {
+		if _, err := l.resolve(path); err == nil || err.Error() != `cannot find module "`+path+`"` {
+			t.Errorf("resolve(%q) should fail. got=%v", path, err)
+		}
+	}
+}
+
+func TestLoaderImport(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.mr": "",
+		"a.mr":    "",
+		"b.mr":    "",
+		"bad.mr":  "let = 1;",
+	})
+	l := NewLoader(filepath.Join(dir, "main.mr"))
+
+	// 同じモジュールは一度だけ読み込む
+	calls := 0
+	load := func(name string, program *ast.Program) (object.Object, error) {
+		calls++
+		return &object.Module{Name: name}, nil
+	}
+	first, err := l.Import("a.mr", load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := l.Import("./a.mr", load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second || calls != 1 {
+		t.Errorf("module should be loaded once. calls=%d", calls)
+	}
+
+	// 読み込み中のモジュールを読み込むと循環エラー
+	var cycle func(name string, program *ast.Program) (object.Object, error)
+	cycle = func(name string, program *ast.Program) (object.Object, error) {
+		next := map[string]string{"b.mr": "main.mr", "main.mr": "b.mr"}[name]
+		return l.Import(next, cycle)
+	}
+	if _, err := l.Import("b.mr", cycle); err == nil || err.Error() != "import cycle: "+filepath.Join(dir, "main.mr")+" -> b.mr -> main.mr" {
+		t.Errorf("import cycle should be detected. got=%v", err)
+	}
+
+	if _, err := l.Import("bad.mr", load); err == nil || err.Error() != "bad.mr: invalid binding target: =" {
+		t.Errorf("parse error should be reported. got=%v", err)
+	}
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
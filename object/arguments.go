@@ -0,0 +1,72 @@
+package object
+
+import (
+	"fmt"
+
+	"github.com/Sa2Knight/maron/ast"
+)
+
+// Parameter 実引数を対応付けるための引数の情報
+type Parameter struct {
+	Name     string // 引数名。分割代入する引数はパターンの文字列表現
+	Optional bool   // 既定値があり、省略できるか
+}
+
+// ParametersOf 関数リテラルの引数の情報を戻す
+func ParametersOf(params []*ast.PatternElement) []Parameter {
+	result := make([]Parameter, len(params))
+	for i, param := range params {
+		result[i] = Parameter{Name: param.Target.String(), Optional: param.Default != nil}
+	}
+	return result
+}
+
+// ArrangeArguments 位置で渡す引数と名前付き引数(nil可)を、引数の並びに対応付ける
+// 値のない引数は nil になり、引数の数を超えた位置引数は rest として戻す
+// 評価器とVMで同じ規則とエラーメッセージを使うための共通の処理
+func ArrangeArguments(name string, params []Parameter, variadic bool, positional []Object, named *Hash) (values, rest []Object, err error) {
+	if name == "" {
+		name = "anonymous function"
+	}
+
+	if len(positional) > len(params) && !variadic {
+		return nil, nil, fmt.Errorf("too many arguments to %s: want at most %d, got %d", name, len(params), len(positional))
+	}
+
+	values = make([]Object, len(params))
+	copy(values, positional)
+	rest = []Object{}
+	if len(positional) > len(params) {
+		rest = append(rest, positional[len(params):]...)
+	}
+
+	if named != nil {
+		for _, key := range named.Keys() {
+			argName := key.(*String).Value
+			i := indexOfParameter(params, argName)
+			if i < 0 {
+				return nil, nil, fmt.Errorf("unknown argument %s in call to %s", argName, name)
+			}
+			if values[i] != nil {
+				return nil, nil, fmt.Errorf("duplicate argument %s in call to %s", argName, name)
+			}
+			values[i], _ = named.Get(key.(*String))
+		}
+	}
+
+	for i, param := range params {
+		if values[i] == nil && !param.Optional {
+			return nil, nil, fmt.Errorf("missing argument %s in call to %s", param.Name, name)
+		}
+	}
+	return values, rest, nil
+}
+
+func indexOfParameter(params []Parameter, name string) int {
+	for i, param := range params {
+		if param.Name == name {
+			return i
+		}
+	}
+	return -1
+}
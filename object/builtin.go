@@ -0,0 +1,156 @@
+package object
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// BuiltinFunction 組み込み関数の実装
+// 引数の誤りなどは *Error を戻す
+type BuiltinFunction func(ctx Context, args ...Object) Object
+
+// Context 組み込み関数を呼び出したエンジンが提供する機能
+type Context interface {
+	// Runtime プログラムを実行している環境の設定
+	Runtime() *Runtime
+
+	// Call 関数(組み込み関数を含む)を位置引数で呼び出し、戻り値を戻す
+	// 関数の実行中のエラーは *Error として戻す
+	Call(fn Object, args ...Object) Object
+}
+
+// ErrInterrupted Runtime.Interrupt によってプログラムの実行を中断した
+var ErrInterrupted = errors.New("interrupted")
+
+// Runtime 組み込み関数がプログラムの外とやり取りする際の設定
+// 埋め込む側が用意し、同じエンジンで実行するプログラムとモジュールで共有する
+// 乱数生成器などの状態を持つので、同時に実行する複数のエンジンでは共有しない
+type Runtime struct {
+	Rand  *rand.Rand // math.random の乱数生成器
+	Clock Clock      // time.now などの現在時刻の取得元
+
+	// 以下はプログラムの外の資源を使う機能で、埋め込む側が明示的に許可しない限り使えない
+
+	// FSRoots fs モジュールで読み書きできるディレクトリの一覧。空の場合は fs モジュールを使えない
+	// 相対パスは先頭のディレクトリを基準に解決する
+	FSRoots []string
+
+	// HTTPTransport http モジュールがリクエストを送る経路。nilの場合は http モジュールを使えない
+	// 通常は http.DefaultTransport を、テストでは httptest のサーバーに接続するものを渡す
+	HTTPTransport http.RoundTripper
+
+	// OS os モジュールが参照するプロセスの環境。nilの場合は os モジュールを使えない
+	OS *OSAccess
+
+	monotonicStart time.Time   // time.monotonic を最初に呼び出した時刻
+	interrupted    atomic.Bool // Interrupt で中断を要求された
+}
+
+// NewRuntime 既定の設定の Runtime を生成する
+// 乱数生成器は現在時刻で初期化し、現在時刻はシステムの時計から取得する
+func NewRuntime() *Runtime {
+	return &Runtime{
+		Rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		Clock: SystemClock{},
+	}
+}
+
+// Monotonic 最初に呼び出した時点からの経過時間を戻す
+// システムの時計では、時計が変更されても巻き戻らない
+func (r *Runtime) Monotonic() time.Duration {
+	now := r.Clock.Now()
+	if r.monotonicStart.IsZero() {
+		r.monotonicStart = now
+	}
+	return now.Sub(r.monotonicStart)
+}
+
+// Interrupt この Runtime で実行中のプログラムの中断を要求する。他のゴルーチンから呼び出せる
+// エンジンは繰り返しと関数呼び出しのたびに中断の要求を確かめ、ErrInterrupted のエラーで実行を終える
+// 一度中断を要求した Runtime で実行するプログラムは、全て中断される
+func (r *Runtime) Interrupt() {
+	r.interrupted.Store(true)
+}
+
+// Interrupted 中断を要求されたか
+func (r *Runtime) Interrupted() bool {
+	return r.interrupted.Load()
+}
+
+// OSAccess os モジュールに見せるプロセスの環境
+type OSAccess struct {
+	Args      []string          // os.args が戻すスクリプトの引数
+	Env       map[string]string // 環境変数。os.setenv で変更でき、os.exec のサブプロセスに引き継ぐ
+	Stdin     io.Reader         // os.read_line で読む標準入力。nilの場合は空の入力として扱う
+	Exit      func(code int)    // os.exit で呼び出す。nilの場合は os.exit を使えない
+	AllowExec bool              // os.exec でサブプロセスを実行できるか
+
+	stdin *bufio.Reader // Stdin を行単位で読むためのバッファ
+}
+
+// NewOSAccess 実行中のプロセスの環境変数、標準入力、終了を使う OSAccess を生成する
+// サブプロセスの実行は許可しない
+func NewOSAccess(args []string) *OSAccess {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	return &OSAccess{Args: args, Env: env, Stdin: os.Stdin, Exit: os.Exit}
+}
+
+// ReadLine 標準入力から1行読み、末尾の改行を除いて戻す。入力の終わりに達していれば ok が false
+func (o *OSAccess) ReadLine() (line string, ok bool, err error) {
+	if o.Stdin == nil {
+		return "", false, nil
+	}
+	if o.stdin == nil {
+		o.stdin = bufio.NewReader(o.Stdin)
+	}
+	line, err = o.stdin.ReadString('\n')
+	if err == io.EOF {
+		// 改行で終わらない最後の行
+		return line, line != "", nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), true, nil
+}
+
+// Clock 現在時刻の取得元
+// テストなどで時刻を固定する場合は、埋め込む側が Runtime.Clock を差し替える
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock システムの時計
+type SystemClock struct{}
+
+// Now is Clock's method.
+func (SystemClock) Now() time.Time { return time.Now() }
+
+/*****************
+ 構造体 Builtin
+******************/
+
+// Builtin 組み込み関数
+type Builtin struct {
+	Name string // エラーメッセージ用の関数名 (math.sqrt)
+	Fn   BuiltinFunction
+}
+
+// Inspect is Builtin's method.
+func (b *Builtin) Inspect() string { return fmt.Sprintf("<builtin %s>", b.Name) }
+
+// Type is Builtin's method.
+func (b *Builtin) Type() ObjectType { return BUILTIN }
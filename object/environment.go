@@ -0,0 +1,159 @@
+package object
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrUndeclared 定義されていない識別子への代入
+	ErrUndeclared = errors.New("cannot assign to undeclared identifier")
+
+	// ErrConstant 定数への代入
+	ErrConstant = errors.New("cannot assign to constant")
+
+	// ErrStackOverflow 関数呼び出しの深さが MaxCallDepth を超えた
+	ErrStackOverflow = errors.New("stack overflow")
+)
+
+// MaxCallDepth 関数呼び出しの深さの上限
+// 評価器は関数呼び出しごとにGoのスタックを消費するので、深い再帰でプロセスが異常終了しないよう制限する
+const MaxCallDepth = 10000
+
+// Environment 識別子と値の対応を保持する環境
+// 外側の環境を持つ場合、見つからない識別子は外側から探す
+// 複数のREPLセッションから同時に参照されることがあるため、読み書きは排他制御する
+type Environment struct {
+	mu      sync.RWMutex
+	store   map[string]Object
+	consts  map[string]bool // const文で束縛された識別子
+	outer   *Environment
+	loader  ModuleLoader // import文でモジュールを読み込む(一番外側の環境のみ)
+	runtime *Runtime     // 組み込み関数が使う実行環境の設定
+	depth   int          // この環境を生成した時点の関数呼び出しの深さ
+}
+
+// NewEnvironment 空の環境を新規生成
+func NewEnvironment() *Environment {
+	return &Environment{store: make(map[string]Object), consts: make(map[string]bool)}
+}
+
+// NewEnclosedEnvironment outer を外側に持つ環境を新規生成
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	env.depth = outer.depth
+	return env
+}
+
+// NewCallEnvironment 関数呼び出しの環境を、関数が定義された環境 outer を外側に持つ環境として新規生成
+// 呼び出しの深さは呼び出し元の環境 caller より1つ深くなり、MaxCallDepth を超える場合は ErrStackOverflow を戻す
+func NewCallEnvironment(outer, caller *Environment) (*Environment, error) {
+	if caller.depth >= MaxCallDepth {
+		return nil, ErrStackOverflow
+	}
+	env := NewEnclosedEnvironment(outer)
+	env.depth = caller.depth + 1
+	return env, nil
+}
+
+// SetLoader import文でモジュールを読み込む ModuleLoader を設定する
+// 設定されていない環境(と、その内側の環境)では import文を使えない
+func (e *Environment) SetLoader(loader ModuleLoader) {
+	e.mu.Lock()
+	e.loader = loader
+	e.mu.Unlock()
+}
+
+// Loader 一番外側の環境に設定された ModuleLoader を戻す。設定されていなければnil
+func (e *Environment) Loader() ModuleLoader {
+	for e.outer != nil {
+		e = e.outer
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.loader
+}
+
+// SetRuntime 組み込み関数が使う実行環境の設定をする
+// この環境(と、その内側の環境)では、外側の環境に設定された Runtime の代わりに runtime を使う
+func (e *Environment) SetRuntime(runtime *Runtime) {
+	e.mu.Lock()
+	e.runtime = runtime
+	e.mu.Unlock()
+}
+
+// Runtime 最も内側の、Runtime が設定された環境の Runtime を戻す
+// どの環境にも設定されていなければ、一番外側の環境に既定の設定を生成する
+func (e *Environment) Runtime() *Runtime {
+	for {
+		e.mu.Lock()
+		if e.runtime != nil || e.outer == nil {
+			break
+		}
+		e.mu.Unlock()
+		e = e.outer
+	}
+	defer e.mu.Unlock()
+	if e.runtime == nil {
+		e.runtime = NewRuntime()
+	}
+	return e.runtime
+}
+
+// Get 識別子に束縛された値を戻す
+func (e *Environment) Get(name string) (Object, bool) {
+	e.mu.RLock()
+	obj, ok := e.store[name]
+	e.mu.RUnlock()
+
+	if !ok && e.outer != nil {
+		return e.outer.Get(name)
+	}
+	return obj, ok
+}
+
+// Set 識別子に値を束縛する
+func (e *Environment) Set(name string, val Object) Object {
+	e.mu.Lock()
+	e.store[name] = val
+	e.mu.Unlock()
+	return val
+}
+
+// SetConst 識別子に値を定数として束縛する
+func (e *Environment) SetConst(name string, val Object) Object {
+	e.mu.Lock()
+	e.store[name] = val
+	e.consts[name] = true
+	e.mu.Unlock()
+	return val
+}
+
+// IsConst 識別子がこの環境で定数として束縛されているか(外側の環境は探さない)
+func (e *Environment) IsConst(name string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.consts[name]
+}
+
+// Assign 定義済みの識別子に値を代入する
+// 識別子を束縛している環境(外側の環境を含む)の値を書き換える
+// 識別子が定義されていない場合は ErrUndeclared を、定数であれば ErrConstant を戻す
+func (e *Environment) Assign(name string, val Object) error {
+	e.mu.Lock()
+	if _, ok := e.store[name]; ok {
+		defer e.mu.Unlock()
+		if e.consts[name] {
+			return ErrConstant
+		}
+		e.store[name] = val
+		return nil
+	}
+	e.mu.Unlock()
+
+	if e.outer == nil {
+		return ErrUndeclared
+	}
+	return e.outer.Assign(name, val)
+}
@@ -0,0 +1,45 @@
+package object
+
+import (
+	"fmt"
+
+	"github.com/Sa2Knight/maron/ast"
+)
+
+// ModuleLoader import文で指定されたモジュールを読み込む
+// 評価器とコンパイラで共通の、パスの解決、循環の検出、読み込み済みのモジュールの記録を受け持つ
+type ModuleLoader interface {
+	// Import path のモジュールを読み込む
+	// 初めて読み込むモジュールであれば、構文解析したプログラムを load で評価(コンパイル)し、その結果を記録して戻す
+	// load の中の import文は、読み込み中のモジュールのファイルを基準に解決する
+	Import(path string, load func(name string, program *ast.Program) (Object, error)) (Object, error)
+}
+
+/*****************
+ 構造体 Module
+******************/
+
+// Module import文で読み込んだモジュール
+type Module struct {
+	Name    string            // import文で指定したパス
+	Exports map[string]Object // export文で公開された識別子と値
+}
+
+// Inspect is Module's method.
+func (m *Module) Inspect() string { return fmt.Sprintf("<module %s>", m.Name) }
+
+// Type is Module's method.
+func (m *Module) Type() ObjectType { return MODULE }
+
+// Member 公開された識別子の値を戻す (m.name, m["name"])
+func (m *Module) Member(index Object) (Object, error) {
+	name, ok := index.(*String)
+	if !ok {
+		return nil, fmt.Errorf("module member must be STRING: %s", index.Type())
+	}
+	val, ok := m.Exports[name.Value]
+	if !ok {
+		return nil, fmt.Errorf("module %s has no export %s", m.Name, name.Value)
+	}
+	return val, nil
+}
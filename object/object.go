@@ -1,6 +1,13 @@
 package object
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Sa2Knight/maron/ast"
+	"github.com/Sa2Knight/maron/code"
+)
 
 type ObjectType string
 
@@ -9,16 +16,90 @@ const (
 	NULL = "NULL"
 	// INTEGER 数値
 	INTEGER = "INTEGER"
+	// FLOAT 浮動小数点数
+	FLOAT = "FLOAT"
 	// BOOLEAN 真偽値
 	BOOLEAN = "BOOLEAN"
+	// STRING 文字列
+	STRING = "STRING"
+	// ARRAY 配列
+	ARRAY = "ARRAY"
+	// HASH ハッシュ
+	HASH = "HASH"
+	// ERROR 評価エラー
+	ERROR = "ERROR"
+	// RETURN_VALUE return文の戻り値
+	RETURN_VALUE = "RETURN_VALUE"
+	// FUNCTION 関数
+	FUNCTION = "FUNCTION"
+	// COMPILED_FUNCTION バイトコードにコンパイルされた関数
+	COMPILED_FUNCTION = "COMPILED_FUNCTION"
+	// MODULE import文で読み込んだモジュール
+	MODULE = "MODULE"
+	// BUILTIN 組み込み関数
+	BUILTIN = "BUILTIN"
+	// REGEX コンパイル済みの正規表現
+	REGEX = "REGEX"
+	// TIME 時刻
+	TIME = "TIME"
+	// DURATION 時間の長さ
+	DURATION = "DURATION"
 )
 
+// 評価器、VM、組み込み関数で共有するネイティブオブジェクト
+// null と真偽値はポインタの比較で一致を判定するので、常にこれらを使う
+var (
+	// NullObject null
+	NullObject = &Null{}
+
+	// TrueObject 真
+	TrueObject = &Boolean{Value: true}
+
+	// FalseObject 偽
+	FalseObject = &Boolean{Value: false}
+)
+
+// NativeBool Goの真偽値に対応する真偽値オブジェクトを戻す
+func NativeBool(input bool) *Boolean {
+	if input {
+		return TrueObject
+	}
+	return FalseObject
+}
+
 // Object is interface for evaluated value
 type Object interface {
 	Type() ObjectType
 	Inspect() string
 }
 
+// Iterable for-in文で要素を順に取り出せるオブジェクト
+type Iterable interface {
+	Object
+	Iterate() []Object // 繰り返しを開始した時点の要素の一覧
+}
+
+// Comparable 同じ種別のオブジェクトと大小を比較できるオブジェクト
+type Comparable interface {
+	Object
+	Compare(other Object) int // other より小さければ負、等しければ0、大きければ正
+}
+
+// Compare 同じ種別の Comparable 同士を比較する。比較できなければ ok が false
+func Compare(left, right Object) (result int, ok bool) {
+	l, ok := left.(Comparable)
+	if !ok || left.Type() != right.Type() {
+		return 0, false
+	}
+	return l.Compare(right), true
+}
+
+// Hashable ハッシュのキーとして使用できるオブジェクト
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
 /*****************
  構造体 Null
 ******************/
@@ -47,6 +128,45 @@ func (i *Integer) Inspect() string { return fmt.Sprintf("%d", i.Value) }
 // Type is Integer's method.
 func (i *Integer) Type() ObjectType { return INTEGER }
 
+// HashKey is Integer's method.
+func (i *Integer) HashKey() HashKey { return HashKey{Type: i.Type(), Value: fmt.Sprint(i.Value)} }
+
+/*****************
+ 構造体 Float
+******************/
+
+// Float 浮動小数点数オブジェクト
+type Float struct {
+	Value float64
+}
+
+// Inspect is Float's method.
+// 整数と区別できるよう、整数値でも小数点を付ける (2.0)
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// Type is Float's method.
+func (f *Float) Type() ObjectType { return FLOAT }
+
+// HashKey is Float's method.
+func (f *Float) HashKey() HashKey { return HashKey{Type: f.Type(), Value: f.Inspect()} }
+
+// ToFloat 数値(整数、浮動小数点数)を float64 に変換する。数値でなければ ok が false
+func ToFloat(obj Object) (value float64, ok bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value), true
+	case *Float:
+		return obj.Value, true
+	}
+	return 0, false
+}
+
 /*****************
  構造体 Boolean
 ******************/
@@ -61,3 +181,233 @@ func (b *Boolean) Inspect() string { return fmt.Sprintf("%t", b.Value) }
 
 // Type is Boolean's method.
 func (b *Boolean) Type() ObjectType { return BOOLEAN }
+
+// HashKey is Boolean's method.
+func (b *Boolean) HashKey() HashKey { return HashKey{Type: b.Type(), Value: fmt.Sprint(b.Value)} }
+
+/*****************
+ 構造体 String
+******************/
+
+// String 文字列オブジェクト
+type String struct {
+	Value string
+}
+
+// Inspect is String's method.
+func (s *String) Inspect() string { return s.Value }
+
+// Type is String's method.
+func (s *String) Type() ObjectType { return STRING }
+
+// HashKey is String's method.
+func (s *String) HashKey() HashKey { return HashKey{Type: s.Type(), Value: s.Value} }
+
+/*****************
+ 構造体 Array
+******************/
+
+// Array 配列オブジェクト
+// 変数や引数は同じ配列を参照するので、要素の変更は共有される
+type Array struct {
+	Elements []Object
+}
+
+// Inspect is Array's method.
+func (a *Array) Inspect() string {
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, inspectElement(e))
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// Type is Array's method.
+func (a *Array) Type() ObjectType { return ARRAY }
+
+// Iterate is Array's method.
+func (a *Array) Iterate() []Object {
+	return append([]Object{}, a.Elements...)
+}
+
+/*****************
+ 構造体 Hash
+******************/
+
+// HashKey ハッシュのキーを比較するための値
+type HashKey struct {
+	Type  ObjectType
+	Value string
+}
+
+// HashPair ハッシュの要素(元のキーと値の組)
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash ハッシュオブジェクト
+// 要素はキーを追加した順に保持する
+type Hash struct {
+	Pairs map[HashKey]HashPair
+	keys  []HashKey // 追加した順のキー
+}
+
+// NewHash 空のハッシュを新規生成
+func NewHash() *Hash {
+	return &Hash{Pairs: map[HashKey]HashPair{}}
+}
+
+// Get キーに対応する値を戻す
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	pair, ok := h.Pairs[key.HashKey()]
+	return pair.Value, ok
+}
+
+// Set キーに値を設定する。新しいキーは末尾に追加する
+func (h *Hash) Set(key Hashable, val Object) {
+	hashKey := key.HashKey()
+	if _, ok := h.Pairs[hashKey]; !ok {
+		h.keys = append(h.keys, hashKey)
+	}
+	h.Pairs[hashKey] = HashPair{Key: key, Value: val}
+}
+
+// Keys 追加した順のキーの一覧を戻す
+func (h *Hash) Keys() []Object {
+	keys := []Object{}
+	for _, k := range h.keys {
+		keys = append(keys, h.Pairs[k].Key)
+	}
+	return keys
+}
+
+// Inspect is Hash's method.
+func (h *Hash) Inspect() string {
+	pairs := []string{}
+	for _, k := range h.keys {
+		pair := h.Pairs[k]
+		pairs = append(pairs, inspectElement(pair.Key)+": "+inspectElement(pair.Value))
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// Type is Hash's method.
+func (h *Hash) Type() ObjectType { return HASH }
+
+// inspectElement 配列やハッシュの要素を表示する(文字列は引用符で囲む)
+func inspectElement(obj Object) string {
+	if s, ok := obj.(*String); ok {
+		return strconv.Quote(s.Value)
+	}
+	return obj.Inspect()
+}
+
+/*****************
+ 構造体 Error
+******************/
+
+// Error 評価時のエラーを表すオブジェクト
+type Error struct {
+	Message string
+}
+
+// Inspect is Error's method.
+func (e *Error) Inspect() string { return "ERROR: " + e.Message }
+
+// Type is Error's method.
+func (e *Error) Type() ObjectType { return ERROR }
+
+/*****************
+ 構造体 ReturnValue
+******************/
+
+// ReturnValue return文で返された値をラップするオブジェクト
+type ReturnValue struct {
+	Value Object
+}
+
+// Inspect is ReturnValue's method.
+func (rv *ReturnValue) Inspect() string { return rv.Value.Inspect() }
+
+// Type is ReturnValue's method.
+func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE }
+
+/*****************
+ 構造体 Function
+******************/
+
+// Function 関数オブジェクト
+type Function struct {
+	Name       string // エラーメッセージ用の関数名(無名関数は空)
+	Parameters []*ast.PatternElement
+	Rest       *ast.Identifier // 残りの引数を受け取る引数(省略時はnil)
+	Body       *ast.BlockStatement
+	Env        *Environment // 関数が定義された環境
+}
+
+// Inspect is Function's method.
+func (f *Function) Inspect() string {
+	rest := ""
+	if f.Rest != nil {
+		rest = f.Rest.Value
+	}
+	return inspectFunction(f.Name, ParametersOf(f.Parameters), rest)
+}
+
+// Type is Function's method.
+func (f *Function) Type() ObjectType { return FUNCTION }
+
+// inspectFunction 関数の名前と引数を文字列にする (<fn add(a, b, ...rest)>)
+// 評価器とVMで同じ表示になるよう、関数本体は含めない
+func inspectFunction(name string, params []Parameter, rest string) string {
+	names := []string{}
+	for _, p := range params {
+		names = append(names, p.Name)
+	}
+	if rest != "" {
+		names = append(names, "..."+rest)
+	}
+	if name != "" {
+		name = " " + name
+	}
+	return fmt.Sprintf("<fn%s(%s)>", name, strings.Join(names, ", "))
+}
+
+/*****************
+ 構造体 CompiledFunction
+******************/
+
+// CompiledFunction バイトコードにコンパイルされた関数
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	Lines         code.LineTable // 命令とソースコードの行の対応(デバッグ用)
+	NumLocals     int            // ローカル変数の数(引数を含む)
+	NumParameters int            // 引数の領域の数(残りの引数を受け取る引数を含む)
+	Name          string         // エラーメッセージ用の関数名(無名関数は空)
+	Parameters    []Parameter    // 残りの引数を受け取る引数を除いた引数
+	Rest          string         // 最後の領域で残りの引数を受け取る引数の名前(なければ空)
+}
+
+// Inspect is CompiledFunction's method.
+func (cf *CompiledFunction) Inspect() string { return inspectFunction(cf.Name, cf.Parameters, cf.Rest) }
+
+// Type is CompiledFunction's method.
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION }
+
+/*****************
+ 構造体 Closure
+******************/
+
+// Closure コンパイル済み関数と、生成時に捕捉した自由変数の組
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+// Inspect is Closure's method.
+func (c *Closure) Inspect() string { return c.Fn.Inspect() }
+
+// Type is Closure's method.
+// 利用者から見ればFunctionと同じく関数なので、同じ種別を戻す
+func (c *Closure) Type() ObjectType { return FUNCTION }
@@ -0,0 +1,21 @@
+package object
+
+import (
+	"fmt"
+	"regexp"
+)
+
+/*****************
+ 構造体 Regex
+******************/
+
+// Regex コンパイル済みの正規表現
+type Regex struct {
+	Regexp *regexp.Regexp
+}
+
+// Inspect is Regex's method.
+func (r *Regex) Inspect() string { return fmt.Sprintf("<regex /%s/>", r.Regexp.String()) }
+
+// Type is Regex's method.
+func (r *Regex) Type() ObjectType { return REGEX }
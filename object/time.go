@@ -0,0 +1,50 @@
+package object
+
+import "time"
+
+/*****************
+ 構造体 Time
+******************/
+
+// Time 時刻(タイムゾーンの情報を含む)
+type Time struct {
+	Value time.Time
+}
+
+// Inspect is Time's method.
+// RFC 3339 の形式で、秒未満がある場合はその桁まで表示する
+func (t *Time) Inspect() string { return t.Value.Format(time.RFC3339Nano) }
+
+// Type is Time's method.
+func (t *Time) Type() ObjectType { return TIME }
+
+// Compare is Time's method.
+// タイムゾーンが異なっても、同じ瞬間であれば等しい
+func (t *Time) Compare(other Object) int { return t.Value.Compare(other.(*Time).Value) }
+
+/*****************
+ 構造体 Duration
+******************/
+
+// Duration 時間の長さ(ナノ秒単位)
+type Duration struct {
+	Value time.Duration
+}
+
+// Inspect is Duration's method.
+func (d *Duration) Inspect() string { return d.Value.String() }
+
+// Type is Duration's method.
+func (d *Duration) Type() ObjectType { return DURATION }
+
+// Compare is Duration's method.
+func (d *Duration) Compare(other Object) int {
+	o := other.(*Duration).Value
+	switch {
+	case d.Value < o:
+		return -1
+	case d.Value > o:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,363 @@
+package optimizer
+
+import (
+	"strconv"
+
+	"github.com/Sa2Knight/maron/ast"
+	"github.com/Sa2Knight/maron/token"
+)
+
+// 変化がなくなるまで最適化を繰り返す最大の回数
+const maxPasses = 10
+
+// Optimize 評価結果を変えない範囲でプログラムを書き換える
+// プログラムはその場で書き換えられる
+//
+//   - 定数の畳み込み: 数値リテラルと真偽値リテラルだけからなる前置式・中置式を計算済みの値に置き換える
+//   - 分岐の削除: 条件が定数のif式を、実行される側のブロックだけにする
+//   - 到達しないコードの削除: ブロック中のreturn文、break文、continue文より後の文を取り除く
+//   - letの展開: リテラルを束縛した識別子を、後続の文の中でリテラルに置き換える
+//     (プログラムのどこかで代入される識別子は展開しない)
+//
+// 0除算や型の合わない演算は実行時エラーとするため畳み込まない
+// 関数の本体は呼び出し時の環境で識別子を解決するので、外側のletを展開しない
+func Optimize(program *ast.Program) *ast.Program {
+	assigned := assignedNames(program)
+	for i := 0; i < maxPasses; i++ {
+		before := program.String()
+		ast.Modify(program, func(node ast.Node) ast.Node {
+			return optimizeNode(node, assigned)
+		})
+		if program.String() == before {
+			break
+		}
+	}
+	return program
+}
+
+func optimizeNode(node ast.Node, assigned map[string]bool) ast.Node {
+	switch node := node.(type) {
+	case *ast.Program:
+		node.Statements = optimizeStatements(node.Statements, assigned)
+	case *ast.BlockStatement:
+		node.Statements = optimizeStatements(node.Statements, assigned)
+	case *ast.PrefixExpression:
+		return foldPrefix(node)
+	case *ast.InfixExpression:
+		return foldInfix(node)
+	case *ast.IfExpression:
+		return pruneIf(node)
+	}
+	return node
+}
+
+// optimizeStatements 文の並びを最適化する
+func optimizeStatements(stmts []ast.Statement, assigned map[string]bool) []ast.Statement {
+	result := []ast.Statement{}
+	for i, stmt := range stmts {
+		// 条件が定数のif文は、ブロックの中身を展開する(ブロックはスコープを作らない)
+		// 最後の文の場合は並び全体の値になるので、値が変わらない場合に限る
+		if block := constantIfBlock(stmt); block != nil && (i < len(stmts)-1 || endsWithExpression(block.Statements)) {
+			result = append(result, block.Statements...)
+		} else {
+			result = append(result, stmt)
+		}
+	}
+
+	// return文、break文、continue文より後ろは実行されない
+	for i, stmt := range result {
+		if isJump(stmt) {
+			result = result[:i+1]
+			break
+		}
+	}
+
+	for i, stmt := range result {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok {
+			continue
+		}
+		if name, ok := let.Name.(*ast.Identifier); ok && isLiteral(let.Value) && !assigned[name.Value] {
+			inlineLet(name.Value, let.Value, result[i+1:])
+		}
+	}
+
+	return result
+}
+
+// inlineLet name を後続の文の中で value に置き換える
+// 再び name が束縛される文に到達したら、その右辺までを置き換えて終了する
+func inlineLet(name string, value ast.Expression, stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		if let, ok := stmt.(*ast.LetStatement); ok && isIdentifier(let.Name, name) {
+			let.Value = substitute(let.Value, name, value).(ast.Expression)
+			return
+		}
+		if rebinds(stmt, name) {
+			return
+		}
+		substitute(stmt, name, value)
+	}
+}
+
+// substitute node の中の識別子 name を value の複製に置き換える
+// 関数リテラルの中と、let文やmatch式のパターン中の識別子、プロパティ名、名前付き引数の名前は置き換えない
+func substitute(node ast.Node, name string, value ast.Expression) ast.Node {
+	skip := map[*ast.Identifier]bool{}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FunctionLiteral:
+			ast.Inspect(n, func(inner ast.Node) bool {
+				if ident, ok := inner.(*ast.Identifier); ok {
+					skip[ident] = true
+				}
+				return true
+			})
+			return false
+		case *ast.LetStatement:
+			// 束縛される側の識別子と、ハッシュパターンのキー
+			skipPattern(n.Name, skip)
+		case *ast.MatchArm:
+			skipPattern(n.Pattern, skip)
+		case *ast.PropertyExpression:
+			skip[n.Property] = true
+		case *ast.NamedArgument:
+			skip[n.Name] = true
+		}
+		return true
+	})
+
+	return ast.Modify(node, func(n ast.Node) ast.Node {
+		if ident, ok := n.(*ast.Identifier); ok && ident.Value == name && !skip[ident] {
+			return copyLiteral(value, ident.Token)
+		}
+		return n
+	})
+}
+
+func skipPattern(pattern ast.Pattern, skip map[*ast.Identifier]bool) {
+	ast.Inspect(pattern, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Identifier); ok {
+			skip[ident] = true
+		}
+		return true
+	})
+}
+
+func isIdentifier(pattern ast.Pattern, name string) bool {
+	ident, ok := pattern.(*ast.Identifier)
+	return ok && ident.Value == name
+}
+
+// assignedNames プログラム中(関数リテラルの中を含む)で代入される識別子の一覧
+func assignedNames(program *ast.Program) map[string]bool {
+	names := map[string]bool{}
+	ast.Inspect(program, func(n ast.Node) bool {
+		if assign, ok := n.(*ast.AssignExpression); ok {
+			if ident, ok := assign.Target.(*ast.Identifier); ok {
+				names[ident.Value] = true
+			}
+		}
+		return true
+	})
+	return names
+}
+
+// rebinds 文の中(関数リテラルの中を除く)で name が束縛されるか
+func rebinds(stmt ast.Statement, name string) bool {
+	found := false
+	ast.Inspect(stmt, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FunctionLiteral:
+			return false
+		case *ast.LetStatement:
+			for _, ident := range ast.PatternNames(n.Name) {
+				found = found || ident.Value == name
+			}
+		case *ast.MatchArm:
+			// match式のパターンの束縛は、腕の中で外側の識別子を隠す
+			for _, ident := range ast.PatternNames(n.Pattern) {
+				found = found || ident.Value == name
+			}
+		case *ast.ForStatement:
+			found = found || n.Variable.Value == name
+		case *ast.ImportStatement:
+			found = found || n.Name.Value == name
+		}
+		return !found
+	})
+	return found
+}
+
+func foldPrefix(node *ast.PrefixExpression) ast.Expression {
+	switch right := node.Right.(type) {
+	case *ast.IntegerLiteral:
+		switch node.Operator {
+		case "-":
+			return newInteger(-right.Value, node.Token)
+		case "!":
+			// 数値は常に真
+			return newBoolean(false, node.Token)
+		}
+	case *ast.Boolean:
+		if node.Operator == "!" {
+			return newBoolean(!right.Value, node.Token)
+		}
+	}
+	return node
+}
+
+func foldInfix(node *ast.InfixExpression) ast.Expression {
+	switch left := node.Left.(type) {
+	case *ast.IntegerLiteral:
+		right, ok := node.Right.(*ast.IntegerLiteral)
+		if !ok {
+			return node
+		}
+
+		l, r := left.Value, right.Value
+		switch node.Operator {
+		case "+":
+			return newInteger(l+r, left.Token)
+		case "-":
+			return newInteger(l-r, left.Token)
+		case "*":
+			return newInteger(l*r, left.Token)
+		case "/":
+			if r != 0 {
+				return newInteger(l/r, left.Token)
+			}
+		case "<":
+			return newBoolean(l < r, left.Token)
+		case ">":
+			return newBoolean(l > r, left.Token)
+		case "==":
+			return newBoolean(l == r, left.Token)
+		case "!=":
+			return newBoolean(l != r, left.Token)
+		}
+
+	case *ast.Boolean:
+		right, ok := node.Right.(*ast.Boolean)
+		if !ok {
+			return node
+		}
+
+		switch node.Operator {
+		case "==":
+			return newBoolean(left.Value == right.Value, left.Token)
+		case "!=":
+			return newBoolean(left.Value != right.Value, left.Token)
+		}
+	}
+	return node
+}
+
+// pruneIf 条件が定数のif式を、実行される側のブロックだけを持つ if (true) { ... } にする
+// ブロックが式ひとつだけであれば、その式に置き換える
+func pruneIf(node *ast.IfExpression) ast.Expression {
+	truthy, ok := constantTruthiness(node.Condition)
+	if !ok {
+		return node
+	}
+
+	block := node.Consequence
+	if !truthy {
+		block = node.Alternative
+	}
+	if block == nil {
+		// 実行されるブロックがない場合の値はnull
+		return &ast.IfExpression{
+			Token:       node.Token,
+			Condition:   newBoolean(false, node.Token),
+			Consequence: &ast.BlockStatement{Token: node.Consequence.Token, Statements: []ast.Statement{}, EndToken: node.Consequence.EndToken},
+		}
+	}
+
+	if len(block.Statements) == 1 {
+		if stmt, ok := block.Statements[0].(*ast.ExpressionStatement); ok {
+			return stmt.Expression
+		}
+	}
+
+	return &ast.IfExpression{
+		Token:       node.Token,
+		Condition:   newBoolean(true, node.Token),
+		Consequence: block,
+	}
+}
+
+// constantIfBlock 文が条件が真の定数であるif文であれば、そのブロックを戻す
+func constantIfBlock(stmt ast.Statement) *ast.BlockStatement {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return nil
+	}
+	ie, ok := es.Expression.(*ast.IfExpression)
+	if !ok || ie.Alternative != nil {
+		return nil
+	}
+	if truthy, ok := constantTruthiness(ie.Condition); !ok || !truthy {
+		return nil
+	}
+	return ie.Consequence
+}
+
+// constantTruthiness 式がリテラルであれば、その真偽を戻す
+func constantTruthiness(exp ast.Expression) (bool, bool) {
+	switch exp := exp.(type) {
+	case *ast.Boolean:
+		return exp.Value, true
+	case *ast.IntegerLiteral:
+		return true, true
+	}
+	return false, false
+}
+
+func isJump(stmt ast.Statement) bool {
+	switch stmt.(type) {
+	case *ast.ReturnStatement, *ast.BreakStatement, *ast.ContinueStatement:
+		return true
+	}
+	return false
+}
+
+func endsWithExpression(stmts []ast.Statement) bool {
+	if len(stmts) == 0 {
+		return false
+	}
+	_, ok := stmts[len(stmts)-1].(*ast.ExpressionStatement)
+	return ok
+}
+
+func isLiteral(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.IntegerLiteral, *ast.Boolean:
+		return true
+	}
+	return false
+}
+
+// copyLiteral リテラルを複製する。位置は置き換え先のトークンのものを使う
+func copyLiteral(lit ast.Expression, at token.Token) ast.Expression {
+	switch lit := lit.(type) {
+	case *ast.IntegerLiteral:
+		return newInteger(lit.Value, at)
+	case *ast.Boolean:
+		return newBoolean(lit.Value, at)
+	}
+	return lit
+}
+
+func newInteger(value int64, at token.Token) *ast.IntegerLiteral {
+	tok := token.Token{Type: token.INT, Literal: strconv.FormatInt(value, 10), Line: at.Line, Column: at.Column}
+	return &ast.IntegerLiteral{Token: tok, Value: value}
+}
+
+func newBoolean(value bool, at token.Token) *ast.Boolean {
+	tok := token.Token{Type: token.FALSE, Literal: "false", Line: at.Line, Column: at.Column}
+	if value {
+		tok = token.Token{Type: token.TRUE, Literal: "true", Line: at.Line, Column: at.Column}
+	}
+	return &ast.Boolean{Token: tok, Value: value}
+}
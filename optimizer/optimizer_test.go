@@ -0,0 +1,103 @@
+package optimizer
+
+import (
+	"testing"
+
+	"github.com/Sa2Knight/maron/ast"
+	"github.com/Sa2Knight/maron/evaluator"
+	"github.com/Sa2Knight/maron/lexer"
+	"github.com/Sa2Knight/maron/object"
+	"github.com/Sa2Knight/maron/parser"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 定数の畳み込み
+		{"1 + 2 * 3", "7"},
+		{"-(5 - 10)", "5"},
+		{"!true == false", "true"},
+		{"10 / 3 > 2", "true"},
+		{"!5", "false"},
+		{"x + 1 * 2", "(x + 2)"},
+		// 実行時エラーになる式は畳み込まない
+		{"10 / 0", "(10 / 0)"},
+		{"1 + true", "(1 + true)"},
+		// 分岐の削除
+		{"if (1 < 2) { 10 } else { 20 }", "10"},
+		{"if (false) { 10 } else { x }", "x"},
+		{"if (false) { 10 }", "iffalse "},
+		{"if (true) { let a = 1; a }; 5", "let a = 1;15"},
+		// 到達しないコードの削除
+		{"return 1; 2; 3", "return 1;"},
+		{"fn() { return x; x + 1 }", "fn() return x;"},
+		// letの展開
+		{"let x = 2; x * 3", "let x = 2;6"},
+		{"let x = 2; let y = x + 1; y * x", "let x = 2;let y = 3;6"},
+		{"let x = 1; let x = x + 1; x", "let x = 1;let x = 2;2"},
+		// 関数の本体は呼び出し時の束縛を参照するので展開しない
+		{"let x = 1; let f = fn() { x }; f()", "let x = 1;let f = fn() x;f()"},
+		// 条件次第で再束縛される場合は展開しない
+		{"let x = 1; if (y) { let x = 2 }; x", "let x = 1;ify let x = 2;x"},
+		// 代入される識別子は展開しない
+		{"let x = 1; x += 1; x", "let x = 1;x += 1x"},
+		{"let f = fn() { x = 2 }; let x = 1; f(); x", "let f = fn() x = 2;let x = 1;f()x"},
+	}
+
+	for _, tt := range tests {
+		program := Optimize(parse(t, tt.input))
+		if program.String() != tt.expected {
+			t.Errorf("Optimize(%q) wrong. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+// 最適化の前後で評価結果が変わらないことを確認する
+func TestOptimizePreservesSemantics(t *testing.T) {
+	tests := []string{
+		"1 + 2 * 3 - 4 / 2",
+		"10 / 0",
+		"-true",
+		"if (10 > 1) { let a = 5; a * 2 }",
+		"if (1 > 10) { 5 }",
+		"if (true) { let a = 5 }",
+		"let a = 1; if (true) { let a = 2 }; a",
+		"let x = 1; let f = fn() { x }; let x = 2; f()",
+		"let f = fn(x) { let y = 2; if (x > y) { return x; 100 } else { return y } }; f(1) + f(5)",
+		"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(10)",
+		"let x = 5; let x = x * x; return x; x + 1",
+		"let a = 1; let b = fn(a) { a * 10 }; b(2) + a",
+		"let a = 1",
+		"let x = 1; match (2) { x => x }; x",
+		`let x = 1; match ({"x": 5}) { {x: y} => y + x }`,
+	}
+
+	for _, input := range tests {
+		expected := evaluator.Eval(parse(t, input), object.NewEnvironment())
+		got := evaluator.Eval(Optimize(parse(t, input)), object.NewEnvironment())
+
+		if inspect(got) != inspect(expected) {
+			t.Errorf("optimized program evaluates differently for %q. want=%s, got=%s", input, inspect(expected), inspect(got))
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+	return string(obj.Type()) + ":" + obj.Inspect()
+}
@@ -13,10 +13,14 @@ const (
 	_ int = iota
 	// LOWEST is lowest ident
 	LOWEST
+	// ASSIGN is = or += (右結合)
+	ASSIGN
 	// EQUALS is =
 	EQUALS
 	// LESSGREATER is < or >
 	LESSGREATER
+	// PIPELINE is x |> f(y)
+	PIPELINE
 	// SUM is +
 	SUM
 	// PRODUCT is *
@@ -25,6 +29,8 @@ const (
 	PREFIX
 	// CALL is like myFunction(X)
 	CALL
+	// INDEX is like array[index] or hash.key
+	INDEX
 )
 
 type (
@@ -34,23 +40,36 @@ type (
 
 // トークンタイプ別の演算子の優先順位を定義したテーブル
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.PIPELINE:        PIPELINE,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
+	token.DOT:             INDEX,
 }
 
 // Parser 構文解析器本体の構造体
 type Parser struct {
-	l         *lexer.Lexer
-	curToken  token.Token // 現在解析中のトークン
-	peekToken token.Token // 現在解析中の次のトークン
-	errors    []string
+	l          *lexer.Lexer
+	curToken   token.Token // 現在解析中のトークン
+	peekToken  token.Token // 現在解析中の次のトークン
+	errors     []string
+	warnings   []string
+	loopDepth  int // 解析中の繰り返し文の入れ子の深さ(break, continue の検査用)
+	blockDepth int // 解析中のブロックの入れ子の深さ(import, export の検査用)
+
+	matchPattern bool // match式の腕のパターンを解析中か(リテラルのパターンの検査用)
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -67,6 +86,7 @@ func New(l *lexer.Lexer) *Parser {
 
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
@@ -74,6 +94,11 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.PIPE, p.parseShorthandFunctionLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
 
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
@@ -84,6 +109,14 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parsePropertyExpression)
+	p.registerInfix(token.PIPELINE, p.parsePipeExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
 
 	return p
 }
@@ -100,6 +133,7 @@ func (p *Parser) ParseProgram() *ast.Program {
 		}
 		p.nextToken()
 	}
+	program.Comments = p.l.Comments()
 	return program
 }
 
@@ -108,26 +142,86 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// Warnings 実行はできるが、誤りの可能性がある箇所の一覧を戻す
+func (p *Parser) Warnings() []string {
+	return p.warnings
+}
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
-	case token.LET:
+	case token.LET, token.CONST:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseLoopControlStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
+// parseImportStatement import "path" as name をパースする
+func (p *Parser) parseImportStatement() ast.Statement {
+	stmt := &ast.ImportStatement{Token: p.curToken}
+	if p.blockDepth > 0 {
+		p.errors = append(p.errors, "import must be at top level")
+		return nil
+	}
+
+	// "path"
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	stmt.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	// as name
+	if !p.expectPeek(token.AS) || !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseExportStatement export let ... (export const ...) をパースする
+func (p *Parser) parseExportStatement() ast.Statement {
+	stmt := &ast.ExportStatement{Token: p.curToken}
+	if p.blockDepth > 0 {
+		p.errors = append(p.errors, "export must be at top level")
+		return nil
+	}
+
+	if !p.peekTokenIs(token.LET) && !p.peekTokenIs(token.CONST) {
+		p.errors = append(p.errors, fmt.Sprintf("expected let or const after export, got %s instead", p.peekToken.Type))
+		return nil
+	}
+	p.nextToken()
+	if stmt.Statement = p.parseLetStatement(); stmt.Statement == nil {
+		return nil
+	}
+	return stmt
+}
+
 func (p *Parser) parseLetStatement() *ast.LetStatement {
-	// let
+	// let or const
 	stmt := &ast.LetStatement{Token: p.curToken}
 
-	// 変数名
-	if !p.expectPeek(token.IDENT) {
+	// 変数名、または分割代入のパターン
+	p.nextToken()
+	if stmt.Name = p.parsePattern(); stmt.Name == nil {
 		return nil
 	}
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
 	// =
 	if !p.expectPeek(token.ASSIGN) {
@@ -138,6 +232,13 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	// 代入する式
 	stmt.Value = p.parseExpression(LOWEST)
 
+	// 関数には束縛される名前を付けておく(エラーメッセージ用)
+	if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		if ident, ok := stmt.Name.(*ast.Identifier); ok {
+			fn.Name = ident.Value
+		}
+	}
+
 	// ; (省略可能)
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
@@ -161,6 +262,107 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	// while (
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+
+	// 条件式
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	// ) {
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	// 繰り返し実行するブロック
+	stmt.Body = p.parseLoopBody()
+
+	// ; (省略可能)
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	// for (
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	// 要素を束縛する変数名
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	// in
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+
+	// 要素を取り出す式
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	// ) {
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	// 要素ごとに実行するブロック
+	stmt.Body = p.parseLoopBody()
+
+	// ; (省略可能)
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseLoopBody 繰り返し文のブロックをパースする
+// ブロックの中では break, continue を使用できる
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+
+	return p.parseBlockStatement()
+}
+
+// parseLoopControlStatement break文、continue文をパースする
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	tok := p.curToken
+	if p.loopDepth == 0 {
+		p.errors = append(p.errors, fmt.Sprintf("%s outside of loop", tok.Literal))
+		return nil
+	}
+
+	// ; (省略可能)
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	if tok.Type == token.BREAK {
+		return &ast.BreakStatement{Token: tok}
+	}
+	return &ast.ContinueStatement{Token: tok}
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 
@@ -252,47 +454,363 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	}
 
 	// 仮引数)
-	lit.Parameters = p.parseFunctionParameters()
+	if lit.Parameters, lit.Rest = p.parseFunctionParameters(); lit.Parameters == nil {
+		return nil
+	}
+	if !p.checkParameterDefaults(lit) {
+		return nil
+	}
 
 	// {
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
+	// 関数の本体から外側の繰り返しを抜けることはできない
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	lit.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
 
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+// parseShorthandFunctionLiteral 短縮形の関数 |x, y| x + y をパースする
+// 本体はひとつの式で、できるだけ長く読む
+func (p *Parser) parseShorthandFunctionLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: p.curToken}
+
+	// 仮引数|
+	params, rest, ok := p.parsePatternElements(token.PIPE)
+	if !ok {
+		return nil
+	}
+	lit.Parameters, lit.Rest = params, rest
+	if !p.checkParameterDefaults(lit) {
+		return nil
+	}
+	p.nextToken()
+	stmt := &ast.ExpressionStatement{Token: p.curToken}
+
+	// 関数の本体から外側の繰り返しを抜けることはできない
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	stmt.Expression = p.parseExpression(LOWEST)
+	p.loopDepth = loopDepth
+	if stmt.Expression == nil {
+		return nil
+	}
+
+	lit.Body = &ast.BlockStatement{Token: lit.Token, Statements: []ast.Statement{stmt}}
+	return lit
+}
+
+// parseFunctionParameters 仮引数の並びを ) までパースする
+// 配列パターンの要素と同じく、既定値と、最後の ...rest を書ける
+func (p *Parser) parseFunctionParameters() ([]*ast.PatternElement, *ast.Identifier) {
+	params, rest, ok := p.parsePatternElements(token.RPAREN)
+	if !ok {
+		return nil, nil
+	}
+	return params, rest
+}
+
+// checkParameterDefaults 引数の既定値が、その引数自身や後ろの引数を参照していないかを検査する
+// 既定値は前の引数を束縛した後に、引数の並びの順に評価する
+func (p *Parser) checkParameterDefaults(lit *ast.FunctionLiteral) bool {
+	later := map[string]bool{}
+	if lit.Rest != nil {
+		later[lit.Rest.Value] = true
+	}
+
+	for i := len(lit.Parameters) - 1; i >= 0; i-- {
+		param := lit.Parameters[i]
+		for _, ident := range ast.PatternNames(param.Target) {
+			later[ident.Value] = true
+		}
+		if param.Default == nil {
+			continue
+		}
+
+		for _, ident := range referencedIdentifiers(param.Default) {
+			if later[ident.Value] {
+				msg := fmt.Sprintf("default value of parameter %s cannot refer to parameter %s", param.Target, ident.Value)
+				p.errors = append(p.errors, msg)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// referencedIdentifiers node の中で値を参照している識別子を戻す(プロパティ名と名前付き引数の名前を除く)
+func referencedIdentifiers(node ast.Node) []*ast.Identifier {
+	skip := map[*ast.Identifier]bool{}
+	idents := []*ast.Identifier{}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.PropertyExpression:
+			skip[n.Property] = true
+		case *ast.NamedArgument:
+			skip[n.Name] = true
+		case *ast.Identifier:
+			if !skip[n] {
+				idents = append(idents, n)
+			}
+		}
+		return true
+	})
+	return idents
+}
+
+// parsePattern 束縛先をパースする
+// 識別子の他に、配列パターン [a, b = 0, ...rest] とハッシュパターン {name, age: a} を書ける
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	}
+
+	// match式では、リテラルも値との一致を調べるパターンになる
+	if p.matchPattern {
+		switch p.curToken.Type {
+		case token.INT:
+			if lit, ok := p.parseIntegerLiteral().(*ast.IntegerLiteral); ok {
+				return lit
+			}
+			return nil
+		case token.MINUS:
+			return p.parseNegativeIntegerPattern()
+		case token.STRING:
+			return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+		case token.TRUE, token.FALSE:
+			return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
+		}
+	}
+
+	p.errors = append(p.errors, fmt.Sprintf("invalid binding target: %s", p.curToken.Literal))
+	return nil
+}
+
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.curToken}
+
+	var ok bool
+	if pattern.Elements, pattern.Rest, ok = p.parsePatternElements(token.RBRACKET); !ok {
+		return nil
+	}
+
+	return pattern
+}
+
+// parsePatternElements end までの、カンマ区切りの束縛先(既定値付き)の並びをパースする
+// ...rest は最後の要素に限る
+func (p *Parser) parsePatternElements(end token.TokenType) ([]*ast.PatternElement, *ast.Identifier, bool) {
+	elements := []*ast.PatternElement{}
+	var rest *ast.Identifier
 
-	// 引数なしの場合
-	if p.peekTokenIs(token.RPAREN) {
+	for !p.peekTokenIs(end) {
+		p.nextToken()
+
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil, nil, false
+			}
+			rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			break
+		}
+
+		element := &ast.PatternElement{Token: p.curToken}
+		if element.Target = p.parsePattern(); element.Target == nil {
+			return nil, nil, false
+		}
+		if !p.parsePatternDefault(element) {
+			return nil, nil, false
+		}
+		elements = append(elements, element)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 		p.nextToken()
-		return identifiers
 	}
 
-	p.nextToken()
+	// ] or )
+	if !p.expectPeek(end) {
+		return nil, nil, false
+	}
+
+	return elements, rest, true
+}
 
-	// 1個目の引数
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pattern := &ast.HashPattern{Token: p.curToken}
 
-	// 次がカンマの場合は、まだ引数が続くので繰り返しパースを続ける
-	for p.peekTokenIs(token.COMMA) {
-		p.nextToken() // カンマは読み飛ばす
+	for !p.peekTokenIs(token.RBRACE) {
+		// キー
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		key := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		element := &ast.PatternElement{Token: p.curToken, Key: key, Target: key}
+
+		// key: 束縛先 (省略時はキーと同名の識別子)
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			p.nextToken()
+			if element.Target = p.parsePattern(); element.Target == nil {
+				return nil
+			}
+		}
+		if !p.parsePatternDefault(element) {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
 	}
 
-	// カンマじゃなければ ) がくるはず
+	// }
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return pattern
+}
+
+// parsePatternDefault パターンの要素に続く = 既定値 をパースする
+// 既定値の中の = は代入ではなく、パースエラーとする
+func (p *Parser) parsePatternDefault(element *ast.PatternElement) bool {
+	if !p.peekTokenIs(token.ASSIGN) {
+		return true
+	}
+	if p.matchPattern {
+		p.errors = append(p.errors, "default value is not allowed in match pattern")
+		return false
+	}
+	p.nextToken()
+	p.nextToken()
+
+	element.Default = p.parseExpression(ASSIGN)
+	return element.Default != nil
+}
+
+// parseNegativeIntegerPattern -1 のような負の整数のパターンをパースする
+func (p *Parser) parseNegativeIntegerPattern() ast.Pattern {
+	minus := p.curToken
+	if !p.expectPeek(token.INT) {
+		return nil
+	}
+
+	lit, ok := p.parseIntegerLiteral().(*ast.IntegerLiteral)
+	if !ok {
+		return nil
+	}
+	lit.Token.Literal = minus.Literal + lit.Token.Literal
+	lit.Token.Line, lit.Token.Column = minus.Line, minus.Column
+	lit.Value = -lit.Value
+	return lit
+}
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.curToken}
+
+	// match (
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+
+	// 照合する値
+	expression.Subject = p.parseExpression(LOWEST)
+
+	// ) {
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	// パターン => 式, ... (末尾のカンマは省略可)
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		expression.Arms = append(expression.Arms, arm)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	// }
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	expression.EndToken = p.curToken
+
+	// 任意の値に一致する腕がなければ、一致しない値で実行時エラーになりうる
+	// ガードのない true と false の腕が両方あれば、真偽値の全ての値を網羅しているとみなす
+	exhaustive := false
+	booleans := map[bool]bool{}
+	for _, arm := range expression.Arms {
+		exhaustive = exhaustive || arm.IsIrrefutable()
+		if b, ok := arm.Pattern.(*ast.Boolean); ok && arm.Guard == nil {
+			booleans[b.Value] = true
+		}
+	}
+	exhaustive = exhaustive || len(booleans) == 2
+	if !exhaustive {
+		msg := fmt.Sprintf("line %d: match expression is not exhaustive (add a %s arm)", expression.Token.Line, ast.WILDCARD)
+		p.warnings = append(p.warnings, msg)
+	}
+
+	return expression
+}
+
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	// パターン
+	p.matchPattern = true
+	pattern := p.parsePattern()
+	p.matchPattern = false
+	if pattern == nil {
+		return nil
+	}
+	arm := &ast.MatchArm{Pattern: pattern}
+
+	// if ガード (option)
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		arm.Guard = p.parseExpression(LOWEST)
+	}
+
+	// =>
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+	arm.Token = p.curToken
+	p.nextToken()
 
-	return identifiers
+	// 一致した場合に評価する式
+	arm.Body = p.parseExpression(LOWEST)
+	if arm.Body == nil {
+		return nil
+	}
+
+	return arm
 }
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
@@ -303,6 +821,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	p.nextToken()
 
 	// } が現れるまで文をパース
+	p.blockDepth++
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
 		stmt := p.parseStatement()
 		if stmt != nil {
@@ -310,6 +829,8 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.nextToken()
 	}
+	p.blockDepth--
+	block.EndToken = p.curToken
 
 	return block
 }
@@ -322,6 +843,15 @@ func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
 
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		p.errors = append(p.errors, fmt.Sprintf("could not parse %q as float", p.curToken.Literal))
+		return nil
+	}
+	return &ast.FloatLiteral{Token: p.curToken, Value: value}
+}
+
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
@@ -337,6 +867,83 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if array.Elements == nil {
+		return nil
+	}
+	array.EndToken = p.curToken
+
+	return array
+}
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken, Pairs: []*ast.HashPair{}}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		// キー: 値
+		key := p.parseExpression(LOWEST)
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		pair := &ast.HashPair{Token: p.curToken, Key: key}
+		p.nextToken()
+		pair.Value = p.parseExpression(LOWEST)
+		hash.Pairs = append(hash.Pairs, pair)
+
+		// 次がカンマでなければ } が来るはず
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	// }
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	hash.EndToken = p.curToken
+
+	return hash
+}
+
+// parseExpressionList end までのカンマ区切りの式をパースする (末尾のカンマは省略可)
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	// 要素なしの場合
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return list
+	}
+
+	p.nextToken()
+	list = append(list, p.parseExpression(LOWEST))
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken() // カンマを飛ばす
+		if p.peekTokenIs(end) {
+			break
+		}
+		p.nextToken()
+		list = append(list, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return list
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
 		Token:    p.curToken,
@@ -363,31 +970,103 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+func (p *Parser) parsePipeExpression(left ast.Expression) ast.Expression {
+	expression := &ast.PipeExpression{Token: p.curToken, Left: left}
+
+	precedence := p.curPrecedance()
+	p.nextToken()
+	if expression.Right = p.parseExpression(precedence); expression.Right == nil {
+		return nil
+	}
+
+	return expression
+}
+
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseCallArguments()
+	exp.EndToken = p.curToken
 	return exp
 }
 
-func (p *Parser) parseCallArguments() []ast.Expression {
-	args := []ast.Expression{}
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+
+	// [
+	p.nextToken()
+
+	// 添字
+	exp.Index = p.parseExpression(LOWEST)
+
+	// ]
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parsePropertyExpression(left ast.Expression) ast.Expression {
+	exp := &ast.PropertyExpression{Token: p.curToken, Left: left}
 
-	// 引数なしの場合終了
-	if p.peekTokenIs(token.RPAREN) {
+	// . の後ろはプロパティ名。キーワードもプロパティ名として使える (re.match)
+	if token.IsKeyword(p.peekToken.Type) {
 		p.nextToken()
-		return args
+	} else if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	exp.Property = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	return exp
+}
+
+// parseAssignExpression 代入式をパースする
+// 右結合なので、右辺は代入演算子より一つ低い優先順位でパースする
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	exp := &ast.AssignExpression{Token: p.curToken, Operator: p.curToken.Literal, Target: target}
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression, *ast.PropertyExpression:
+	default:
+		p.errors = append(p.errors, fmt.Sprintf("invalid assignment target: %s", target))
+		return nil
 	}
 
-	// 引数1個め
 	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
+	exp.Value = p.parseExpression(ASSIGN - 1)
 
-	// 次がカンマであれば、もう一つ引数があるので積んでいく
-	for p.peekTokenIs(token.COMMA) {
-		p.nextToken() // カンマを飛ばす
-		p.nextToken() // 次の引数を見る
+	return exp
+}
+
+// parseCallArguments 実引数の並びを ) までパースする
+// 実引数には、配列を展開する ...xs と、名前付き引数 name: value を書ける
+// 名前付き引数は位置で渡す引数の後ろに限る
+func (p *Parser) parseCallArguments() []ast.Expression {
+	args := []ast.Expression{}
+	named := map[string]bool{}
+
+	for !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+
+		arg := p.parseCallArgument()
+		if arg == nil {
+			return nil
+		}
+		// 誤りを記録した後も、後続のエラーを報告しないよう ) までパースを続ける
+		if na, ok := arg.(*ast.NamedArgument); ok {
+			if named[na.Name.Value] {
+				p.errors = append(p.errors, fmt.Sprintf("duplicate named argument %s", na.Name.Value))
+			}
+			named[na.Name.Value] = true
+		} else if len(named) > 0 {
+			p.errors = append(p.errors, "positional argument after named argument")
+		}
+		args = append(args, arg)
 
-		args = append(args, p.parseExpression(LOWEST))
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
 	}
 
 	// カンマじゃなかったら ) が来るはず
@@ -398,6 +1077,32 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 	return args
 }
 
+func (p *Parser) parseCallArgument() ast.Expression {
+	switch {
+	// ...配列
+	case p.curTokenIs(token.ELLIPSIS):
+		spread := &ast.SpreadElement{Token: p.curToken}
+		p.nextToken()
+		if spread.Value = p.parseExpression(LOWEST); spread.Value == nil {
+			return nil
+		}
+		return spread
+
+	// 引数名: 値
+	case p.curTokenIs(token.IDENT) && p.peekTokenIs(token.COLON):
+		name := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		p.nextToken()
+		arg := &ast.NamedArgument{Token: p.curToken, Name: name}
+		p.nextToken()
+		if arg.Value = p.parseExpression(LOWEST); arg.Value == nil {
+			return nil
+		}
+		return arg
+	}
+
+	return p.parseExpression(LOWEST)
+}
+
 func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
 }
@@ -438,16 +1143,18 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
-func (p *Parser) peekPrecedance() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
+// Precedence トークンタイプに対応する演算子の優先順位を戻す
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
 		return p
 	}
 	return LOWEST
 }
 
+func (p *Parser) peekPrecedance() int {
+	return Precedence(p.peekToken.Type)
+}
+
 func (p *Parser) curPrecedance() int {
-	if p, ok := precedences[p.curToken.Type]; ok {
-		return p
-	}
-	return LOWEST
+	return Precedence(p.curToken.Type)
 }
@@ -49,6 +49,22 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	program := getParsedProgram(t, "3.25;", 1)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+
+	lit, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+	}
+	if lit.Value != 3.25 {
+		t.Errorf("lit.Value not %f. got=%f", 3.25, lit.Value)
+	}
+	if lit.TokenLiteral() != "3.25" {
+		t.Errorf("lit.TokenLiteral not %s. got=%s", "3.25", lit.TokenLiteral())
+	}
+}
+
 func TestBooleanExpression(t *testing.T) {
 	booleanTests := []struct {
 		input    string
@@ -118,8 +134,9 @@ func testLetStatement(t *testing.T, s ast.Statement, name string, value interfac
 		return false
 	}
 
-	if letStmt.Name.Value != name {
-		t.Errorf("letStmt.Name.Value not '%s'. got=%s", name, letStmt.Name.Value)
+	ident, ok := letStmt.Name.(*ast.Identifier)
+	if !ok || ident.Value != name {
+		t.Errorf("letStmt.Name not identifier '%s'. got=%s", name, letStmt.Name)
 		return false
 	}
 
@@ -232,6 +249,10 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"-a * b",
 			"((-a) * b)",
 		},
+		{
+			"re.match(p, s) + m.if.x",
+			"((re.match)(p, s) + ((m.if).x))",
+		},
 		{
 			"!-a",
 			"(!(-a))",
@@ -324,6 +345,22 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
+		{
+			"a * b[1] + h.k",
+			"((a * (b[1])) + (h.k))",
+		},
+		{
+			"f(x)[0].y",
+			"((f(x)[0]).y)",
+		},
+		{
+			"a = b = c + 1",
+			"a = b = (c + 1)",
+		},
+		{
+			"a[i + 1] += h.k * 2",
+			"(a[(i + 1)]) += ((h.k) * 2)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -422,8 +459,8 @@ func TestFunctionLiteralParsing(t *testing.T) {
 		t.Fatalf("関数の引数は2個にしてたはずなのに%d個とパースされちゃったよ", len(function.Parameters))
 	}
 
-	testLiteralExpression(t, function.Parameters[0], "x")
-	testLiteralExpression(t, function.Parameters[1], "y")
+	testLiteralExpression(t, function.Parameters[0].Target.(ast.Expression), "x")
+	testLiteralExpression(t, function.Parameters[1].Target.(ast.Expression), "y")
 
 	if len(function.Body.Statements) != 1 {
 		t.Fatalf("関数のボディは1個の式しかないはずなのに%d個とパースされたよ", len(function.Body.Statements))
@@ -459,7 +496,7 @@ func TestFunctionParameterParsing(t *testing.T) {
 		}
 
 		for i, ident := range tt.expectedParams {
-			testLiteralExpression(t, function.Parameters[i], ident)
+			testLiteralExpression(t, function.Parameters[i].Target.(ast.Expression), ident)
 		}
 	}
 }
@@ -492,6 +529,375 @@ func TestCallExpressionParsing(t *testing.T) {
 	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
 }
 
+func TestConstStatement(t *testing.T) {
+	program := getParsedProgram(t, "const x = 5; let y = x;", 2)
+
+	for i, expected := range []bool{true, false} {
+		stmt, ok := program.Statements[i].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("let文としてパースされてないぞ. got=%T", program.Statements[i])
+		}
+		if stmt.IsConst() != expected {
+			t.Errorf("statements[%d].IsConst() wrong. want=%t, got=%t", i, expected, stmt.IsConst())
+		}
+	}
+	if program.String() != "const x = 5;let y = x;" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestAssignExpression(t *testing.T) {
+	program := getParsedProgram(t, "x -= 1", 1)
+
+	exp, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.AssignExpression)
+	if !ok {
+		t.Fatalf("代入式としてパースされてないぞ. got=%T", program.Statements[0].(*ast.ExpressionStatement).Expression)
+	}
+	if exp.Operator != "-=" {
+		t.Errorf("演算子が-=じゃなくて%sになってるよ", exp.Operator)
+	}
+	if !testIdentifier(t, exp.Target, "x") || !testIntegerLiteral(t, exp.Value, 1) {
+		return
+	}
+
+	for _, input := range []string{"1 = 2", "f() = 1", "a + b = c"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q must be a parse error", input)
+		}
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < y) { let x = x + 1; continue; }`
+	program := getParsedProgram(t, input, 1)
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("while文としてパースされてないぞ. got=%T", program.Statements[0])
+	}
+	if !testInfixExpression(t, stmt.Condition, "x", "<", "y") {
+		return
+	}
+	if len(stmt.Body.Statements) != 2 {
+		t.Fatalf("ブロックが2文じゃなくて%d文になってるよ", len(stmt.Body.Statements))
+	}
+	if _, ok := stmt.Body.Statements[1].(*ast.ContinueStatement); !ok {
+		t.Errorf("continue文としてパースされてないぞ. got=%T", stmt.Body.Statements[1])
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	input := `for (x in xs) { if (x) { break } }; x`
+	program := getParsedProgram(t, input, 2)
+
+	stmt, ok := program.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("for文としてパースされてないぞ. got=%T", program.Statements[0])
+	}
+	if stmt.Variable.Value != "x" {
+		t.Errorf("変数名がxじゃなくて%sになってるよ", stmt.Variable.Value)
+	}
+	if !testIdentifier(t, stmt.Iterable, "xs") {
+		return
+	}
+	ie := stmt.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if _, ok := ie.Consequence.Statements[0].(*ast.BreakStatement); !ok {
+		t.Errorf("break文としてパースされてないぞ. got=%T", ie.Consequence.Statements[0])
+	}
+}
+
+func TestCollectionLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"hello world"`, `"hello world"`},
+		{"[]", "[]"},
+		{"[1, 2 * 2, a + b]", "[1, (2 * 2), (a + b)]"},
+		{"[\n1,\n2,\n]", "[1, 2]"},
+		{"{}", "{}"},
+		{`{"one": 1, two: 1 + 1, 3: [3]}`, `{"one": 1, two: (1 + 1), 3: [3]}`},
+		{"{\n1: 2,\n}", "{1: 2}"},
+		{"[1, 2][0] + {1: 2}[1]", "(([1, 2][0]) + ({1: 2}[1]))"},
+	}
+
+	for _, tt := range tests {
+		program := getParsedProgram(t, tt.input, 1)
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestDestructuringPatterns(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b] = xs;", "let [a, b] = xs;"},
+		{"let [a, ...rest] = xs;", "let [a, ...rest] = xs;"},
+		{"let [...rest] = xs;", "let [...rest] = xs;"},
+		{"let [] = xs;", "let [] = xs;"},
+		{"let [x = 0, y = x + 1] = xs;", "let [x = 0, y = (x + 1)] = xs;"},
+		{"let {name, age} = person;", "let {name, age} = person;"},
+		{"let {name: n, age = 20} = person;", "let {name: n, age = 20} = person;"},
+		{"const [a, {b: [c, d]}] = xs;", "const [a, {b: [c, d]}] = xs;"},
+		{"fn([a, b], {c}, d) { a }", "fn([a, b], {c}, d) a"},
+	}
+
+	for _, tt := range tests {
+		program := getParsedProgram(t, tt.input, 1)
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"let 5 = x", "invalid binding target: 5"},
+		{"let [a, ...rest, b] = xs", "expected next token to be ], got , instead"},
+		{"let {a: 1} = h", "invalid binding target: 1"},
+		{"let [a = b = 1] = xs", "expected next token to be ], got = instead"},
+		{"fn(a + b) { a }", "expected next token to be ), got + instead"},
+	}
+
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestFunctionParametersAndArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a, b = 2) { a }", "fn(a, b = 2) a"},
+		{"fn(a, ...rest) { rest }", "fn(a, ...rest) rest"},
+		{"fn(...args) { args }", "fn(...args) args"},
+		{"fn(a, b = a * 2, [c, d] = [b, 1]) { a }", "fn(a, b = (a * 2), [c, d] = [b, 1]) a"},
+		{"f(...xs)", "f(...xs)"},
+		{"f(1, ...xs, 2)", "f(1, ...xs, 2)"},
+		{"f(1, b: 2, c: x + 1)", "f(1, b: 2, c: (x + 1))"},
+		{"f(...xs, b: 2)", "f(...xs, b: 2)"},
+	}
+
+	for _, tt := range tests {
+		program := getParsedProgram(t, tt.input, 1)
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(...rest, a) { a }", "expected next token to be ), got , instead"},
+		{"fn(a = b, b) { a }", "default value of parameter a cannot refer to parameter b"},
+		{"fn(a = a) { a }", "default value of parameter a cannot refer to parameter a"},
+		{"fn(a = 1, ...rest = 2) { a }", "expected next token to be ), got = instead"},
+		{"f(a: 1, a: 2)", "duplicate named argument a"},
+		{"f(a: 1, 2)", "positional argument after named argument"},
+		{"f(a: 1, ...xs)", "positional argument after named argument"},
+	}
+
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+
+	// 実引数の並びの誤りの後も ) までパースを続け、後続のエラーを報告しない
+	for _, input := range []string{"f(a: 1, a: 2)", "f(a: 1, 2, b: 3); g(1)", "let x = f(a: 1, ...xs) + 1"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+
+		if len(p.Errors()) != 1 {
+			t.Errorf("expected exactly one error for %q. got=%q", input, p.Errors())
+		}
+	}
+}
+
+func TestShorthandFunctionsAndPipelines(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"|x| x * 2", "|x| (x * 2)"},
+		{"|| 1", "|| 1"},
+		{"|a, b = 1, ...rest| a", "|a, b = 1, ...rest| a"},
+		{"|[a, b], {c}| a + b + c", "|[a, b], {c}| ((a + b) + c)"},
+		{"|x| |y| x + y", "|x| |y| (x + y)"},
+		{"map(xs, |x| x + 1)", "map(xs, |x| (x + 1))"},
+		{"xs |> map(double) |> sum", "((xs |> map(double)) |> sum)"},
+		{"a + b |> f", "((a + b) |> f)"},
+		{"xs |> sum == 6", "((xs |> sum) == 6)"},
+		{"x |> |y| y + 1", "(x |> |y| (y + 1))"},
+		{"let double = |x| x * 2;", "let double = |x| (x * 2);"},
+	}
+
+	for _, tt := range tests {
+		program := getParsedProgram(t, tt.input, 1)
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"|x x", "expected next token to be |, got IDENT instead"},
+		{"|a = b, b| a", "default value of parameter a cannot refer to parameter b"},
+		{"while (true) { |x| break }", "no prefix parse function for BREAK found"},
+	}
+
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestImportAndExportStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "lib/math.mr" as math`, `import "lib/math.mr" as math;`},
+		{`import "a.mr" as a; import "b.mr" as b;`, `import "a.mr" as a;import "b.mr" as b;`},
+		{"export let x = 1;", "export let x = 1;"},
+		{"export const [a, {b}] = xs;", "export const [a, {b}] = xs;"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	program := getParsedProgram(t, "export const [a, {b: c}] = xs;", 1)
+	export, ok := program.Statements[0].(*ast.ExportStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ExportStatement. got=%T", program.Statements[0])
+	}
+	if names := export.Names(); len(names) != 2 || names[0].Value != "a" || names[1].Value != "c" {
+		t.Errorf("export.Names() wrong. got=%v", names)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`import math`, "expected next token to be STRING, got IDENT instead"},
+		{`import "math.mr"`, "expected next token to be AS, got EOF instead"},
+		{`if (true) { import "a.mr" as a }`, "import must be at top level"},
+		{"fn() { export let x = 1; }", "export must be at top level"},
+		{"export x = 1", "expected let or const after export, got IDENT instead"},
+	}
+
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		warnings int
+	}{
+		{`match (x) { 1 => "one", -1 => "minus", _ => "other" }`, `match (x) { 1 => "one", -1 => "minus", _ => "other" }`, 0},
+		{`match (x) { "a" => 1, true => 2, n => n, }`, `match (x) { "a" => 1, true => 2, n => n }`, 0},
+		{"match (xs) { [] => 0, [x, ...rest] => x + 1 }", "match (xs) { [] => 0, [x, ...rest] => (x + 1) }", 1},
+		{"match (p) { {name: \"a\", age} if age > 20 => age, {name} => name }", "match (p) { {name: \"a\", age} if (age > 20) => age, {name} => name }", 1},
+		{"match (x) { n if n > 0 => 1 }", "match (x) { n if (n > 0) => 1 }", 1},
+		{"match (x) {}", "match (x) {}", 1},
+		{"match (b) { true => 1, false => 0 }", "match (b) { true => 1, false => 0 }", 0},
+		{"match (b) { false => 0, true => 1, true => 2 }", "match (b) { false => 0, true => 1, true => 2 }", 0},
+		{"match (b) { true => 1 }", "match (b) { true => 1 }", 1},
+		{"match (b) { true if c => 1, false => 0 }", "match (b) { true if c => 1, false => 0 }", 1},
+		{"let y = match (x) { _ => 1 } + 1;", "let y = (match (x) { _ => 1 } + 1);", 0},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+		if len(p.Warnings()) != tt.warnings {
+			t.Errorf("wrong number of warnings for %q. want=%d, got=%q", tt.input, tt.warnings, p.Warnings())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"match x { _ => 1 }", "expected next token to be (, got IDENT instead"},
+		{"match (x) { 1 + 1 => 2 }", "expected next token to be =>, got + instead"},
+		{"match (x) { [a = 1] => a }", "default value is not allowed in match pattern"},
+		{"match (x) { fn => 1 }", "invalid binding target: fn"},
+		{"let 1 = x", "invalid binding target: 1"},
+	}
+
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestLoopControlOutsideOfLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break", "break outside of loop"},
+		{"if (true) { continue; }", "continue outside of loop"},
+		{"while (true) { fn() { break } }", "break outside of loop"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
 func getParsedProgram(t *testing.T, input string, statementSize int) *ast.Program {
 	p := New(lexer.New(input))
 
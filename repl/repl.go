@@ -2,18 +2,19 @@ package repl
 
 import (
 	"bufio"
-	"fmt"
 	"io"
 
-	"github.com/Sa2Knight/maron/evaluator"
+	"github.com/Sa2Knight/maron/engine"
 	"github.com/Sa2Knight/maron/lexer"
+	"github.com/Sa2Knight/maron/object"
+	"github.com/Sa2Knight/maron/optimizer"
 	"github.com/Sa2Knight/maron/parser"
 )
 
 // PROMPT REPLに毎行表示する文字列
 const PROMPT = ">> "
 
-//MARON マスコット
+// MARON マスコット
 const MARON = `
                                                                                     ..dbbpbka,
                                                                                    .4bbVY"TWbbW,
@@ -58,11 +59,50 @@ const MARON = `
                          Y^        ~!<<<<<<<<<!!~       .7\
 `
 
-// Start REPLを開始する
+// Options REPLの入出力に関する設定
+type Options struct {
+	Prompt   string // 毎行の入力前に表示する文字列
+	Banner   string // REPL開始時に一度だけ表示する文字列
+	ErrorArt string // パースエラー時にエラー内容の前に表示する文字列
+	Quiet    bool   // trueの場合、Prompt, Banner, ErrorArt を表示せず評価結果とエラーのみ出力する
+
+	Engine   string              // 実行エンジン名 (engine.EVAL or engine.VM)。空の場合は評価器を使う
+	Env      *object.Environment // 評価器で使用する環境。nilの場合は新しい環境を生成する。VMは識別子を自身で保持するので使用しない
+	Runtime  *object.Runtime     // 組み込み関数が使う実行環境の設定。nilの場合は Env に設定されたもの(VMでは既定の設定)を使う
+	Optimize bool                // trueの場合、実行前にプログラムを最適化する
+}
+
+// DefaultOptions デフォルトの設定を戻す
+func DefaultOptions() Options {
+	return Options{
+		Prompt:   PROMPT,
+		ErrorArt: MARON,
+	}
+}
+
+// Start デフォルトの設定でREPLを開始する
 func Start(in io.Reader, out io.Writer) {
+	StartWithOptions(in, out, DefaultOptions())
+}
+
+// StartWithOptions 設定を指定してREPLを開始する
+// 出力はすべて out に書き込まれる
+func StartWithOptions(in io.Reader, out io.Writer, opts Options) {
 	scanner := bufio.NewScanner(in)
+	e, err := newEngine(opts)
+	if err != nil {
+		io.WriteString(out, err.Error()+"\n")
+		return
+	}
+
+	if !opts.Quiet && opts.Banner != "" {
+		io.WriteString(out, opts.Banner)
+	}
+
 	for {
-		fmt.Printf(PROMPT)
+		if !opts.Quiet {
+			io.WriteString(out, opts.Prompt)
+		}
 		scanned := scanner.Scan()
 		if !scanned {
 			return
@@ -74,11 +114,15 @@ func Start(in io.Reader, out io.Writer) {
 
 		program := p.ParseProgram()
 		if len(p.Errors()) != 0 {
-			printParseErrors(out, p.Errors())
+			printParseErrors(out, opts, p.Errors())
 			continue
 		}
 
-		evaluated := evaluator.Eval(program)
+		if opts.Optimize {
+			program = optimizer.Optimize(program)
+		}
+
+		evaluated := e.Run(program)
 		if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
@@ -86,8 +130,27 @@ func Start(in io.Reader, out io.Writer) {
 	}
 }
 
-func printParseErrors(out io.Writer, errors []string) {
-	fmt.Println(MARON)
+// newEngine 設定に従ってエンジンを生成する
+// VMはコンパイル済みのグローバル変数を保持するので、opts.Env の識別子は引き継がない
+func newEngine(opts Options) (engine.Engine, error) {
+	if opts.Engine != "" && opts.Engine != engine.EVAL {
+		return engine.NewWithOptions(opts.Engine, engine.Options{Runtime: opts.Runtime})
+	}
+
+	env := opts.Env
+	if env == nil {
+		env = object.NewEnvironment()
+	}
+	if opts.Runtime != nil {
+		env.SetRuntime(opts.Runtime)
+	}
+	return engine.NewEvaluator(env), nil
+}
+
+func printParseErrors(out io.Writer, opts Options, errors []string) {
+	if !opts.Quiet && opts.ErrorArt != "" {
+		io.WriteString(out, opts.ErrorArt)
+	}
 	for _, msg := range errors {
 		io.WriteString(out, "\t"+msg+"\n")
 	}
@@ -0,0 +1,71 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStartWithOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		input    string
+		expected string
+	}{
+		{
+			"デフォルト設定",
+			Options{Prompt: ">> "},
+			"5\ntrue\n",
+			">> 5\n>> true\n>> ",
+		},
+		{
+			"バナーとプロンプトの変更",
+			Options{Prompt: "maron> ", Banner: "welcome\n"},
+			"10\n",
+			"welcome\nmaron> 10\nmaron> ",
+		},
+		{
+			"パースエラー時のアスキーアート",
+			Options{Prompt: ">> ", ErrorArt: "(x_x)\n"},
+			"let x 5\n",
+			">> (x_x)\n\texpected next token to be =, got INT instead\n>> ",
+		},
+		{
+			"Quietモード",
+			Options{Prompt: ">> ", Banner: "welcome\n", ErrorArt: "(x_x)\n", Quiet: true},
+			"5\nlet x 5\nfalse\n",
+			"5\n\texpected next token to be =, got INT instead\nfalse\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		StartWithOptions(strings.NewReader(tt.input), &out, tt.opts)
+		if out.String() != tt.expected {
+			t.Errorf("[%s] transcript wrong.\nwant=%q\ngot =%q", tt.name, tt.expected, out.String())
+		}
+	}
+}
+
+func TestStartWritesOnlyToWriter(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader("let x 5\n"), &out)
+
+	if !strings.HasPrefix(out.String(), PROMPT+MARON) {
+		t.Errorf("prompt and MARON must be written to out. got=%q", out.String())
+	}
+}
+
+func TestStartWithEngine(t *testing.T) {
+	input := "let add = fn(x, y) { x + y };\nadd(1, 2)\n5 + true\n"
+	expected := "3\nERROR: type mismatch: INTEGER + BOOLEAN\n"
+
+	for _, name := range []string{"eval", "vm"} {
+		var out bytes.Buffer
+		StartWithOptions(strings.NewReader(input), &out, Options{Quiet: true, Engine: name})
+		if out.String() != expected {
+			t.Errorf("[%s] transcript wrong.\nwant=%q\ngot =%q", name, expected, out.String())
+		}
+	}
+}
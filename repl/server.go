@@ -0,0 +1,202 @@
+package repl
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sa2Knight/maron/object"
+)
+
+// TOO_MANY_CONNECTIONS 同時接続数の上限を超えた接続に送るメッセージ
+const TOO_MANY_CONNECTIONS = "too many connections\n"
+
+// IDLE_TIMEOUT 一定時間入力がなく切断する際に送るメッセージ
+const IDLE_TIMEOUT = "\nidle timeout\n"
+
+// ErrServerClosed Close済みのServerでServeを呼び出した場合のエラー
+var ErrServerClosed = errors.New("repl: server closed")
+
+// Server 接続ごとに独立したREPLセッションを提供するサーバ
+type Server struct {
+	Options        Options                    // 各セッションのREPL設定 (Env と Runtime は使用されない)
+	NewEnvironment func() *object.Environment // 評価器でセッションごとの環境を生成する関数。nilの場合は空の環境を使用する
+	NewRuntime     func() *object.Runtime     // セッションごとの Runtime を生成する関数。nilの場合は既定の設定を使用する
+	IdleTimeout    time.Duration              // 入力がない場合に切断するまでの時間。0の場合は無制限
+	MaxConns       int                        // 同時接続数の上限。0の場合は無制限
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]*object.Runtime // 接続と、そのセッションの Runtime
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// Listen アドレスを解釈して待ち受けを開始する
+// "unix:" で始まる場合はUnixソケット、それ以外はTCPのアドレスとして扱う
+func Listen(addr string) (net.Listener, error) {
+	if strings.HasPrefix(addr, "unix:") {
+		return net.Listen("unix", strings.TrimPrefix(addr, "unix:"))
+	}
+	return net.Listen("tcp", addr)
+}
+
+// ListenAndServe addr で待ち受けを開始し、接続を受け付ける
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := Listen(addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve l で接続を受け付け、接続ごとにREPLセッションを開始する
+// Closeされるまで戻らない
+func (s *Server) Serve(l net.Listener) error {
+	if !s.trackListener(l) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer s.untrackListener(l)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		runtime := s.newRuntime()
+		if !s.trackConn(conn, runtime) {
+			io.WriteString(conn, TOO_MANY_CONNECTIONS)
+			conn.Close()
+			continue
+		}
+		go s.serveConn(conn, runtime)
+	}
+}
+
+// Close 待ち受けと全てのセッションを終了する
+// 評価中のプログラムは中断するので、終わらないプログラムを実行中のセッションがあっても戻る
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		if e := l.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	for c, runtime := range s.conns {
+		c.Close()
+		runtime.Interrupt()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serveConn(conn net.Conn, runtime *object.Runtime) {
+	defer s.wg.Done()
+	defer s.untrackConn(conn)
+	defer conn.Close()
+
+	opts := s.Options
+	if s.NewEnvironment != nil {
+		opts.Env = s.NewEnvironment()
+	} else {
+		opts.Env = object.NewEnvironment()
+	}
+	opts.Runtime = runtime
+
+	in := &idleReader{conn: conn, timeout: s.IdleTimeout}
+	StartWithOptions(in, conn, opts)
+
+	if in.timedOut {
+		io.WriteString(conn, IDLE_TIMEOUT)
+	}
+}
+
+// newRuntime セッションの Runtime を生成する
+// 環境を共有するセッションでも、乱数生成器などを共有せず、セッションごとに中断できるよう、セッションごとに生成する
+func (s *Server) newRuntime() *object.Runtime {
+	if s.NewRuntime != nil {
+		return s.NewRuntime()
+	}
+	return object.NewRuntime()
+}
+
+func (s *Server) trackListener(l net.Listener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	return true
+}
+
+func (s *Server) untrackListener(l net.Listener) {
+	s.mu.Lock()
+	delete(s.listeners, l)
+	s.mu.Unlock()
+}
+
+// trackConn 接続をセッションの Runtime とともに登録する。登録した場合は、Close が待つセッションとして数える
+// Close の wg.Wait と競合しないよう、wg.Add はロックを持ったまま呼び出す
+func (s *Server) trackConn(c net.Conn, runtime *object.Runtime) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed || (s.MaxConns > 0 && len(s.conns) >= s.MaxConns) {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]*object.Runtime)
+	}
+	s.conns[c] = runtime
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrackConn(c net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// idleReader 読み込みのたびにタイムアウトを設定し直す io.Reader
+type idleReader struct {
+	conn     net.Conn
+	timeout  time.Duration
+	timedOut bool
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	if r.timeout > 0 {
+		r.conn.SetReadDeadline(time.Now().Add(r.timeout))
+	}
+
+	n, err := r.conn.Read(p)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		r.timedOut = true
+	}
+	return n, err
+}
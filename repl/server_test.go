@@ -0,0 +1,165 @@
+package repl
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sa2Knight/maron/object"
+)
+
+func startTestServer(t *testing.T, s *Server) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %s", err)
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+
+	return l.Addr().String()
+}
+
+func dial(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial failed: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	return conn, bufio.NewReader(conn)
+}
+
+func send(t *testing.T, conn net.Conn, r *bufio.Reader, line string) string {
+	if _, err := io.WriteString(conn, line+"\n"); err != nil {
+		t.Fatalf("write failed: %s", err)
+	}
+	res, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("read failed: %s", err)
+	}
+	return res
+}
+
+func TestServerSessionsHaveOwnEnvironment(t *testing.T) {
+	addr := startTestServer(t, &Server{Options: Options{Quiet: true}})
+
+	c1, r1 := dial(t, addr)
+	c2, r2 := dial(t, addr)
+
+	send(t, c1, r1, "let x = 5; x")
+	if res := send(t, c1, r1, "x"); res != "5\n" {
+		t.Errorf("session 1 lost its binding. got=%q", res)
+	}
+	if res := send(t, c2, r2, "x"); res != "ERROR: identifier not found: x\n" {
+		t.Errorf("session 2 must not see session 1's binding. got=%q", res)
+	}
+}
+
+func TestServerNewEnvironment(t *testing.T) {
+	global := object.NewEnvironment()
+	global.Set("answer", &object.Integer{Value: 42})
+
+	addr := startTestServer(t, &Server{
+		Options:        Options{Quiet: true},
+		NewEnvironment: func() *object.Environment { return object.NewEnclosedEnvironment(global) },
+	})
+
+	c, r := dial(t, addr)
+	if res := send(t, c, r, "answer"); res != "42\n" {
+		t.Errorf("embedder's state must be visible. got=%q", res)
+	}
+}
+
+func TestServerSessionsHaveOwnRuntime(t *testing.T) {
+	global := object.NewEnvironment()
+
+	addr := startTestServer(t, &Server{
+		Options:        Options{Quiet: true},
+		NewEnvironment: func() *object.Environment { return object.NewEnclosedEnvironment(global) },
+	})
+
+	c1, r1 := dial(t, addr)
+	c2, r2 := dial(t, addr)
+
+	send(t, c1, r1, "math.seed(7)")
+	send(t, c2, r2, "math.seed(7)")
+	first := send(t, c1, r1, "math.random()")
+	if res := send(t, c2, r2, "math.random()"); res != first {
+		t.Errorf("sessions must not share the random generator. got=%q and %q", first, res)
+	}
+}
+
+func TestServerMaxConns(t *testing.T) {
+	addr := startTestServer(t, &Server{Options: Options{Quiet: true}, MaxConns: 1})
+
+	c1, r1 := dial(t, addr)
+	send(t, c1, r1, "1") // 1本目の接続が確立するのを待つ
+
+	_, r2 := dial(t, addr)
+	res, _ := r2.ReadString('\n')
+	if res != TOO_MANY_CONNECTIONS {
+		t.Errorf("second connection must be rejected. got=%q", res)
+	}
+}
+
+func TestServerIdleTimeout(t *testing.T) {
+	addr := startTestServer(t, &Server{Options: Options{Quiet: true}, IdleTimeout: 50 * time.Millisecond})
+
+	_, r := dial(t, addr)
+	res, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read failed: %s", err)
+	}
+	if string(res) != IDLE_TIMEOUT {
+		t.Errorf("idle connection must be closed with message. got=%q", string(res))
+	}
+}
+
+func TestServerCloseInterruptsSessions(t *testing.T) {
+	for _, name := range []string{"eval", "vm"} {
+		s := &Server{Options: Options{Quiet: true, Engine: name}}
+		addr := startTestServer(t, s)
+
+		c, r := dial(t, addr)
+		send(t, c, r, "1") // セッションが始まるのを待つ
+		io.WriteString(c, "while (true) {}\n")
+		time.Sleep(50 * time.Millisecond)
+
+		closed := make(chan struct{})
+		go func() {
+			s.Close()
+			close(closed)
+		}()
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("[%s] Close must not wait for a session running an endless loop", name)
+		}
+	}
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	path := t.TempDir() + "/maron.sock"
+	l, err := Listen("unix:" + path)
+	if err != nil {
+		t.Fatalf("listen failed: %s", err)
+	}
+	s := &Server{Options: Options{Quiet: true}}
+	go s.Serve(l)
+	defer s.Close()
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial failed: %s", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if res := send(t, conn, bufio.NewReader(conn), "true"); !strings.HasPrefix(res, "true") {
+		t.Errorf("unexpected response. got=%q", res)
+	}
+}
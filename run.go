@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/Sa2Knight/maron/compiler"
+	"github.com/Sa2Knight/maron/engine"
+	"github.com/Sa2Knight/maron/module"
+	"github.com/Sa2Knight/maron/object"
+	"github.com/Sa2Knight/maron/optimizer"
+	"github.com/Sa2Knight/maron/vm"
+)
+
+// runFile ソースコードのファイルを実行し、最後の式の値を表示する (maron run [--engine=vm] [--optimize] [--warn] [--path dirs] [--allow-fs dirs] [--allow-http] [--allow-exec] file.mr [args...])
+// コンパイル済みモジュール(maron build の出力)はVMで実行する
+// import文のモジュールは、ファイルのディレクトリと --path (省略時は環境変数 MARON_PATH)のディレクトリから探す
+// fs モジュールは --allow-fs で指定したディレクトリの中でのみ、http モジュールは --allow-http を指定した場合のみ使える
+// ファイルより後の引数は os.args で参照でき、os.exec は --allow-exec を指定した場合のみ使える
+// 終了コードを戻す
+func runFile(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	engineName := fs.String("engine", engine.EVAL, "実行エンジン (eval or vm)")
+	optimize := fs.Bool("optimize", false, "実行前にプログラムを最適化する")
+	warn := fs.Bool("warn", false, "網羅的でないmatch式などの警告を表示する")
+	path := fs.String("path", "", "モジュールを探すディレクトリ(: 区切り)。省略時は環境変数 "+MODULE_PATH_ENV)
+	allowFS := fs.String("allow-fs", "", "fs モジュールで読み書きできるディレクトリ(: 区切り)。省略時は fs モジュールを使えない")
+	allowHTTP := fs.Bool("allow-http", false, "http モジュールでの通信を許可する")
+	allowExec := fs.Bool("allow-exec", false, "os.exec でのサブプロセスの実行を許可する")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "usage: maron run [--engine=eval|vm] [--optimize] [--warn] [--path dirs] [--allow-fs dirs] [--allow-http] [--allow-exec] file.mr [args...]")
+		return 2
+	}
+
+	runtime := object.NewRuntime()
+	runtime.FSRoots = filepath.SplitList(*allowFS)
+	if *allowHTTP {
+		runtime.HTTPTransport = http.DefaultTransport
+	}
+	runtime.OS = object.NewOSAccess(fs.Args()[1:])
+	runtime.OS.AllowExec = *allowExec
+
+	loader := module.NewLoader(fs.Arg(0), modulePath(*path)...)
+	e, err := engine.NewWithOptions(*engineName, engine.Options{Loader: loader, Runtime: runtime})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var result object.Object
+	if compiler.IsModule(data) {
+		result = runModule(data, runtime)
+	} else {
+		var warnings io.Writer
+		if *warn {
+			warnings = os.Stderr
+		}
+		program, err := parseSource(fs.Arg(0), data, warnings)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if *optimize {
+			program = optimizer.Optimize(program)
+		}
+		result = e.Run(program)
+	}
+
+	if result == nil {
+		return 0
+	}
+	if result.Type() == object.ERROR {
+		fmt.Fprintln(os.Stderr, result.Inspect())
+		return 1
+	}
+	fmt.Println(result.Inspect())
+	return 0
+}
+
+// runModule コンパイル済みモジュールをVMで実行する
+func runModule(data []byte, runtime *object.Runtime) object.Object {
+	bytecode, err := compiler.UnmarshalBytecode(data)
+	if err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	machine := vm.New(bytecode)
+	machine.SetRuntime(runtime)
+	if err := machine.Run(); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	return machine.LastPoppedStackElem()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Sa2Knight/maron/engine"
+	"github.com/Sa2Knight/maron/repl"
+)
+
+// serve ネットワーク越しにREPLを提供する (maron serve --listen addr)
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:7070", "待ち受けるアドレス。unix:/path/to.sock の形式でUnixソケットを指定できる")
+	idleTimeout := fs.Duration("idle-timeout", 0, "入力がない接続を切断するまでの時間。0の場合は無制限")
+	maxConns := fs.Int("max-conns", 0, "同時接続数の上限。0の場合は無制限")
+	quiet := fs.Bool("quiet", false, "プロンプトやバナーを表示せず、評価結果のみを出力する")
+	engineName := fs.String("engine", engine.EVAL, "実行エンジン (eval or vm)")
+	optimize := fs.Bool("optimize", false, "実行前にプログラムを最適化する")
+	fs.Parse(args)
+
+	if _, err := engine.New(*engineName); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	opts := repl.DefaultOptions()
+	opts.Quiet = *quiet
+	opts.Engine = *engineName
+	opts.Optimize = *optimize
+	opts.Banner = "This is the Maron programming language!\n"
+
+	server := &repl.Server{
+		Options:     opts,
+		IdleTimeout: *idleTimeout,
+		MaxConns:    *maxConns,
+	}
+
+	fmt.Fprintf(os.Stderr, "maron: listening on %s\n", *listen)
+	if err := server.ListenAndServe(*listen); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
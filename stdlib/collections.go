@@ -0,0 +1,577 @@
+package stdlib
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Sa2Knight/maron/object"
+)
+
+// 配列を扱う組み込み関数。モジュールにまとめず、識別子として直接参照できる
+// 関数を受け取るものは、呼び出したエンジン(ctx.Call)を通してその関数を呼び出す
+func init() {
+	for name, fn := range map[string]object.BuiltinFunction{
+		"len":       builtinLen,
+		"push":      builtinPush,
+		"range":     builtinRange,
+		"map":       builtinMap,
+		"filter":    builtinFilter,
+		"reduce":    builtinReduce,
+		"each":      builtinEach,
+		"zip":       builtinZip,
+		"enumerate": builtinEnumerate,
+		"sort":      builtinSort,
+		"sort_by":   builtinSortBy,
+		"group_by":  builtinGroupBy,
+		"uniq":      builtinUniq,
+		"flatten":   builtinFlatten,
+		"any":       predicateFunction("any", true),
+		"all":       predicateFunction("all", false),
+		"find":      builtinFind,
+		"take":      sliceFunction("take", func(elements []object.Object, n int) []object.Object { return elements[:n] }),
+		"drop":      sliceFunction("drop", func(elements []object.Object, n int) []object.Object { return elements[n:] }),
+		"sum":       builtinSum,
+	} {
+		register(name, &object.Builtin{Name: name, Fn: fn})
+	}
+}
+
+// arrayArg 配列の引数の要素を取り出す
+// 要素は呼び出した時点のものを複製して戻すので、関数の呼び出し中に配列が変わっても影響しない
+func arrayArg(name string, arg object.Object) ([]object.Object, *object.Error) {
+	array, ok := arg.(*object.Array)
+	if !ok {
+		return nil, newError("argument to %s must be ARRAY, got %s", name, arg.Type())
+	}
+	return array.Iterate(), nil
+}
+
+// call 関数を呼び出す。関数の中で起きたエラーはそのまま戻す
+func call(ctx object.Context, fn object.Object, args ...object.Object) (object.Object, *object.Error) {
+	result := ctx.Call(fn, args...)
+	if err, ok := result.(*object.Error); ok {
+		return nil, err
+	}
+	return result, nil
+}
+
+// isTruthy null と false 以外は全て真として扱う
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Null:
+		return false
+	case *object.Boolean:
+		return obj.Value
+	}
+	return true
+}
+
+// compare 整数、浮動小数点数、文字列、時刻などの大小を比較する
+// a が小さければ負、等しければ0、大きければ正を戻す
+func compare(name string, a, b object.Object) (int, *object.Error) {
+	if x, ok := a.(*object.Integer); ok {
+		if y, ok := b.(*object.Integer); ok {
+			switch {
+			case x.Value < y.Value:
+				return -1, nil
+			case x.Value > y.Value:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	if x, ok := object.ToFloat(a); ok {
+		if y, ok := object.ToFloat(b); ok {
+			switch {
+			case x < y:
+				return -1, nil
+			case x > y:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	if x, ok := a.(*object.String); ok {
+		if y, ok := b.(*object.String); ok {
+			return strings.Compare(x.Value, y.Value), nil
+		}
+	}
+	if result, ok := object.Compare(a, b); ok {
+		return result, nil
+	}
+	return 0, newError("%s: cannot compare %s and %s", name, a.Type(), b.Type())
+}
+
+// builtinLen 配列とハッシュは要素数を、文字列は文字数を戻す
+func builtinLen(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("len", args, 1, 1); err != nil {
+		return err
+	}
+	switch arg := args[0].(type) {
+	case *object.Array:
+		return &object.Integer{Value: int64(len(arg.Elements))}
+	case *object.String:
+		return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+	case *object.Hash:
+		return &object.Integer{Value: int64(len(arg.Pairs))}
+	}
+	return newError("argument to len not supported, got %s", args[0].Type())
+}
+
+// builtinPush 末尾に値を追加した新しい配列を戻す。元の配列は変更しない
+func builtinPush(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("push", args, 1, -1); err != nil {
+		return err
+	}
+	elements, err := arrayArg("push", args[0])
+	if err != nil {
+		return err
+	}
+	return &object.Array{Elements: append(elements, args[1:]...)}
+}
+
+// builtinRange 整数の配列を戻す
+//
+//	range(n)    0以上n未満
+//	range(a, b) a以上b未満
+func builtinRange(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("range", args, 1, 2); err != nil {
+		return err
+	}
+	var start, end int64
+	if len(args) == 1 {
+		n, err := integerArg("range", args[0])
+		if err != nil {
+			return err
+		}
+		end = n
+	} else {
+		a, b, err := integerPair("range", args)
+		if err != nil {
+			return err
+		}
+		start, end = a, b
+	}
+
+	elements := []object.Object{}
+	for i := start; i < end; i++ {
+		elements = append(elements, &object.Integer{Value: i})
+	}
+	return &object.Array{Elements: elements}
+}
+
+// builtinMap 各要素に関数を適用した結果の配列を戻す
+func builtinMap(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("map", args, 2, 2); err != nil {
+		return err
+	}
+	elements, err := arrayArg("map", args[0])
+	if err != nil {
+		return err
+	}
+	result := make([]object.Object, len(elements))
+	for i, el := range elements {
+		if result[i], err = call(ctx, args[1], el); err != nil {
+			return err
+		}
+	}
+	return &object.Array{Elements: result}
+}
+
+// builtinFilter 関数の結果が真になる要素だけの配列を戻す
+func builtinFilter(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("filter", args, 2, 2); err != nil {
+		return err
+	}
+	elements, err := arrayArg("filter", args[0])
+	if err != nil {
+		return err
+	}
+	result := []object.Object{}
+	for _, el := range elements {
+		keep, err := call(ctx, args[1], el)
+		if err != nil {
+			return err
+		}
+		if isTruthy(keep) {
+			result = append(result, el)
+		}
+	}
+	return &object.Array{Elements: result}
+}
+
+// builtinReduce 関数に(それまでの結果, 要素)を順に渡して畳み込む
+// 初期値を省略した場合は最初の要素を初期値にする
+func builtinReduce(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("reduce", args, 2, 3); err != nil {
+		return err
+	}
+	elements, err := arrayArg("reduce", args[0])
+	if err != nil {
+		return err
+	}
+
+	var acc object.Object
+	if len(args) == 3 {
+		acc = args[2]
+	} else {
+		if len(elements) == 0 {
+			return newError("reduce: empty array with no initial value")
+		}
+		acc, elements = elements[0], elements[1:]
+	}
+	for _, el := range elements {
+		if acc, err = call(ctx, args[1], acc, el); err != nil {
+			return err
+		}
+	}
+	return acc
+}
+
+// builtinEach 各要素に関数を適用する。戻り値は null
+func builtinEach(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("each", args, 2, 2); err != nil {
+		return err
+	}
+	elements, err := arrayArg("each", args[0])
+	if err != nil {
+		return err
+	}
+	for _, el := range elements {
+		if _, err := call(ctx, args[1], el); err != nil {
+			return err
+		}
+	}
+	return object.NullObject
+}
+
+// builtinZip 各配列の同じ位置の要素を組にした配列を戻す。長さは最も短い配列に合わせる
+func builtinZip(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("zip", args, 1, -1); err != nil {
+		return err
+	}
+	arrays := make([][]object.Object, len(args))
+	length := math.MaxInt64
+	for i, arg := range args {
+		elements, err := arrayArg("zip", arg)
+		if err != nil {
+			return err
+		}
+		arrays[i] = elements
+		if len(elements) < length {
+			length = len(elements)
+		}
+	}
+
+	result := make([]object.Object, length)
+	for i := range result {
+		tuple := make([]object.Object, len(arrays))
+		for j, elements := range arrays {
+			tuple[j] = elements[i]
+		}
+		result[i] = &object.Array{Elements: tuple}
+	}
+	return &object.Array{Elements: result}
+}
+
+// builtinEnumerate [位置, 要素] の組の配列を戻す
+func builtinEnumerate(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("enumerate", args, 1, 1); err != nil {
+		return err
+	}
+	elements, err := arrayArg("enumerate", args[0])
+	if err != nil {
+		return err
+	}
+	result := make([]object.Object, len(elements))
+	for i, el := range elements {
+		result[i] = &object.Array{Elements: []object.Object{&object.Integer{Value: int64(i)}, el}}
+	}
+	return &object.Array{Elements: result}
+}
+
+// stableSort less で要素を安定ソートした新しい配列を戻す
+// less がエラーを戻した場合は、以降の比較を打ち切ってそのエラーを戻す
+func stableSort(elements []object.Object, less func(a, b object.Object) (bool, *object.Error)) object.Object {
+	var sortErr *object.Error
+	sort.SliceStable(elements, func(i, j int) bool {
+		if sortErr != nil {
+			return false
+		}
+		result, err := less(elements[i], elements[j])
+		sortErr = err
+		return result
+	})
+	if sortErr != nil {
+		return sortErr
+	}
+	return &object.Array{Elements: elements}
+}
+
+// builtinSort 昇順に並べ替えた新しい配列を戻す。元の配列は変更しない
+// 比較関数を渡した場合は、その結果で並べ替える。比較関数は次のどちらかを戻す
+//
+//	整数       a が先なら負、等しければ0、b が先なら正
+//	真偽値     a が b より先なら true
+func builtinSort(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("sort", args, 1, 2); err != nil {
+		return err
+	}
+	elements, err := arrayArg("sort", args[0])
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 1 {
+		return stableSort(elements, func(a, b object.Object) (bool, *object.Error) {
+			c, err := compare("sort", a, b)
+			return c < 0, err
+		})
+	}
+	return stableSort(elements, func(a, b object.Object) (bool, *object.Error) {
+		result, err := call(ctx, args[1], a, b)
+		if err != nil {
+			return false, err
+		}
+		switch result := result.(type) {
+		case *object.Integer:
+			return result.Value < 0, nil
+		case *object.Boolean:
+			return result.Value, nil
+		}
+		return false, newError("sort: comparator must return INTEGER or BOOLEAN, got %s", result.Type())
+	})
+}
+
+// builtinSortBy 各要素に関数を適用した結果(キー)の昇順に並べ替えた新しい配列を戻す
+// 関数は要素ごとに一度だけ呼び出す
+func builtinSortBy(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("sort_by", args, 2, 2); err != nil {
+		return err
+	}
+	elements, err := arrayArg("sort_by", args[0])
+	if err != nil {
+		return err
+	}
+
+	keys := map[object.Object]object.Object{}
+	for _, el := range elements {
+		key, err := call(ctx, args[1], el)
+		if err != nil {
+			return err
+		}
+		keys[el] = key
+	}
+	// 同じオブジェクトが複数回現れても、キーは同じになる
+	return stableSort(elements, func(a, b object.Object) (bool, *object.Error) {
+		c, err := compare("sort_by", keys[a], keys[b])
+		return c < 0, err
+	})
+}
+
+// builtinGroupBy 関数の結果をキーとし、同じキーになった要素の配列を値とするハッシュを戻す
+func builtinGroupBy(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("group_by", args, 2, 2); err != nil {
+		return err
+	}
+	elements, err := arrayArg("group_by", args[0])
+	if err != nil {
+		return err
+	}
+
+	groups := object.NewHash()
+	for _, el := range elements {
+		result, err := call(ctx, args[1], el)
+		if err != nil {
+			return err
+		}
+		key, ok := result.(object.Hashable)
+		if !ok {
+			return newError("group_by: unusable as hash key: %s", result.Type())
+		}
+		group, ok := groups.Get(key)
+		if !ok {
+			group = &object.Array{Elements: []object.Object{}}
+			groups.Set(key, group)
+		}
+		array := group.(*object.Array)
+		array.Elements = append(array.Elements, el)
+	}
+	return groups
+}
+
+// builtinUniq 重複する要素を取り除いた配列を戻す。最初に現れた要素を残す
+// ハッシュのキーにできない要素(配列など)は同じオブジェクトかどうかで比べる
+func builtinUniq(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("uniq", args, 1, 1); err != nil {
+		return err
+	}
+	elements, err := arrayArg("uniq", args[0])
+	if err != nil {
+		return err
+	}
+
+	seenKeys := map[object.HashKey]bool{}
+	seenObjects := map[object.Object]bool{}
+	result := []object.Object{}
+	for _, el := range elements {
+		if key, ok := el.(object.Hashable); ok {
+			if seenKeys[key.HashKey()] {
+				continue
+			}
+			seenKeys[key.HashKey()] = true
+		} else {
+			if seenObjects[el] {
+				continue
+			}
+			seenObjects[el] = true
+		}
+		result = append(result, el)
+	}
+	return &object.Array{Elements: result}
+}
+
+// builtinFlatten 入れ子の配列を平らにした配列を戻す
+// 深さを省略した場合は全ての入れ子を展開する
+func builtinFlatten(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("flatten", args, 1, 2); err != nil {
+		return err
+	}
+	elements, err := arrayArg("flatten", args[0])
+	if err != nil {
+		return err
+	}
+	depth := int64(-1)
+	if len(args) == 2 {
+		if depth, err = integerArg("flatten", args[1]); err != nil {
+			return err
+		}
+		if depth < 0 {
+			return newError("flatten: negative depth: %d", depth)
+		}
+	}
+	return &object.Array{Elements: flatten(elements, depth, []object.Object{})}
+}
+
+// flatten 要素を result に追加する。depth が負の場合は深さの制限なし
+func flatten(elements []object.Object, depth int64, result []object.Object) []object.Object {
+	for _, el := range elements {
+		if array, ok := el.(*object.Array); ok && depth != 0 {
+			result = flatten(array.Elements, depth-1, result)
+		} else {
+			result = append(result, el)
+		}
+	}
+	return result
+}
+
+// predicateFunction 要素のいずれか(some が真)、または全てが条件を満たすか判定する関数を生成する
+// 関数を省略した場合は要素そのものの真偽で判定する
+func predicateFunction(name string, some bool) object.BuiltinFunction {
+	return func(ctx object.Context, args ...object.Object) object.Object {
+		if err := checkArgs(name, args, 1, 2); err != nil {
+			return err
+		}
+		elements, err := arrayArg(name, args[0])
+		if err != nil {
+			return err
+		}
+		for _, el := range elements {
+			result := el
+			if len(args) == 2 {
+				if result, err = call(ctx, args[1], el); err != nil {
+					return err
+				}
+			}
+			// 結果が決まった時点で打ち切る
+			if isTruthy(result) == some {
+				return object.NativeBool(some)
+			}
+		}
+		return object.NativeBool(!some)
+	}
+}
+
+// builtinFind 関数の結果が最初に真になる要素を戻す。見つからなければ null
+func builtinFind(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("find", args, 2, 2); err != nil {
+		return err
+	}
+	elements, err := arrayArg("find", args[0])
+	if err != nil {
+		return err
+	}
+	for _, el := range elements {
+		found, err := call(ctx, args[1], el)
+		if err != nil {
+			return err
+		}
+		if isTruthy(found) {
+			return el
+		}
+	}
+	return object.NullObject
+}
+
+// sliceFunction 配列と個数を受け取り、配列の一部を戻す関数を生成する
+// 個数が配列の長さより大きい場合は長さに切り詰める
+func sliceFunction(name string, slice func(elements []object.Object, n int) []object.Object) object.BuiltinFunction {
+	return func(ctx object.Context, args ...object.Object) object.Object {
+		if err := checkArgs(name, args, 2, 2); err != nil {
+			return err
+		}
+		elements, err := arrayArg(name, args[0])
+		if err != nil {
+			return err
+		}
+		n, err := integerArg(name, args[1])
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return newError("%s: negative count: %d", name, n)
+		}
+		if n > int64(len(elements)) {
+			n = int64(len(elements))
+		}
+		return &object.Array{Elements: slice(elements, int(n))}
+	}
+}
+
+// builtinSum 数値の合計を戻す
+// 全て整数であれば整数で、浮動小数点数を含む場合は浮動小数点数で計算する。空の配列は 0
+func builtinSum(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("sum", args, 1, 1); err != nil {
+		return err
+	}
+	elements, err := arrayArg("sum", args[0])
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	var floatTotal float64
+	isFloat := false
+	for i, el := range elements {
+		switch el := el.(type) {
+		case *object.Integer:
+			next := total + el.Value
+			if (next > total) != (el.Value > 0) {
+				return newError("sum: integer overflow")
+			}
+			total = next
+			floatTotal += float64(el.Value)
+		case *object.Float:
+			isFloat = true
+			floatTotal += el.Value
+		default:
+			return newError("sum: element %d must be INTEGER or FLOAT, got %s", i, el.Type())
+		}
+	}
+	if isFloat {
+		return floatResult("sum", floatTotal)
+	}
+	return &object.Integer{Value: total}
+}
@@ -0,0 +1,316 @@
+package stdlib
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Sa2Knight/maron/object"
+)
+
+// ファイルの読み書きは、Runtime.FSRoots で許可したディレクトリの中に限る
+// パスは .. とシンボリックリンク(リンク先が存在しないものを含む)を解決した上で、許可したディレクトリの外を指していないか検査する
+// 書き込みは開いたファイルが検査したパスのファイルであることを確かめてから行うが、
+// それ以外の操作では検査の後にファイルシステムが変更された場合までは防がない
+func init() {
+	register("fs", newModule("fs", map[string]object.BuiltinFunction{
+		"read_file":  fsReadFile,
+		"write_file": fsWriteFile,
+		"list_dir":   fsListDir,
+		"exists":     fsExists,
+		"mkdir":      fsMkdir,
+		"glob":       fsGlob,
+	}, nil))
+}
+
+// sandbox 許可したディレクトリ(シンボリックリンクを解決した絶対パス)
+type sandbox struct {
+	roots []string
+}
+
+// newSandbox Runtime の設定から sandbox を生成する。許可したディレクトリがなければエラー
+func newSandbox(name string, ctx object.Context) (*sandbox, *object.Error) {
+	if len(ctx.Runtime().FSRoots) == 0 {
+		return nil, newError("%s: file system access is disabled", name)
+	}
+	s := &sandbox{}
+	for _, root := range ctx.Runtime().FSRoots {
+		resolved, err := resolveSymlinks(root)
+		if err != nil {
+			return nil, newError("%s: invalid root directory: %s", name, root)
+		}
+		s.roots = append(s.roots, resolved)
+	}
+	return s, nil
+}
+
+// abs 相対パスを先頭のディレクトリを基準に絶対パスにする(.. を取り除く)
+func (s *sandbox) abs(path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(s.roots[0], path)
+}
+
+// contains パスが許可したディレクトリのいずれかの中にあるか
+func (s *sandbox) contains(path string) bool {
+	for _, root := range s.roots {
+		rel, err := filepath.Rel(root, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve パスを、シンボリックリンクを解決した絶対パスにする
+// 許可したディレクトリの外を指す場合はエラー
+func (s *sandbox) resolve(name, path string) (string, *object.Error) {
+	resolved, err := resolveSymlinks(s.abs(path))
+	if err != nil || !s.contains(resolved) {
+		return "", newError("%s: path outside allowed directories: %s", name, path)
+	}
+	return resolved, nil
+}
+
+// maxSymlinks リンク先が存在しないシンボリックリンクを辿る回数の上限(循環するリンク対策)
+const maxSymlinks = 255
+
+// resolveSymlinks パスのシンボリックリンクを解決した絶対パスを戻す
+// まだ存在しない部分(書き込むファイルなど)は、存在する親ディレクトリを解決した後ろにそのまま付ける
+// リンク先が存在しないシンボリックリンクは、書き込むとリンク先に作られるので、リンク先のパスに置き換えて解決を続ける
+func resolveSymlinks(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	missing := []string{}
+	links := 0
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		if info, lstatErr := os.Lstat(path); lstatErr == nil && info.Mode()&os.ModeSymlink != 0 {
+			if links++; links > maxSymlinks {
+				return "", errors.New("too many levels of symbolic links")
+			}
+			target, err := os.Readlink(path)
+			if err != nil {
+				return "", err
+			}
+			if !filepath.IsAbs(target) {
+				// 相対パスのリンク先は、リンクのあるディレクトリ(のリンクを解決したもの)からの位置
+				dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+				if err != nil {
+					return "", err
+				}
+				target = filepath.Join(dir, target)
+			}
+			path = filepath.Clean(target)
+			continue
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
+
+// sandboxedPath 引数のパスを取り出し、許可したディレクトリの中の絶対パスに解決する
+func sandboxedPath(name string, ctx object.Context, arg object.Object) (resolved, path string, err *object.Error) {
+	s, err := newSandbox(name, ctx)
+	if err != nil {
+		return "", "", err
+	}
+	if path, err = stringArg(name, arg); err != nil {
+		return "", "", err
+	}
+	if resolved, err = s.resolve(name, path); err != nil {
+		return "", "", err
+	}
+	return resolved, path, nil
+}
+
+// fsError ファイル操作のエラーを、プログラムが指定したパスで表す(絶対パスを見せない)
+func fsError(name, path string, err error) *object.Error {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	return newError("%s: %s: %s", name, path, err)
+}
+
+// fsReadFile ファイルの内容を文字列で戻す
+func fsReadFile(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("fs.read_file", args, 1, 1); err != nil {
+		return err
+	}
+	resolved, path, err := sandboxedPath("fs.read_file", ctx, args[0])
+	if err != nil {
+		return err
+	}
+	data, readErr := os.ReadFile(resolved)
+	if readErr != nil {
+		return fsError("fs.read_file", path, readErr)
+	}
+	return &object.String{Value: string(data)}
+}
+
+// fsWriteFile 文字列をファイルに書き込む。ファイルがあれば上書きする(親ディレクトリは作らない)
+func fsWriteFile(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("fs.write_file", args, 2, 2); err != nil {
+		return err
+	}
+	resolved, path, err := sandboxedPath("fs.write_file", ctx, args[0])
+	if err != nil {
+		return err
+	}
+	content, err := stringArg("fs.write_file", args[1])
+	if err != nil {
+		return err
+	}
+	if writeErr := writeFile(resolved, content); writeErr != nil {
+		if errors.Is(writeErr, errPathChanged) {
+			return newError("fs.write_file: path outside allowed directories: %s", path)
+		}
+		return fsError("fs.write_file", path, writeErr)
+	}
+	return object.NullObject
+}
+
+// errPathChanged 検査したパスが、開くまでの間に別のファイルに置き換えられた
+var errPathChanged = errors.New("path changed")
+
+// writeFile 解決したパスのファイルに書き込む
+// 検査の後にシンボリックリンクに置き換えられていないよう、リンクを辿らずに開き、
+// 開いたファイルがパスのファイルそのものであることを確かめてから内容を書き換える
+// (リンクを辿って開くと、リンク先が存在しない場合に許可したディレクトリの外にファイルを作ってしまう)
+func writeFile(resolved, content string) error {
+	f, err := os.OpenFile(resolved, os.O_WRONLY|os.O_CREATE|openNoFollow, 0644)
+	if err != nil {
+		if current, lerr := os.Lstat(resolved); lerr == nil && current.Mode()&os.ModeSymlink != 0 {
+			return errPathChanged
+		}
+		return err
+	}
+	defer f.Close()
+
+	opened, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	current, err := os.Lstat(resolved)
+	if err != nil || current.Mode()&os.ModeSymlink != 0 || !os.SameFile(opened, current) {
+		return errPathChanged
+	}
+
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// fsListDir ディレクトリの中のファイル名を名前の順に戻す
+func fsListDir(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("fs.list_dir", args, 1, 1); err != nil {
+		return err
+	}
+	resolved, path, err := sandboxedPath("fs.list_dir", ctx, args[0])
+	if err != nil {
+		return err
+	}
+	entries, readErr := os.ReadDir(resolved)
+	if readErr != nil {
+		return fsError("fs.list_dir", path, readErr)
+	}
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	return stringArray(names)
+}
+
+// fsExists ファイルまたはディレクトリが存在するか
+// 許可したディレクトリの外のパスは、存在するかどうかに関わらずエラーにする
+func fsExists(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("fs.exists", args, 1, 1); err != nil {
+		return err
+	}
+	resolved, path, err := sandboxedPath("fs.exists", ctx, args[0])
+	if err != nil {
+		return err
+	}
+	_, statErr := os.Stat(resolved)
+	switch {
+	case statErr == nil:
+		return object.TrueObject
+	case errors.Is(statErr, os.ErrNotExist):
+		return object.FalseObject
+	}
+	return fsError("fs.exists", path, statErr)
+}
+
+// fsMkdir ディレクトリを(必要であれば親ディレクトリも)作る。既にあれば何もしない
+func fsMkdir(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("fs.mkdir", args, 1, 1); err != nil {
+		return err
+	}
+	resolved, path, err := sandboxedPath("fs.mkdir", ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if mkdirErr := os.MkdirAll(resolved, 0755); mkdirErr != nil {
+		return fsError("fs.mkdir", path, mkdirErr)
+	}
+	return object.NullObject
+}
+
+// fsGlob パターン(*, ?, [...])に一致するパスを名前の順に戻す
+// 相対パスのパターンであれば、結果も先頭のディレクトリからの相対パスにする
+// シンボリックリンクで許可したディレクトリの外を指すものは結果に含めない
+func fsGlob(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("fs.glob", args, 1, 1); err != nil {
+		return err
+	}
+	s, err := newSandbox("fs.glob", ctx)
+	if err != nil {
+		return err
+	}
+	pattern, err := stringArg("fs.glob", args[0])
+	if err != nil {
+		return err
+	}
+
+	// パターンの記号はディレクトリの区切りと .. を含まないので、記号のまま範囲を検査できる
+	absPattern := s.abs(pattern)
+	if !s.contains(absPattern) {
+		return newError("fs.glob: path outside allowed directories: %s", pattern)
+	}
+	matches, globErr := filepath.Glob(absPattern)
+	if globErr != nil {
+		return newError("fs.glob: invalid pattern: %s", pattern)
+	}
+
+	paths := []string{}
+	for _, match := range matches {
+		if _, err := s.resolve("fs.glob", match); err != nil {
+			continue
+		}
+		if !filepath.IsAbs(pattern) {
+			match, _ = filepath.Rel(s.roots[0], match)
+		}
+		paths = append(paths, filepath.ToSlash(match))
+	}
+	return stringArray(paths)
+}
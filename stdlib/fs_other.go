@@ -0,0 +1,6 @@
+//go:build !unix
+
+package stdlib
+
+// openNoFollow シンボリックリンクを辿らずに開くフラグがない環境では、開いた後の検査だけで防ぐ
+const openNoFollow = 0
@@ -0,0 +1,25 @@
+package stdlib
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestWriteFileSymlink 検査の後にシンボリックリンクに置き換えられたパスには、リンク先が存在しなくても書き込まない
+func TestWriteFileSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "outside.txt")
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFile(link, "x"); !errors.Is(err, errPathChanged) {
+		t.Errorf("writeFile should fail with errPathChanged. got=%v", err)
+	}
+	if _, err := os.Lstat(target); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("%s should not be created. err=%v", target, err)
+	}
+}
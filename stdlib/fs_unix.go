@@ -0,0 +1,8 @@
+//go:build unix
+
+package stdlib
+
+import "syscall"
+
+// openNoFollow 書き込むファイルを開くとき、パスがシンボリックリンクであれば辿らずに失敗させるフラグ
+const openNoFollow = syscall.O_NOFOLLOW
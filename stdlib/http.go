@@ -0,0 +1,262 @@
+package stdlib
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Sa2Knight/maron/object"
+)
+
+// HTTPリクエストは Runtime.HTTPTransport を通して送る
+// オプションのハッシュには次のキーを指定できる
+//
+//	headers   リクエストヘッダー(名前と値の文字列のハッシュ)
+//	body      リクエストの本文(文字列)
+//	json      リクエストの本文にするJSONの値。Content-Type は application/json になる
+//	timeout   応答を待つ時間(DURATION または秒数)。省略時は30秒
+//
+// 応答は次のキーを持つハッシュで戻す。4xx, 5xx の応答もエラーにはしない
+//
+//	status    ステータスコード(整数)
+//	ok        ステータスコードが2xxか
+//	headers   応答ヘッダー(小文字の名前をキーとし、複数の値は ", " で連結する)
+//	body      応答の本文(文字列)
+func init() {
+	register("http", newModule("http", map[string]object.BuiltinFunction{
+		"get":     httpGet,
+		"post":    httpPost,
+		"request": httpRequest,
+	}, nil))
+}
+
+// defaultHTTPTimeout 応答を待つ時間の既定値
+const defaultHTTPTimeout = 30 * time.Second
+
+// maxHTTPBodySize 読み込む応答の本文の大きさの上限
+const maxHTTPBodySize = 10 << 20
+
+// httpOptions リクエストのオプション
+type httpOptions struct {
+	headers     http.Header
+	body        string
+	hasBody     bool
+	contentType string
+	timeout     time.Duration
+}
+
+// parseHTTPOptions オプションのハッシュを読む
+func parseHTTPOptions(name string, arg object.Object) (*httpOptions, *object.Error) {
+	opts := &httpOptions{headers: http.Header{}, timeout: defaultHTTPTimeout}
+	if arg == nil {
+		return opts, nil
+	}
+	hash, ok := arg.(*object.Hash)
+	if !ok {
+		return nil, newError("argument to %s must be HASH, got %s", name, arg.Type())
+	}
+
+	for _, key := range hash.Keys() {
+		value, _ := hash.Get(key.(object.Hashable))
+		switch key.Inspect() {
+		case "headers":
+			if err := setHeaders(name, opts.headers, value); err != nil {
+				return nil, err
+			}
+		case "body":
+			body, err := stringArg(name, value)
+			if err != nil {
+				return nil, err
+			}
+			opts.setBody(body, "")
+		case "json":
+			body, err := stringifyJSON(name, value, "")
+			if err != nil {
+				return nil, err
+			}
+			opts.setBody(body, "application/json")
+		case "timeout":
+			timeout, err := timeoutArg(name, value)
+			if err != nil {
+				return nil, err
+			}
+			opts.timeout = timeout
+		default:
+			return nil, newError("%s: unknown option: %s", name, key.Inspect())
+		}
+	}
+	return opts, nil
+}
+
+func (o *httpOptions) setBody(body, contentType string) {
+	o.body, o.hasBody, o.contentType = body, true, contentType
+}
+
+// setHeaders ハッシュのヘッダーを設定する
+func setHeaders(name string, headers http.Header, arg object.Object) *object.Error {
+	hash, ok := arg.(*object.Hash)
+	if !ok {
+		return newError("%s: headers must be HASH, got %s", name, arg.Type())
+	}
+	for _, key := range hash.Keys() {
+		value, _ := hash.Get(key.(object.Hashable))
+		k, keyOK := key.(*object.String)
+		v, valueOK := value.(*object.String)
+		if !keyOK || !valueOK {
+			return newError("%s: headers must map STRING to STRING, got %s: %s", name, key.Type(), value.Type())
+		}
+		headers.Set(k.Value, v.Value)
+	}
+	return nil
+}
+
+// timeoutArg 応答を待つ時間を読む。DURATION の他に秒数(整数、浮動小数点数)を受け付ける
+func timeoutArg(name string, arg object.Object) (time.Duration, *object.Error) {
+	if d, ok := arg.(*object.Duration); ok {
+		if d.Value <= 0 {
+			return 0, newError("%s: timeout must be positive: %s", name, d.Inspect())
+		}
+		return d.Value, nil
+	}
+	seconds, ok := object.ToFloat(arg)
+	if !ok {
+		return 0, newError("%s: timeout must be DURATION or a number of seconds, got %s", name, arg.Type())
+	}
+	if seconds <= 0 {
+		return 0, newError("%s: timeout must be positive: %s", name, arg.Inspect())
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// httpGet GET リクエストを送る
+//
+//	get(url[, options])
+func httpGet(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("http.get", args, 1, 2); err != nil {
+		return err
+	}
+	opts, err := parseHTTPOptions("http.get", optionalArg(args, 1))
+	if err != nil {
+		return err
+	}
+	return sendHTTP("http.get", ctx, http.MethodGet, args[0], opts)
+}
+
+// httpPost POST リクエストを送る。本文は文字列ならそのまま、それ以外はJSONにして送る
+// オプションの body, json より引数の本文を優先する
+//
+//	post(url, body[, options])
+func httpPost(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("http.post", args, 2, 3); err != nil {
+		return err
+	}
+	opts, err := parseHTTPOptions("http.post", optionalArg(args, 2))
+	if err != nil {
+		return err
+	}
+	if body, ok := args[1].(*object.String); ok {
+		opts.setBody(body.Value, "")
+	} else {
+		body, err := stringifyJSON("http.post", args[1], "")
+		if err != nil {
+			return err
+		}
+		opts.setBody(body, "application/json")
+	}
+	return sendHTTP("http.post", ctx, http.MethodPost, args[0], opts)
+}
+
+// httpRequest 任意のメソッドでリクエストを送る
+//
+//	request(method, url[, options])
+func httpRequest(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("http.request", args, 2, 3); err != nil {
+		return err
+	}
+	method, err := stringArg("http.request", args[0])
+	if err != nil {
+		return err
+	}
+	opts, err := parseHTTPOptions("http.request", optionalArg(args, 2))
+	if err != nil {
+		return err
+	}
+	return sendHTTP("http.request", ctx, strings.ToUpper(method), args[1], opts)
+}
+
+func optionalArg(args []object.Object, i int) object.Object {
+	if len(args) <= i {
+		return nil
+	}
+	return args[i]
+}
+
+// sendHTTP リクエストを送り、応答をハッシュにして戻す
+func sendHTTP(name string, ctx object.Context, method string, urlArg object.Object, opts *httpOptions) object.Object {
+	transport := ctx.Runtime().HTTPTransport
+	if transport == nil {
+		return newError("%s: network access is disabled", name)
+	}
+	rawURL, err := stringArg(name, urlArg)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if opts.hasBody {
+		body = strings.NewReader(opts.body)
+	}
+	req, reqErr := http.NewRequest(method, rawURL, body)
+	if reqErr != nil {
+		return newError("%s: invalid request: %s", name, reqErr)
+	}
+	req.Header = opts.headers
+	if opts.contentType != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", opts.contentType)
+	}
+
+	client := &http.Client{Transport: transport, Timeout: opts.timeout}
+	resp, doErr := client.Do(req)
+	if doErr != nil {
+		var urlErr *url.Error
+		if errors.As(doErr, &urlErr) && urlErr.Timeout() {
+			return newError("%s: request timed out after %s: %s", name, opts.timeout, rawURL)
+		}
+		return newError("%s: request failed: %s", name, doErr)
+	}
+	defer resp.Body.Close()
+
+	data, readErr := io.ReadAll(io.LimitReader(resp.Body, maxHTTPBodySize+1))
+	if readErr != nil {
+		return newError("%s: reading response failed: %s", name, readErr)
+	}
+	if len(data) > maxHTTPBodySize {
+		return newError("%s: response body too large", name)
+	}
+	return httpResponse(resp, string(data))
+}
+
+// httpResponse 応答をハッシュにする
+func httpResponse(resp *http.Response, body string) *object.Hash {
+	names := make([]string, 0, len(resp.Header))
+	for headerName := range resp.Header {
+		names = append(names, headerName)
+	}
+	sort.Strings(names)
+
+	headers := object.NewHash()
+	for _, headerName := range names {
+		headers.Set(&object.String{Value: strings.ToLower(headerName)}, &object.String{Value: strings.Join(resp.Header[headerName], ", ")})
+	}
+
+	result := object.NewHash()
+	result.Set(&object.String{Value: "status"}, &object.Integer{Value: int64(resp.StatusCode)})
+	result.Set(&object.String{Value: "ok"}, object.NativeBool(200 <= resp.StatusCode && resp.StatusCode < 300))
+	result.Set(&object.String{Value: "headers"}, headers)
+	result.Set(&object.String{Value: "body"}, &object.String{Value: body})
+	return result
+}
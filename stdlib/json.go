@@ -0,0 +1,486 @@
+package stdlib
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/Sa2Knight/maron/object"
+)
+
+// JSONの値とオブジェクトの対応
+//
+//	オブジェクト   ハッシュ(キーは文字列、順序はJSONに現れた順)
+//	配列           配列
+//	数値           小数部と指数部がなく int64 に収まれば整数、それ以外は浮動小数点数
+//	文字列         文字列
+//	true/false     真偽値
+//	null           null
+func init() {
+	register("json", newModule("json", map[string]object.BuiltinFunction{
+		"parse":     jsonParse,
+		"stringify": jsonStringify,
+	}, nil))
+}
+
+// jsonParse JSONの文字列を解析してオブジェクトに変換する
+// 不正な入力は、問題のある位置(先頭からのバイト数)を含むエラーにする
+func jsonParse(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("json.parse", args, 1, 1); err != nil {
+		return err
+	}
+	text, err := stringArg("json.parse", args[0])
+	if err != nil {
+		return err
+	}
+
+	p := &jsonParser{input: text}
+	p.skipSpace()
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return p.unexpected()
+	}
+	return value
+}
+
+// jsonParser JSONの構文解析器
+type jsonParser struct {
+	input string
+	pos   int // 次に読む位置(バイト単位)
+}
+
+func (p *jsonParser) errorAt(pos int, format string, a ...interface{}) *object.Error {
+	return newError("json.parse: %s at offset %d", fmt.Sprintf(format, a...), pos)
+}
+
+// unexpected 現在位置の文字が想定外であるエラーを生成する
+func (p *jsonParser) unexpected() *object.Error {
+	if p.pos >= len(p.input) {
+		return p.errorAt(p.pos, "unexpected end of input")
+	}
+	r, _ := utf8.DecodeRuneInString(p.input[p.pos:])
+	return p.errorAt(p.pos, "unexpected character %q", r)
+}
+
+func (p *jsonParser) skipSpace() {
+	for p.pos < len(p.input) {
+		switch p.input[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// expect 現在位置の文字が c であれば読み進める
+func (p *jsonParser) expect(c byte) *object.Error {
+	if p.pos >= len(p.input) || p.input[p.pos] != c {
+		return p.unexpected()
+	}
+	p.pos++
+	return nil
+}
+
+func (p *jsonParser) parseValue() (object.Object, *object.Error) {
+	if p.pos >= len(p.input) {
+		return nil, p.unexpected()
+	}
+	switch c := p.input[p.pos]; {
+	case c == '{':
+		return p.parseObject()
+	case c == '[':
+		return p.parseArray()
+	case c == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return &object.String{Value: s}, nil
+	case c == '-' || ('0' <= c && c <= '9'):
+		return p.parseNumber()
+	}
+
+	for literal, value := range map[string]object.Object{"true": object.TrueObject, "false": object.FalseObject, "null": object.NullObject} {
+		if strings.HasPrefix(p.input[p.pos:], literal) {
+			p.pos += len(literal)
+			return value, nil
+		}
+	}
+	return nil, p.unexpected()
+}
+
+func (p *jsonParser) parseObject() (object.Object, *object.Error) {
+	hash := object.NewHash()
+	p.pos++ // {
+	p.skipSpace()
+	if p.pos < len(p.input) && p.input[p.pos] == '}' {
+		p.pos++
+		return hash, nil
+	}
+
+	for {
+		if p.pos >= len(p.input) || p.input[p.pos] != '"' {
+			return nil, p.unexpected()
+		}
+		key, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if err := p.expect(':'); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		// 同じキーが複数ある場合は、最後の値を使う
+		hash.Set(&object.String{Value: key}, value)
+
+		p.skipSpace()
+		if p.pos < len(p.input) && p.input[p.pos] == '}' {
+			p.pos++
+			return hash, nil
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+	}
+}
+
+func (p *jsonParser) parseArray() (object.Object, *object.Error) {
+	elements := []object.Object{}
+	p.pos++ // [
+	p.skipSpace()
+	if p.pos < len(p.input) && p.input[p.pos] == ']' {
+		p.pos++
+		return &object.Array{Elements: elements}, nil
+	}
+
+	for {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, value)
+
+		p.skipSpace()
+		if p.pos < len(p.input) && p.input[p.pos] == ']' {
+			p.pos++
+			return &object.Array{Elements: elements}, nil
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+	}
+}
+
+// parseString 二重引用符で囲まれた文字列を読み、エスケープを展開した値を戻す
+func (p *jsonParser) parseString() (string, *object.Error) {
+	p.pos++ // "
+	var out strings.Builder
+	for {
+		if p.pos >= len(p.input) {
+			return "", p.unexpected()
+		}
+		c := p.input[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return out.String(), nil
+		case c < 0x20:
+			return "", p.errorAt(p.pos, "control character %q in string", c)
+		case c == '\\':
+			if err := p.parseEscape(&out); err != nil {
+				return "", err
+			}
+		default:
+			r, size := utf8.DecodeRuneInString(p.input[p.pos:])
+			if r == utf8.RuneError && size == 1 {
+				return "", p.errorAt(p.pos, "invalid UTF-8")
+			}
+			out.WriteString(p.input[p.pos : p.pos+size])
+			p.pos += size
+		}
+	}
+}
+
+var jsonEscapes = map[byte]byte{'"': '"', '\\': '\\', '/': '/', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t'}
+
+// parseEscape \ で始まるエスケープを展開する
+// サロゲートペア(😀 など)は1文字にまとめる
+func (p *jsonParser) parseEscape(out *strings.Builder) *object.Error {
+	start := p.pos
+	if p.pos+1 >= len(p.input) {
+		p.pos++
+		return p.unexpected()
+	}
+	c := p.input[p.pos+1]
+	if unescaped, ok := jsonEscapes[c]; ok {
+		out.WriteByte(unescaped)
+		p.pos += 2
+		return nil
+	}
+	if c != 'u' {
+		return p.errorAt(start, "invalid escape %q", p.input[start:start+2])
+	}
+
+	r, ok := p.readHex4(start + 2)
+	if !ok {
+		return p.errorAt(start, "invalid unicode escape")
+	}
+	p.pos = start + 6
+	if utf16.IsSurrogate(r) {
+		if strings.HasPrefix(p.input[p.pos:], `\u`) {
+			if low, ok := p.readHex4(p.pos + 2); ok {
+				if combined := utf16.DecodeRune(r, low); combined != utf8.RuneError {
+					out.WriteRune(combined)
+					p.pos += 6
+					return nil
+				}
+			}
+		}
+		// 対になっていないサロゲートは置換文字にする
+		r = utf8.RuneError
+	}
+	out.WriteRune(r)
+	return nil
+}
+
+// readHex4 pos から始まる16進数4桁を読む
+func (p *jsonParser) readHex4(pos int) (rune, bool) {
+	if pos+4 > len(p.input) {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(p.input[pos:pos+4], 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	return rune(n), true
+}
+
+// parseNumber JSONの数値の文法 -?(0|[1-9][0-9]*)(.[0-9]+)?([eE][+-]?[0-9]+)? に従って数値を読む
+func (p *jsonParser) parseNumber() (object.Object, *object.Error) {
+	start := p.pos
+	isFloat := false
+	if p.input[p.pos] == '-' {
+		p.pos++
+	}
+	switch {
+	case p.pos < len(p.input) && p.input[p.pos] == '0':
+		p.pos++
+	case !p.skipDigits():
+		return nil, p.unexpected()
+	}
+	if p.pos < len(p.input) && p.input[p.pos] == '.' {
+		isFloat = true
+		p.pos++
+		if !p.skipDigits() {
+			return nil, p.unexpected()
+		}
+	}
+	if p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+		isFloat = true
+		p.pos++
+		if p.pos < len(p.input) && (p.input[p.pos] == '+' || p.input[p.pos] == '-') {
+			p.pos++
+		}
+		if !p.skipDigits() {
+			return nil, p.unexpected()
+		}
+	}
+
+	literal := p.input[start:p.pos]
+	if !isFloat {
+		if i, err := strconv.ParseInt(literal, 10, 64); err == nil {
+			return &object.Integer{Value: i}, nil
+		}
+	}
+	f, err := strconv.ParseFloat(literal, 64)
+	if err != nil {
+		return nil, p.errorAt(start, "number out of range %s", literal)
+	}
+	return &object.Float{Value: f}, nil
+}
+
+// skipDigits 数字を読み飛ばす。1文字も読まなかった場合は false
+func (p *jsonParser) skipDigits() bool {
+	start := p.pos
+	for p.pos < len(p.input) && '0' <= p.input[p.pos] && p.input[p.pos] <= '9' {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+// jsonStringify オブジェクトをJSONの文字列に変換する
+// 字下げ(空白の数、または字下げに使う文字列)を指定すると、要素ごとに改行して整形する
+// ハッシュのキーは文字列と整数(10進数の文字列にする)に限る
+func jsonStringify(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("json.stringify", args, 1, 2); err != nil {
+		return err
+	}
+	indent := ""
+	if len(args) == 2 {
+		switch arg := args[1].(type) {
+		case *object.Integer:
+			if arg.Value < 0 || arg.Value > 10 {
+				return newError("json.stringify: indent out of range: %d", arg.Value)
+			}
+			indent = strings.Repeat(" ", int(arg.Value))
+		case *object.String:
+			indent = arg.Value
+		default:
+			return newError("argument to json.stringify must be INTEGER or STRING, got %s", arg.Type())
+		}
+	}
+
+	text, err := stringifyJSON("json.stringify", args[0], indent)
+	if err != nil {
+		return err
+	}
+	return &object.String{Value: text}
+}
+
+// stringifyJSON オブジェクトをJSONに変換する。name はエラーメッセージ用の関数名
+func stringifyJSON(name string, obj object.Object, indent string) (string, *object.Error) {
+	e := &jsonEncoder{name: name, indent: indent, visiting: map[object.Object]bool{}}
+	if err := e.encode(obj, 0); err != nil {
+		return "", err
+	}
+	return e.out.String(), nil
+}
+
+// jsonEncoder オブジェクトをJSONに変換する
+type jsonEncoder struct {
+	name     string // エラーメッセージ用の関数名
+	out      strings.Builder
+	indent   string
+	visiting map[object.Object]bool // 変換中の配列とハッシュ(循環の検出用)
+}
+
+func (e *jsonEncoder) encode(obj object.Object, depth int) *object.Error {
+	switch obj := obj.(type) {
+	case *object.Null:
+		e.out.WriteString("null")
+	case *object.Boolean:
+		e.out.WriteString(strconv.FormatBool(obj.Value))
+	case *object.Integer:
+		e.out.WriteString(strconv.FormatInt(obj.Value, 10))
+	case *object.Float:
+		if math.IsInf(obj.Value, 0) || math.IsNaN(obj.Value) {
+			return newError("%s: unsupported value: %s", e.name, obj.Inspect())
+		}
+		e.out.WriteString(obj.Inspect())
+	case *object.String:
+		e.writeString(obj.Value)
+	case *object.Array:
+		if e.visiting[obj] {
+			return newError("%s: cyclic structure", e.name)
+		}
+		e.visiting[obj] = true
+		defer delete(e.visiting, obj)
+
+		e.out.WriteByte('[')
+		for i, el := range obj.Elements {
+			e.separator(i, depth+1)
+			if err := e.encode(el, depth+1); err != nil {
+				return err
+			}
+		}
+		e.closing(len(obj.Elements), depth)
+		e.out.WriteByte(']')
+	case *object.Hash:
+		if e.visiting[obj] {
+			return newError("%s: cyclic structure", e.name)
+		}
+		e.visiting[obj] = true
+		defer delete(e.visiting, obj)
+
+		e.out.WriteByte('{')
+		for i, key := range obj.Keys() {
+			e.separator(i, depth+1)
+			switch key := key.(type) {
+			case *object.String:
+				e.writeString(key.Value)
+			case *object.Integer:
+				e.writeString(strconv.FormatInt(key.Value, 10))
+			default:
+				return newError("%s: unsupported hash key: %s", e.name, key.Type())
+			}
+			e.out.WriteByte(':')
+			if e.indent != "" {
+				e.out.WriteByte(' ')
+			}
+			value, _ := obj.Get(key.(object.Hashable))
+			if err := e.encode(value, depth+1); err != nil {
+				return err
+			}
+		}
+		e.closing(len(obj.Pairs), depth)
+		e.out.WriteByte('}')
+	default:
+		return newError("%s: unsupported value: %s", e.name, obj.Type())
+	}
+	return nil
+}
+
+// separator i 番目の要素の前に、区切りと(整形する場合は)改行と字下げを書く
+func (e *jsonEncoder) separator(i, depth int) {
+	if i > 0 {
+		e.out.WriteByte(',')
+	}
+	e.newline(depth)
+}
+
+// closing 要素があれば、閉じ括弧の前に改行と字下げを書く
+func (e *jsonEncoder) closing(length, depth int) {
+	if length > 0 {
+		e.newline(depth)
+	}
+}
+
+func (e *jsonEncoder) newline(depth int) {
+	if e.indent == "" {
+		return
+	}
+	e.out.WriteByte('\n')
+	e.out.WriteString(strings.Repeat(e.indent, depth))
+}
+
+// writeString 文字列を二重引用符で囲み、必要な文字をエスケープして書く
+// UTF-8として不正なバイトは置換文字にする
+func (e *jsonEncoder) writeString(s string) {
+	e.out.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		switch {
+		case r == '"' || r == '\\':
+			e.out.WriteByte('\\')
+			e.out.WriteRune(r)
+		case r == '\n':
+			e.out.WriteString(`\n`)
+		case r == '\r':
+			e.out.WriteString(`\r`)
+		case r == '\t':
+			e.out.WriteString(`\t`)
+		case r < 0x20:
+			fmt.Fprintf(&e.out, `\u%04x`, r)
+		default:
+			// 不正なバイトは RuneError として読まれるので、置換文字になる
+			e.out.WriteRune(r)
+		}
+	}
+	e.out.WriteByte('"')
+}
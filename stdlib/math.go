@@ -0,0 +1,350 @@
+package stdlib
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/Sa2Knight/maron/object"
+)
+
+func init() {
+	register("math", newModule("math", map[string]object.BuiltinFunction{
+		"abs":    mathAbs,
+		"min":    mathMinMax("math.min", func(a, b float64) bool { return a < b }),
+		"max":    mathMinMax("math.max", func(a, b float64) bool { return a > b }),
+		"pow":    mathPow,
+		"sqrt":   floatFunction("math.sqrt", func(x float64) bool { return x >= 0 }, math.Sqrt),
+		"floor":  roundFunction("math.floor", math.Floor),
+		"ceil":   roundFunction("math.ceil", math.Ceil),
+		"round":  roundFunction("math.round", math.Round),
+		"sin":    floatFunction("math.sin", nil, math.Sin),
+		"cos":    floatFunction("math.cos", nil, math.Cos),
+		"tan":    floatFunction("math.tan", nil, math.Tan),
+		"asin":   floatFunction("math.asin", func(x float64) bool { return -1 <= x && x <= 1 }, math.Asin),
+		"acos":   floatFunction("math.acos", func(x float64) bool { return -1 <= x && x <= 1 }, math.Acos),
+		"atan":   floatFunction("math.atan", nil, math.Atan),
+		"atan2":  mathAtan2,
+		"exp":    floatFunction("math.exp", nil, math.Exp),
+		"log":    mathLog,
+		"log2":   floatFunction("math.log2", func(x float64) bool { return x > 0 }, math.Log2),
+		"log10":  floatFunction("math.log10", func(x float64) bool { return x > 0 }, math.Log10),
+		"gcd":    mathGcd,
+		"lcm":    mathLcm,
+		"random": mathRandom,
+		"seed":   mathSeed,
+	}, map[string]object.Object{
+		"pi": &object.Float{Value: math.Pi},
+		"e":  &object.Float{Value: math.E},
+	}))
+}
+
+// floatResult 浮動小数点数の計算結果を戻す
+// 無限大や NaN になった場合はエラーにする
+func floatResult(name string, value float64) object.Object {
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return newError("%s: result out of range", name)
+	}
+	return &object.Float{Value: value}
+}
+
+// floatFunction 数値をひとつ受け取り、浮動小数点数を戻す関数を生成する
+// domain が false を戻す引数はエラーにする(nilなら全ての数値を受け付ける)
+func floatFunction(name string, domain func(float64) bool, fn func(float64) float64) object.BuiltinFunction {
+	return func(ctx object.Context, args ...object.Object) object.Object {
+		if err := checkArgs(name, args, 1, 1); err != nil {
+			return err
+		}
+		x, err := numberArg(name, args[0])
+		if err != nil {
+			return err
+		}
+		if domain != nil && !domain(x) {
+			return newError("%s: argument out of domain: %s", name, args[0].Inspect())
+		}
+		return floatResult(name, fn(x))
+	}
+}
+
+// roundFunction 数値を整数に丸める関数を生成する。整数はそのまま戻す
+func roundFunction(name string, fn func(float64) float64) object.BuiltinFunction {
+	return func(ctx object.Context, args ...object.Object) object.Object {
+		if err := checkArgs(name, args, 1, 1); err != nil {
+			return err
+		}
+		if i, ok := args[0].(*object.Integer); ok {
+			return i
+		}
+		x, err := numberArg(name, args[0])
+		if err != nil {
+			return err
+		}
+		rounded := fn(x)
+		if rounded < math.MinInt64 || rounded >= math.MaxInt64 {
+			return newError("%s: integer overflow", name)
+		}
+		return &object.Integer{Value: int64(rounded)}
+	}
+}
+
+// mathMinMax 最小値、最大値を戻す関数を生成する
+// less(a, b) は a を b より優先する場合に真を戻す。結果は引数を元の種別のまま戻す
+func mathMinMax(name string, less func(a, b float64) bool) object.BuiltinFunction {
+	return func(ctx object.Context, args ...object.Object) object.Object {
+		if err := checkArgs(name, args, 1, -1); err != nil {
+			return err
+		}
+		result := args[0]
+		best, err := numberArg(name, result)
+		if err != nil {
+			return err
+		}
+		for _, arg := range args[1:] {
+			x, err := numberArg(name, arg)
+			if err != nil {
+				return err
+			}
+			if less(x, best) {
+				result, best = arg, x
+			}
+		}
+		return result
+	}
+}
+
+func mathAbs(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("math.abs", args, 1, 1); err != nil {
+		return err
+	}
+	switch arg := args[0].(type) {
+	case *object.Integer:
+		if arg.Value == math.MinInt64 {
+			return newError("math.abs: integer overflow")
+		}
+		if arg.Value < 0 {
+			return &object.Integer{Value: -arg.Value}
+		}
+		return arg
+	case *object.Float:
+		return &object.Float{Value: math.Abs(arg.Value)}
+	}
+	return newError("argument to math.abs must be INTEGER or FLOAT, got %s", args[0].Type())
+}
+
+// mathPow 累乗を戻す
+// 整数の0以上の整数乗は整数で、それ以外は浮動小数点数で計算する
+func mathPow(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("math.pow", args, 2, 2); err != nil {
+		return err
+	}
+	base, baseIsInt := args[0].(*object.Integer)
+	exp, expIsInt := args[1].(*object.Integer)
+	if baseIsInt && expIsInt && exp.Value >= 0 {
+		result, ok := powInt(base.Value, exp.Value)
+		if !ok {
+			return newError("math.pow: integer overflow")
+		}
+		return &object.Integer{Value: result}
+	}
+
+	x, err := numberArg("math.pow", args[0])
+	if err != nil {
+		return err
+	}
+	y, err := numberArg("math.pow", args[1])
+	if err != nil {
+		return err
+	}
+	if x < 0 && y != math.Trunc(y) {
+		return newError("math.pow: argument out of domain: %s", args[0].Inspect())
+	}
+	return floatResult("math.pow", math.Pow(x, y))
+}
+
+// powInt 整数の累乗を計算する。オーバーフローした場合は ok が false
+func powInt(base, exp int64) (result int64, ok bool) {
+	switch {
+	case exp == 0 || base == 1:
+		return 1, true
+	case base == 0:
+		return 0, true
+	case base == -1 && exp%2 == 0:
+		return 1, true
+	case base == -1:
+		return -1, true
+	}
+
+	// 底の絶対値が2以上なので、64回未満でオーバーフローする
+	result = 1
+	for ; exp > 0; exp-- {
+		next := result * base
+		if next/base != result {
+			return 0, false
+		}
+		result = next
+	}
+	return result, true
+}
+
+func mathAtan2(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("math.atan2", args, 2, 2); err != nil {
+		return err
+	}
+	y, err := numberArg("math.atan2", args[0])
+	if err != nil {
+		return err
+	}
+	x, err := numberArg("math.atan2", args[1])
+	if err != nil {
+		return err
+	}
+	return floatResult("math.atan2", math.Atan2(y, x))
+}
+
+// mathLog 自然対数を戻す。底を指定した場合はその底の対数を戻す
+func mathLog(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("math.log", args, 1, 2); err != nil {
+		return err
+	}
+	x, err := numberArg("math.log", args[0])
+	if err != nil {
+		return err
+	}
+	if x <= 0 {
+		return newError("math.log: argument out of domain: %s", args[0].Inspect())
+	}
+	if len(args) == 1 {
+		return floatResult("math.log", math.Log(x))
+	}
+
+	base, err := numberArg("math.log", args[1])
+	if err != nil {
+		return err
+	}
+	if base <= 0 || base == 1 {
+		return newError("math.log: base out of domain: %s", args[1].Inspect())
+	}
+	return floatResult("math.log", math.Log(x)/math.Log(base))
+}
+
+// mathGcd 最大公約数を戻す(常に0以上)
+func mathGcd(ctx object.Context, args ...object.Object) object.Object {
+	a, b, err := integerPair("math.gcd", args)
+	if err != nil {
+		return err
+	}
+	g, ok := gcd(a, b)
+	if !ok {
+		return newError("math.gcd: integer overflow")
+	}
+	return &object.Integer{Value: g}
+}
+
+// mathLcm 最小公倍数を戻す(常に0以上)
+func mathLcm(ctx object.Context, args ...object.Object) object.Object {
+	a, b, err := integerPair("math.lcm", args)
+	if err != nil {
+		return err
+	}
+	if a == 0 || b == 0 {
+		return &object.Integer{Value: 0}
+	}
+	g, ok := gcd(a, b)
+	if !ok {
+		return newError("math.lcm: integer overflow")
+	}
+	result := a / g * b
+	if result/b != a/g || result == math.MinInt64 {
+		return newError("math.lcm: integer overflow")
+	}
+	if result < 0 {
+		result = -result
+	}
+	return &object.Integer{Value: result}
+}
+
+func integerPair(name string, args []object.Object) (int64, int64, *object.Error) {
+	if err := checkArgs(name, args, 2, 2); err != nil {
+		return 0, 0, err
+	}
+	a, err := integerArg(name, args[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := integerArg(name, args[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return a, b, nil
+}
+
+// gcd ユークリッドの互除法で最大公約数を求める
+// 結果が int64 に収まらない場合(最小値同士など)は ok が false
+func gcd(a, b int64) (int64, bool) {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	if a == math.MinInt64 {
+		return 0, false
+	}
+	if a < 0 {
+		a = -a
+	}
+	return a, true
+}
+
+// mathRandom 乱数を戻す
+//
+//	random()     0以上1未満の浮動小数点数
+//	random(n)    0以上n未満の整数
+//	random(a, b) a以上b以下の整数
+func mathRandom(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("math.random", args, 0, 2); err != nil {
+		return err
+	}
+	r := ctx.Runtime().Rand
+
+	switch len(args) {
+	case 0:
+		return &object.Float{Value: r.Float64()}
+	case 1:
+		n, err := integerArg("math.random", args[0])
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			return newError("math.random: upper bound must be positive: %d", n)
+		}
+		return &object.Integer{Value: r.Int63n(n)}
+	}
+
+	low, high, err := integerPair("math.random", args)
+	if err != nil {
+		return err
+	}
+	if low > high {
+		return newError("math.random: empty range %d to %d", low, high)
+	}
+	// 範囲の大きさは int64 に収まらないことがあるので、符号なしで計算する(0 は全ての整数)
+	span := uint64(high-low) + 1
+	switch {
+	case span == 0:
+		return &object.Integer{Value: int64(r.Uint64())}
+	case span <= math.MaxInt64:
+		return &object.Integer{Value: low + r.Int63n(int64(span))}
+	default:
+		return &object.Integer{Value: low + int64(r.Uint64()%span)}
+	}
+}
+
+// mathSeed 乱数生成器を初期化する。同じ値で初期化すると同じ乱数列を生成する
+func mathSeed(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("math.seed", args, 1, 1); err != nil {
+		return err
+	}
+	seed, err := integerArg("math.seed", args[0])
+	if err != nil {
+		return err
+	}
+	ctx.Runtime().Rand = rand.New(rand.NewSource(seed))
+	return object.NullObject
+}
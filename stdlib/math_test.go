@@ -0,0 +1,57 @@
+package stdlib
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPowInt(t *testing.T) {
+	tests := []struct {
+		base, exp int64
+		expected  int64
+		ok        bool
+	}{
+		{2, 0, 1, true},
+		{0, 0, 1, true},
+		{0, 5, 0, true},
+		{1, math.MaxInt64, 1, true},
+		{-1, math.MaxInt64, -1, true},
+		{-1, 1 << 40, 1, true},
+		{3, 4, 81, true},
+		{-2, 63, math.MinInt64, true},
+		{2, 62, 1 << 62, true},
+		{2, 63, 0, false},
+		{10, 19, 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := powInt(tt.base, tt.exp)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("powInt(%d, %d) wrong. want=(%d, %t), got=(%d, %t)", tt.base, tt.exp, tt.expected, tt.ok, got, ok)
+		}
+	}
+}
+
+func TestGcd(t *testing.T) {
+	tests := []struct {
+		a, b     int64
+		expected int64
+		ok       bool
+	}{
+		{12, 18, 6, true},
+		{-12, 18, 6, true},
+		{12, -18, 6, true},
+		{0, 0, 0, true},
+		{0, -7, 7, true},
+		{math.MinInt64, 6, 2, true},
+		{math.MinInt64, 0, 0, false},
+		{math.MinInt64, math.MinInt64, 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := gcd(tt.a, tt.b)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("gcd(%d, %d) wrong. want=(%d, %t), got=(%d, %t)", tt.a, tt.b, tt.expected, tt.ok, got, ok)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package stdlib
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/Sa2Knight/maron/object"
+)
+
+// プロセスの環境は Runtime.OS を通して参照する
+// os.setenv は Runtime.OS.Env だけを変更し、実行中のプロセスの環境変数は変更しない
+func init() {
+	register("os", newModule("os", map[string]object.BuiltinFunction{
+		"args":       osArgs,
+		"getenv":     osGetenv,
+		"setenv":     osSetenv,
+		"environ":    osEnviron,
+		"read_line":  osReadLine,
+		"read_lines": osReadLines,
+		"exit":       osExit,
+		"exec":       osExec,
+	}, nil))
+}
+
+// osAccess Runtime の OSAccess を戻す。許可されていなければエラー
+func osAccess(name string, ctx object.Context) (*object.OSAccess, *object.Error) {
+	access := ctx.Runtime().OS
+	if access == nil {
+		return nil, newError("%s: os access is disabled", name)
+	}
+	return access, nil
+}
+
+// osArgs スクリプトに渡された引数の配列を戻す
+func osArgs(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("os.args", args, 0, 0); err != nil {
+		return err
+	}
+	access, err := osAccess("os.args", ctx)
+	if err != nil {
+		return err
+	}
+	return stringArray(access.Args)
+}
+
+// osGetenv 環境変数の値を戻す。設定されていなければ既定値(省略時は null)を戻す
+func osGetenv(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("os.getenv", args, 1, 2); err != nil {
+		return err
+	}
+	access, err := osAccess("os.getenv", ctx)
+	if err != nil {
+		return err
+	}
+	key, err := stringArg("os.getenv", args[0])
+	if err != nil {
+		return err
+	}
+	if value, ok := access.Env[key]; ok {
+		return &object.String{Value: value}
+	}
+	if len(args) == 2 {
+		return args[1]
+	}
+	return object.NullObject
+}
+
+// osSetenv 環境変数を設定する。値が null であれば取り除く
+func osSetenv(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("os.setenv", args, 2, 2); err != nil {
+		return err
+	}
+	access, err := osAccess("os.setenv", ctx)
+	if err != nil {
+		return err
+	}
+	key, err := stringArg("os.setenv", args[0])
+	if err != nil {
+		return err
+	}
+	if key == "" || strings.ContainsAny(key, "=\x00") {
+		return newError("os.setenv: invalid name: %q", key)
+	}
+	if args[1] == object.NullObject {
+		delete(access.Env, key)
+		return object.NullObject
+	}
+	value, err := stringArg("os.setenv", args[1])
+	if err != nil {
+		return err
+	}
+	if access.Env == nil {
+		access.Env = map[string]string{}
+	}
+	access.Env[key] = value
+	return object.NullObject
+}
+
+// osEnviron 全ての環境変数を、名前の順に並べたハッシュで戻す
+func osEnviron(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("os.environ", args, 0, 0); err != nil {
+		return err
+	}
+	access, err := osAccess("os.environ", ctx)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(access.Env))
+	for k := range access.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	env := object.NewHash()
+	for _, k := range keys {
+		env.Set(&object.String{Value: k}, &object.String{Value: access.Env[k]})
+	}
+	return env
+}
+
+// osReadLine 標準入力から1行読む(末尾の改行は含まない)。入力の終わりに達していれば null
+func osReadLine(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("os.read_line", args, 0, 0); err != nil {
+		return err
+	}
+	access, err := osAccess("os.read_line", ctx)
+	if err != nil {
+		return err
+	}
+	line, ok, readErr := access.ReadLine()
+	if readErr != nil {
+		return newError("os.read_line: %s", readErr)
+	}
+	if !ok {
+		return object.NullObject
+	}
+	return &object.String{Value: line}
+}
+
+// osReadLines 標準入力の残りを全て読み、行の配列で戻す
+func osReadLines(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("os.read_lines", args, 0, 0); err != nil {
+		return err
+	}
+	access, err := osAccess("os.read_lines", ctx)
+	if err != nil {
+		return err
+	}
+	lines := []string{}
+	for {
+		line, ok, readErr := access.ReadLine()
+		if readErr != nil {
+			return newError("os.read_lines: %s", readErr)
+		}
+		if !ok {
+			return stringArray(lines)
+		}
+		lines = append(lines, line)
+	}
+}
+
+// osExit 終了コード(省略時は0)を指定してプロセスを終了する
+func osExit(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("os.exit", args, 0, 1); err != nil {
+		return err
+	}
+	access, err := osAccess("os.exit", ctx)
+	if err != nil {
+		return err
+	}
+	if access.Exit == nil {
+		return newError("os.exit: exit is not available")
+	}
+	code := int64(0)
+	if len(args) == 1 {
+		if code, err = integerArg("os.exit", args[0]); err != nil {
+			return err
+		}
+		if code < 0 || code > 255 {
+			return newError("os.exit: exit code out of range: %d", code)
+		}
+	}
+	access.Exit(int(code))
+	return object.NullObject
+}
+
+// osExec コマンドを実行し、終了を待って結果をハッシュで戻す
+// コマンドはシェルを介さずに実行する。0以外の終了コードもエラーにはしない
+//
+//	exec(command[, args[, options]])
+//
+// オプションのハッシュには次のキーを指定できる
+//
+//	stdin   コマンドの標準入力に渡す文字列
+//	dir     コマンドを実行するディレクトリ
+//
+// 結果のハッシュのキーは status (終了コード)、stdout、stderr
+func osExec(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("os.exec", args, 1, 3); err != nil {
+		return err
+	}
+	access, err := osAccess("os.exec", ctx)
+	if err != nil {
+		return err
+	}
+	if !access.AllowExec {
+		return newError("os.exec: subprocess execution is disabled")
+	}
+	command, err := stringArg("os.exec", args[0])
+	if err != nil {
+		return err
+	}
+
+	cmdArgs := []string{}
+	if len(args) >= 2 {
+		elements, err := arrayArg("os.exec", args[1])
+		if err != nil {
+			return err
+		}
+		for i, el := range elements {
+			s, ok := el.(*object.String)
+			if !ok {
+				return newError("os.exec: argument %d must be STRING, got %s", i, el.Type())
+			}
+			cmdArgs = append(cmdArgs, s.Value)
+		}
+	}
+
+	cmd := exec.Command(command, cmdArgs...)
+	cmd.Env = []string{}
+	for k, v := range access.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	sort.Strings(cmd.Env)
+	if len(args) == 3 {
+		if err := setExecOptions(cmd, args[2]); err != nil {
+			return err
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	runErr := cmd.Run()
+	var exitErr *exec.ExitError
+	if runErr != nil && !errors.As(runErr, &exitErr) {
+		return newError("os.exec: %s", runErr)
+	}
+
+	result := object.NewHash()
+	result.Set(&object.String{Value: "status"}, &object.Integer{Value: int64(cmd.ProcessState.ExitCode())})
+	result.Set(&object.String{Value: "stdout"}, &object.String{Value: stdout.String()})
+	result.Set(&object.String{Value: "stderr"}, &object.String{Value: stderr.String()})
+	return result
+}
+
+// setExecOptions オプションのハッシュをコマンドに設定する
+func setExecOptions(cmd *exec.Cmd, arg object.Object) *object.Error {
+	hash, ok := arg.(*object.Hash)
+	if !ok {
+		return newError("argument to os.exec must be HASH, got %s", arg.Type())
+	}
+	for _, key := range hash.Keys() {
+		value, _ := hash.Get(key.(object.Hashable))
+		switch key.Inspect() {
+		case "stdin":
+			stdin, err := stringArg("os.exec", value)
+			if err != nil {
+				return err
+			}
+			cmd.Stdin = strings.NewReader(stdin)
+		case "dir":
+			dir, err := stringArg("os.exec", value)
+			if err != nil {
+				return err
+			}
+			cmd.Dir = dir
+		default:
+			return newError("os.exec: unknown option: %s", key.Inspect())
+		}
+	}
+	return nil
+}
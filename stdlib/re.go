@@ -0,0 +1,208 @@
+package stdlib
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/Sa2Knight/maron/object"
+)
+
+// 正規表現の文法は Go の regexp パッケージ (RE2) に従う
+// パターンを受け取る関数には、re.compile で生成した正規表現の他に文字列も渡せる(呼び出しの度にコンパイルする)
+func init() {
+	register("re", newModule("re", map[string]object.BuiltinFunction{
+		"compile":  reCompile,
+		"match":    reMatch,
+		"find":     reFind,
+		"find_all": reFindAll,
+		"captures": reCaptures,
+		"replace":  reReplace,
+		"split":    reSplit,
+		"escape":   stringFunction("re.escape", regexp.QuoteMeta),
+	}, nil))
+}
+
+// compileRegex パターンの文字列をコンパイルする
+func compileRegex(name, pattern string) (*regexp.Regexp, *object.Error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, newError("%s: invalid pattern: %s", name, err)
+	}
+	return re, nil
+}
+
+// regexArg 正規表現、またはパターンの文字列の引数を取り出す
+func regexArg(name string, arg object.Object) (*regexp.Regexp, *object.Error) {
+	switch arg := arg.(type) {
+	case *object.Regex:
+		return arg.Regexp, nil
+	case *object.String:
+		return compileRegex(name, arg.Value)
+	}
+	return nil, newError("argument to %s must be REGEX or STRING, got %s", name, arg.Type())
+}
+
+// regexAndString 正規表現と対象の文字列を引数の先頭から取り出す
+func regexAndString(name string, args []object.Object, min, max int) (*regexp.Regexp, string, *object.Error) {
+	if err := checkArgs(name, args, min, max); err != nil {
+		return nil, "", err
+	}
+	re, err := regexArg(name, args[0])
+	if err != nil {
+		return nil, "", err
+	}
+	s, err := stringArg(name, args[1])
+	if err != nil {
+		return nil, "", err
+	}
+	return re, s, nil
+}
+
+// countArg 省略可能な回数の引数を取り出す。省略した場合は -1 (制限なし)
+func countArg(name string, args []object.Object, i int) (int, *object.Error) {
+	if len(args) <= i {
+		return -1, nil
+	}
+	n, err := integerArg(name, args[i])
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+func reCompile(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("re.compile", args, 1, 1); err != nil {
+		return err
+	}
+	pattern, err := stringArg("re.compile", args[0])
+	if err != nil {
+		return err
+	}
+	re, err := compileRegex("re.compile", pattern)
+	if err != nil {
+		return err
+	}
+	return &object.Regex{Regexp: re}
+}
+
+// reMatch 文字列のどこかが正規表現に一致するか
+// 文字列全体の一致を調べるには、パターンを ^ と $ で囲む
+func reMatch(ctx object.Context, args ...object.Object) object.Object {
+	re, s, err := regexAndString("re.match", args, 2, 2)
+	if err != nil {
+		return err
+	}
+	return object.NativeBool(re.MatchString(s))
+}
+
+// reFind 最初に一致した部分を戻す。一致しなければ null
+func reFind(ctx object.Context, args ...object.Object) object.Object {
+	re, s, err := regexAndString("re.find", args, 2, 2)
+	if err != nil {
+		return err
+	}
+	loc := re.FindStringIndex(s)
+	if loc == nil {
+		return object.NullObject
+	}
+	return &object.String{Value: s[loc[0]:loc[1]]}
+}
+
+// reFindAll 一致した部分を全て(回数を指定した場合は先頭からその回数まで)戻す
+func reFindAll(ctx object.Context, args ...object.Object) object.Object {
+	re, s, err := regexAndString("re.find_all", args, 2, 3)
+	if err != nil {
+		return err
+	}
+	n, err := countArg("re.find_all", args, 2)
+	if err != nil {
+		return err
+	}
+	return stringArray(re.FindAllString(s, n))
+}
+
+// reCaptures 最初に一致した部分のグループを戻す。一致しなければ null
+//
+//	名前付きグループ (?P<name>...) がない場合   [一致した全体, グループ1, グループ2, ...] の配列
+//	名前付きグループがある場合                 名前をキーとするハッシュ(名前のないグループは含まない)
+//
+// 一致に加わらなかったグループは null になる
+func reCaptures(ctx object.Context, args ...object.Object) object.Object {
+	re, s, err := regexAndString("re.captures", args, 2, 2)
+	if err != nil {
+		return err
+	}
+	loc := re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return object.NullObject
+	}
+
+	groups := make([]object.Object, len(loc)/2)
+	for i := range groups {
+		if loc[2*i] < 0 {
+			groups[i] = object.NullObject
+		} else {
+			groups[i] = &object.String{Value: s[loc[2*i]:loc[2*i+1]]}
+		}
+	}
+
+	hasNames := false
+	captures := object.NewHash()
+	for i, groupName := range re.SubexpNames() {
+		if groupName != "" {
+			hasNames = true
+			captures.Set(&object.String{Value: groupName}, groups[i])
+		}
+	}
+	if hasNames {
+		return captures
+	}
+	return &object.Array{Elements: groups}
+}
+
+// reReplace 一致した部分を全て置き換える
+// 置き換え後の値には次のどちらかを渡す
+//
+//	文字列   $1 や ${name} はグループに一致した部分に展開される($ 自体は $$ と書く)
+//	関数     一致した部分を受け取り、置き換える文字列を戻す
+func reReplace(ctx object.Context, args ...object.Object) object.Object {
+	re, s, err := regexAndString("re.replace", args, 3, 3)
+	if err != nil {
+		return err
+	}
+	if replacement, ok := args[2].(*object.String); ok {
+		return &object.String{Value: re.ReplaceAllString(s, replacement.Value)}
+	}
+
+	var out strings.Builder
+	last := 0
+	for _, loc := range re.FindAllStringIndex(s, -1) {
+		result, err := call(ctx, args[2], &object.String{Value: s[loc[0]:loc[1]]})
+		if err != nil {
+			return err
+		}
+		replaced, ok := result.(*object.String)
+		if !ok {
+			return newError("re.replace: replacement function must return STRING, got %s", result.Type())
+		}
+		out.WriteString(s[last:loc[0]])
+		out.WriteString(replaced.Value)
+		last = loc[1]
+	}
+	out.WriteString(s[last:])
+	return &object.String{Value: out.String()}
+}
+
+// reSplit 一致した部分を区切りとして分割する
+// 回数を指定した場合は、最大でその数に分割する(最後の要素は残り全て)
+func reSplit(ctx object.Context, args ...object.Object) object.Object {
+	re, s, err := regexAndString("re.split", args, 2, 3)
+	if err != nil {
+		return err
+	}
+	n, err := countArg("re.split", args, 2)
+	if err != nil {
+		return err
+	}
+	return stringArray(re.Split(s, n))
+}
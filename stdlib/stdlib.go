@@ -0,0 +1,71 @@
+package stdlib
+
+import (
+	"fmt"
+
+	"github.com/Sa2Knight/maron/object"
+)
+
+// builtins 全てのプログラムから参照できる組み込みの識別子
+// プログラムで同じ名前の識別子を定義した場合は、そちらが優先される
+var builtins = map[string]object.Object{}
+
+// Lookup 組み込みの識別子の値を戻す
+func Lookup(name string) (object.Object, bool) {
+	obj, ok := builtins[name]
+	return obj, ok
+}
+
+// register 組み込みの識別子を登録する
+func register(name string, obj object.Object) {
+	builtins[name] = obj
+}
+
+// newModule 組み込み関数と定数をまとめたモジュールを生成する
+// 関数の名前は "モジュール名.関数名" にする
+func newModule(name string, functions map[string]object.BuiltinFunction, constants map[string]object.Object) *object.Module {
+	exports := map[string]object.Object{}
+	for fnName, fn := range functions {
+		exports[fnName] = &object.Builtin{Name: name + "." + fnName, Fn: fn}
+	}
+	for constName, val := range constants {
+		exports[constName] = val
+	}
+	return &object.Module{Name: name, Exports: exports}
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// checkArgs 引数の数が min 以上 max 以下か検査する。max が負の場合は上限なし
+func checkArgs(name string, args []object.Object, min, max int) *object.Error {
+	n := len(args)
+	switch {
+	case min == max && n != min:
+		return newError("wrong number of arguments to %s: want %d, got %d", name, min, n)
+	case max < 0 && n < min:
+		return newError("wrong number of arguments to %s: want at least %d, got %d", name, min, n)
+	case max >= 0 && (n < min || n > max):
+		return newError("wrong number of arguments to %s: want %d to %d, got %d", name, min, max, n)
+	}
+	return nil
+}
+
+// integerArg 整数の引数の値を取り出す
+func integerArg(name string, arg object.Object) (int64, *object.Error) {
+	i, ok := arg.(*object.Integer)
+	if !ok {
+		return 0, newError("argument to %s must be INTEGER, got %s", name, arg.Type())
+	}
+	return i.Value, nil
+}
+
+// numberArg 数値(整数、浮動小数点数)の引数の値を取り出す
+func numberArg(name string, arg object.Object) (float64, *object.Error) {
+	f, ok := object.ToFloat(arg)
+	if !ok {
+		return 0, newError("argument to %s must be INTEGER or FLOAT, got %s", name, arg.Type())
+	}
+	return f, nil
+}
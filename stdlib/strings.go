@@ -0,0 +1,340 @@
+package stdlib
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Sa2Knight/maron/object"
+)
+
+// 文字列の位置と長さは、バイトではなく文字(Unicodeのコードポイント)単位で数える
+func init() {
+	register("strings", newModule("strings", map[string]object.BuiltinFunction{
+		"len":         stringsLen,
+		"split":       stringsSplit,
+		"join":        stringsJoin,
+		"trim":        trimFunction("strings.trim", strings.Trim, strings.TrimFunc),
+		"trim_start":  trimFunction("strings.trim_start", strings.TrimLeft, strings.TrimLeftFunc),
+		"trim_end":    trimFunction("strings.trim_end", strings.TrimRight, strings.TrimRightFunc),
+		"trim_prefix": stringPairFunction("strings.trim_prefix", stringResult(strings.TrimPrefix)),
+		"trim_suffix": stringPairFunction("strings.trim_suffix", stringResult(strings.TrimSuffix)),
+		"upper":       stringFunction("strings.upper", strings.ToUpper),
+		"lower":       stringFunction("strings.lower", strings.ToLower),
+		"contains":    stringPairFunction("strings.contains", boolResult(strings.Contains)),
+		"starts_with": stringPairFunction("strings.starts_with", boolResult(strings.HasPrefix)),
+		"ends_with":   stringPairFunction("strings.ends_with", boolResult(strings.HasSuffix)),
+		"index_of":    stringPairFunction("strings.index_of", indexOf),
+		"replace":     stringsReplace,
+		"repeat":      stringsRepeat,
+		"pad_start":   padFunction("strings.pad_start", true),
+		"pad_end":     padFunction("strings.pad_end", false),
+		"format":      stringsFormat,
+		"chars":       stringsChars,
+		"char":        stringsChar,
+		"code":        stringsCode,
+	}, nil))
+}
+
+// stringArg 文字列の引数の値を取り出す
+func stringArg(name string, arg object.Object) (string, *object.Error) {
+	s, ok := arg.(*object.String)
+	if !ok {
+		return "", newError("argument to %s must be STRING, got %s", name, arg.Type())
+	}
+	return s.Value, nil
+}
+
+// stringFunction 文字列をひとつ受け取り、文字列を戻す関数を生成する
+func stringFunction(name string, fn func(string) string) object.BuiltinFunction {
+	return func(ctx object.Context, args ...object.Object) object.Object {
+		if err := checkArgs(name, args, 1, 1); err != nil {
+			return err
+		}
+		s, err := stringArg(name, args[0])
+		if err != nil {
+			return err
+		}
+		return &object.String{Value: fn(s)}
+	}
+}
+
+// stringPairFunction 文字列をふたつ受け取る関数を生成する
+func stringPairFunction(name string, fn func(s, t string) object.Object) object.BuiltinFunction {
+	return func(ctx object.Context, args ...object.Object) object.Object {
+		if err := checkArgs(name, args, 2, 2); err != nil {
+			return err
+		}
+		s, err := stringArg(name, args[0])
+		if err != nil {
+			return err
+		}
+		t, err := stringArg(name, args[1])
+		if err != nil {
+			return err
+		}
+		return fn(s, t)
+	}
+}
+
+func stringResult(fn func(s, t string) string) func(s, t string) object.Object {
+	return func(s, t string) object.Object { return &object.String{Value: fn(s, t)} }
+}
+
+func boolResult(fn func(s, t string) bool) func(s, t string) object.Object {
+	return func(s, t string) object.Object { return object.NativeBool(fn(s, t)) }
+}
+
+// trimFunction 前後の文字を取り除く関数を生成する
+// 取り除く文字を並べた文字列を省略した場合は、空白(Unicodeの空白文字)を取り除く
+func trimFunction(name string, trim func(s, cutset string) string, trimFunc func(string, func(rune) bool) string) object.BuiltinFunction {
+	return func(ctx object.Context, args ...object.Object) object.Object {
+		if err := checkArgs(name, args, 1, 2); err != nil {
+			return err
+		}
+		s, err := stringArg(name, args[0])
+		if err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			return &object.String{Value: trimFunc(s, unicode.IsSpace)}
+		}
+		cutset, err := stringArg(name, args[1])
+		if err != nil {
+			return err
+		}
+		return &object.String{Value: trim(s, cutset)}
+	}
+}
+
+func stringsLen(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("strings.len", args, 1, 1); err != nil {
+		return err
+	}
+	s, err := stringArg("strings.len", args[0])
+	if err != nil {
+		return err
+	}
+	return &object.Integer{Value: int64(utf8.RuneCountInString(s))}
+}
+
+// stringsSplit 区切り文字列で分割した配列を戻す。区切りが空文字列であれば1文字ずつに分割する
+func stringsSplit(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("strings.split", args, 2, 2); err != nil {
+		return err
+	}
+	s, err := stringArg("strings.split", args[0])
+	if err != nil {
+		return err
+	}
+	sep, err := stringArg("strings.split", args[1])
+	if err != nil {
+		return err
+	}
+	return stringArray(strings.Split(s, sep))
+}
+
+// stringsJoin 文字列の配列を区切り文字列で連結する
+func stringsJoin(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("strings.join", args, 2, 2); err != nil {
+		return err
+	}
+	array, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("argument to strings.join must be ARRAY, got %s", args[0].Type())
+	}
+	sep, err := stringArg("strings.join", args[1])
+	if err != nil {
+		return err
+	}
+
+	elements := make([]string, len(array.Elements))
+	for i, el := range array.Elements {
+		s, ok := el.(*object.String)
+		if !ok {
+			return newError("strings.join: element %d must be STRING, got %s", i, el.Type())
+		}
+		elements[i] = s.Value
+	}
+	return &object.String{Value: strings.Join(elements, sep)}
+}
+
+// indexOf 最初に現れる位置(文字単位)を戻す。見つからなければ -1
+func indexOf(s, sub string) object.Object {
+	i := strings.Index(s, sub)
+	if i < 0 {
+		return &object.Integer{Value: -1}
+	}
+	return &object.Integer{Value: int64(utf8.RuneCountInString(s[:i]))}
+}
+
+// stringsReplace old を new に置き換える。回数を指定しなければ全て置き換える
+func stringsReplace(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("strings.replace", args, 3, 4); err != nil {
+		return err
+	}
+	values := make([]string, 3)
+	for i, arg := range args[:3] {
+		s, err := stringArg("strings.replace", arg)
+		if err != nil {
+			return err
+		}
+		values[i] = s
+	}
+
+	n := int64(-1)
+	if len(args) == 4 {
+		count, err := integerArg("strings.replace", args[3])
+		if err != nil {
+			return err
+		}
+		n = count
+	}
+	return &object.String{Value: strings.Replace(values[0], values[1], values[2], int(n))}
+}
+
+func stringsRepeat(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("strings.repeat", args, 2, 2); err != nil {
+		return err
+	}
+	s, err := stringArg("strings.repeat", args[0])
+	if err != nil {
+		return err
+	}
+	n, err := integerArg("strings.repeat", args[1])
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return newError("strings.repeat: negative count: %d", n)
+	}
+	if n > 0 && int64(len(s))*n/n != int64(len(s)) {
+		return newError("strings.repeat: result too long")
+	}
+	return &object.String{Value: strings.Repeat(s, int(n))}
+}
+
+// padFunction 文字数が width になるまで、前(start が真)または後ろに詰め物の文字列を繰り返し付け足す関数を生成する
+// 詰め物を省略した場合は空白を使う。width より長い文字列はそのまま戻す
+func padFunction(name string, start bool) object.BuiltinFunction {
+	return func(ctx object.Context, args ...object.Object) object.Object {
+		if err := checkArgs(name, args, 2, 3); err != nil {
+			return err
+		}
+		s, err := stringArg(name, args[0])
+		if err != nil {
+			return err
+		}
+		width, err := integerArg(name, args[1])
+		if err != nil {
+			return err
+		}
+		pad := " "
+		if len(args) == 3 {
+			if pad, err = stringArg(name, args[2]); err != nil {
+				return err
+			}
+			if pad == "" {
+				return newError("%s: empty padding", name)
+			}
+		}
+
+		missing := int(width) - utf8.RuneCountInString(s)
+		if missing <= 0 {
+			return args[0]
+		}
+		padding := []rune(strings.Repeat(pad, missing/utf8.RuneCountInString(pad)+1))[:missing]
+		if start {
+			return &object.String{Value: string(padding) + s}
+		}
+		return &object.String{Value: s + string(padding)}
+	}
+}
+
+// stringsFormat 書式の {} を、引数を順に文字列にしたもので置き換える
+// {{ と }} はそれぞれ { と } を表す
+func stringsFormat(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("strings.format", args, 1, -1); err != nil {
+		return err
+	}
+	format, err := stringArg("strings.format", args[0])
+	if err != nil {
+		return err
+	}
+
+	var out strings.Builder
+	values := args[1:]
+	for i := 0; i < len(format); i++ {
+		switch {
+		case strings.HasPrefix(format[i:], "{{"), strings.HasPrefix(format[i:], "}}"):
+			out.WriteByte(format[i])
+			i++
+		case strings.HasPrefix(format[i:], "{}"):
+			if len(values) == 0 {
+				return newError("strings.format: too few arguments for %q", format)
+			}
+			out.WriteString(values[0].Inspect())
+			values = values[1:]
+			i++
+		case format[i] == '{' || format[i] == '}':
+			return newError("strings.format: unmatched %c in %q", format[i], format)
+		default:
+			out.WriteByte(format[i])
+		}
+	}
+	if len(values) > 0 {
+		return newError("strings.format: too many arguments for %q", format)
+	}
+	return &object.String{Value: out.String()}
+}
+
+// stringsChars 1文字ずつの文字列の配列を戻す
+func stringsChars(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("strings.chars", args, 1, 1); err != nil {
+		return err
+	}
+	s, err := stringArg("strings.chars", args[0])
+	if err != nil {
+		return err
+	}
+	return stringArray(strings.Split(s, ""))
+}
+
+// stringsChar コードポイントから1文字の文字列を生成する
+func stringsChar(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("strings.char", args, 1, 1); err != nil {
+		return err
+	}
+	code, err := integerArg("strings.char", args[0])
+	if err != nil {
+		return err
+	}
+	if code < 0 || code > utf8.MaxRune || !utf8.ValidRune(rune(code)) {
+		return newError("strings.char: invalid code point: %d", code)
+	}
+	return &object.String{Value: string(rune(code))}
+}
+
+// stringsCode 1文字の文字列のコードポイントを戻す
+func stringsCode(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("strings.code", args, 1, 1); err != nil {
+		return err
+	}
+	s, err := stringArg("strings.code", args[0])
+	if err != nil {
+		return err
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if s == "" || size != len(s) || (r == utf8.RuneError && size == 1) {
+		return newError("strings.code: want a single character, got %q", s)
+	}
+	return &object.Integer{Value: int64(r)}
+}
+
+func stringArray(values []string) *object.Array {
+	elements := make([]object.Object, len(values))
+	for i, v := range values {
+		elements[i] = &object.String{Value: v}
+	}
+	return &object.Array{Elements: elements}
+}
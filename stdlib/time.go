@@ -0,0 +1,359 @@
+package stdlib
+
+import (
+	"time"
+	_ "time/tzdata" // 実行環境にタイムゾーンのデータベースがなくても、タイムゾーン名を使えるようにする
+
+	"github.com/Sa2Knight/maron/object"
+)
+
+// 書式(レイアウト)は Go の time パッケージと同じく、基準の時刻 2006-01-02 15:04:05 -0700 MST の各部分で表す
+// タイムゾーンは IANA のタイムゾーン名 (Asia/Tokyo, UTC など) で指定する
+func init() {
+	register("time", newModule("time", map[string]object.BuiltinFunction{
+		"now":       timeNow,
+		"monotonic": timeMonotonic,
+		"date":      timeDate,
+		"parse":     timeParse,
+		"format":    timeFormat,
+		"unix":      timeUnix,
+		"from_unix": timeFromUnix,
+		"fields":    timeFields,
+		"in_zone":   timeInZone,
+		"zone":      timeZone,
+		"duration":  timeDuration,
+		"seconds":   timeSeconds,
+		"add":       timeAdd,
+		"sub":       timeSub,
+		"add_date":  timeAddDate,
+	}, map[string]object.Object{
+		"rfc3339":   &object.String{Value: time.RFC3339},
+		"rfc1123":   &object.String{Value: time.RFC1123},
+		"date_only": &object.String{Value: time.DateOnly},
+		"time_only": &object.String{Value: time.TimeOnly},
+		"datetime":  &object.String{Value: time.DateTime},
+	}))
+}
+
+// timeArg 時刻の引数の値を取り出す
+func timeArg(name string, arg object.Object) (time.Time, *object.Error) {
+	t, ok := arg.(*object.Time)
+	if !ok {
+		return time.Time{}, newError("argument to %s must be TIME, got %s", name, arg.Type())
+	}
+	return t.Value, nil
+}
+
+// durationArg 時間の長さの引数の値を取り出す
+func durationArg(name string, arg object.Object) (time.Duration, *object.Error) {
+	d, ok := arg.(*object.Duration)
+	if !ok {
+		return 0, newError("argument to %s must be DURATION, got %s", name, arg.Type())
+	}
+	return d.Value, nil
+}
+
+// zoneArg タイムゾーン名の引数からタイムゾーンを読み込む
+func zoneArg(name string, arg object.Object) (*time.Location, *object.Error) {
+	zone, err := stringArg(name, arg)
+	if err != nil {
+		return nil, err
+	}
+	loc, loadErr := time.LoadLocation(zone)
+	if loadErr != nil {
+		return nil, newError("%s: unknown time zone: %s", name, zone)
+	}
+	return loc, nil
+}
+
+// timeNow 現在時刻を戻す。時刻は Runtime の Clock から取得する
+func timeNow(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("time.now", args, 0, 0); err != nil {
+		return err
+	}
+	return &object.Time{Value: ctx.Runtime().Clock.Now()}
+}
+
+// timeMonotonic 最初に呼び出した時点からの経過時間を戻す。処理時間の計測に使う
+func timeMonotonic(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("time.monotonic", args, 0, 0); err != nil {
+		return err
+	}
+	return &object.Duration{Value: ctx.Runtime().Monotonic()}
+}
+
+// timeDate 年月日(と時分秒、タイムゾーン)から時刻を生成する
+// 省略した時分秒は0、タイムゾーンは UTC にする。存在しない日時(2月30日など)はエラーにする
+//
+//	date(year, month, day[, hour, minute, second[, zone]])
+func timeDate(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("time.date", args, 3, 7); err != nil {
+		return err
+	}
+	if len(args) == 4 || len(args) == 5 {
+		return newError("time.date: want hour, minute and second together")
+	}
+
+	numbers := args
+	if len(args) == 7 {
+		numbers = args[:6]
+	}
+	values := make([]int, 6)
+	for i, arg := range numbers {
+		v, err := integerArg("time.date", arg)
+		if err != nil {
+			return err
+		}
+		values[i] = int(v)
+	}
+	loc := time.UTC
+	if len(args) == 7 {
+		var err *object.Error
+		if loc, err = zoneArg("time.date", args[6]); err != nil {
+			return err
+		}
+	}
+
+	t := time.Date(values[0], time.Month(values[1]), values[2], values[3], values[4], values[5], 0, loc)
+	if t.Year() != values[0] || int(t.Month()) != values[1] || t.Day() != values[2] ||
+		values[3] < 0 || values[3] > 23 || values[4] < 0 || values[4] > 59 || values[5] < 0 || values[5] > 59 {
+		return newError("time.date: invalid date: %04d-%02d-%02d %02d:%02d:%02d", values[0], values[1], values[2], values[3], values[4], values[5])
+	}
+	return &object.Time{Value: t}
+}
+
+// timeParse 文字列を書式に従って解析する
+// 書式を省略した場合は RFC 3339、書式にタイムゾーンが含まれない場合は指定したタイムゾーン(省略時は UTC)の時刻とする
+func timeParse(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("time.parse", args, 1, 3); err != nil {
+		return err
+	}
+	s, err := stringArg("time.parse", args[0])
+	if err != nil {
+		return err
+	}
+	layout := time.RFC3339
+	if len(args) >= 2 {
+		if layout, err = stringArg("time.parse", args[1]); err != nil {
+			return err
+		}
+	}
+	loc := time.UTC
+	if len(args) == 3 {
+		if loc, err = zoneArg("time.parse", args[2]); err != nil {
+			return err
+		}
+	}
+
+	t, parseErr := time.ParseInLocation(layout, s, loc)
+	if parseErr != nil {
+		return newError("time.parse: %s", parseErr)
+	}
+	return &object.Time{Value: t}
+}
+
+// timeFormat 時刻を書式に従って文字列にする。書式を省略した場合は RFC 3339
+func timeFormat(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("time.format", args, 1, 2); err != nil {
+		return err
+	}
+	t, err := timeArg("time.format", args[0])
+	if err != nil {
+		return err
+	}
+	layout := time.RFC3339Nano
+	if len(args) == 2 {
+		if layout, err = stringArg("time.format", args[1]); err != nil {
+			return err
+		}
+	}
+	return &object.String{Value: t.Format(layout)}
+}
+
+// timeUnix UNIX時間(1970-01-01T00:00:00Z からの秒数)を戻す
+func timeUnix(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("time.unix", args, 1, 1); err != nil {
+		return err
+	}
+	t, err := timeArg("time.unix", args[0])
+	if err != nil {
+		return err
+	}
+	return &object.Integer{Value: t.Unix()}
+}
+
+// timeFromUnix UNIX時間から時刻を生成する。タイムゾーンを省略した場合は UTC
+func timeFromUnix(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("time.from_unix", args, 1, 2); err != nil {
+		return err
+	}
+	sec, err := integerArg("time.from_unix", args[0])
+	if err != nil {
+		return err
+	}
+	loc := time.UTC
+	if len(args) == 2 {
+		if loc, err = zoneArg("time.from_unix", args[1]); err != nil {
+			return err
+		}
+	}
+	return &object.Time{Value: time.Unix(sec, 0).In(loc)}
+}
+
+// timeFields 時刻の各部分をハッシュにして戻す
+// weekday は曜日の英語名、zone はタイムゾーンの略称、offset は UTC との差(秒)
+func timeFields(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("time.fields", args, 1, 1); err != nil {
+		return err
+	}
+	t, err := timeArg("time.fields", args[0])
+	if err != nil {
+		return err
+	}
+
+	zone, offset := t.Zone()
+	fields := object.NewHash()
+	for _, field := range []struct {
+		name  string
+		value object.Object
+	}{
+		{"year", &object.Integer{Value: int64(t.Year())}},
+		{"month", &object.Integer{Value: int64(t.Month())}},
+		{"day", &object.Integer{Value: int64(t.Day())}},
+		{"hour", &object.Integer{Value: int64(t.Hour())}},
+		{"minute", &object.Integer{Value: int64(t.Minute())}},
+		{"second", &object.Integer{Value: int64(t.Second())}},
+		{"nanosecond", &object.Integer{Value: int64(t.Nanosecond())}},
+		{"weekday", &object.String{Value: t.Weekday().String()}},
+		{"yearday", &object.Integer{Value: int64(t.YearDay())}},
+		{"zone", &object.String{Value: zone}},
+		{"offset", &object.Integer{Value: int64(offset)}},
+	} {
+		fields.Set(&object.String{Value: field.name}, field.value)
+	}
+	return fields
+}
+
+// timeInZone 同じ瞬間を、指定したタイムゾーンの時刻として戻す
+func timeInZone(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("time.in_zone", args, 2, 2); err != nil {
+		return err
+	}
+	t, err := timeArg("time.in_zone", args[0])
+	if err != nil {
+		return err
+	}
+	loc, err := zoneArg("time.in_zone", args[1])
+	if err != nil {
+		return err
+	}
+	return &object.Time{Value: t.In(loc)}
+}
+
+// timeZone 時刻のタイムゾーン名を戻す
+func timeZone(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("time.zone", args, 1, 1); err != nil {
+		return err
+	}
+	t, err := timeArg("time.zone", args[0])
+	if err != nil {
+		return err
+	}
+	return &object.String{Value: t.Location().String()}
+}
+
+// timeDuration "1h30m" や "-1.5s" のような文字列から時間の長さを生成する
+// 単位は ns, us, ms, s, m, h
+func timeDuration(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("time.duration", args, 1, 1); err != nil {
+		return err
+	}
+	s, err := stringArg("time.duration", args[0])
+	if err != nil {
+		return err
+	}
+	d, parseErr := time.ParseDuration(s)
+	if parseErr != nil {
+		return newError("time.duration: invalid duration: %q", s)
+	}
+	return &object.Duration{Value: d}
+}
+
+// timeSeconds 時間の長さを秒数(浮動小数点数)で戻す
+func timeSeconds(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("time.seconds", args, 1, 1); err != nil {
+		return err
+	}
+	d, err := durationArg("time.seconds", args[0])
+	if err != nil {
+		return err
+	}
+	return &object.Float{Value: d.Seconds()}
+}
+
+// timeAdd 時刻または時間の長さに、時間の長さを足す
+func timeAdd(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("time.add", args, 2, 2); err != nil {
+		return err
+	}
+	d, err := durationArg("time.add", args[1])
+	if err != nil {
+		return err
+	}
+	switch base := args[0].(type) {
+	case *object.Time:
+		return &object.Time{Value: base.Value.Add(d)}
+	case *object.Duration:
+		return &object.Duration{Value: base.Value + d}
+	}
+	return newError("argument to time.add must be TIME or DURATION, got %s", args[0].Type())
+}
+
+// timeSub 引き算をする
+//
+//	sub(時刻, 時刻)                 2つの時刻の差(時間の長さ)
+//	sub(時刻, 時間の長さ)           その長さだけ前の時刻
+//	sub(時間の長さ, 時間の長さ)     時間の長さの差
+func timeSub(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("time.sub", args, 2, 2); err != nil {
+		return err
+	}
+	switch left := args[0].(type) {
+	case *object.Time:
+		if right, ok := args[1].(*object.Time); ok {
+			return &object.Duration{Value: left.Value.Sub(right.Value)}
+		}
+		d, err := durationArg("time.sub", args[1])
+		if err != nil {
+			return newError("argument to time.sub must be TIME or DURATION, got %s", args[1].Type())
+		}
+		return &object.Time{Value: left.Value.Add(-d)}
+	case *object.Duration:
+		d, err := durationArg("time.sub", args[1])
+		if err != nil {
+			return err
+		}
+		return &object.Duration{Value: left.Value - d}
+	}
+	return newError("argument to time.sub must be TIME or DURATION, got %s", args[0].Type())
+}
+
+// timeAddDate 暦の上で年、月、日を足す。月末を越えた日付は翌月に繰り越す(1月31日の1か月後は3月2日または3日)
+func timeAddDate(ctx object.Context, args ...object.Object) object.Object {
+	if err := checkArgs("time.add_date", args, 4, 4); err != nil {
+		return err
+	}
+	t, err := timeArg("time.add_date", args[0])
+	if err != nil {
+		return err
+	}
+	values := make([]int, 3)
+	for i, arg := range args[1:] {
+		v, err := integerArg("time.add_date", arg)
+		if err != nil {
+			return err
+		}
+		values[i] = int(v)
+	}
+	return &object.Time{Value: t.AddDate(values[0], values[1], values[2])}
+}
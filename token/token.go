@@ -5,8 +5,10 @@ type TokenType string
 
 // Token トークン
 type Token struct {
-	Type    TokenType
-	Literal string
+	Type    TokenType `json:"type"`
+	Literal string    `json:"literal"`
+	Line    int       `json:"line"`   // トークンが出現した行(1始まり)
+	Column  int       `json:"column"` // トークンが出現した列(1始まり、バイト単位)
 }
 
 const (
@@ -22,9 +24,30 @@ const (
 	// INT 数値リテラル
 	INT = "INT"
 
+	// FLOAT 浮動小数点数リテラル
+	FLOAT = "FLOAT"
+
+	// STRING 文字列リテラル
+	STRING = "STRING"
+
+	// COMMENT コメント (// から行末まで)
+	COMMENT = "COMMENT"
+
 	// ASSIGN 代入演算子
 	ASSIGN = "="
 
+	// PLUS_ASSIGN 加算して代入
+	PLUS_ASSIGN = "+="
+
+	// MINUS_ASSIGN 減算して代入
+	MINUS_ASSIGN = "-="
+
+	// ASTERISK_ASSIGN 積算して代入
+	ASTERISK_ASSIGN = "*="
+
+	// SLASH_ASSIGN 除算して代入
+	SLASH_ASSIGN = "/="
+
 	// PLUS 加算演算子
 	PLUS = "+"
 
@@ -52,6 +75,24 @@ const (
 	// SEMICOLON 式の終端文字
 	SEMICOLON = ";"
 
+	// COLON ハッシュのキーと値の区切り文字
+	COLON = ":"
+
+	// DOT プロパティの参照
+	DOT = "."
+
+	// ARROW パターンと式の区切り文字
+	ARROW = "=>"
+
+	// PIPE 短縮形の関数の仮引数の区切り文字
+	PIPE = "|"
+
+	// PIPELINE 左辺を右辺の関数の第1引数として渡す
+	PIPELINE = "|>"
+
+	// ELLIPSIS 残りの要素をまとめて受け取る
+	ELLIPSIS = "..."
+
 	// LPAREN 括弧開始
 	LPAREN = "("
 
@@ -64,12 +105,21 @@ const (
 	// RBRACE 中括弧終了
 	RBRACE = "}"
 
+	// LBRACKET 角括弧開始
+	LBRACKET = "["
+
+	// RBRACKET 角括弧終了
+	RBRACKET = "]"
+
 	// FUNCTION 関数定義
 	FUNCTION = "FUNCTION"
 
 	// LET 変数定義
 	LET = "LET"
 
+	// CONST 定数定義
+	CONST = "CONST"
+
 	// TRUE 真
 	TRUE = "TRUE"
 
@@ -85,6 +135,33 @@ const (
 	// RETURN 値の返却
 	RETURN = "RETURN"
 
+	// WHILE 条件を満たす間の繰り返し
+	WHILE = "WHILE"
+
+	// FOR 要素ごとの繰り返し
+	FOR = "FOR"
+
+	// IN 繰り返す要素の取り出し元
+	IN = "IN"
+
+	// BREAK 繰り返しの終了
+	BREAK = "BREAK"
+
+	// CONTINUE 繰り返しの次の周回へ
+	CONTINUE = "CONTINUE"
+
+	// MATCH パターンによる場合分け
+	MATCH = "MATCH"
+
+	// IMPORT モジュールの読み込み
+	IMPORT = "IMPORT"
+
+	// AS 読み込んだモジュールを束縛する識別子の指定
+	AS = "AS"
+
+	// EXPORT モジュールの外に公開する定義
+	EXPORT = "EXPORT"
+
 	// EQ 一致
 	EQ = "=="
 
@@ -93,13 +170,23 @@ const (
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"const":    CONST,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"match":    MATCH,
+	"import":   IMPORT,
+	"as":       AS,
+	"export":   EXPORT,
 }
 
 // LookupIdent 文字列のトークンタイプを戻す(キーワードか識別子か)
@@ -109,3 +196,13 @@ func LookupIdent(ident string) TokenType {
 	}
 	return IDENT
 }
+
+// IsKeyword トークンタイプがキーワードか
+func IsKeyword(t TokenType) bool {
+	for _, keyword := range keywords {
+		if keyword == t {
+			return true
+		}
+	}
+	return false
+}
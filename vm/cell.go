@@ -0,0 +1,19 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/Sa2Knight/maron/object"
+)
+
+// cell クロージャに捕捉されるローカル変数の格納先(VMの内部でのみ使用する)
+// 外側の関数とクロージャが同じセルを参照することで、代入を共有する
+type cell struct {
+	value object.Object
+}
+
+// Inspect is cell's method.
+func (c *cell) Inspect() string { return fmt.Sprintf("cell(%s)", c.value.Inspect()) }
+
+// Type is cell's method.
+func (c *cell) Type() object.ObjectType { return "CELL" }
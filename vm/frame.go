@@ -0,0 +1,23 @@
+package vm
+
+import (
+	"github.com/Sa2Knight/maron/code"
+	"github.com/Sa2Knight/maron/object"
+)
+
+// Frame 関数呼び出しごとの実行状態
+type Frame struct {
+	cl          *object.Closure
+	ip          int // 実行中の命令の位置
+	basePointer int // 呼び出し時のスタックポインタ(ローカル変数の先頭)
+}
+
+// NewFrame クロージャを実行するフレームを新規生成
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+// Instructions フレームで実行する命令列を戻す
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,15 @@
+package vm
+
+import "github.com/Sa2Knight/maron/object"
+
+// iterator for-in文で繰り返し中の要素(VMの内部でのみ使用する)
+type iterator struct {
+	elements []object.Object
+	next     int // 次に取り出す要素の位置
+}
+
+// Inspect is iterator's method.
+func (it *iterator) Inspect() string { return "iterator" }
+
+// Type is iterator's method.
+func (it *iterator) Type() object.ObjectType { return "ITERATOR" }
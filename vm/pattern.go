@@ -0,0 +1,146 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/Sa2Knight/maron/code"
+	"github.com/Sa2Knight/maron/object"
+)
+
+// missing 分割代入で対応する値がないことを表す目印(VMの内部でのみ使用する)
+// 既定値があれば OpJumpPresent で置き換え、なければ OpRequire がエラーにする
+type missing struct {
+	desc string // エラーメッセージ用の要素の説明
+}
+
+// Inspect is missing's method.
+func (m *missing) Inspect() string { return "missing " + m.desc }
+
+// Type is missing's method.
+func (m *missing) Type() object.ObjectType { return "MISSING" }
+
+// unpackArray スタックの先頭の配列を分解し、先頭の要素が上になるように積む
+// hasRest であれば、残りの要素の配列を最初に積む
+func (vm *VM) unpackArray(numElements int, hasRest bool) error {
+	operand := vm.pop()
+	array, ok := operand.(*object.Array)
+	if !ok {
+		return fmt.Errorf("cannot destructure %s as array", operand.Type())
+	}
+	if !hasRest && len(array.Elements) > numElements {
+		return fmt.Errorf("too many elements to destructure: want=%d, got=%d", numElements, len(array.Elements))
+	}
+	return vm.pushElements(array, numElements, hasRest)
+}
+
+// matchArray スタックの先頭が要素数の合う配列であれば、unpackArray と同じく分解して真を積む
+// 一致しなければ偽のみを積む
+func (vm *VM) matchArray(numElements int, hasRest bool) error {
+	array, ok := vm.pop().(*object.Array)
+	if !ok || len(array.Elements) < numElements || !hasRest && len(array.Elements) != numElements {
+		return vm.push(False)
+	}
+
+	if err := vm.pushElements(array, numElements, hasRest); err != nil {
+		return err
+	}
+	return vm.push(True)
+}
+
+func (vm *VM) pushElements(array *object.Array, numElements int, hasRest bool) error {
+	if hasRest {
+		rest := []object.Object{}
+		if len(array.Elements) > numElements {
+			rest = append(rest, array.Elements[numElements:]...)
+		}
+		if err := vm.push(&object.Array{Elements: rest}); err != nil {
+			return err
+		}
+	}
+
+	for i := numElements - 1; i >= 0; i-- {
+		var element object.Object = &missing{desc: fmt.Sprintf("element %d in array pattern", i)}
+		if i < len(array.Elements) {
+			element = array.Elements[i]
+		}
+		if err := vm.push(element); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unpackHash スタックに積まれたキーと、その下のハッシュを取り出し、最初のキーの値が上になるように積む
+func (vm *VM) unpackHash(numKeys int) error {
+	keys, err := vm.popKeys(code.OpUnpackHash, numKeys)
+	if err != nil {
+		return err
+	}
+
+	operand := vm.pop()
+	hash, ok := operand.(*object.Hash)
+	if !ok {
+		return fmt.Errorf("cannot destructure %s as hash", operand.Type())
+	}
+	return vm.pushValues(hash, keys)
+}
+
+// matchHash スタックに積まれたキーを全て持つハッシュであれば、unpackHash と同じく分解して真を積む
+// 一致しなければ偽のみを積む
+func (vm *VM) matchHash(numKeys int) error {
+	keys, err := vm.popKeys(code.OpMatchHash, numKeys)
+	if err != nil {
+		return err
+	}
+
+	hash, ok := vm.pop().(*object.Hash)
+	if !ok {
+		return vm.push(False)
+	}
+	for _, key := range keys {
+		if _, ok := hash.Get(key); !ok {
+			return vm.push(False)
+		}
+	}
+
+	if err := vm.pushValues(hash, keys); err != nil {
+		return err
+	}
+	return vm.push(True)
+}
+
+func (vm *VM) popKeys(op code.Opcode, numKeys int) ([]*object.String, error) {
+	keys := make([]*object.String, numKeys)
+	for i, key := range vm.stack[vm.sp-numKeys : vm.sp] {
+		s, ok := key.(*object.String)
+		if !ok {
+			return nil, invalidOperand(op, key)
+		}
+		keys[i] = s
+	}
+	vm.sp -= numKeys
+	return keys, nil
+}
+
+func (vm *VM) pushValues(hash *object.Hash, keys []*object.String) error {
+	for i := len(keys) - 1; i >= 0; i-- {
+		value, ok := hash.Get(keys[i])
+		if !ok {
+			value = &missing{desc: fmt.Sprintf("key %s in hash pattern", keys[i].Value)}
+		}
+		if err := vm.push(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchValue スタックの先頭のリテラルと、その下の値が一致するかを積む
+func (vm *VM) matchValue() error {
+	literal, ok := vm.pop().(object.Hashable)
+	if !ok {
+		return invalidOperand(code.OpMatchValue, vm.stack[vm.sp])
+	}
+	operand, ok := vm.pop().(object.Hashable)
+	return vm.push(nativeBoolToBooleanObject(ok && operand.HashKey() == literal.HashKey()))
+}
@@ -0,0 +1,1070 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/Sa2Knight/maron/code"
+	"github.com/Sa2Knight/maron/compiler"
+	"github.com/Sa2Knight/maron/object"
+	"github.com/Sa2Knight/maron/stdlib"
+)
+
+// StackSize 最初に確保するスタックの大きさ
+// 足りなくなれば拡張する。深さは関数呼び出しの深さ(MaxFrames)で制限する
+const StackSize = 2048
+
+// GlobalsSize グローバル変数の最大数
+const GlobalsSize = 65536
+
+// MaxFrames フレームの最大数
+// 評価器と同じ深さまで関数を呼び出せるよう、トップレベルのフレームに object.MaxCallDepth を加えた数とする
+const MaxFrames = object.MaxCallDepth + 1
+
+var (
+	// Null ネイティブオブジェクト
+	Null = object.NullObject
+
+	// True ネイティブオブジェクト
+	True = object.TrueObject
+
+	// False ネイティブオブジェクト
+	False = object.FalseObject
+)
+
+// エラーメッセージ用の演算子の表記
+var operators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+}
+
+// VM バイトコードを実行するスタックマシン
+type VM struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+
+	stack []object.Object
+	sp    int // 次に積む位置。スタックの先頭は stack[sp-1]
+
+	frames      []*Frame
+	framesIndex int
+
+	lastPopped object.Object // 最後にトップレベルの式文で取り除かれた値
+
+	modules map[*object.CompiledFunction]*object.Module // 実行済みのモジュールの関数と、生成したモジュール
+
+	runtime *object.Runtime // 組み込み関数が使う実行環境の設定
+}
+
+// New バイトコードを実行するVMを新規生成
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode, make([]object.Object, GlobalsSize))
+}
+
+// NewWithGlobalsStore 前回の実行のグローバル変数を引き継いでVMを生成(REPL用)
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, globals []object.Object) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, NumLocals: bytecode.NumLocals}
+	mainClosure := &object.Closure{Fn: mainFn}
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = NewFrame(mainClosure, 0)
+
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     globals,
+		globalNames: bytecode.GlobalNames,
+
+		// トップレベルのブロックのローカル変数の領域を確保しておく
+		stack: make([]object.Object, max(StackSize, mainFn.NumLocals)),
+		sp:    mainFn.NumLocals,
+
+		frames:      frames,
+		framesIndex: 1,
+
+		modules: map[*object.CompiledFunction]*object.Module{},
+
+		runtime: object.NewRuntime(),
+	}
+}
+
+// SetRuntime 組み込み関数が使う実行環境の設定をする
+func (vm *VM) SetRuntime(runtime *object.Runtime) {
+	vm.runtime = runtime
+}
+
+// Runtime is object.Context's method.
+func (vm *VM) Runtime() *object.Runtime {
+	return vm.runtime
+}
+
+// Call is object.Context's method.
+// 組み込み関数から呼び出す関数のフレームを積み、そのフレームから戻るまで命令を実行する
+func (vm *VM) Call(fn object.Object, args ...object.Object) object.Object {
+	if err := vm.push(fn); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	for _, arg := range args {
+		if err := vm.push(arg); err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+	}
+
+	depth := vm.framesIndex
+	if err := vm.callFunction(len(args), nil); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	// 組み込み関数はフレームを積まずに、戻り値を積み終えている
+	if vm.framesIndex > depth {
+		if err := vm.run(depth); err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+	}
+	return vm.pop()
+}
+
+// LastPoppedStackElem プログラム全体の評価結果を戻す
+// 評価器と同じく、最後の文が値を持たない場合(let文など)はnil
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.lastPopped
+}
+
+// Run バイトコードを実行する
+func (vm *VM) Run() error {
+	return vm.run(0)
+}
+
+// run フレームの数が depth 以下になる(depth より深いフレームから戻る)まで命令を実行する
+func (vm *VM) run(depth int) error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.framesIndex > depth && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			if err := vm.push(vm.constants[constIndex]); err != nil {
+				return err
+			}
+
+		case code.OpPop:
+			popped := vm.pop()
+			if vm.framesIndex == 1 {
+				vm.lastPopped = popped
+			}
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+			if err := vm.executeBinaryOperation(op); err != nil {
+				return err
+			}
+
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
+			if err := vm.executeComparison(op); err != nil {
+				return err
+			}
+
+		case code.OpTrue:
+			if err := vm.push(True); err != nil {
+				return err
+			}
+
+		case code.OpFalse:
+			if err := vm.push(False); err != nil {
+				return err
+			}
+
+		case code.OpNull:
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+
+		case code.OpBang:
+			if err := vm.push(nativeBoolToBooleanObject(!isTruthy(vm.pop()))); err != nil {
+				return err
+			}
+
+		case code.OpMinus:
+			if err := vm.executeMinusOperator(); err != nil {
+				return err
+			}
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			// 終わらない繰り返しも中断できるよう、後方へのジャンプのたびに確かめる
+			if pos <= ip && vm.runtime.Interrupted() {
+				return object.ErrInterrupted
+			}
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if !isTruthy(vm.pop()) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+			// let文は値を持たない
+			vm.lastPopped = nil
+
+		case code.OpAssignGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			if vm.globals[globalIndex] == nil {
+				return fmt.Errorf("cannot assign to undeclared identifier: %s", vm.globalName(int(globalIndex)))
+			}
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpDup:
+			n := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip++
+
+			for _, o := range vm.stack[vm.sp-n : vm.sp] {
+				if err := vm.push(o); err != nil {
+					return err
+				}
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			if err := vm.executeIndexExpression(left, index); err != nil {
+				return err
+			}
+
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			if err := vm.executeSetIndex(left, index, value); err != nil {
+				return err
+			}
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp -= numElements
+
+			if err := vm.push(&object.Array{Elements: elements}); err != nil {
+				return err
+			}
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp -= numElements
+
+			if err := vm.push(hash); err != nil {
+				return err
+			}
+
+		case code.OpUnpackArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			hasRest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+
+			if err := vm.unpackArray(numElements, hasRest); err != nil {
+				return err
+			}
+
+		case code.OpMatchArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			hasRest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+
+			if err := vm.matchArray(numElements, hasRest); err != nil {
+				return err
+			}
+
+		case code.OpMatchHash:
+			numKeys := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if err := vm.matchHash(numKeys); err != nil {
+				return err
+			}
+
+		case code.OpMatchValue:
+			if err := vm.matchValue(); err != nil {
+				return err
+			}
+
+		case code.OpNoMatch:
+			return fmt.Errorf("no match for %s", vm.pop().Inspect())
+
+		case code.OpUnpackHash:
+			numKeys := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if err := vm.unpackHash(numKeys); err != nil {
+				return err
+			}
+
+		case code.OpJumpPresent:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if _, ok := vm.stack[vm.sp-1].(*missing); !ok {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpRequire:
+			if m, ok := vm.stack[vm.sp-1].(*missing); ok {
+				return fmt.Errorf("missing %s", m.desc)
+			}
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			val := vm.globals[globalIndex]
+			if val == nil {
+				// 評価器と同じく、定義されていなければ組み込みの識別子を探す
+				builtin, ok := stdlib.Lookup(vm.globalName(int(globalIndex)))
+				if !ok {
+					return fmt.Errorf("identifier not found: %s", vm.globalName(int(globalIndex)))
+				}
+				val = builtin
+			}
+			if err := vm.push(val); err != nil {
+				return err
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			frame := vm.currentFrame()
+			local := vm.stack[frame.basePointer+int(localIndex)]
+			if local == nil {
+				return invalidOperand(op, nil)
+			}
+			if err := vm.push(local); err != nil {
+				return err
+			}
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			free := vm.currentFrame().cl.Free[freeIndex]
+			if c, ok := free.(*cell); ok {
+				free = c.value
+			}
+			if err := vm.push(free); err != nil {
+				return err
+			}
+
+		case code.OpGetFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			if err := vm.push(vm.currentFrame().cl.Free[freeIndex]); err != nil {
+				return err
+			}
+
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			c, ok := vm.currentFrame().cl.Free[freeIndex].(*cell)
+			if !ok {
+				return fmt.Errorf("cannot assign to captured function")
+			}
+			c.value = vm.pop()
+
+		case code.OpGetCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			frame := vm.currentFrame()
+			c, ok := vm.stack[frame.basePointer+int(localIndex)].(*cell)
+			if !ok {
+				return fmt.Errorf("uninitialized variable")
+			}
+			if err := vm.push(c.value); err != nil {
+				return err
+			}
+
+		case code.OpSetCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			frame := vm.currentFrame()
+			slot := frame.basePointer + int(localIndex)
+			if c, ok := vm.stack[slot].(*cell); ok {
+				c.value = vm.pop()
+			} else {
+				vm.stack[slot] = &cell{value: vm.pop()}
+			}
+
+		case code.OpCurrentClosure:
+			if err := vm.push(vm.currentFrame().cl); err != nil {
+				return err
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			if err := vm.callFunction(int(numArgs), nil); err != nil {
+				return err
+			}
+
+		case code.OpTailCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip++
+
+			if err := vm.tailCallFunction(int(numArgs), nil); err != nil {
+				return err
+			}
+
+		case code.OpCallArgs, code.OpTailCallArgs:
+			numArgs, named, err := vm.spreadArguments(op)
+			if err != nil {
+				return err
+			}
+
+			if op == code.OpCallArgs {
+				err = vm.callFunction(numArgs, named)
+			} else {
+				err = vm.tailCallFunction(numArgs, named)
+			}
+			if err != nil {
+				return err
+			}
+
+		case code.OpAppend:
+			val := vm.pop()
+			array, ok := vm.stack[vm.sp-1].(*object.Array)
+			if !ok {
+				return invalidOperand(op, vm.stack[vm.sp-1])
+			}
+			array.Elements = append(array.Elements, val)
+
+		case code.OpExtend:
+			operand := vm.pop()
+			elements, ok := operand.(*object.Array)
+			if !ok {
+				return fmt.Errorf("cannot spread %s", operand.Type())
+			}
+			array, ok := vm.stack[vm.sp-1].(*object.Array)
+			if !ok {
+				return invalidOperand(op, vm.stack[vm.sp-1])
+			}
+			array.Elements = append(array.Elements, elements.Elements...)
+
+		case code.OpIterInit:
+			operand := vm.pop()
+			iterable, ok := operand.(object.Iterable)
+			if !ok {
+				return fmt.Errorf("not iterable: %s", operand.Type())
+			}
+			if err := vm.push(&iterator{elements: iterable.Iterate()}); err != nil {
+				return err
+			}
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			it, ok := vm.stack[vm.sp-1].(*iterator)
+			if !ok {
+				return invalidOperand(op, vm.stack[vm.sp-1])
+			}
+			if it.next >= len(it.elements) {
+				vm.currentFrame().ip = pos - 1
+				break
+			}
+			it.next++
+			if err := vm.push(it.elements[it.next-1]); err != nil {
+				return err
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			// トップレベルのreturn文はプログラムを終了する
+			if vm.framesIndex == 1 {
+				vm.lastPopped = returnValue
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			if err := vm.push(returnValue); err != nil {
+				return err
+			}
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			if err := vm.pushClosure(int(constIndex), int(numFree)); err != nil {
+				return err
+			}
+
+		case code.OpImport:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			if err := vm.importModule(int(constIndex)); err != nil {
+				return err
+			}
+
+		case code.OpModule:
+			numExports := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			exports := map[string]object.Object{}
+			for i := vm.sp - numExports*2; i < vm.sp; i += 2 {
+				name, ok := vm.stack[i].(*object.String)
+				if !ok {
+					return invalidOperand(op, vm.stack[i])
+				}
+				exports[name.Value] = vm.stack[i+1]
+			}
+			vm.sp -= numExports * 2
+
+			fn := vm.currentFrame().cl.Fn
+			mod := &object.Module{Name: fn.Name, Exports: exports}
+			vm.modules[fn] = mod
+			if err := vm.push(mod); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("unknown opcode: %d", op)
+		}
+	}
+
+	return nil
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	if left.Type() != object.INTEGER || right.Type() != object.INTEGER {
+		// 浮動小数点数を含む数値同士は、浮動小数点数で計算する
+		if isNumber(left) && isNumber(right) {
+			return vm.executeFloatOperation(op, left, right)
+		}
+		// 文字列同士の + は連結
+		if left.Type() == object.STRING && right.Type() == object.STRING && op == code.OpAdd {
+			return vm.push(&object.String{Value: left.(*object.String).Value + right.(*object.String).Value})
+		}
+		return operatorError(op, left, right)
+	}
+
+	leftValue := left.(*object.Integer).Value
+	rightValue := right.(*object.Integer).Value
+
+	var result int64
+	switch op {
+	case code.OpAdd:
+		result = leftValue + rightValue
+	case code.OpSub:
+		result = leftValue - rightValue
+	case code.OpMul:
+		result = leftValue * rightValue
+	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		result = leftValue / rightValue
+	}
+
+	return vm.push(&object.Integer{Value: result})
+}
+
+func (vm *VM) executeFloatOperation(op code.Opcode, left, right object.Object) error {
+	leftValue, _ := object.ToFloat(left)
+	rightValue, _ := object.ToFloat(right)
+
+	var result float64
+	switch op {
+	case code.OpAdd:
+		result = leftValue + rightValue
+	case code.OpSub:
+		result = leftValue - rightValue
+	case code.OpMul:
+		result = leftValue * rightValue
+	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		result = leftValue / rightValue
+	}
+
+	return vm.push(&object.Float{Value: result})
+}
+
+func (vm *VM) executeComparison(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	if left.Type() == object.INTEGER && right.Type() == object.INTEGER {
+		leftValue := left.(*object.Integer).Value
+		rightValue := right.(*object.Integer).Value
+
+		switch op {
+		case code.OpEqual:
+			return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+		case code.OpNotEqual:
+			return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+		case code.OpGreaterThan:
+			return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+		case code.OpLessThan:
+			return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+		}
+	}
+
+	if isNumber(left) && isNumber(right) {
+		leftValue, _ := object.ToFloat(left)
+		rightValue, _ := object.ToFloat(right)
+
+		switch op {
+		case code.OpEqual:
+			return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+		case code.OpNotEqual:
+			return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+		case code.OpGreaterThan:
+			return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+		case code.OpLessThan:
+			return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+		}
+	}
+
+	// 文字列はバイト列の辞書順で比較する
+	if left.Type() == object.STRING && right.Type() == object.STRING {
+		leftValue := left.(*object.String).Value
+		rightValue := right.(*object.String).Value
+
+		switch op {
+		case code.OpEqual:
+			return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+		case code.OpNotEqual:
+			return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+		case code.OpGreaterThan:
+			return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+		case code.OpLessThan:
+			return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+		}
+	}
+
+	// 時刻などの大小を比較できるオブジェクト同士
+	if result, ok := object.Compare(left, right); ok {
+		switch op {
+		case code.OpEqual:
+			return vm.push(nativeBoolToBooleanObject(result == 0))
+		case code.OpNotEqual:
+			return vm.push(nativeBoolToBooleanObject(result != 0))
+		case code.OpGreaterThan:
+			return vm.push(nativeBoolToBooleanObject(result > 0))
+		case code.OpLessThan:
+			return vm.push(nativeBoolToBooleanObject(result < 0))
+		}
+	}
+
+	// 数値と文字列以外はネイティブオブジェクトを使い回しているので、ポインタの比較で一致を判定できる
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(left == right))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(left != right))
+	default:
+		return operatorError(op, left, right)
+	}
+}
+
+func (vm *VM) executeMinusOperator() error {
+	switch operand := vm.pop().(type) {
+	case *object.Integer:
+		return vm.push(&object.Integer{Value: -operand.Value})
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
+		return fmt.Errorf("unknown operator: -%s", operand.Type())
+	}
+}
+
+// callFunction スタックに積まれた関数と numArgs 個の位置引数、名前付き引数(nil可)で関数を呼び出す
+func (vm *VM) callFunction(numArgs int, named *object.Hash) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	if builtin, ok := callee.(*object.Builtin); ok {
+		return vm.callBuiltin(builtin, numArgs, named)
+	}
+
+	cl, ok := callee.(*object.Closure)
+	if !ok {
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+
+	if err := vm.arrangeArguments(cl.Fn, numArgs, named); err != nil {
+		return err
+	}
+	if vm.runtime.Interrupted() {
+		return object.ErrInterrupted
+	}
+	if vm.framesIndex >= MaxFrames {
+		return object.ErrStackOverflow
+	}
+
+	frame := NewFrame(cl, vm.sp-cl.Fn.NumParameters)
+	vm.growStack(frame.basePointer + cl.Fn.NumLocals)
+	vm.pushFrame(frame)
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	vm.clearLocals(frame.basePointer, cl.Fn)
+
+	return nil
+}
+
+// tailCallFunction 現在のフレームを呼び出し先の関数のフレームで置き換える
+// 末尾呼び出しはフレームを積まないので、再帰の深さに関わらず MaxFrames を超えない
+func (vm *VM) tailCallFunction(numArgs int, named *object.Hash) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	// 組み込み関数はフレームを積まないので、通常の呼び出しと同じ
+	if builtin, ok := callee.(*object.Builtin); ok {
+		return vm.callBuiltin(builtin, numArgs, named)
+	}
+
+	cl, ok := callee.(*object.Closure)
+	if !ok {
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+
+	if err := vm.arrangeArguments(cl.Fn, numArgs, named); err != nil {
+		return err
+	}
+	if vm.runtime.Interrupted() {
+		return object.ErrInterrupted
+	}
+
+	// 呼び出し先と引数を、現在のフレームの呼び出し先と引数の位置へ移す
+	basePointer := vm.currentFrame().basePointer
+	copy(vm.stack[basePointer-1:], vm.stack[vm.sp-1-cl.Fn.NumParameters:vm.sp])
+
+	vm.growStack(basePointer + cl.Fn.NumLocals)
+	vm.frames[vm.framesIndex-1] = NewFrame(cl, basePointer)
+	vm.sp = basePointer + cl.Fn.NumLocals
+	vm.clearLocals(basePointer, cl.Fn)
+
+	return nil
+}
+
+// callBuiltin スタックに積まれた組み込み関数と引数を、呼び出した結果で置き換える
+// 組み込み関数が戻したエラーは、評価器と同じメッセージの実行時エラーにする
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int, named *object.Hash) error {
+	if named != nil {
+		return fmt.Errorf("%s does not accept named arguments", builtin.Name)
+	}
+
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	result := builtin.Fn(vm, args...)
+	if err, ok := result.(*object.Error); ok {
+		return fmt.Errorf("%s", err.Message)
+	}
+
+	vm.sp -= numArgs + 1
+	return vm.push(result)
+}
+
+// importModule モジュールの関数を呼び出す。実行済みであれば記録したモジュールを積む
+func (vm *VM) importModule(constIndex int) error {
+	fn := vm.constants[constIndex].(*object.CompiledFunction)
+	if mod, ok := vm.modules[fn]; ok {
+		return vm.push(mod)
+	}
+
+	if err := vm.push(&object.Closure{Fn: fn}); err != nil {
+		return err
+	}
+	return vm.callFunction(0, nil)
+}
+
+// arrangeArguments スタックに積まれた numArgs 個の位置引数と名前付き引数を、関数の引数の領域の並びに置き換える
+// 省略された引数の領域には値がないことを表す目印を、残りの引数の領域には配列を積む
+func (vm *VM) arrangeArguments(fn *object.CompiledFunction, numArgs int, named *object.Hash) error {
+	// 引数の数がちょうど合う場合は、そのまま引数の領域として使う
+	if named == nil && fn.Rest == "" && numArgs == len(fn.Parameters) {
+		return nil
+	}
+
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	values, rest, err := object.ArrangeArguments(fn.Name, fn.Parameters, fn.Rest != "", args, named)
+	if err != nil {
+		return err
+	}
+
+	vm.sp -= numArgs
+	for i, val := range values {
+		if val == nil {
+			val = &missing{desc: "argument " + fn.Parameters[i].Name}
+		}
+		if err := vm.push(val); err != nil {
+			return err
+		}
+	}
+	if fn.Rest != "" {
+		return vm.push(&object.Array{Elements: rest})
+	}
+	return nil
+}
+
+// spreadArguments スタックに積まれた位置引数の配列と名前付き引数のハッシュを取り出し、位置引数を積み直す
+// 位置引数の数と、名前付き引数(なければnil)を戻す
+func (vm *VM) spreadArguments(op code.Opcode) (int, *object.Hash, error) {
+	named, ok := vm.pop().(*object.Hash)
+	if !ok {
+		return 0, nil, invalidOperand(op, vm.stack[vm.sp])
+	}
+	positional, ok := vm.pop().(*object.Array)
+	if !ok {
+		return 0, nil, invalidOperand(op, vm.stack[vm.sp])
+	}
+
+	for _, arg := range positional.Elements {
+		if err := vm.push(arg); err != nil {
+			return 0, nil, err
+		}
+	}
+	if len(named.Pairs) == 0 {
+		return len(positional.Elements), nil, nil
+	}
+	return len(positional.Elements), named, nil
+}
+
+// clearLocals 引数以外のローカル変数の領域を空にする
+// 以前の呼び出しのセルが残っていると、OpSetCell がそのセルに書き込んでしまうため
+func (vm *VM) clearLocals(basePointer int, fn *object.CompiledFunction) {
+	for i := basePointer + fn.NumParameters; i < basePointer+fn.NumLocals; i++ {
+		vm.stack[i] = nil
+	}
+}
+
+// buildHash スタックの start から end の手前までに積まれたキーと値の組からハッシュを生成する
+func (vm *VM) buildHash(start, end int) (object.Object, error) {
+	hash := object.NewHash()
+	for i := start; i < end; i += 2 {
+		key, ok := vm.stack[i].(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", vm.stack[i].Type())
+		}
+		hash.Set(key, vm.stack[i+1])
+	}
+	return hash, nil
+}
+
+// executeIndexExpression 配列、ハッシュから要素を取り出して積む
+// 範囲外の添字や存在しないキーの場合は null を積む
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return fmt.Errorf("array index must be INTEGER: %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return vm.push(Null)
+		}
+		return vm.push(left.Elements[i.Value])
+
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		if val, ok := left.Get(key); ok {
+			return vm.push(val)
+		}
+		return vm.push(Null)
+
+	case *object.Module:
+		val, err := left.Member(index)
+		if err != nil {
+			return err
+		}
+		return vm.push(val)
+	}
+
+	return fmt.Errorf("index operator not supported: %s", left.Type())
+}
+
+// executeSetIndex 配列、ハッシュの要素を書き換え、代入した値を積む
+func (vm *VM) executeSetIndex(left, index, value object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return fmt.Errorf("array index must be INTEGER: %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return fmt.Errorf("index out of range: %d", i.Value)
+		}
+		left.Elements[i.Value] = value
+		return vm.push(value)
+
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		left.Set(key, value)
+		return vm.push(value)
+	}
+
+	return fmt.Errorf("index assignment not supported: %s", left.Type())
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	return vm.push(&object.Closure{Fn: function, Free: free})
+}
+
+// growStack スタックを size 個の値を置ける大きさまで拡張する
+func (vm *VM) growStack(size int) {
+	if size <= len(vm.stack) {
+		return
+	}
+	stack := make([]object.Object, max(size, 2*len(vm.stack)))
+	copy(stack, vm.stack)
+	vm.stack = stack
+}
+
+func (vm *VM) push(o object.Object) error {
+	vm.growStack(vm.sp + 1)
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+func (vm *VM) globalName(index int) string {
+	if index < len(vm.globalNames) {
+		return vm.globalNames[index]
+	}
+	return fmt.Sprintf("global#%d", index)
+}
+
+// invalidOperand コンパイラが生成しない種類の値に命令を適用した場合のエラー
+// 壊れたコンパイル済みモジュールを実行した場合にのみ起きる
+func invalidOperand(op code.Opcode, operand object.Object) error {
+	def, _ := code.Lookup(byte(op))
+	kind := "nothing"
+	if operand != nil {
+		kind = string(operand.Type())
+	}
+	return fmt.Errorf("invalid bytecode: %s applied to %s", def.Name, kind)
+}
+
+// operatorError 評価器と同じ形式で、演算子を適用できない場合のエラーを生成する
+func operatorError(op code.Opcode, left, right object.Object) error {
+	if left.Type() != right.Type() {
+		return fmt.Errorf("type mismatch: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+	return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+}
+
+func isNumber(obj object.Object) bool {
+	_, ok := object.ToFloat(obj)
+	return ok
+}
+
+// isTruthy 評価器と同じく、NULLとFALSE以外は全て真として扱う
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
@@ -0,0 +1,89 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/Sa2Knight/maron/ast"
+	"github.com/Sa2Knight/maron/code"
+	"github.com/Sa2Knight/maron/compiler"
+	"github.com/Sa2Knight/maron/lexer"
+	"github.com/Sa2Knight/maron/object"
+	"github.com/Sa2Knight/maron/parser"
+)
+
+// 言語機能ごとの評価結果は evaluator のテストで評価器と比較しているので、ここではVM固有の振る舞いを確認する
+
+func TestGlobalsStore(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	constants := []object.Object{}
+	globals := make([]object.Object, GlobalsSize)
+
+	inputs := []string{"let a = 5;", "let f = fn(x) { a * x };", "f(2)"}
+
+	var result object.Object
+	for _, input := range inputs {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+
+		machine := NewWithGlobalsStore(bytecode, globals)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		result = machine.LastPoppedStackElem()
+	}
+
+	integer, ok := result.(*object.Integer)
+	if !ok || integer.Value != 10 {
+		t.Errorf("result wrong. got=%+v", result)
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse("let f = fn(x) { f(x + 1) + 1 }; f(0)")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err := New(comp.Bytecode()).Run()
+	if err == nil || err.Error() != "stack overflow" {
+		t.Errorf("expected stack overflow. got=%v", err)
+	}
+}
+
+// TestInvalidBytecode 検査を通っても、コンパイラが生成しない種類の値に命令を適用する壊れたバイトコードはエラーにする
+func TestInvalidBytecode(t *testing.T) {
+	integer := &object.Integer{Value: 1}
+
+	tests := []struct {
+		instructions []code.Instructions
+		expected     string
+	}{
+		{[]code.Instructions{code.Make(code.OpConstant, 0), code.Make(code.OpConstant, 0), code.Make(code.OpAppend), code.Make(code.OpPop)},
+			"invalid bytecode: OpAppend applied to INTEGER"},
+		{[]code.Instructions{code.Make(code.OpConstant, 0), code.Make(code.OpIterNext, 6), code.Make(code.OpPop)},
+			"invalid bytecode: OpIterNext applied to INTEGER"},
+		{[]code.Instructions{code.Make(code.OpConstant, 0), code.Make(code.OpArray, 0), code.Make(code.OpMatchValue), code.Make(code.OpPop)},
+			"invalid bytecode: OpMatchValue applied to ARRAY"},
+		{[]code.Instructions{code.Make(code.OpConstant, 0), code.Make(code.OpConstant, 0), code.Make(code.OpMatchHash, 1), code.Make(code.OpJumpNotTruthy, 13), code.Make(code.OpPop)},
+			"invalid bytecode: OpMatchHash applied to INTEGER"},
+	}
+
+	for _, tt := range tests {
+		ins := code.Instructions{}
+		for _, i := range tt.instructions {
+			ins = append(ins, i...)
+		}
+		err := New(&compiler.Bytecode{Instructions: ins, Constants: []object.Object{integer}}).Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for\n%s\nwant=%q, got=%v", ins, tt.expected, err)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	return parser.New(lexer.New(input)).ParseProgram()
+}